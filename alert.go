@@ -0,0 +1,126 @@
+package openbar
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRule is returned when parsing an invalid rule.
+var ErrRule = errors.New("invalid rule")
+
+// Rule is a condition on the value of a module, like "value > 90 for 5m": the
+// value must be past the limit on every run for the given duration. Without
+// duration, a single run is enough. See Valuer.
+type Rule struct {
+	// Op is one of >, >=, <, <=, == and !=.
+	Op    string
+	Limit float64
+	For   time.Duration
+}
+
+// Comparisons of rules.
+var comparisons = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// ParseRule reads a rule like "value > 90 for 5m" or "value < 10".
+func ParseRule(s string) (Rule, error) {
+	fields := strings.Fields(s)
+	if (len(fields) != 3 && len(fields) != 5) || fields[0] != "value" {
+		return Rule{}, fmt.Errorf("%w: %s: want value OP NUMBER [for DURATION]", ErrRule, s)
+	}
+
+	r := Rule{Op: fields[1]}
+	if _, ok := comparisons[r.Op]; !ok {
+		return Rule{}, fmt.Errorf("%w: %s: unknown operator: %s", ErrRule, s, r.Op)
+	}
+
+	var err error
+	if r.Limit, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return Rule{}, fmt.Errorf("%w: %s: invalid number: %s", ErrRule, s, fields[2])
+	}
+
+	if len(fields) == 5 {
+		if fields[3] != "for" {
+			return Rule{}, fmt.Errorf("%w: %s: want for, got: %s", ErrRule, s, fields[3])
+		}
+		if r.For, err = time.ParseDuration(fields[4]); err != nil || r.For < 0 {
+			return Rule{}, fmt.Errorf("%w: %s: invalid duration: %s", ErrRule, s, fields[4])
+		}
+	}
+
+	return r, nil
+}
+
+// String prints the rule in a form ParseRule reads.
+func (r Rule) String() string {
+	s := "value " + r.Op + " " + strconv.FormatFloat(r.Limit, 'f', -1, 64)
+	if r.For > 0 {
+		s += " for " + r.For.String()
+	}
+	return s
+}
+
+// Alert acts when the rule on the value of a module starts to hold, like
+// when a temperature stays too high.
+type Alert struct {
+	Rule Rule
+	// Urgent marks the block of the module urgent while the rule holds.
+	Urgent bool
+	// Fire is called with the value once the rule holds, and again only after
+	// it stopped holding. It must not block.
+	Fire func(Value)
+}
+
+// The state of an alert of a module, shared by the copies of its cell. Only the
+// worker of the module touches it.
+type alerting struct {
+	Alert
+	since  time.Time
+	firing bool
+}
+
+// Check the value of a run against the rule and fire if it starts to hold.
+// Missing values and unknown operators break the rule. Return whether the
+// block is urgent.
+func (a *alerting) check(v *Value, now time.Time) bool {
+	holds, ok := comparisons[a.Rule.Op]
+	if v == nil || !ok || !holds(v.Number, a.Rule.Limit) {
+		a.since, a.firing = time.Time{}, false
+		return false
+	}
+
+	if a.since.IsZero() {
+		a.since = now
+	}
+	if now.Sub(a.since) < a.Rule.For {
+		return false
+	}
+
+	if !a.firing && a.Fire != nil {
+		a.Fire(*v)
+	}
+	a.firing = true
+
+	return a.Urgent
+}
+
+// Check the alerts of a cell against the value of a run. Return whether one of
+// them makes the block urgent.
+func (c cell) alert(v *Value) bool {
+	urgent, now := false, time.Now()
+	for _, a := range c.alerts {
+		if a.check(v, now) {
+			urgent = true
+		}
+	}
+	return urgent
+}
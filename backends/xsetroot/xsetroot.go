@@ -0,0 +1,48 @@
+// Package xsetroot is an OpenBar backend setting the name of the X root window,
+// which is where dwm and similar window managers read their status text from.
+package xsetroot
+
+import (
+	"openbar"
+	"os/exec"
+)
+
+// DefaultSeparator is printed between blocks when none is configured.
+const DefaultSeparator = " | "
+
+// Command is the program renaming the root window.
+const Command = "xsetroot"
+
+// Backend renders the bar as plain text and hands it to xsetroot(1).
+type Backend struct {
+	sep  string
+	last string
+}
+
+// New returns a backend joining blocks with the given separator.
+func New(sep string) *Backend {
+	return &Backend{sep: sep}
+}
+
+// Start implements openbar.Backend. There is no header to print.
+func (b *Backend) Start(openbar.Header) error {
+	return nil
+}
+
+// Frame implements openbar.Backend. The root window is only renamed when the
+// text actually changed to avoid spawning processes for nothing.
+func (b *Backend) Frame(blocks []openbar.Block) error {
+	text := openbar.Plain(blocks, b.sep)
+	if text == b.last {
+		return nil
+	}
+
+	//nolint:gosec
+	if err := exec.Command(Command, "-name", text).Run(); err != nil {
+		return err
+	}
+
+	b.last = text
+
+	return nil
+}
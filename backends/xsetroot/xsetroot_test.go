@@ -0,0 +1,83 @@
+package xsetroot_test
+
+import (
+	"openbar"
+	"openbar/backends/xsetroot"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Install a fake xsetroot in a directory prepended to PATH, logging its
+// arguments one call per line, and return the path of the log.
+func fake(t *testing.T, status int) string {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := "#!/bin/sh\necho \"$*\" >> \"" + log + "\"\nexit " + strconv.Itoa(status) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, xsetroot.Command), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+// Return the calls logged by the fake xsetroot.
+func calls(t *testing.T, log string) []string {
+	data, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestFrame(t *testing.T) {
+	log := fake(t, 0)
+
+	b := xsetroot.New(" / ")
+	if err := b.Start(openbar.Header{}); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := [][]openbar.Block{
+		{{FullText: "a"}, {FullText: ""}, {FullText: "<b>b</b> &amp; c", Markup: openbar.Pango}},
+		{{FullText: "a"}, {FullText: "<b>b</b> &amp; c", Markup: openbar.Pango}},
+		{{FullText: "d"}},
+	}
+	for _, f := range frames {
+		if err := b.Frame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second frame renders the same text as the first one.
+	want := []string{"-name a / b & c", "-name d"}
+	got := calls(t, log)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	log := fake(t, 1)
+
+	b := xsetroot.New(xsetroot.DefaultSeparator)
+	frame := []openbar.Block{{FullText: "a"}, {FullText: "b"}}
+
+	// Text that could not be set is set again with the next frame.
+	for i := 0; i < 2; i++ {
+		if err := b.Frame(frame); err == nil {
+			t.Error("want: error, got: <nil>")
+		}
+	}
+
+	want := []string{"-name a | b", "-name a | b"}
+	got := calls(t, log)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
@@ -0,0 +1,99 @@
+package openbar
+
+import "context"
+
+// BlockModule is a bar module that emits a whole block rather than its text,
+// for modules styling their block according to their value, like a battery
+// turning red. Attributes left empty keep the style the module is configured
+// with, and the name and instance of the block can't be changed since clicks
+// are routed with them.
+type BlockModule interface {
+	Block() (Block, error)
+}
+
+// BlockModuleFunc is a function for the single-method interface BlockModule.
+type BlockModuleFunc func() (Block, error)
+
+// Block implements BlockModule for BlockModuleFunc.
+func (f BlockModuleFunc) Block() (Block, error) {
+	return f()
+}
+
+// Return what a module was configured with, to find the optional interfaces
+// it implements.
+func (c cell) source() interface{} {
+	if c.push != nil {
+		return c.push.source
+	}
+	if c.multi != nil {
+		return c.multi
+	}
+	if c.block != nil {
+		return c.block
+	}
+	return c.module
+}
+
+// Run a module once, whatever the interface it implements.
+func (c cell) render(ctx context.Context) (Block, error) {
+	if c.block != nil {
+		return c.block.Block()
+	}
+	if m, ok := c.module.(ContextModule); ok {
+		text, err := m.FullTextContext(ctx)
+		return Block{FullText: text}, err
+	}
+	text, err := c.module.FullText()
+	return Block{FullText: text}, err
+}
+
+// Derive the context of a run from the one of the bar, bounded by the timeout
+// of the module if any.
+func (c cell) deadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Lay the attributes a module set on its block over its configured style. The
+// text is left out.
+func overlay(style, b Block) Block {
+	if b.Color != "" {
+		style.Color = b.Color
+	}
+	if b.Background != "" {
+		style.Background = b.Background
+	}
+	if b.Border != "" {
+		style.Border = b.Border
+	}
+	if b.BorderTop != nil {
+		style.BorderTop = b.BorderTop
+	}
+	if b.BorderRight != nil {
+		style.BorderRight = b.BorderRight
+	}
+	if b.BorderBottom != nil {
+		style.BorderBottom = b.BorderBottom
+	}
+	if b.BorderLeft != nil {
+		style.BorderLeft = b.BorderLeft
+	}
+	if b.MinWidth != nil {
+		style.MinWidth = b.MinWidth
+	}
+	if b.Align != "" {
+		style.Align = b.Align
+	}
+	if b.Separator != nil {
+		style.Separator = b.Separator
+	}
+	if b.SeparatorBlockWidth != nil {
+		style.SeparatorBlockWidth = b.SeparatorBlockWidth
+	}
+	if b.Markup != "" {
+		style.Markup = b.Markup
+	}
+	return style
+}
@@ -0,0 +1,165 @@
+package openbar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// Click is a click on a block as sent by the bar, see swaybar-protocol(7).
+type Click struct {
+	Name      string   `json:"name"`
+	Instance  string   `json:"instance"`
+	Button    int      `json:"button"`
+	Event     int      `json:"event"`
+	X         int      `json:"x"`
+	Y         int      `json:"y"`
+	RelativeX int      `json:"relative_x"`
+	RelativeY int      `json:"relative_y"`
+	OutputX   int      `json:"output_x"`
+	OutputY   int      `json:"output_y"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	Scale     float64  `json:"scale"`
+	Modifiers []string `json:"modifiers"`
+}
+
+// Mouse buttons, numbered like X11 does.
+const (
+	LeftButton    = 1
+	MiddleButton  = 2
+	RightButton   = 3
+	ScrollUp      = 4
+	ScrollDown    = 5
+	BackButton    = 8
+	ForwardButton = 9
+)
+
+// ClickHandler is implemented by modules reacting to clicks on their block. The
+// module is refreshed once the handler returns.
+type ClickHandler interface {
+	Click(c Click) error
+}
+
+// Linux input event codes of mouse buttons, see linux/input-event-codes.h.
+var buttons = map[int]int{
+	0x110: LeftButton,
+	0x111: RightButton,
+	0x112: MiddleButton,
+	0x113: BackButton,
+	0x114: ForwardButton,
+}
+
+// A router finds the block a click was made on. Blocks are told apart by their
+// instance, or by their name when the bar leaves the instance out, as long as
+// no other block has the same. Blocks emitted by a MultiModule have their
+// instance nested in that of the module.
+type router struct {
+	instances map[string]int
+	names     map[string]int
+}
+
+// Build the router of the given blocks.
+func newRouter(blocks []Block) router {
+	r := router{make(map[string]int, len(blocks)), make(map[string]int, len(blocks))}
+	for i, b := range blocks {
+		r.add(r.instances, b.Instance, i)
+		r.add(r.names, b.Name, i)
+	}
+	return r
+}
+
+// Register a block under a key, unless another block has it too.
+func (r router) add(m map[string]int, key string, idx int) {
+	if _, ok := m[key]; ok {
+		m[key] = -1
+		return
+	}
+	m[key] = idx
+}
+
+// Return the index of the block a click was made on, and the instance the
+// module gave the block if it emitted several.
+func (r router) find(c Click) (int, string, bool) {
+	if c.Instance == "" {
+		idx, ok := r.names[c.Name]
+		return idx, "", ok && idx >= 0
+	}
+	if idx, ok := r.instances[c.Instance]; ok {
+		return idx, "", idx >= 0
+	}
+	for i := range c.Instance {
+		if c.Instance[i] != '/' {
+			continue
+		}
+		if idx, ok := r.instances[c.Instance[:i]]; ok && idx >= 0 {
+			return idx, c.Instance[i+1:], true
+		}
+	}
+	return 0, "", false
+}
+
+// Read clicks from the bar and pass them to the handler of the block they were
+// made on. The stream is an infinite array with one click per line; i3bar and
+// swaybar don't agree on commas and on whether the button or only the event
+// code is set, so both are accepted.
+func listen(r io.Reader, route router, handle func(idx int, c Click)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 4096), 1<<20)
+
+	for sc.Scan() {
+		line := strings.TrimLeft(strings.TrimSpace(sc.Text()), "[,")
+		if line == "" {
+			continue
+		}
+
+		var c Click
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			log.Printf("invalid click: %v", err)
+			continue
+		}
+
+		if c.Button == 0 {
+			c.Button = buttons[c.Event]
+		}
+
+		if idx, sub, ok := route.find(c); ok {
+			if sub != "" {
+				c.Instance = sub
+			}
+			handle(idx, c)
+		}
+	}
+
+	return sc.Err()
+}
+
+// ErrNotHandled is returned by handlers given to OnClick for clicks they leave
+// to the module.
+var ErrNotHandled = errors.New("click not handled")
+
+// Pass a click to the handler of a cell, if any. Scrolls adjust modules
+// implementing Adjuster by the given delta. Return whether it was handled.
+func (c cell) click(e Click, delta int) (bool, error) {
+	if c.onClick != nil {
+		if err := c.onClick(e); !errors.Is(err, ErrNotHandled) {
+			return true, err
+		}
+	}
+	if a, ok := c.source().(Adjuster); ok && delta != 0 {
+		return true, a.Adjust(delta)
+	}
+	if h, ok := c.source().(ClickHandler); ok {
+		return true, h.Click(e)
+	}
+	return false, nil
+}
+
+// Describe a click handler failure.
+func clickError(idx int, c cell, err error) error {
+	return fmt.Errorf("module %d (%s): click: %w", idx, c.name, err)
+}
@@ -6,15 +6,27 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/syslog"
 	"openbar"
+	"openbar/backends/xsetroot"
+	"openbar/config"
+	"openbar/ctl"
+	"openbar/modules"
+	_ "openbar/modules/builtin"
 	"openbar/modules/command"
+	"openbar/modules/helper"
+	"openbar/record"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 )
 
@@ -31,80 +43,767 @@ func run(args ...string) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	sigc := make(chan os.Signal, 1)
+
+	signal.Notify(sigc,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT)
+
+	go func() {
+		defer cancel()
+		<-sigc
+	}()
+
 	if len(args) < 2 {
-		return fmt.Errorf("usage: %s PATH", args[0])
+		return usage(args[0])
+	}
+
+	switch args[1] {
+	case "helper":
+		return serve(args[0], args[2:]...)
+	case "record":
+		return capture(ctx, args[0], args[2:]...)
+	case "replay":
+		return replay(ctx, args[0], args[2:]...)
+	case "ctl":
+		return control(args[0], args[2:]...)
+	case "check":
+		return check(args[0], args[2:]...)
+	case "modules":
+		return inventory(args[0], args[2:]...)
+	default:
+		return bar(ctx, os.Stdout, args[0], args[1:]...)
+	}
+}
+
+// Describe the command line.
+func usage(name string) error {
+	return fmt.Errorf("usage: %s [record FILE] [-i3|-xsetroot] [-debug-frames FILE] [-bar NAME] [-socket PATH] [-upgrade] [-export] [-harden] [-allow DIRS] [-once [-plain]] PATH\n"+
+		"       %s replay FILE\n"+
+		"       %s ctl [-bar NAME] [-socket PATH] status [-json] | reload [INDEX|ID] | reload-group NAME | disable|enable INDEX|ID | events [-follow] | restart | lowpower on|off|auto\n"+
+		"       %s check [-run] [-bar NAME] PATH\n"+
+		"       %s modules [-describe NAME]\n"+
+		"       %s helper [-socket PATH]", name, name, name, name, name, name)
+}
+
+// Run the bar until the context is done.
+func bar(ctx context.Context, stdout io.Writer, name string, args ...string) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	harden := flags.Bool("harden", false, "refuse insecure configurations")
+	i3 := flags.Bool("i3", false, "advertise the stop signal suited to i3bar")
+	xroot := flags.Bool("xsetroot", false, "set the X root window name instead of printing")
+	frames := flags.String("debug-frames", "", "write human-readable frames to a file (- for stderr)")
+	socket := flags.String("socket", "", "control socket (defaults to one per bar)")
+	which := flags.String("bar", "", "bar to run when the configuration defines several")
+	upgrade := flags.Bool("upgrade", false, "restart when the binary is replaced")
+	export := flags.Bool("export", false, "write the state of the bar to files for other tools")
+	once := flags.Bool("once", false, "run every module once, print the bar and exit")
+	plain := flags.Bool("plain", false, "print the bar as plain text with -once")
+	allow := flags.String("allow", strings.Join(config.DefaultAllow, string(filepath.ListSeparator)),
+		"directories commands may live in when hardened")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 {
+		return usage(name)
 	}
 
-	stderr, err := syslog.New(syslog.LOG_ERR, args[0])
+	stderr, err := syslog.New(syslog.LOG_ERR, name)
 	if err != nil {
 		return err
 	}
 
-	opts, err := parse(args[1])
+	path := flags.Arg(0)
+
+	file, err := config.Load(path)
 	if err != nil {
 		return err
 	}
 
-	sigc := make(chan os.Signal, 1)
+	if err := file.Select(*which); err != nil {
+		return err
+	}
 
-	signal.Notify(sigc,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT)
+	if *socket == "" {
+		*socket = ctl.BarSocket(*which)
+	}
+
+	if *harden {
+		var extra [][]string
+		if *xroot {
+			extra = append(extra, []string{xsetroot.Command})
+		}
+		if err := config.Harden(path, file, filepath.SplitList(*allow), extra...); err != nil {
+			return err
+		}
+	}
 
+	opts, err := file.Options()
+	if err != nil {
+		return err
+	}
+
+	bridge, err := file.Bridge()
+	if err != nil {
+		return err
+	}
+
+	if *i3 {
+		opts = append(opts, openbar.WithProtocol(openbar.I3))
+	}
+
+	// A single run prints one line and leaves, with nothing to serve meanwhile.
+	if *once {
+		switch {
+		case *plain:
+			opts = append(opts, openbar.WithBackend(text{stdout, xsetroot.DefaultSeparator}))
+		case *xroot:
+			opts = append(opts, openbar.WithBackend(xsetroot.New(xsetroot.DefaultSeparator)))
+		}
+		err := openbar.Once(ctx, append(opts, openbar.WithOutput(stdout), openbar.WithError(os.Stderr))...)
+		command.Kill()
+		return err
+	}
+
+	// Only bars speaking the protocol send clicks.
+	if *xroot {
+		opts = append(opts, openbar.WithBackend(xsetroot.New(xsetroot.DefaultSeparator)))
+	} else if file.Clicks() {
+		opts = append(opts, openbar.WithClickEvents(os.Stdin))
+	}
+
+	switch *frames {
+	case "":
+	case "-":
+		opts = append(opts, openbar.WithDebugFrames(os.Stderr))
+	default:
+		fd, err := os.OpenFile(filepath.Clean(*frames), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		opts = append(opts, openbar.WithDebugFrames(fd))
+	}
+
+	// A bar re-executed by a restart continues the output of its predecessor.
+	if path := os.Getenv(resumeEnv); path != "" {
+		frame, err := resume(path)
+		if err != nil {
+			_ = stderr.Err(err.Error())
+		}
+		opts = append(opts, openbar.WithResume(frame))
+	}
+
+	// Restarting stops the bar like a signal would, then the binary is executed
+	// again in place of this process.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	restart := make(chan struct{}, 1)
+	reboot := func() error {
+		select {
+		case restart <- struct{}{}:
+		default:
+		}
+		stop()
+		return nil
+	}
+
+	if *upgrade {
+		go func() {
+			if err := upgrades(ctx, binaryPoll, reboot); err != nil {
+				_ = stderr.Err(err.Error())
+			}
+		}()
+	}
+
+	// A bar without control socket is still useful, so only log failures.
+	control := openbar.NewControl()
+	server := ctl.Server{Control: control, Children: command.Live, Restart: reboot}
 	go func() {
-		defer cancel()
-		<-sigc
+		if err := server.Serve(ctx, *socket); err != nil {
+			_ = stderr.Err(err.Error())
+		}
 	}()
 
+	// Home automation follows the bar through the broker, if any.
+	if bridge != nil {
+		bridge.Control = control
+		opts = append(opts, openbar.WithUpdateHook(bridge.Update), openbar.WithClickHook(bridge.Click))
+		go func() {
+			if err := bridge.Run(ctx); err != nil {
+				_ = stderr.Err(err.Error())
+			}
+		}()
+	}
+
+	// Keep the last frame to hand it over on restart. Blocks are given by module
+	// identifier, which is their instance, so that a configuration edited in
+	// between still finds them. Modules emitting several blocks start over.
+	last := make(map[string]openbar.Block)
+	var ids map[string]bool
+	opts = append(opts, openbar.WithFrameHook(func(b []openbar.Block) {
+		if ids == nil {
+			ids = make(map[string]bool)
+			for _, s := range control.Status() {
+				ids[s.ID] = true
+			}
+		}
+		for _, block := range b {
+			if ids[block.Instance] {
+				last[block.Instance] = block
+			}
+		}
+	}))
+
+	// Defaults come first so that the configuration can override them.
+	opts = append([]openbar.Option{
+		openbar.WithDrain(2 * time.Second),
+		openbar.WithCrashDir(stateDir()),
+		openbar.WithHistoryFile(historyFile(*which)),
+	}, opts...)
+
+	if *export {
+		opts = append(opts, openbar.WithExport(exportDir(*which)))
+	}
+
 	opts = append(
 		opts,
-		openbar.WithOutput(os.Stdout),
+		openbar.WithControl(control),
+		openbar.WithOutput(stdout),
 		openbar.WithError(stderr),
 		openbar.WithJitter(2000),
 	)
 
-	return openbar.Run(ctx, opts...)
+	err = openbar.Run(ctx, opts...)
+
+	// Don't leave processes behind when modules did not finish in time.
+	command.Kill()
+
+	select {
+	case <-restart:
+		return reexec(last)
+	default:
+		return err
+	}
+}
+
+// A backend printing the bar as a line of plain text.
+type text struct {
+	w   io.Writer
+	sep string
+}
+
+// Start implements openbar.Backend. There is no header to print.
+func (t text) Start(openbar.Header) error {
+	return nil
+}
+
+// Frame implements openbar.Backend.
+func (t text) Frame(b []openbar.Block) error {
+	_, err := fmt.Fprintln(t.w, openbar.Plain(b, t.sep))
+	return err
+}
+
+// How often the binary is checked for upgrades.
+const binaryPoll = 10 * time.Second
+
+// Call fn once the binary was replaced, for instance by a package upgrade. The
+// modification time must be stable for two checks in a row so that a binary
+// still being written is not executed.
+func upgrades(ctx context.Context, every time.Duration, fn func() error) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	current, candidate := info.ModTime(), time.Time{}
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+
+		// The binary may be missing for a moment while it is replaced.
+		info, err := os.Stat(exe)
+		if err != nil {
+			continue
+		}
+
+		switch mtime := info.ModTime(); {
+		case mtime.Equal(current):
+			candidate = time.Time{}
+		case mtime.Equal(candidate):
+			return fn()
+		default:
+			candidate = mtime
+		}
+	}
+}
+
+// Environment variable pointing a re-executed bar to the state left by its
+// predecessor.
+const resumeEnv = "OPENBAR_RESUME"
+
+// Replace the process with a new instance of the binary. Standard output is
+// inherited and the new instance starts from the last frame, so the bar does
+// not notice.
+func reexec(frame map[string]openbar.Block) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	dir := stateDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	fd, err := os.CreateTemp(dir, "resume-*.json")
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(fd).Encode(frame); err != nil {
+		fd.Close()
+		return err
+	}
+
+	if err := fd.Close(); err != nil {
+		return err
+	}
+
+	env := append(os.Environ(), resumeEnv+"="+fd.Name())
+
+	//nolint:gosec
+	return syscall.Exec(exe, os.Args, env)
 }
 
-// Parse a JSON configuration file with each entry of the array being an object
-// with `command` and `interval` defined.
-func parse(path string) ([]openbar.Option, error) {
-	fd, err := os.Open(filepath.Clean(path))
+// Read the frame handed over by the previous instance. The state is consumed
+// so that commands started by the bar don't see it.
+func resume(path string) (map[string]openbar.Block, error) {
+	defer os.Unsetenv(resumeEnv)
+	defer os.Remove(path)
+
+	raw, err := os.ReadFile(filepath.Clean(path))
 	if err != nil {
 		return nil, err
 	}
 
+	var frame map[string]openbar.Block
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// Return the directory where state is kept across sessions.
+func stateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "openbar")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("openbar-%d", os.Getuid()))
+	}
+	return filepath.Join(home, ".local", "state", "openbar")
+}
+
+// Return the file keeping the history of sparklines for the given bar.
+func historyFile(bar string) string {
+	if bar == "" {
+		return filepath.Join(stateDir(), "history.json")
+	}
+	return filepath.Join(stateDir(), "history-"+bar+".json")
+}
+
+// Return the directory where the given bar exports its state, which lives as
+// long as the session.
+func exportDir(bar string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("openbar-%d", os.Getuid()))
+	} else {
+		dir = filepath.Join(dir, "openbar")
+	}
+	if bar == "" {
+		return dir
+	}
+	return filepath.Join(dir, bar)
+}
+
+// Run the bar while recording its output to a file.
+func capture(ctx context.Context, name string, args ...string) error {
+	if len(args) < 1 {
+		return usage(name)
+	}
+
+	fd, err := os.Create(filepath.Clean(args[0]))
+	if err != nil {
+		return err
+	}
+
 	defer fd.Close()
 
-	data, err := io.ReadAll(fd)
+	return bar(ctx, record.NewRecorder(os.Stdout, fd), name, args[1:]...)
+}
+
+// Print a recording to the standard output at its original speed.
+func replay(ctx context.Context, name string, args ...string) error {
+	if len(args) != 1 {
+		return usage(name)
+	}
+
+	fd, err := os.Open(filepath.Clean(args[0]))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	type entry struct {
-		Command  []string `json:"command"`
-		Interval string   `json:"interval"`
+	defer fd.Close()
+
+	return record.Replay(ctx, os.Stdout, fd)
+}
+
+// Send a command to a running bar and print the answer.
+func control(name string, args ...string) error {
+	flags := flag.NewFlagSet(name+" ctl", flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket (defaults to the one of the bar)")
+	which := flags.String("bar", "", "bar to control")
+
+	if err := flags.Parse(args); err != nil {
+		return err
 	}
 
-	entries := make([]entry, 0)
-	if err := json.Unmarshal(data, &entries); err != nil {
-		return nil, err
+	if *socket == "" {
+		*socket = ctl.BarSocket(*which)
 	}
 
-	res := make([]openbar.Option, len(entries))
-	for i, e := range entries {
-		duration, err := time.ParseDuration(e.Interval)
-		if err != nil {
-			return nil, err
+	if flags.NArg() < 1 {
+		return usage(name)
+	}
+
+	switch flags.Arg(0) {
+	case "status":
+		return status(*socket, flags.Args()[1:]...)
+	case "reload":
+		return reload(*socket, flags.Args()[1:]...)
+	case "reload-group":
+		if flags.NArg() != 2 {
+			return usage(name)
+		}
+		return ctl.ReloadGroup(*socket, flags.Arg(1))
+	case "events":
+		return events(*socket, flags.Args()[1:]...)
+	case "disable", "enable":
+		return toggle(*socket, flags.Arg(0) == "disable", flags.Args()[1:]...)
+	case "restart":
+		return ctl.Restart(*socket)
+	case "lowpower":
+		return lowPower(*socket, flags.Args()[1:]...)
+	default:
+		return usage(name)
+	}
+}
+
+// Refresh one module, by index or identifier, or all of them.
+func reload(socket string, args ...string) error {
+	if len(args) == 0 {
+		return ctl.Reload(socket, -1)
+	}
+
+	idx, err := strconv.Atoi(args[0])
+	if err != nil {
+		return ctl.ReloadID(socket, args[0])
+	}
+
+	return ctl.Reload(socket, idx)
+}
+
+// Disable or enable one module, by index or identifier.
+func toggle(socket string, off bool, args ...string) error {
+	if len(args) != 1 {
+		return errors.New("usage: disable|enable INDEX|ID")
+	}
+
+	byIndex, byID := ctl.Enable, ctl.EnableID
+	if off {
+		byIndex, byID = ctl.Disable, ctl.DisableID
+	}
+
+	idx, err := strconv.Atoi(args[0])
+	if err != nil {
+		return byID(socket, args[0])
+	}
+
+	return byIndex(socket, idx)
+}
+
+// Change the power mode of a bar.
+func lowPower(socket string, args ...string) error {
+	if len(args) != 1 {
+		return errors.New("usage: lowpower on|off|auto")
+	}
+
+	m, err := openbar.ParsePowerMode(args[0])
+	if err != nil {
+		return err
+	}
+
+	return ctl.SetLowPower(socket, m)
+}
+
+// Print the last module updates, and the following ones when asked to.
+func events(socket string, args ...string) error {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	follow := flags.Bool("follow", false, "keep printing events as they happen")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return ctl.Events(socket, *follow, func(e openbar.Event) error {
+		res := "ok"
+		if e.Error != "" {
+			res = "error: " + e.Error
+		}
+		_, err := fmt.Printf("%s  [%d] %s %q %s\n", e.Time.Format(time.RFC3339Nano), e.Index, e.Name, e.Text, res)
+		return err
+	})
+}
+
+// Print the status of every module, either as JSON or as a table.
+func status(socket string, args ...string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := ctl.Status(socket)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, 0x20, 0)
+
+	fmt.Fprintln(tw, "INDEX\tID\tNAME\tINTERVAL\tUPDATED\tTEXT\tERROR\tSTDERR")
+
+	for _, s := range report.Modules {
+		updated := "never"
+		if !s.Updated.IsZero() {
+			updated = s.Updated.Format(time.RFC3339)
+		}
+		// Only the last line of standard error fits in a table.
+		stderr := s.Stderr
+		if i := strings.LastIndexByte(stderr, 0x0A); i >= 0 {
+			stderr = stderr[i+1:]
 		}
+		interval := s.Interval.String()
+		if s.Disabled {
+			interval = "disabled"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%v\t%s\t%q\t%s\t%s\n", s.Index, s.ID, s.Name, interval, updated, s.Text, s.Error, stderr)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
 
-		res[i] = openbar.WithModuleFunc(
-			command.New(e.Command...),
-			duration,
-		)
+	_, err = fmt.Fprintf(os.Stdout, "\n%d running command(s)\n", report.Children)
+	if err == nil && report.LowPower {
+		_, err = fmt.Fprintln(os.Stdout, "low-power mode")
 	}
 
-	return res, nil
+	return err
+}
+
+// ErrLint is returned when checking a configuration finds errors.
+var ErrLint = errors.New("configuration has errors")
+
+// Report mistakes in a configuration file.
+func check(name string, args ...string) error {
+	flags := flag.NewFlagSet(name+" check", flag.ContinueOnError)
+	run := flags.Bool("run", false, "run each module once to time it")
+	which := flags.String("bar", "", "bar to check (all of them by default)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usage(name)
+	}
+
+	file, err := config.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	bars := []string{*which}
+	if *which == "" && len(file.Bars) > 0 {
+		bars = file.BarNames()
+	}
+
+	failed := false
+
+	for _, b := range bars {
+		if len(bars) > 1 {
+			fmt.Printf("bar %s:\n", b)
+		}
+
+		selected := *file
+		diagnostics := []config.Diagnostic{}
+
+		if err := selected.Select(b); err != nil {
+			diagnostics = append(diagnostics, config.Diagnostic{
+				Severity: config.Error,
+				Module:   -1,
+				Message:  err.Error(),
+				Hint:     "check the bar name, shared modules and conditions",
+			})
+		} else {
+			diagnostics = config.Lint(&selected, *run)
+		}
+
+		for _, d := range diagnostics {
+			fmt.Println(d)
+			failed = failed || d.Severity == config.Error
+		}
+	}
+
+	if failed {
+		return ErrLint
+	}
+
+	return nil
+}
+
+// List the built-in modules with their options and requirements, or describe
+// one of them in detail.
+func inventory(name string, args ...string) error {
+	flags := flag.NewFlagSet(name+" modules", flag.ContinueOnError)
+	describe := flags.String("describe", "", "describe the options of a module")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *describe != "" {
+		info, ok := modules.Describe(*describe)
+		if !ok {
+			return fmt.Errorf("unknown module: %s", *describe)
+		}
+		return details(info)
+	}
+
+	for _, info := range modules.List() {
+		if info.Disabled != "" {
+			fmt.Printf("%s: left out by build tag %s\n\n", info.Name, info.Disabled)
+			continue
+		}
+
+		fmt.Printf("%s: %s\n", info.Name, info.Description)
+
+		if len(info.Requires) > 0 {
+			fmt.Printf("  requires: %s\n", strings.Join(info.Requires, ", "))
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, 0x20, 0)
+
+		for _, o := range info.Options {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", o.Name, o.Type, placeholder(o.Default))
+		}
+
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// Print everything known about a module.
+func details(info modules.Info) error {
+	if info.Disabled != "" {
+		return fmt.Errorf("%s: left out by build tag %s", info.Name, info.Disabled)
+	}
+
+	fmt.Printf("%s: %s\n", info.Name, info.Description)
+
+	if len(info.Requires) > 0 {
+		fmt.Printf("requires: %s\n", strings.Join(info.Requires, ", "))
+	}
+
+	if info.Network {
+		fmt.Println("network: paused in low-power mode")
+	}
+
+	if info.Stream {
+		fmt.Println("stream: refreshed as values come, no interval needed")
+	}
+
+	if len(info.Options) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, 0x20, 0)
+
+	fmt.Fprintln(tw, "OPTION\tTYPE\tDEFAULT\tDESCRIPTION")
+
+	for _, o := range info.Options {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Name, o.Type, placeholder(o.Default), o.Description)
+	}
+
+	return tw.Flush()
+}
+
+// Show a dash for empty values.
+func placeholder(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Run the privileged helper until it fails.
+func serve(name string, args ...string) error {
+	flags := flag.NewFlagSet(name+" helper", flag.ContinueOnError)
+	socket := flags.String("socket", helper.DefaultSocket, "socket to listen on if not activated")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	l, err := helper.Listen(*socket)
+	if err != nil {
+		return err
+	}
+
+	defer l.Close()
+
+	return helper.Server{}.Serve(l)
 }
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"openbar"
+	"openbar/dbus"
+	"openbar/modules/command"
+)
+
+// Alert acts when the value of a module breaches a rule. The short form
+// "alert": "value > 90 for 5m" marks the block urgent, and the long one
+// chooses what happens, like
+// "alert": {"when": "value > 90 for 5m", "notify": "CPU too hot"}.
+type Alert struct {
+	When string `json:"when"`
+	// Urgent marks the block urgent while the rule holds.
+	Urgent bool `json:"urgent"`
+	// Notify sends a desktop notification with the given summary.
+	Notify string `json:"notify"`
+	// Command runs once the rule holds.
+	Command []string `json:"command"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Alert so that a rule alone
+// makes blocks urgent.
+func (a *Alert) UnmarshalJSON(data []byte) error {
+	var rule string
+	if err := json.Unmarshal(data, &rule); err == nil {
+		*a = Alert{When: rule, Urgent: true}
+		return nil
+	}
+
+	type plain Alert
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// Convert the alert of the named module to its runtime counterpart.
+func (a Alert) convert(name string) (openbar.Alert, error) {
+	rule, err := openbar.ParseRule(a.When)
+	if err != nil {
+		return openbar.Alert{}, fmt.Errorf("alert: %w", err)
+	}
+
+	if !a.Urgent && a.Notify == "" && len(a.Command) == 0 {
+		return openbar.Alert{}, errors.New("alert: nothing to do, set urgent, notify or command")
+	}
+
+	res := openbar.Alert{Rule: rule, Urgent: a.Urgent}
+	if a.Notify == "" && len(a.Command) == 0 {
+		return res, nil
+	}
+
+	res.Fire = func(v openbar.Value) {
+		go func() {
+			if a.Notify != "" {
+				body := fmt.Sprintf("%s: %s (%s)", name, v, rule)
+				if err := notify(a.Notify, body); err != nil {
+					log.Printf("module %s: alert: %v", name, err)
+				}
+			}
+			if len(a.Command) > 0 {
+				if _, err := command.Spawn(a.Command...); err != nil {
+					log.Printf("module %s: alert: %v", name, err)
+				}
+			}
+		}()
+	}
+
+	return res, nil
+}
+
+// Send a desktop notification, see the Desktop Notifications Specification.
+func notify(summary, body string) error {
+	_, err := dbus.Session().Call(
+		"org.freedesktop.Notifications",
+		"/org/freedesktop/Notifications",
+		"org.freedesktop.Notifications",
+		"Notify",
+		"openbar", uint32(0), "", summary, body, []string{}, map[string]dbus.Variant{}, int32(-1),
+	)
+	return err
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrBar is returned when the bar to run is missing or unknown.
+var ErrBar = errors.New("unknown bar")
+
+// Bar is one of the bars defined in a configuration file, for instance the top
+// or the bottom one. Its modules may reference shared definitions by name.
+type Bar struct {
+	Modules []Entry `json:"modules"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Entry so that a string stands
+// for the shared definition of that name.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*e = Entry{Use: name}
+		return nil
+	}
+	type alias Entry
+	return json.Unmarshal(data, (*alias)(e))
+}
+
+// Select keeps the modules of the named bar, resolves the references to shared
+// definitions and leaves out the modules whose condition doesn't hold on this
+// machine. The name must be empty for files without bars and is required
+// otherwise.
+func (f *File) Select(name string) error {
+	switch {
+	case name == "" && len(f.Bars) > 0:
+		return fmt.Errorf("%w: choose one of %s", ErrBar, strings.Join(f.BarNames(), ", "))
+	case name != "":
+		b, ok := f.Bars[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrBar, name)
+		}
+		f.Modules = b.Modules
+	}
+
+	res := make([]Entry, 0, len(f.Modules))
+
+	for i, e := range f.Modules {
+		if e.Use != "" {
+			shared, ok := f.Shared[e.Use]
+			if !ok {
+				return fmt.Errorf("module %d: unknown shared module: %s", i, e.Use)
+			}
+			e = shared
+		}
+
+		if e.When != "" {
+			ok, err := holds(e.When)
+			if err != nil {
+				return fmt.Errorf("module %d: %w", i, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		res = append(res, e)
+	}
+
+	f.Modules = res
+
+	return nil
+}
+
+// BarNames returns the sorted names of the bars defined in the file.
+func (f *File) BarNames() []string {
+	res := make([]string, 0, len(f.Bars))
+	for name := range f.Bars {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"openbar"
+	"openbar/modules/command"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How long a click waits for its command to exit before the module is
+// refreshed. Commands opening an application keep running in the background.
+const clickWait = time.Second
+
+// Names of mouse buttons in the configuration.
+var buttons = map[string]int{
+	"left":    openbar.LeftButton,
+	"middle":  openbar.MiddleButton,
+	"right":   openbar.RightButton,
+	"up":      openbar.ScrollUp,
+	"down":    openbar.ScrollDown,
+	"back":    openbar.BackButton,
+	"forward": openbar.ForwardButton,
+}
+
+// Names of modifier keys in the configuration, and as the bar names them.
+var modifiers = map[string]string{
+	"shift":   "Shift",
+	"ctrl":    "Control",
+	"control": "Control",
+	"alt":     "Mod1",
+	"super":   "Mod4",
+	"mod1":    "Mod1",
+	"mod2":    "Mod2",
+	"mod3":    "Mod3",
+	"mod4":    "Mod4",
+	"mod5":    "Mod5",
+}
+
+// Toggle configures how modules are disabled from the bar. The gesture is a
+// button preceded by modifiers, like "shift+middle".
+type Toggle struct {
+	Gesture   string `json:"gesture"`
+	Indicator string `json:"indicator"`
+}
+
+// Convert the toggle to its runtime counterpart.
+func (t Toggle) convert() (openbar.Toggle, error) {
+	res := openbar.Toggle{Indicator: t.Indicator}
+	if t.Gesture == "" {
+		return res, nil
+	}
+
+	keys := strings.Split(strings.ToLower(t.Gesture), "+")
+	b, ok := buttons[keys[len(keys)-1]]
+	if !ok {
+		return openbar.Toggle{}, fmt.Errorf("toggle: unknown button: %s", keys[len(keys)-1])
+	}
+
+	g := &openbar.Gesture{Button: b}
+	for _, k := range keys[:len(keys)-1] {
+		m, ok := modifiers[k]
+		if !ok {
+			return openbar.Toggle{}, fmt.Errorf("toggle: unknown modifier: %s", k)
+		}
+		g.Modifiers = append(g.Modifiers, m)
+	}
+	res.Gesture = g
+
+	return res, nil
+}
+
+// Clicks tells whether the bar should ask for click events. They are disabled
+// unless the file asks for them.
+func (f *File) Clicks() bool {
+	return f.ClickEvents != nil && *f.ClickEvents
+}
+
+// Build the click handler of an entry: buttons with a command run it, other
+// buttons are left to the module.
+func (e Entry) clicks() (func(openbar.Click) error, error) {
+	names := make([]string, 0, len(e.OnClick))
+	for name := range e.OnClick {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	actions := make(map[int][]string, len(e.OnClick))
+	for _, name := range names {
+		b, ok := buttons[name]
+		if !ok {
+			return nil, fmt.Errorf("on_click: unknown button: %s", name)
+		}
+		if len(e.OnClick[name]) == 0 {
+			return nil, fmt.Errorf("on_click: empty command for %s", name)
+		}
+		actions[b] = e.OnClick[name]
+	}
+
+	return func(c openbar.Click) error {
+		args, ok := actions[c.Button]
+		if !ok {
+			return openbar.ErrNotHandled
+		}
+
+		done, err := command.Spawn(args...)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(clickWait):
+			return nil
+		}
+	}, nil
+}
+
+// Confirm configures the clicks on a module that only take effect when repeated
+// in time, like "confirm": {"buttons": ["left"], "within": "3s"}.
+type Confirm struct {
+	Buttons []string `json:"buttons"`
+	Within  string   `json:"within"`
+	Prompt  string   `json:"prompt"`
+}
+
+// Convert the confirmation to its runtime counterpart.
+func (c Confirm) convert() (openbar.Confirmation, error) {
+	res := openbar.Confirmation{Prompt: c.Prompt}
+
+	for _, name := range c.Buttons {
+		b, ok := buttons[name]
+		if !ok {
+			return openbar.Confirmation{}, fmt.Errorf("confirm: unknown button: %s", name)
+		}
+		res.Buttons = append(res.Buttons, b)
+	}
+
+	if c.Within != "" {
+		d, err := time.ParseDuration(c.Within)
+		if err != nil {
+			return openbar.Confirmation{}, fmt.Errorf("confirm: %w", err)
+		}
+		res.Within = d
+	}
+
+	return res, nil
+}
+
+// Scroll configures how scrolls change adjustable modules, like
+// "scroll": {"step": 2, "max": 10, "within": "100ms"}.
+type Scroll struct {
+	Step   int    `json:"step"`
+	Max    int    `json:"max"`
+	Within string `json:"within"`
+}
+
+// Convert the scroll setting to its runtime counterpart.
+func (s Scroll) convert() (openbar.Scroll, error) {
+	res := openbar.Scroll{Step: s.Step, Max: s.Max}
+
+	if s.Step < 0 || s.Max < 0 {
+		return openbar.Scroll{}, fmt.Errorf("scroll: negative step: %d, %d", s.Step, s.Max)
+	}
+
+	if s.Within != "" {
+		d, err := time.ParseDuration(s.Within)
+		if err != nil {
+			return openbar.Scroll{}, fmt.Errorf("scroll: %w", err)
+		}
+		res.Within = d
+	}
+
+	return res, nil
+}
@@ -0,0 +1,888 @@
+// Package config loads the JSON runtime configuration of the openbar command.
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/inotify"
+	"openbar/location"
+	"openbar/modules"
+	"openbar/modules/command"
+	"openbar/mqtt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// File is a configuration file. Global settings are optional and the list of
+// modules can be given on its own as a top-level array. Files defining several
+// bars list their modules per bar instead, and Select picks the one to run.
+type File struct {
+	Protocol   string            `json:"protocol"`
+	StopSignal *Signal           `json:"stop_signal"`
+	ContSignal *Signal           `json:"cont_signal"`
+	MaxFPS     *int              `json:"max_fps"`
+	LowSlots   int               `json:"low_priority_slots"`
+	Coalesce   string            `json:"coalesce"`
+	Feedback   map[string]string `json:"feedback"`
+	Spinner    []string          `json:"spinner"`
+	Drain      string            `json:"drain"`
+	Markup     string            `json:"markup"`
+	Highlight  *Emphasis         `json:"highlight"`
+	Theme      *Theme            `json:"theme"`
+	HTTP       HTTP              `json:"http"`
+	Location   *Location         `json:"location"`
+	MQTT       *MQTT             `json:"mqtt"`
+	Modules    []Entry           `json:"modules"`
+	Shared     map[string]Entry  `json:"shared"`
+	Bars       map[string]Bar    `json:"bars"`
+	// Defaults are block attributes applied to every module, and presets are
+	// named sets of attributes modules refer to.
+	Defaults json.RawMessage            `json:"defaults"`
+	Presets  map[string]json.RawMessage `json:"presets"`
+	// ClickEvents enables clicks when set to true.
+	ClickEvents *bool `json:"click_events"`
+	// LowPower configures how the bar saves energy.
+	LowPower *LowPower `json:"low_power"`
+	// Separator and SeparatorBlockWidth apply to every module without a
+	// separator of its own.
+	Separator           *bool `json:"separator"`
+	SeparatorBlockWidth *int  `json:"separator_block_width"`
+	// Toggle configures how modules are disabled from the bar.
+	Toggle *Toggle `json:"toggle"`
+	// Scroll configures how scrolls change adjustable modules.
+	Scroll *Scroll `json:"scroll"`
+	// Icons add to or replace the icons formats know by name.
+	Icons map[string]string `json:"icons"`
+	// OnError tells what the blocks of failing modules show.
+	OnError *OnError `json:"on_error"`
+	// Placeholder is shown while refreshes are pending, an empty one
+	// leaving blocks as they are.
+	Placeholder *string `json:"placeholder"`
+	// Groups gives groups of modules the signal refreshing all of them, like
+	// {"network": "SIGRTMIN+20"}.
+	Groups map[string]Signal `json:"groups"`
+}
+
+// LowPower configures low-power mode. It engages below the given battery
+// percentage, or only through the control socket when it is zero.
+type LowPower struct {
+	Below     int    `json:"below"`
+	Factor    int    `json:"factor"`
+	Indicator string `json:"indicator"`
+}
+
+// HTTP configures the client shared by network modules.
+type HTTP struct {
+	Timeout   string `json:"timeout"`
+	Proxy     string `json:"proxy"`
+	UserAgent string `json:"user_agent"`
+	CAFile    string `json:"ca_file"`
+	Insecure  bool   `json:"insecure"`
+	NoCache   bool   `json:"no_cache"`
+}
+
+// Location configures where the machine is, either with coordinates or with
+// GeoClue, in which case coordinates are the fallback.
+type Location struct {
+	Provider  string   `json:"provider"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Command   []string `json:"command"`
+}
+
+// MQTT configures the broker modules subscribe to by default. With Publish,
+// the bar also publishes the status of its modules and clicks on their blocks
+// under the given prefix, and with Commands it obeys reloads, enables and
+// disables sent to it, see mqtt.Bridge.
+type MQTT struct {
+	Broker    string `json:"broker"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	KeepAlive string `json:"keep_alive"`
+	Publish   string `json:"publish"`
+	Commands  bool   `json:"commands"`
+}
+
+// Build the shared broker. It is nil when not configured.
+func (m *MQTT) broker() (*mqtt.Broker, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	if m.Broker == "" {
+		return nil, errors.New("mqtt: missing broker")
+	}
+
+	if strings.ContainsAny(m.Publish, "+#") {
+		return nil, fmt.Errorf("mqtt: wildcard in prefix: %s", m.Publish)
+	}
+
+	if m.Commands && m.Publish == "" {
+		return nil, errors.New("mqtt: commands need a prefix to publish to")
+	}
+
+	res := &mqtt.Broker{Addr: m.Broker, Username: m.Username, Password: m.Password}
+
+	if m.KeepAlive != "" {
+		d, err := time.ParseDuration(m.KeepAlive)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt: %w", err)
+		}
+		res.KeepAlive = d
+	}
+
+	return res, nil
+}
+
+// Bridge returns what publishes the bar to the broker, or nil unless
+// configured. It still needs the control of the bar.
+func (f File) Bridge() (*mqtt.Bridge, error) {
+	b, err := f.MQTT.broker()
+	if err != nil || b == nil || f.MQTT.Publish == "" {
+		return nil, err
+	}
+
+	res := mqtt.NewBridge(*b, f.MQTT.Publish)
+	res.Commands = f.MQTT.Commands
+
+	return res, nil
+}
+
+// Build the shared location provider. It is nil when not configured.
+func (l *Location) provider() (location.Provider, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	var fixed *location.Coordinates
+	switch {
+	case l.Latitude != nil && l.Longitude != nil:
+		fixed = &location.Coordinates{Latitude: *l.Latitude, Longitude: *l.Longitude}
+		if !fixed.Valid() {
+			return nil, fmt.Errorf("location: coordinates out of bounds: %v", *fixed)
+		}
+	case l.Latitude != nil || l.Longitude != nil:
+		return nil, errors.New("location: latitude and longitude go together")
+	}
+
+	switch l.Provider {
+	case "", "manual":
+		if fixed == nil {
+			return nil, errors.New("location: missing coordinates")
+		}
+		return location.Fixed(*fixed), nil
+	case "geoclue":
+		return location.NewGeoClue(fixed, l.Command...), nil
+	default:
+		return nil, fmt.Errorf("location: unknown provider: %s", l.Provider)
+	}
+}
+
+// Build the shared client.
+func (h HTTP) client() (*http.Client, error) {
+	cfg := httpclient.Config{
+		Proxy:     h.Proxy,
+		UserAgent: h.UserAgent,
+		CAFile:    h.CAFile,
+		Insecure:  h.Insecure,
+		NoCache:   h.NoCache,
+	}
+
+	if h.Timeout != "" {
+		d, err := time.ParseDuration(h.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Timeout = d
+	}
+
+	return httpclient.New(cfg)
+}
+
+// Entry is one module of the configuration file. It either runs a command or
+// references a built-in module by name along with its options.
+type Entry struct {
+	Name      string          `json:"name"`
+	Command   []string        `json:"command"`
+	Module    string          `json:"module"`
+	Options   json.RawMessage `json:"options"`
+	Interval  string          `json:"interval"`
+	SubSecond bool            `json:"subsecond"`
+	Manual    bool            `json:"manual"`
+	Spin      string          `json:"spin"`
+	Timeout   string          `json:"timeout"`
+	Nice      int             `json:"nice"`
+	IONice    string          `json:"ionice"`
+	Low       bool            `json:"low_priority"`
+	Emphasis  *Emphasis       `json:"emphasis"`
+	Preset    string          `json:"preset"`
+	When      string          `json:"when"`
+	Sparkline int             `json:"sparkline"`
+	Progress  int             `json:"progress"`
+	Trend     string          `json:"trend"`
+	Network   bool            `json:"network"`
+	Markup    string          `json:"markup"`
+	Urgent    *Urgent         `json:"urgent"`
+	Alert     *Alert          `json:"alert"`
+	// Format rewrites the text with a template, like `{{icon "bat"}} {{.}}%`.
+	Format string `json:"format"`
+	// Color, background and border override those of the preset and the
+	// defaults.
+	Color      string `json:"color"`
+	Background string `json:"background"`
+	Border     string `json:"border"`
+	// MinWidth, a number of pixels or a text like "100%", and Align override
+	// those of the preset and the defaults.
+	MinWidth *openbar.Width `json:"min_width"`
+	Align    string         `json:"align"`
+	// Separator and SeparatorBlockWidth override the separator of the
+	// preset, the defaults and the global one.
+	Separator           *bool `json:"separator"`
+	SeparatorBlockWidth *int  `json:"separator_block_width"`
+	// Watch lists files or directories whose changes refresh the module, like
+	// "~/Mail/INBOX/new".
+	Watch []string `json:"watch"`
+	// Active lists the windows outside of which the module is hidden, like
+	// "mon-fri 09:00-18:00".
+	Active []string `json:"active"`
+	// Schedule runs the module at the times of a crontab(5) expression, like
+	// "0 7 * * *", instead of at intervals.
+	Schedule string `json:"schedule"`
+	// Group is the group of modules the module is refreshed with.
+	Group string `json:"group"`
+	// Signal is the signal refreshing the module, like "SIGRTMIN+5", instead
+	// of the one given by its position. "none" leaves it without.
+	Signal *Signal `json:"signal"`
+	// OnClick maps mouse buttons to the command they run.
+	OnClick map[string][]string `json:"on_click"`
+	// Confirm makes clicks take effect only when repeated.
+	Confirm *Confirm `json:"confirm"`
+	// Scroll overrides the global scroll setting.
+	Scroll *Scroll `json:"scroll"`
+	// OnError overrides the global error setting.
+	OnError *OnError `json:"on_error"`
+	// Placeholder overrides the global placeholder.
+	Placeholder *string `json:"placeholder"`
+	// Use is the name of the shared definition an entry stands for.
+	Use string `json:"-"`
+}
+
+// Urgent holds the limits past which the first number of a block makes it
+// urgent, like a battery level below 10 or a temperature above 90.
+type Urgent struct {
+	Below *float64 `json:"below"`
+	Above *float64 `json:"above"`
+}
+
+// Emphasis is the style taken by a block for a while when its value changes.
+type Emphasis struct {
+	Duration   string         `json:"duration"`
+	Color      string         `json:"color"`
+	MinWidth   *openbar.Width `json:"min_width"`
+	Background string         `json:"background"`
+	Border     string         `json:"border"`
+}
+
+// Convert an emphasis to its bar counterpart.
+func (e Emphasis) convert() (openbar.Emphasis, error) {
+	d, err := time.ParseDuration(e.Duration)
+	if err != nil {
+		return openbar.Emphasis{}, err
+	}
+	return openbar.Emphasis{
+		Duration:   d,
+		Color:      e.Color,
+		MinWidth:   e.MinWidth,
+		Background: e.Background,
+		Border:     e.Border,
+	}, nil
+}
+
+// Load parses a JSON configuration file. Each module is an object with
+// `interval` and either `command` or `module` defined.
+func Load(path string) (*File, error) {
+	fd, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	defer fd.Close()
+
+	data, err := io.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes the content of a configuration file.
+func Parse(data []byte) (*File, error) {
+	f := new(File)
+
+	// Bare arrays are the original format where only modules are listed.
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == 0x5B {
+		if err := json.Unmarshal(data, &f.Modules); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Convert the protocol and the signals of the header to bar options.
+func (f *File) header() ([]openbar.Option, error) {
+	res := make([]openbar.Option, 0, len(f.Modules)+3)
+
+	switch f.Protocol {
+	case "", "sway":
+	case "i3":
+		res = append(res, openbar.WithProtocol(openbar.I3))
+	default:
+		return nil, fmt.Errorf("unknown protocol: %s", f.Protocol)
+	}
+
+	if f.StopSignal != nil {
+		res = append(res, openbar.WithStopSignal(syscall.Signal(*f.StopSignal)))
+	}
+
+	if f.ContSignal != nil {
+		res = append(res, openbar.WithContSignal(syscall.Signal(*f.ContSignal)))
+	}
+
+	return res, nil
+}
+
+// Options converts the configuration to bar options.
+func (f *File) Options() ([]openbar.Option, error) {
+	res, err := f.header()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.MaxFPS != nil {
+		res = append(res, openbar.WithMaxFPS(*f.MaxFPS))
+	}
+
+	if f.LowSlots != 0 {
+		res = append(res, openbar.WithLowPrioritySlots(f.LowSlots))
+	}
+
+	if f.Coalesce != "" {
+		d, err := time.ParseDuration(f.Coalesce)
+		if err != nil {
+			return nil, fmt.Errorf("coalesce: %w", err)
+		}
+		res = append(res, openbar.WithCoalesce(d))
+	}
+
+	if f.Drain != "" {
+		d, err := time.ParseDuration(f.Drain)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithDrain(d))
+	}
+
+	if f.Highlight != nil {
+		highlight, err := f.Highlight.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithHighlight(highlight))
+	}
+
+	if f.Theme != nil {
+		theme, err := f.Theme.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithTheme(theme))
+	}
+
+	if f.Separator != nil || f.SeparatorBlockWidth != nil {
+		s, err := separator(f.Separator, f.SeparatorBlockWidth)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithSeparator(s))
+	}
+
+	if len(f.Spinner) > 0 {
+		res = append(res, openbar.WithSpinner(f.Spinner...))
+	}
+
+	markup, err := pango(f.Markup)
+	if err != nil {
+		return nil, err
+	}
+
+	if markup {
+		res = append(res, openbar.WithMarkup())
+	}
+
+	if lp := f.LowPower; lp != nil {
+		res = append(res, openbar.WithLowPower(openbar.LowPower{
+			Factor:    lp.Factor,
+			Below:     lp.Below,
+			Level:     batteryLevel,
+			Indicator: lp.Indicator,
+		}))
+	}
+
+	if f.Toggle != nil {
+		t, err := f.Toggle.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithToggle(t))
+	}
+
+	if f.Scroll != nil {
+		s, err := f.Scroll.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithScroll(s))
+	}
+
+	if f.OnError != nil {
+		p, err := f.OnError.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.WithErrorPolicy(p))
+	}
+
+	if f.Placeholder != nil {
+		res = append(res, openbar.WithPlaceholder(*f.Placeholder))
+	}
+
+	for group, sig := range f.Groups {
+		res = append(res, openbar.WithGroupSignal(group, syscall.Signal(sig)))
+	}
+
+	for trigger, feedback := range f.Feedback {
+		opt, err := feedbackOption(trigger, feedback)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, opt)
+	}
+
+	if err := f.checkStyles(); err != nil {
+		return nil, err
+	}
+
+	client, err := f.HTTP.client()
+	if err != nil {
+		return nil, err
+	}
+
+	where, err := f.Location.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	broker, err := f.MQTT.broker()
+	if err != nil {
+		return nil, err
+	}
+
+	env := modules.Env{HTTP: client, Location: where, MQTT: broker}
+
+	// Identical entries are told apart by their rank among themselves.
+	ids := make(map[string]int)
+
+	for _, e := range f.Modules {
+		duration, err := e.interval()
+		if err != nil {
+			return nil, err
+		}
+
+		opts, err := e.options()
+		if err != nil {
+			return nil, err
+		}
+
+		format, err := e.format(f.Icons)
+		if err != nil {
+			return nil, err
+		}
+		if format != nil {
+			opts = append(opts, openbar.Formatted(format))
+		}
+
+		id := e.id()
+		if ids[id]++; ids[id] > 1 {
+			id = fmt.Sprintf("%s-%d", id, ids[id])
+		}
+		opts = append(opts, openbar.Identified(id))
+
+		style, err := f.style(e)
+		if err != nil {
+			return nil, err
+		}
+
+		if style != (openbar.Block{}) {
+			opts = append(opts, openbar.Style(style))
+		}
+
+		if e.Separator != nil || e.SeparatorBlockWidth != nil {
+			s, err := separator(e.Separator, e.SeparatorBlockWidth)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, openbar.Separated(s))
+		}
+
+		markup, err := pango(e.Markup)
+		if err != nil {
+			return nil, err
+		}
+
+		if markup {
+			opts = append(opts, openbar.Markup())
+		}
+
+		if info, _ := modules.Describe(e.Module); e.Network || info.Network {
+			opts = append(opts, openbar.PauseOnLowPower())
+		}
+
+		module, err := build(env, e)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(e.OnClick) > 0 {
+			click, err := e.clicks()
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, openbar.OnClick(click))
+		}
+
+		// Modules emitting several blocks are laid out as such, and modules
+		// pushing their values are never polled.
+		if m, ok := module.(openbar.StreamModule); ok {
+			res = append(res, openbar.WithStreamModule(m, opts...))
+			continue
+		}
+		if m, ok := module.(openbar.MultiModule); ok {
+			res = append(res, openbar.WithMultiModule(m, duration, opts...))
+			continue
+		}
+		res = append(res, openbar.WithModule(module, duration, opts...))
+	}
+
+	return res, nil
+}
+
+// Convert separator settings. Gaps can't be negative.
+func separator(show *bool, width *int) (openbar.Separator, error) {
+	if width != nil && *width < 0 {
+		return openbar.Separator{}, fmt.Errorf("negative separator_block_width: %d", *width)
+	}
+	return openbar.Separator{Show: show, Width: width}, nil
+}
+
+// Tell whether a markup setting asks for Pango markup.
+func pango(markup string) (bool, error) {
+	switch markup {
+	case "", "none":
+		return false, nil
+	case openbar.Pango:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown markup: %s", markup)
+	}
+}
+
+// Convert a feedback setting.
+func feedbackOption(trigger, feedback string) (openbar.Option, error) {
+	triggers := map[string]openbar.Trigger{
+		"broadcast": openbar.Broadcast,
+		"single":    openbar.Single,
+		"remote":    openbar.Remote,
+	}
+
+	feedbacks := map[string]openbar.Feedback{
+		"keep":        openbar.Keep,
+		"placeholder": openbar.Placeholder,
+		"spinner":     openbar.Spinner,
+	}
+
+	t, ok := triggers[trigger]
+	if !ok {
+		return nil, fmt.Errorf("unknown trigger: %s", trigger)
+	}
+
+	f, ok := feedbacks[feedback]
+	if !ok {
+		return nil, fmt.Errorf("unknown feedback: %s", feedback)
+	}
+
+	return openbar.WithFeedback(t, f), nil
+}
+
+// Parse the interval of an entry. Manual modules, scheduled modules and
+// modules pushing their values don't need one.
+func (e Entry) interval() (time.Duration, error) {
+	if (e.Manual || e.Schedule != "" || e.streams()) && e.Interval == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(e.Interval)
+}
+
+// Tell whether the module of an entry pushes its values.
+func (e Entry) streams() bool {
+	info, _ := modules.Describe(e.Module)
+	return info.Stream
+}
+
+// Collect the module settings of an entry.
+func (e Entry) options() ([]openbar.ModuleOption, error) {
+	res := []openbar.ModuleOption{openbar.Named(e.name())}
+	if e.SubSecond {
+		res = append(res, openbar.SubSecond())
+	}
+	if e.Manual {
+		res = append(res, openbar.Manual())
+	}
+	if e.Low {
+		res = append(res, openbar.LowPriority())
+	}
+	if e.Sparkline > 0 {
+		res = append(res, openbar.Sparkline(e.Sparkline))
+	}
+	if e.Progress > 0 {
+		res = append(res, openbar.ProgressBar(e.Progress))
+	}
+	if e.Alert != nil {
+		a, err := e.Alert.convert(e.name())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.Alerting(a))
+	}
+	switch e.Trend {
+	case "":
+	case "arrow":
+		res = append(res, openbar.ShowTrend(false))
+	case "delta":
+		res = append(res, openbar.ShowTrend(true))
+	default:
+		return nil, fmt.Errorf("unknown trend: %s", e.Trend)
+	}
+	if e.Spin != "" {
+		d, err := time.ParseDuration(e.Spin)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.Spin(d))
+	}
+	if e.Emphasis != nil {
+		emphasis, err := e.Emphasis.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.Emphasize(emphasis))
+	}
+	if e.Urgent != nil && e.Urgent.Below != nil {
+		res = append(res, openbar.UrgentBelow(*e.Urgent.Below))
+	}
+	if e.Urgent != nil && e.Urgent.Above != nil {
+		res = append(res, openbar.UrgentAbove(*e.Urgent.Above))
+	}
+	for _, path := range e.Watch {
+		path := expand(path)
+		res = append(res, openbar.RefreshOn(openbar.NotifierFunc(func(ctx context.Context, changed func()) error {
+			return inotify.Shared().Watch(ctx, path, changed)
+		})))
+	}
+	if len(e.Active) > 0 {
+		windows := make([]openbar.Window, 0, len(e.Active))
+		for _, s := range e.Active {
+			w, err := openbar.ParseWindow(s)
+			if err != nil {
+				return nil, err
+			}
+			windows = append(windows, w)
+		}
+		res = append(res, openbar.ActiveDuring(windows...))
+	}
+	if e.Group != "" {
+		res = append(res, openbar.Group(e.Group))
+	}
+	if e.Signal != nil {
+		res = append(res, openbar.ReloadOn(syscall.Signal(*e.Signal)))
+	}
+	if e.Schedule != "" {
+		s, err := openbar.ParseSchedule(e.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.OnSchedule(s))
+	}
+	if e.Confirm != nil {
+		conf, err := e.Confirm.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.Confirm(conf))
+	}
+	if e.Scroll != nil {
+		s, err := e.Scroll.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.Scrolling(s))
+	}
+	if e.OnError != nil {
+		p, err := e.OnError.convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, openbar.OnError(p))
+	}
+	if e.Placeholder != nil {
+		res = append(res, openbar.PlaceholderText(*e.Placeholder))
+	}
+	return res, nil
+}
+
+// Parse the format of an entry, if any, knowing the given icons.
+func (e Entry) format(icons map[string]string) (*openbar.Format, error) {
+	if e.Format == "" {
+		return nil, nil
+	}
+	f, err := openbar.ParseFormat(e.Format, icons)
+	if err != nil {
+		return nil, fmt.Errorf("format: %w", err)
+	}
+	return f, nil
+}
+
+// Expand a leading ~ to the home directory.
+func expand(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Return the name of an entry, falling back to the module or command name.
+func (e Entry) name() string {
+	switch {
+	case e.Name != "":
+		return e.Name
+	case e.Module != "":
+		return e.Module
+	case len(e.Command) > 0:
+		return filepath.Base(e.Command[0])
+	default:
+		return ""
+	}
+}
+
+// Derive an identifier from what an entry runs so that it stays the same when
+// modules are reordered: the name of the entry followed by a hash of its
+// definition.
+func (e Entry) id() string {
+	def, err := json.Marshal(struct {
+		Name    string          `json:"name"`
+		Command []string        `json:"command"`
+		Module  string          `json:"module"`
+		Options json.RawMessage `json:"options"`
+	}{e.Name, e.Command, e.Module, e.Options})
+	if err != nil {
+		def = append([]byte(e.Module), e.Options...)
+	}
+	sum := sha256.Sum256(def)
+	return fmt.Sprintf("%s-%x", e.name(), sum[:4])
+}
+
+// Instantiate the module described by an entry.
+func build(env modules.Env, e Entry) (openbar.Module, error) {
+	if e.Module == "" {
+		if len(e.Command) == 0 {
+			return nil, fmt.Errorf("entry has neither command nor module")
+		}
+		opts, err := e.command()
+		if err != nil {
+			return nil, err
+		}
+		opts.Name = e.name()
+		return command.NewModule(opts, e.Command...), nil
+	}
+
+	if e.Timeout != "" || e.Nice != 0 || e.IONice != "" {
+		return nil, fmt.Errorf("%s: timeout, nice and ionice only apply to commands", e.Module)
+	}
+
+	factory, ok := modules.Lookup(e.Module)
+	if !ok {
+		return nil, fmt.Errorf("unknown module: %s", e.Module)
+	}
+
+	options := e.Options
+	if len(options) == 0 {
+		options = json.RawMessage("{}")
+	}
+
+	if err := modules.Validate(e.Module, options); err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Module, err)
+	}
+
+	module, err := factory(env, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Module, err)
+	}
+
+	return module, nil
+}
+
+// Collect the settings of a command entry.
+func (e Entry) command() (command.Options, error) {
+	var res command.Options
+
+	if e.Timeout != "" {
+		d, err := time.ParseDuration(e.Timeout)
+		if err != nil {
+			return res, err
+		}
+		res.Timeout = d
+	}
+
+	if e.IONice != "" {
+		p, err := command.ParseIOPriority(e.IONice)
+		if err != nil {
+			return res, err
+		}
+		res.IOPriority = p
+	}
+
+	res.Nice = e.Nice
+
+	return res, nil
+}
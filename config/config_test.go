@@ -0,0 +1,556 @@
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"openbar"
+	"openbar/config"
+	"openbar/modules"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		data    string
+		modules int
+		stop    *config.Signal
+		err     bool
+	}{
+		{
+			data:    `[{"command": ["date"], "interval": "1s"}]`,
+			modules: 1,
+			stop:    nil,
+			err:     false,
+		},
+		{
+			data:    `{"stop_signal": "SIGTSTP", "modules": [{"command": ["date"], "interval": "1s"}]}`,
+			modules: 1,
+			stop:    signal(syscall.SIGTSTP),
+			err:     false,
+		},
+		{
+			data:    `{"stop_signal": "none", "modules": []}`,
+			modules: 0,
+			stop:    signal(0),
+			err:     false,
+		},
+		{
+			data:    `{"stop_signal": 20}`,
+			modules: 0,
+			stop:    signal(syscall.SIGTSTP),
+			err:     false,
+		},
+		{
+			data:    `{"stop_signal": "SIGRTMIN+2"}`,
+			modules: 0,
+			stop:    signal(36),
+			err:     false,
+		},
+		{
+			data:    `{"stop_signal": "RTMAX-1"}`,
+			modules: 0,
+			stop:    signal(63),
+			err:     false,
+		},
+		{
+			data:    `{"stop_signal": "SIGRTMIN-1"}`,
+			modules: 0,
+			stop:    nil,
+			err:     true,
+		},
+		{
+			data:    `{"stop_signal": "SIGFOO"}`,
+			modules: 0,
+			stop:    nil,
+			err:     true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			f, err := config.Parse([]byte(test.data))
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(f.Modules) != test.modules {
+				t.Errorf("want: %d modules, got: %d", test.modules, len(f.Modules))
+			}
+
+			switch {
+			case test.stop == nil && f.StopSignal != nil:
+				t.Errorf("want no stop signal, got: %d", *f.StopSignal)
+			case test.stop != nil && (f.StopSignal == nil || *f.StopSignal != *test.stop):
+				t.Errorf("want stop signal: %d, got: %v", *test.stop, f.StopSignal)
+			}
+		})
+	}
+}
+
+func signal(sig syscall.Signal) *config.Signal {
+	s := config.Signal(sig)
+	return &s
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "harden",
+		Description: "module running the command of its options",
+		Options:     []modules.Option{{Name: "command", Type: modules.Strings, Description: "command run"}},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts := struct {
+				Command []string `json:"command"`
+			}{}
+			err := json.Unmarshal(options, &opts)
+			return [][]string{opts.Command}, err
+		},
+	}, func(modules.Env, json.RawMessage) (openbar.Module, error) {
+		return openbar.ModuleFunc(func() (string, error) { return "", nil }), nil
+	})
+}
+
+func TestHarden(t *testing.T) {
+	const missing = "no-such-command-for-openbar"
+
+	tests := []struct {
+		mode  os.FileMode
+		data  string
+		allow []string
+		extra [][]string
+		err   error
+	}{
+		{
+			mode:  0o644,
+			data:  `[{"command": ["true"], "interval": "1s"}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   nil,
+		},
+		{
+			mode:  0o666,
+			data:  `[{"command": ["true"], "interval": "1s"}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   config.ErrInsecure,
+		},
+		{
+			mode:  0o644,
+			data:  `[{"command": ["true"], "interval": "1s"}]`,
+			allow: []string{"/nonexistent"},
+			err:   config.ErrInsecure,
+		},
+		{
+			mode:  0o644,
+			data:  `[{"command": ["` + missing + `"], "interval": "1s"}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   config.ErrInsecure,
+		},
+		{
+			mode:  0o644,
+			data:  `[{"command": ["true"], "interval": "1s", "alert": {"when": "value > 1", "command": ["` + missing + `"]}}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   config.ErrInsecure,
+		},
+		{
+			mode:  0o644,
+			data:  `[{"module": "harden", "interval": "1s", "options": {"command": ["true"]}}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   nil,
+		},
+		{
+			mode:  0o644,
+			data:  `[{"module": "harden", "interval": "1s", "options": {"command": ["` + missing + `"]}}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   config.ErrInsecure,
+		},
+		{
+			mode:  0o644,
+			data:  `{"location": {"provider": "geoclue", "command": ["` + missing + `"]}, "modules": []}`,
+			allow: []string{"/usr/bin", "/bin"},
+			err:   config.ErrInsecure,
+		},
+		{
+			mode:  0o644,
+			data:  `[{"command": ["true"], "interval": "1s"}]`,
+			allow: []string{"/usr/bin", "/bin"},
+			extra: [][]string{{missing}},
+			err:   config.ErrInsecure,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(test.data), test.mode); err != nil {
+				t.Fatal(err)
+			}
+			// Bypass umask.
+			if err := os.Chmod(path, test.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := config.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = config.Harden(path, f, test.allow, test.extra...)
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	const data = `{
+		"shared": {"clock": {"command": ["date"], "interval": "1s"}},
+		"bars": {
+			"top": {"modules": ["clock", {"command": ["uptime"], "interval": "1m"}]},
+			"bottom": {"modules": ["clock", "missing"]}
+		}
+	}`
+
+	tests := []struct {
+		bar      string
+		commands []string
+		err      bool
+	}{
+		{bar: "top", commands: []string{"date", "uptime"}},
+		{bar: "bottom", err: true},
+		{bar: "left", err: true},
+		{bar: "", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			f, err := config.Parse([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = f.Select(test.bar)
+			if test.err != (err != nil) {
+				t.Fatalf("want error: %v, got: %v", test.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			commands := make([]string, 0, len(f.Modules))
+			for _, e := range f.Modules {
+				commands = append(commands, e.Command[0])
+			}
+
+			if fmt.Sprint(commands) != fmt.Sprint(test.commands) {
+				t.Errorf("want: %v, got: %v", test.commands, commands)
+			}
+		})
+	}
+}
+
+func TestPresets(t *testing.T) {
+	const data = `{
+		"defaults": {"color": "#cccccc", "separator_block_width": 20, "min_width": 50},
+		"theme": {"colors": {"critical": "#ff0000"}},
+		"separator": false,
+		"presets": {"warn": {"color": "critical"}},
+		"modules": [
+			{"command": ["echo", "a"], "interval": "1h"},
+			{"command": ["echo", "b"], "interval": "1h", "preset": "warn"},
+			{"command": ["echo", "c"], "interval": "1h", "preset": "warn", "color": "#00ff00", "background": "#000000",
+			 "separator": true, "separator_block_width": 8, "min_width": "100%", "align": "right"}
+		]
+	}`
+
+	f, err := config.Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := f.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 10)
+	opts = append(opts,
+		openbar.WithOutput(io.Discard),
+		openbar.WithFrameHook(func(b []openbar.Block) {
+			if b[0].FullText == "a" && b[1].FullText == "b" && b[2].FullText == "c" {
+				frames <- append([]openbar.Block(nil), b...)
+			}
+		}),
+	)
+
+	go func() { _ = openbar.Run(ctx, opts...) }()
+
+	want := `[{"full_text":"a","color":"#cccccc","min_width":50,"name":"echo","instance":"echo-1d3355d8",` +
+		`"separator":false,"separator_block_width":20},` +
+		`{"full_text":"b","color":"#ff0000","min_width":50,"name":"echo","instance":"echo-753e1d26",` +
+		`"separator":false,"separator_block_width":20},` +
+		`{"full_text":"c","color":"#00ff00","background":"#000000","min_width":"100%","align":"right",` +
+		`"name":"echo","instance":"echo-f07f31df","separator":true,"separator_block_width":8}]`
+
+	select {
+	case b := <-frames:
+		got, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("want: %s, got: %s", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame")
+	}
+
+	for i, data := range []string{
+		`{"presets": {"bad": {"full_text": "x"}}, "modules": []}`,
+		`{"defaults": {"colour": "#fff"}, "modules": []}`,
+		`{"modules": [{"command": ["date"], "interval": "1s", "preset": "missing"}]}`,
+		`{"modules": [{"command": ["date"], "interval": "1s", "color": "red"}]}`,
+		`{"theme": {"colors": {"critical": "red"}}, "modules": []}`,
+		`{"modules": [{"command": ["date"], "interval": "1s", "separator_block_width": -1}]}`,
+		`{"modules": [{"command": ["date"], "interval": "1s", "align": "middle"}]}`,
+		`{"defaults": {"min_width": -5}, "modules": []}`,
+	} {
+		f, err := config.Parse([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Options(); err == nil {
+			t.Errorf("%d: want error", i)
+		}
+	}
+}
+
+func TestWhen(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		when string
+		kept bool
+		err  bool
+	}{
+		{when: "", kept: true},
+		{when: fmt.Sprintf("hostname == '%s'", host), kept: true},
+		{when: fmt.Sprintf("hostname != '%s'", host), kept: false},
+		{when: fmt.Sprintf(`exists("%s")`, dir), kept: true},
+		{when: fmt.Sprintf(`!exists("%s")`, dir), kept: false},
+		{when: "exists('/nonexistent/openbar')", kept: false},
+		{when: "on_the_moon", err: true},
+		{when: "hostname == laptop", err: true},
+		{when: "shell('true')", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			f := &config.File{Modules: []config.Entry{{Command: []string{"date"}, When: test.when}}}
+
+			err := f.Select("")
+			if !errors.Is(err, config.ErrCondition) != !test.err {
+				t.Fatalf("want error: %v, got: %v", test.err, err)
+			}
+
+			if err == nil && (len(f.Modules) == 1) != test.kept {
+				t.Errorf("want kept: %v, got: %d modules", test.kept, len(f.Modules))
+			}
+		})
+	}
+}
+
+func TestIDs(t *testing.T) {
+	// Return the identifiers of the modules of a configuration.
+	ids := func(data string) []string {
+		f, err := config.Parse([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts, err := f.Options()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The control knows every module once one of them returned.
+		control, updated := openbar.NewControl(), make(chan struct{}, 1)
+		go func() {
+			_ = openbar.Run(ctx, append(opts,
+				openbar.WithOutput(io.Discard),
+				openbar.WithControl(control),
+				openbar.WithUpdateHook(func(openbar.Status) {
+					select {
+					case updated <- struct{}{}:
+					default:
+					}
+				}),
+			)...)
+		}()
+
+		select {
+		case <-updated:
+		case <-time.After(time.Second):
+			t.Fatal("bar not started")
+		}
+
+		status := control.Status()
+		res := make([]string, 0, len(status))
+		for _, s := range status {
+			res = append(res, s.ID)
+		}
+		return res
+	}
+
+	before := ids(`[
+		{"command": ["date"], "interval": "1h"},
+		{"command": ["uptime"], "interval": "1h"}
+	]`)
+
+	after := ids(`[
+		{"command": ["uptime"], "interval": "1m"},
+		{"command": ["date"], "interval": "1h"},
+		{"command": ["date"], "interval": "1h"}
+	]`)
+
+	// Reordering modules or changing their interval keeps their identifier.
+	if before[0] != after[1] || before[1] != after[0] {
+		t.Errorf("want: same identifiers, got: %v and %v", before, after)
+	}
+
+	if !strings.HasPrefix(before[0], "date-") {
+		t.Errorf("want: identifier named after the module, got: %s", before[0])
+	}
+
+	if want := after[1] + "-2"; after[2] != want {
+		t.Errorf("want: %s, got: %s", want, after[2])
+	}
+}
+
+func TestToggle(t *testing.T) {
+	tests := []struct {
+		toggle string
+		err    bool
+	}{
+		{`{"indicator": "off"}`, false},
+		{`{"gesture": "shift+middle"}`, false},
+		{`{"gesture": "Ctrl+Alt+right"}`, false},
+		{`{"gesture": "shift+wheel"}`, true},
+		{`{"gesture": "hyper+left"}`, true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			f, err := config.Parse([]byte(`{"toggle": ` + test.toggle + `}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Options(); (err != nil) != test.err {
+				t.Errorf("want error: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestOnClick(t *testing.T) {
+	dir := t.TempDir()
+	clicked := filepath.Join(dir, "clicked")
+
+	data := fmt.Sprintf(`[{
+		"command": ["sh", "-c", "test -e %[1]s && echo yes || echo no"],
+		"interval": "1h",
+		"on_click": {"left": ["touch", "%[1]s"]}
+	}]`, clicked)
+
+	f, err := config.Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := f.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	// Clicks are handled one after the other: once the left click comes, the
+	// right one is done with.
+	texts, touched := make(chan string, 100), make(chan bool, 1)
+	opts = append(opts,
+		openbar.WithOutput(io.Discard),
+		openbar.WithClickEvents(r),
+		openbar.WithFrameHook(func(b []openbar.Block) {
+			select {
+			case texts <- b[0].FullText + " " + b[0].Name:
+			default:
+			}
+		}),
+		openbar.WithClickHook(func(_ int, c openbar.Click) {
+			if c.Button == openbar.LeftButton {
+				_, err := os.Stat(clicked)
+				touched <- err == nil
+			}
+		}),
+	)
+
+	go func() { _ = openbar.Run(ctx, opts...) }()
+
+	name := ""
+	for text := range texts {
+		if parts := strings.Fields(text); parts[0] == "no" {
+			name = parts[1]
+			break
+		}
+	}
+
+	click := func(button int) {
+		if _, err := fmt.Fprintf(w, `{"name": %q, "button": %d}`+"\n", name, button); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Clicks with other buttons are ignored.
+	click(openbar.RightButton)
+	click(openbar.LeftButton)
+	if <-touched {
+		t.Fatal("want: right click ignored")
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case text := <-texts:
+			if strings.HasPrefix(text, "yes") {
+				return
+			}
+		case <-timeout:
+			t.Fatal("module not refreshed")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"openbar"
+)
+
+// What the blocks of failing modules may show.
+var displays = map[string]openbar.ErrorDisplay{
+	"output":      openbar.ErrorOutput,
+	"error":       openbar.ErrorMessage,
+	"placeholder": openbar.ErrorPlaceholder,
+	"keep":        openbar.ErrorKeep,
+	"blank":       openbar.ErrorBlank,
+}
+
+// OnError tells what the block of a failing module shows: what it printed
+// along with the error ("output", the default), the "error" itself, a
+// "placeholder", the last value without error ("keep") or nothing ("blank").
+// The short form "on_error": "keep" only chooses what is shown, and the long
+// one "on_error": {"show": "placeholder", "placeholder": "n/a"} sets the
+// placeholder too.
+type OnError struct {
+	Show        string `json:"show"`
+	Placeholder string `json:"placeholder"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler for OnError so that a display
+// alone is enough.
+func (o *OnError) UnmarshalJSON(data []byte) error {
+	var show string
+	if err := json.Unmarshal(data, &show); err == nil {
+		*o = OnError{Show: show}
+		return nil
+	}
+
+	type plain OnError
+	return json.Unmarshal(data, (*plain)(o))
+}
+
+// Convert the setting to its runtime counterpart.
+func (o OnError) convert() (openbar.ErrorPolicy, error) {
+	d, ok := displays[o.Show]
+	if !ok && o.Show != "" {
+		return openbar.ErrorPolicy{}, fmt.Errorf("on_error: unknown display: %s", o.Show)
+	}
+	return openbar.ErrorPolicy{Display: d, Placeholder: o.Placeholder}, nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar/location"
+	"openbar/modules"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAllow is the list of directories commands may live in when hardening
+// is enabled and no other list is given.
+var DefaultAllow = []string{"/usr/bin", "/bin", "/usr/local/bin"}
+
+// ErrInsecure is returned when the configuration does not pass hardening checks.
+var ErrInsecure = errors.New("insecure configuration")
+
+// Harden refuses configurations that could be used to run arbitrary programs on
+// shared or locked-down machines: the file must not be world-writable and every
+// command, including those run on click, by alerts, by built-in modules and by
+// global sections like the location, must resolve to an executable inside one
+// of the allowed directories. So must the given commands, which the bar runs
+// besides those of the configuration, like the one of its backend. Symbolic
+// links are resolved on both sides so a link planted in an allowed directory
+// can't point elsewhere.
+func Harden(path string, f *File, allow []string, extra ...[]string) error {
+	info, err := os.Stat(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Perm()&0o002 != 0 {
+		return fmt.Errorf("%w: %s is world-writable", ErrInsecure, path)
+	}
+
+	dirs := make([]string, 0, len(allow))
+	for _, dir := range allow {
+		// Ignore directories that don't exist on this system.
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			dirs = append(dirs, real)
+		}
+	}
+
+	commands, err := f.commands()
+	if err != nil {
+		return err
+	}
+
+	for _, args := range append(commands, extra...) {
+		if len(args) == 0 {
+			continue
+		}
+
+		bin, err := resolve(args[0])
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInsecure, err)
+		}
+
+		if !within(filepath.Dir(bin), dirs) {
+			return fmt.Errorf("%w: %s is not in an allowed directory", ErrInsecure, bin)
+		}
+	}
+
+	return nil
+}
+
+// List the commands the configuration may run, those of its modules and of its
+// global sections.
+func (f *File) commands() ([][]string, error) {
+	res := make([][]string, 0)
+
+	if l := f.Location; l != nil && l.Provider == "geoclue" {
+		args := l.Command
+		if len(args) == 0 {
+			args = location.DefaultCommand
+		}
+		res = append(res, args)
+	}
+
+	for _, e := range f.Modules {
+		commands, err := e.commands()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, commands...)
+	}
+
+	return res, nil
+}
+
+// List the commands an entry may run, including those run on click, by its
+// alert and by its module.
+func (e Entry) commands() ([][]string, error) {
+	res := [][]string{e.Command}
+	for _, args := range e.OnClick {
+		res = append(res, args)
+	}
+
+	if e.Alert != nil {
+		res = append(res, e.Alert.Command)
+	}
+
+	if e.Module != "" {
+		options := e.Options
+		if len(options) == 0 {
+			options = json.RawMessage("{}")
+		}
+		commands, err := modules.Commands(e.Module, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Module, err)
+		}
+		res = append(res, commands...)
+	}
+
+	return res, nil
+}
+
+// Find the real location of the executable the command would run.
+func resolve(name string) (string, error) {
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(bin)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// Tell if a directory is one of the given directories or one of their children.
+func within(dir string, dirs []string) bool {
+	for _, d := range dirs {
+		if dir == d || strings.HasPrefix(dir, d+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,356 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"openbar"
+	"openbar/modules"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Severity tells whether a diagnostic prevents the bar from working.
+type Severity int
+
+const (
+	// Warning is a likely mistake the bar can live with.
+	Warning Severity = iota
+	// Error is a problem preventing the bar from starting or a module from
+	// ever working.
+	Error
+)
+
+// String implements fmt.Stringer.
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found in a configuration along with a hint on how to
+// fix it. Module is the index of the module concerned, or negative for global
+// settings.
+type Diagnostic struct {
+	Severity Severity
+	Module   int
+	Name     string
+	Message  string
+	Hint     string
+}
+
+// String implements fmt.Stringer.
+func (d Diagnostic) String() string {
+	where := "configuration"
+	if d.Module >= 0 {
+		where = fmt.Sprintf("module %d (%s)", d.Module, d.Name)
+	}
+	res := fmt.Sprintf("%s: %s: %s", d.Severity, where, d.Message)
+	if d.Hint != "" {
+		res += "\n  hint: " + d.Hint
+	}
+	return res
+}
+
+// Lint looks for mistakes in a configuration. When run is set, each module is
+// executed once to compare how long it takes with its interval, except manual
+// modules.
+func Lint(f *File, run bool) []Diagnostic {
+	res := make([]Diagnostic, 0)
+
+	// Global settings are checked on their own, modules are checked below.
+	global := *f
+	global.Modules = nil
+
+	if _, err := global.Options(); err != nil {
+		res = append(res, Diagnostic{Error, -1, "", err.Error(), "fix the setting, the bar won't start"})
+	}
+
+	res = append(res, f.lintSignals()...)
+	res = append(res, f.lintTheme()...)
+
+	client, err := f.HTTP.client()
+	if err != nil {
+		client = http.DefaultClient
+	}
+
+	// Errors in the location are reported with global settings.
+	where, _ := f.Location.provider()
+	broker, _ := f.MQTT.broker()
+
+	env := modules.Env{HTTP: client, Location: where, MQTT: broker}
+
+	for i, e := range f.Modules {
+		res = append(res, e.lint(i, env, run, f.Clicks())...)
+		if _, err := f.style(e); errors.Is(err, ErrColor) {
+			res = append(res, Diagnostic{Error, i, e.name(), err.Error(), "use #RRGGBB or a color of the theme"})
+		} else if errors.Is(err, ErrAlign) {
+			res = append(res, Diagnostic{Error, i, e.name(), err.Error(), "use left, center or right"})
+		} else if err != nil {
+			res = append(res, Diagnostic{Error, i, e.name(), err.Error(), "define the preset under presets"})
+		}
+		if _, err := e.format(f.Icons); err != nil {
+			res = append(res, Diagnostic{Error, i, e.name(), err.Error(), "fix the template"})
+		}
+		if _, err := pango(e.Markup); err != nil {
+			res = append(res, Diagnostic{Error, i, e.name(), err.Error(), "use pango or none"})
+		}
+		if e.Confirm != nil && !f.Clicks() {
+			res = append(res, Diagnostic{Warning, i, e.name(), "confirm is set but click events are disabled",
+				"set \"click_events\": true or remove confirm"})
+		}
+		if len(e.OnClick) == 0 {
+			continue
+		}
+		if _, err := e.clicks(); err != nil {
+			res = append(res, Diagnostic{Error, i, e.name(), err.Error(), "use left, middle, right, up, down, back or forward"})
+		} else if !f.Clicks() {
+			res = append(res, Diagnostic{Warning, i, e.name(), "on_click is set but click events are disabled",
+				"set \"click_events\": true or remove the handler"})
+		}
+	}
+
+	return res
+}
+
+// Reload signals must be usable and distinct.
+func (f *File) lintSignals() []Diagnostic {
+	res := make([]Diagnostic, 0)
+
+	owners := map[syscall.Signal]string{syscall.SIGUSR1: "the broadcast reload"}
+	if f.StopSignal != nil && *f.StopSignal != 0 {
+		owners[syscall.Signal(*f.StopSignal)] = "stop_signal"
+	}
+	if f.ContSignal != nil && *f.ContSignal != 0 {
+		owners[syscall.Signal(*f.ContSignal)] = "cont_signal"
+	}
+
+	// Some signals can't be given to modules at all: the bar can't catch them
+	// or already uses them, like the signals of the header, set or not. An
+	// unknown protocol is reported on its own.
+	header, _ := f.header()
+
+	// Signals given to modules are claimed first: they don't move, unlike
+	// those given by positions.
+	for i, e := range f.Modules {
+		if e.Signal == nil || *e.Signal == 0 {
+			continue
+		}
+
+		sig := syscall.Signal(*e.Signal)
+
+		if why := openbar.Reserved(sig, header...); why != "" {
+			res = append(res, Diagnostic{Error, i, e.name(), fmt.Sprintf("signal %d %s", sig, why), "use a signal like SIGRTMIN+5"})
+			continue
+		}
+
+		if owner, ok := owners[sig]; ok {
+			res = append(res, Diagnostic{
+				Warning, i, e.name(),
+				fmt.Sprintf("signal %d is shared with %s", sig, owner),
+				"pick a signal no module uses",
+			})
+			continue
+		}
+
+		owners[sig] = fmt.Sprintf("module %d", i)
+	}
+
+	for i, e := range f.Modules {
+		if e.Signal != nil {
+			continue
+		}
+
+		sig := openbar.ReloadSignal(i)
+
+		if sig > sigRtMax {
+			res = append(res, Diagnostic{
+				Warning, i, e.name(),
+				fmt.Sprintf("reload signal %d is past SIGRTMAX", sig),
+				"move the module up, set its signal or refresh it with openbar ctl reload",
+			})
+			continue
+		}
+
+		if owner, ok := owners[sig]; ok {
+			res = append(res, Diagnostic{
+				Warning, i, e.name(),
+				fmt.Sprintf("reload signal %d is shared with %s", sig, owner),
+				"reorder modules, set their signal or change the conflicting signal",
+			})
+			continue
+		}
+
+		owners[sig] = fmt.Sprintf("module %d", i)
+	}
+
+	// Groups come in a stable order so that diagnostics do too.
+	groups := make([]string, 0, len(f.Groups))
+	for g := range f.Groups {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+
+	for _, g := range groups {
+		sig := syscall.Signal(f.Groups[g])
+
+		empty := true
+		for _, e := range f.Modules {
+			if e.Group == g {
+				empty = false
+			}
+		}
+
+		switch owner, taken := owners[sig]; {
+		case empty:
+			res = append(res, Diagnostic{Warning, -1, "", fmt.Sprintf("group %s has no module", g), `set "group" on its modules`})
+		case sig == 0 || sig > sigRtMax:
+			res = append(res, Diagnostic{Error, -1, "", fmt.Sprintf("group %s: signal %d can't be sent", g, sig), "use a signal like SIGRTMIN+20"})
+		case taken:
+			res = append(res, Diagnostic{Warning, -1, "", fmt.Sprintf("group %s: signal %d is shared with %s", g, sig, owner), "pick a signal no module uses"})
+		default:
+			owners[sig] = "group " + g
+		}
+	}
+
+	return res
+}
+
+// Colors of the theme should be used somewhere.
+func (f *File) lintTheme() []Diagnostic {
+	res := make([]Diagnostic, 0)
+
+	used := make(map[string]bool)
+	mark := func(colors ...string) {
+		for _, c := range colors {
+			used[c] = true
+		}
+	}
+
+	if h := f.Highlight; h != nil {
+		mark(h.Color, h.Background, h.Border)
+	}
+
+	layers := []json.RawMessage{f.Defaults}
+	for _, p := range f.Presets {
+		layers = append(layers, p)
+	}
+	for _, l := range layers {
+		if b, err := merge(l); err == nil {
+			mark(b.Color, b.Background, b.Border)
+		}
+	}
+
+	// Colors used by other bars count as well.
+	entries := append([]Entry(nil), f.Modules...)
+	for _, e := range f.Shared {
+		entries = append(entries, e)
+	}
+	for _, b := range f.Bars {
+		entries = append(entries, b.Modules...)
+	}
+	for _, e := range entries {
+		mark(e.Color, e.Background, e.Border)
+	}
+
+	for _, name := range f.Theme.names() {
+		if !used[name] {
+			res = append(res, Diagnostic{
+				Warning, -1, "",
+				fmt.Sprintf("theme color %s is never used", name),
+				"remove it or refer to it from a module, a preset or the defaults",
+			})
+		}
+	}
+
+	return res
+}
+
+// Check a single module, whose block is expected to react to clicks when
+// clicked is set.
+func (e Entry) lint(i int, env modules.Env, run, clicked bool) []Diagnostic {
+	res := make([]Diagnostic, 0)
+
+	broken := false
+	diag := func(s Severity, msg, hint string) {
+		res = append(res, Diagnostic{s, i, e.name(), msg, hint})
+		broken = broken || s == Error
+	}
+
+	if len(e.Command) > 0 {
+		if _, err := exec.LookPath(e.Command[0]); err != nil {
+			diag(Error, fmt.Sprintf("command %s not found", e.Command[0]), "install it or use an absolute path")
+		}
+	}
+
+	interval, err := e.interval()
+	if err != nil {
+		diag(Error, fmt.Sprintf("invalid interval: %v", err), `use a duration like "30s"`)
+	}
+
+	if e.Schedule != "" && e.Interval != "" {
+		diag(Warning, "interval is ignored with a schedule", "remove the interval")
+	}
+
+	if e.Timeout != "" && err == nil && !e.Manual && e.Schedule == "" && !e.streams() {
+		if d, err := time.ParseDuration(e.Timeout); err == nil && d > interval {
+			diag(Warning, fmt.Sprintf("timeout %v is longer than interval %v", d, interval),
+				"lower the timeout so that slow runs are killed before the next one")
+		}
+	}
+
+	if _, err := e.options(); err != nil {
+		diag(Error, err.Error(), "fix the module settings")
+	}
+
+	// Files may not exist yet but their directory must.
+	for _, path := range e.Watch {
+		path = expand(path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Dir(path)); err != nil {
+			diag(Warning, fmt.Sprintf("watch: %v", err), "create the directory or fix the path")
+		}
+	}
+
+	module, err := build(env, e)
+	if err != nil {
+		diag(Error, err.Error(), "fix the module settings")
+	}
+
+	if clicked && len(e.OnClick) == 0 && !broken {
+		switch module.(type) {
+		case openbar.ClickHandler, openbar.Adjuster:
+		default:
+			diag(Warning, "clicks are enabled but nothing handles them", "set on_click or use a module reacting to clicks")
+		}
+	}
+
+	// Manual modules are costly by definition so they are never run, and
+	// modules pushing their values have no run to time.
+	if !run || e.Manual || e.streams() || broken {
+		return res
+	}
+
+	start := time.Now()
+	_, err = module.FullText()
+	took := time.Since(start)
+
+	if err != nil {
+		diag(Warning, fmt.Sprintf("failed: %v", err), "run it by hand to see what is wrong")
+	}
+
+	if e.Schedule == "" && took > interval/2 {
+		diag(Warning, fmt.Sprintf("took %v to run with an interval of %v", took.Round(time.Millisecond), interval),
+			"raise the interval, make it a manual module or give it a spinner")
+	}
+
+	return res
+}
@@ -0,0 +1,203 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"openbar"
+	"openbar/config"
+	"openbar/modules"
+	"strings"
+	"testing"
+)
+
+// A module handling clicks.
+type clicked struct{}
+
+func (clicked) FullText() (string, error) {
+	return "", nil
+}
+
+func (clicked) Click(openbar.Click) error {
+	return nil
+}
+
+func init() {
+	modules.Register(modules.Info{Name: "clicked", Description: "module handling clicks"}, func(modules.Env, json.RawMessage) (openbar.Module, error) {
+		return clicked{}, nil
+	})
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		data  string
+		run   bool
+		diags []string
+	}{
+		{
+			data:  `[{"command": ["date"], "interval": "1s"}]`,
+			run:   true,
+			diags: []string{},
+		},
+		{
+			data:  `[{"command": ["openbar-nonexistent"], "interval": "1s"}]`,
+			diags: []string{"error: module 0 (openbar-nonexistent): command openbar-nonexistent not found"},
+		},
+		{
+			data:  `{"cont_signal": 35, "modules": [{"command": ["date"], "interval": "1s"}]}`,
+			diags: []string{"warning: module 0 (date): reload signal 35 is shared with cont_signal"},
+		},
+		{
+			data:  `[{"command": ["sleep", "0.6"], "interval": "1s", "timeout": "2s"}]`,
+			run:   true,
+			diags: []string{"warning: module 0 (sleep): timeout 2s is longer than interval 1s", "warning: module 0 (sleep): took"},
+		},
+		{
+			data:  `{"protocol": "dbus", "modules": [{"command": ["date"], "interval": "soon"}]}`,
+			diags: []string{"error: configuration: unknown protocol: dbus", "error: module 0 (date): invalid interval"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "on_click": {"wheel": ["true"]}}]`,
+			diags: []string{"error: module 0 (date): on_click: unknown button: wheel"},
+		},
+		{
+			data:  `{"click_events": true, "modules": [{"command": ["date"], "interval": "1s", "confirm": {"buttons": ["wheel"]}}]}`,
+			diags: []string{"error: module 0 (date): confirm: unknown button: wheel"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "scroll": {"step": 2, "within": "fast"}}]`,
+			diags: []string{"error: module 0 (date): scroll: time: invalid duration"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "on_error": "ignore"}]`,
+			diags: []string{"error: module 0 (date): on_error: unknown display: ignore"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "trend": "up"}]`,
+			diags: []string{"error: module 0 (date): unknown trend: up"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "alert": "value > hot"}]`,
+			diags: []string{"error: module 0 (date): alert: invalid rule: value > hot: invalid number: hot"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "alert": {"when": "value > 1"}}]`,
+			diags: []string{"error: module 0 (date): alert: nothing to do"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "format": "{{pad 4 .}"}]`,
+			diags: []string{"error: module 0 (date): format: template: format:1: bad character"},
+		},
+		{
+			data:  `{"click_events": false, "modules": [{"command": ["date"], "interval": "1s", "on_click": {"left": ["true"]}}]}`,
+			diags: []string{"warning: module 0 (date): on_click is set but click events are disabled"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "on_click": {"left": ["true"]}}]`,
+			diags: []string{"warning: module 0 (date): on_click is set but click events are disabled"},
+		},
+		{
+			data:  `{"click_events": true, "modules": [{"command": ["date"], "interval": "1s"}, {"command": ["date"], "interval": "1s", "on_click": {"left": ["true"]}}, {"module": "clicked", "interval": "1s"}]}`,
+			diags: []string{"warning: module 0 (date): clicks are enabled but nothing handles them"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "confirm": {}}, {"command": ["date"], "interval": "1s"}]`,
+			diags: []string{"warning: module 0 (date): confirm is set but click events are disabled"},
+		},
+		{
+			data:  `{"click_events": true, "modules": [{"command": ["date"], "interval": "1s", "confirm": {}, "on_click": {"left": ["true"]}}]}`,
+			diags: []string{},
+		},
+		{
+			data:  `{"markup": "pango", "modules": [{"command": ["date"], "interval": "1s", "markup": "html"}]}`,
+			diags: []string{"error: module 0 (date): unknown markup: html"},
+		},
+		{
+			data:  `{"groups": {"net": "SIGRTMIN+1"}, "modules": [{"command": ["date"], "interval": "1s", "group": "net"}]}`,
+			diags: []string{"warning: configuration: group net: signal 35 is shared with module 0"},
+		},
+		{
+			data:  `{"groups": {"net": "SIGRTMAX-4"}, "modules": [{"command": ["date"], "interval": "1s"}]}`,
+			diags: []string{"warning: configuration: group net has no module"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s"}, {"command": ["date"], "interval": "1s", "signal": "SIGRTMIN+1"}]`,
+			diags: []string{"warning: module 0 (date): reload signal 35 is shared with module 1"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "signal": "USR1"}, {"command": ["date"], "interval": "1s", "signal": 70}]`,
+			diags: []string{"error: module 0 (date): signal 10 refreshes every module", "error: module 1 (date): signal 70 can't be sent"},
+		},
+		{
+			data:  `{"protocol": "i3", "modules": [{"command": ["date"], "interval": "1s", "signal": "TERM"}, {"command": ["date"], "interval": "1s", "signal": "TSTP"}, {"command": ["date"], "interval": "1s", "signal": 9}]}`,
+			diags: []string{"error: module 0 (date): signal 15 stops the bar", "error: module 1 (date): signal 20 hides or shows the bar", "error: module 2 (date): signal 9 can't be caught"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "signal": "TSTP"}, {"command": ["date"], "interval": "1s", "signal": "RTMIN+5"}, {"command": ["date"], "interval": "1s", "signal": "RTMIN+5"}]`,
+			diags: []string{"warning: module 2 (date): signal 39 is shared with module 1"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "signal": "none"}, {"command": ["date"], "interval": "1s", "signal": "SIGRTMIN+1"}]`,
+			diags: []string{},
+		},
+		{
+			data:  `[{"command": ["date"], "schedule": "0 7 * * *"}]`,
+			run:   true,
+			diags: []string{},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1h", "schedule": "0 25 * * *"}]`,
+			diags: []string{"warning: module 0 (date): interval is ignored with a schedule", "error: module 0 (date): invalid schedule: 0 25 * * *: want 0-23, got: 25"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "active": ["weekdays"]}]`,
+			diags: []string{"error: module 0 (date): invalid window: weekdays: unknown day: weekdays"},
+		},
+		{
+			data:  `{"location": {"provider": "gps"}, "modules": [{"command": ["date"], "interval": "1s"}]}`,
+			diags: []string{"error: configuration: location: unknown provider: gps"},
+		},
+		{
+			data:  `{"mqtt": {"broker": "localhost", "commands": true}, "modules": [{"command": ["date"], "interval": "1s"}]}`,
+			diags: []string{"error: configuration: mqtt: commands need a prefix to publish to"},
+		},
+		{
+			data:  `[{"command": ["date"], "interval": "1s", "watch": ["/tmp/todo.txt", "/openbar-nonexistent/new"]}]`,
+			diags: []string{"warning: module 0 (date): watch: stat /openbar-nonexistent"},
+		},
+		{
+			data: `{
+				"theme": {"colors": {"warning": "#ffff00", "accent": "#0000ff", "critical": "#ff0000"}},
+				"presets": {"alert": {"background": "critical"}},
+				"modules": [
+					{"command": ["date"], "interval": "1s", "color": "accent"},
+					{"command": ["date"], "interval": "1s", "color": "info"}
+				]
+			}`,
+			diags: []string{
+				"warning: configuration: theme color warning is never used",
+				"error: module 1 (date): color: invalid color: info",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			f, err := config.Parse([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diags := config.Lint(f, test.run)
+
+			if len(diags) != len(test.diags) {
+				t.Fatalf("want: %d diagnostics, got: %v", len(test.diags), diags)
+			}
+
+			for j, d := range diags {
+				if !strings.HasPrefix(d.String(), test.diags[j]) {
+					t.Errorf("want: %q, got: %q", test.diags[j], d)
+				}
+			}
+		})
+	}
+}
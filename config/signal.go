@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Real-time signals on Linux. Signals past SIGRTMAX can't be sent.
+const (
+	sigRtMin = 34
+	sigRtMax = 64
+)
+
+// Signal is a signal number that can be written either as an integer or as a
+// name such as "SIGTSTP" or "TSTP" in the configuration file, real-time ones
+// being written like "SIGRTMIN+3" or "RTMAX-1". "SIG0", "0" and "none" all
+// mean no signal at all.
+type Signal syscall.Signal
+
+var signals = map[string]syscall.Signal{
+	"NONE":  0,
+	"0":     0,
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"TERM":  syscall.SIGTERM,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Signal.
+func (s *Signal) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Signal(n)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	upper := strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	sig, ok := signals[upper]
+	if !ok {
+		if sig, ok = realtime(upper); !ok {
+			return fmt.Errorf("unknown signal: %s", name)
+		}
+	}
+
+	*s = Signal(sig)
+
+	return nil
+}
+
+// Read the name of a real-time signal, like "RTMIN+3", without its prefix.
+// Offsets count up from SIGRTMIN and down from SIGRTMAX.
+func realtime(name string) (syscall.Signal, bool) {
+	var base int
+	var sep string
+	switch {
+	case strings.HasPrefix(name, "RTMIN"):
+		base, sep = sigRtMin, "+"
+	case strings.HasPrefix(name, "RTMAX"):
+		base, sep = sigRtMax, "-"
+	default:
+		return 0, false
+	}
+
+	offset := 0
+	if rest := name[len("RTMIN"):]; rest != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(rest, sep))
+		if !strings.HasPrefix(rest, sep) || err != nil || n < 0 {
+			return 0, false
+		}
+		offset = n
+	}
+
+	sig := base + offset
+	if sep == "-" {
+		sig = base - offset
+	}
+	if sig > sigRtMax || sig < sigRtMin {
+		return 0, false
+	}
+
+	return syscall.Signal(sig), true
+}
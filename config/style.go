@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"regexp"
+	"sort"
+)
+
+// Compute the style of the block of an entry. Attributes of its preset take
+// precedence over the defaults, and the colors, width and alignment of the
+// entry itself over both.
+// Colors naming a color of the theme are resolved by the bar.
+func (f *File) style(e Entry) (openbar.Block, error) {
+	layers := []json.RawMessage{f.Defaults}
+
+	if e.Preset != "" {
+		p, ok := f.Presets[e.Preset]
+		if !ok {
+			return openbar.Block{}, fmt.Errorf("unknown preset: %s", e.Preset)
+		}
+		layers = append(layers, p)
+	}
+
+	res, err := merge(layers...)
+	if err != nil {
+		return openbar.Block{}, err
+	}
+
+	for _, c := range []struct {
+		name  string
+		value string
+		attr  *string
+	}{
+		{"color", e.Color, &res.Color},
+		{"background", e.Background, &res.Background},
+		{"border", e.Border, &res.Border},
+	} {
+		if c.value == "" {
+			continue
+		}
+		if !f.Theme.valid(c.value) {
+			return openbar.Block{}, fmt.Errorf("%s: %w: %s", c.name, ErrColor, c.value)
+		}
+		*c.attr = c.value
+	}
+
+	if e.MinWidth != nil {
+		res.MinWidth = e.MinWidth
+	}
+
+	switch e.Align {
+	case "":
+	case openbar.AlignLeft, openbar.AlignCenter, openbar.AlignRight:
+		res.Align = e.Align
+	default:
+		return openbar.Block{}, fmt.Errorf("%w: %s", ErrAlign, e.Align)
+	}
+
+	return res, nil
+}
+
+// ErrColor is returned for colors sway wouldn't understand.
+var ErrColor = errors.New("invalid color")
+
+// ErrAlign is returned for alignments other than left, center and right.
+var ErrAlign = errors.New("unknown align")
+
+// Colors are #RRGGBB or #RRGGBBAA, like swaybar-protocol(7) wants them, unless
+// they name a color of the theme.
+var color = regexp.MustCompile(`^#[0-9a-fA-F]{6}([0-9a-fA-F]{2})?$`)
+
+// Check the defaults and every preset, used or not.
+func (f *File) checkStyles() error {
+	if _, err := merge(f.Defaults); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+
+	names := make([]string, 0, len(f.Presets))
+	for name := range f.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := merge(f.Presets[name]); err != nil {
+			return fmt.Errorf("preset %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Merge objects of block attributes, the last ones winning. The text of a block
+// always comes from its module.
+func merge(layers ...json.RawMessage) (openbar.Block, error) {
+	attrs := make(map[string]json.RawMessage)
+
+	for _, l := range layers {
+		if len(l) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(l, &attrs); err != nil {
+			return openbar.Block{}, errors.New("block attributes must be an object")
+		}
+	}
+
+	if _, ok := attrs["full_text"]; ok {
+		return openbar.Block{}, errors.New("full_text comes from the module")
+	}
+
+	raw, err := json.Marshal(attrs)
+	if err != nil {
+		return openbar.Block{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	var res openbar.Block
+	if err := dec.Decode(&res); err != nil {
+		return openbar.Block{}, fmt.Errorf("invalid block attributes: %w", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"openbar"
+	"sort"
+)
+
+// Theme is the palette of the bar along with its separators and padding. Colors
+// of modules, presets, defaults and highlight may name one of its colors.
+type Theme struct {
+	Colors              map[string]string `json:"colors"`
+	Separator           *bool             `json:"separator"`
+	SeparatorBlockWidth *int              `json:"separator_block_width"`
+	Padding             int               `json:"padding"`
+}
+
+// Convert a theme to its bar counterpart. Colors of the theme itself must be
+// hex codes.
+func (t *Theme) convert() (openbar.Theme, error) {
+	if t == nil {
+		return openbar.Theme{}, nil
+	}
+
+	for _, name := range t.names() {
+		if c := t.Colors[name]; !color.MatchString(c) {
+			return openbar.Theme{}, fmt.Errorf("theme: %s: %w: %s", name, ErrColor, c)
+		}
+	}
+
+	if t.Padding < 0 {
+		return openbar.Theme{}, fmt.Errorf("theme: negative padding: %d", t.Padding)
+	}
+
+	return openbar.Theme{
+		Colors:              t.Colors,
+		Separator:           t.Separator,
+		SeparatorBlockWidth: t.SeparatorBlockWidth,
+		Padding:             t.Padding,
+	}, nil
+}
+
+// Return the names of the colors, sorted.
+func (t *Theme) names() []string {
+	if t == nil {
+		return nil
+	}
+	res := make([]string, 0, len(t.Colors))
+	for name := range t.Colors {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Tell whether a color is a hex code or a color of the theme.
+func (t *Theme) valid(c string) bool {
+	if color.MatchString(c) {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	_, ok := t.Colors[c]
+	return ok
+}
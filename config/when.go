@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrCondition is returned when the condition of an entry can't be evaluated.
+var ErrCondition = errors.New("invalid condition")
+
+// Where the kernel lists power supplies.
+const powerSupplies = "/sys/class/power_supply"
+
+// Values conditions can compare.
+var variables = map[string]func() (string, error){
+	"hostname": os.Hostname,
+	"user": func() (string, error) {
+		return os.Getenv("USER"), nil
+	},
+}
+
+// Functions conditions can call with a single string.
+var functions = map[string]func(string) bool{
+	"exists": func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	},
+	"command": func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	},
+}
+
+// Facts conditions can test on their own.
+var facts = map[string]func() bool{
+	"on_battery": onBattery,
+}
+
+// Evaluate a condition. It is either a fact like on_battery, a call like
+// exists('/path') or a comparison like hostname == 'laptop', optionally negated
+// with a leading !.
+func holds(cond string) (bool, error) {
+	cond = strings.TrimSpace(cond)
+
+	if strings.HasPrefix(cond, "!") && !strings.HasPrefix(cond, "!=") {
+		ok, err := holds(cond[1:])
+		return !ok, err
+	}
+
+	for _, op := range []string{"==", "!="} {
+		parts := strings.SplitN(cond, op, 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		get, ok := variables[strings.TrimSpace(parts[0])]
+		if !ok {
+			return false, fmt.Errorf("%w: unknown variable %q", ErrCondition, strings.TrimSpace(parts[0]))
+		}
+
+		want, err := literal(parts[1])
+		if err != nil {
+			return false, err
+		}
+
+		got, err := get()
+		if err != nil {
+			return false, err
+		}
+
+		return (got == want) == (op == "=="), nil
+	}
+
+	if i := strings.IndexByte(cond, 0x28); i > 0 && strings.HasSuffix(cond, ")") {
+		f, ok := functions[strings.TrimSpace(cond[:i])]
+		if !ok {
+			return false, fmt.Errorf("%w: unknown function %q", ErrCondition, strings.TrimSpace(cond[:i]))
+		}
+
+		arg, err := literal(cond[i+1 : len(cond)-1])
+		if err != nil {
+			return false, err
+		}
+
+		return f(arg), nil
+	}
+
+	f, ok := facts[cond]
+	if !ok {
+		return false, fmt.Errorf("%w: unknown fact %q", ErrCondition, cond)
+	}
+
+	return f(), nil
+}
+
+// Parse a quoted string.
+func literal(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != 0x27 && s[0] != 0x22) {
+		return "", fmt.Errorf("%w: %s is not a quoted string", ErrCondition, s)
+	}
+	return s[1 : len(s)-1], nil
+}
+
+// Tell whether the machine has a mains adapter that is unplugged. Machines
+// without one, like desktops, are never on battery.
+func onBattery() bool {
+	dirs, err := filepath.Glob(filepath.Join(powerSupplies, "*"))
+	if err != nil {
+		return false
+	}
+
+	for _, dir := range dirs {
+		kind, err := os.ReadFile(filepath.Join(dir, "type"))
+		if err != nil || strings.TrimSpace(string(kind)) != "Mains" {
+			continue
+		}
+
+		online, err := os.ReadFile(filepath.Join(dir, "online"))
+		if err == nil && strings.TrimSpace(string(online)) == "0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the lowest charge of the batteries, in percent. The level is full
+// while the machine is plugged in or has no battery so that low-power mode only
+// engages when energy actually runs out.
+func batteryLevel() (int, error) {
+	if !onBattery() {
+		return 100, nil
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(powerSupplies, "*"))
+	if err != nil {
+		return 0, err
+	}
+
+	level := 100
+
+	for _, dir := range dirs {
+		kind, err := os.ReadFile(filepath.Join(dir, "type"))
+		if err != nil || strings.TrimSpace(string(kind)) != "Battery" {
+			continue
+		}
+
+		capacity, err := os.ReadFile(filepath.Join(dir, "capacity"))
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(string(capacity)))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", dir, err)
+		}
+
+		if n < level {
+			level = n
+		}
+	}
+
+	return level, nil
+}
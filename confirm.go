@@ -0,0 +1,91 @@
+package openbar
+
+import "time"
+
+// Confirmation makes clicks on a block take effect only when repeated, for
+// actions that are hard to undo like disconnecting a VPN or killing a process.
+// The first click replaces the text of the block with the prompt, and the
+// block goes back to its value if the second one doesn't come in time.
+type Confirmation struct {
+	// Buttons are those needing confirmation, all of them when empty.
+	Buttons []int
+	// Within is how long the second click may take. Defaults to 3 seconds.
+	Within time.Duration
+	// Prompt is the text of the block meanwhile. Defaults to "confirm?".
+	Prompt string
+}
+
+var defaultConfirmation = Confirmation{Within: 3 * time.Second, Prompt: "confirm?"}
+
+// Confirmer is implemented by modules knowing which of their clicks are hard to
+// undo, like the one shutting the machine down. Confirm tells whether a click
+// needs confirmation and what the block shows meanwhile. Modules configured
+// with Confirm are not asked.
+type Confirmer interface {
+	Confirm(c Click) (prompt string, ok bool)
+}
+
+// Return how a click on a cell is confirmed, or nil if it goes through.
+func (c cell) confirmation(e Click) *Confirmation {
+	if c.confirm != nil {
+		if !c.confirm.covers(e.Button) {
+			return nil
+		}
+		return c.confirm
+	}
+	if cf, ok := c.source().(Confirmer); ok {
+		if prompt, ok := cf.Confirm(e); ok {
+			if prompt == "" {
+				prompt = defaultConfirmation.Prompt
+			}
+			return &Confirmation{Within: defaultConfirmation.Within, Prompt: prompt}
+		}
+	}
+	return nil
+}
+
+// Tell whether a button needs confirmation.
+func (c Confirmation) covers(button int) bool {
+	if len(c.Buttons) == 0 {
+		return true
+	}
+	for _, b := range c.Buttons {
+		if b == button {
+			return true
+		}
+	}
+	return false
+}
+
+// Clicks waiting to be repeated, by block. Clicks are handled one at a time.
+type confirmations map[int]armed
+
+// A click waiting to be repeated.
+type armed struct {
+	button int
+	until  time.Time
+	timer  *time.Timer
+}
+
+// Tell whether a click on a block takes effect. A first click needing
+// confirmation arms the block and shows the prompt, and expire is called when
+// the second click doesn't come in time. Any other click disarms the block.
+func (a confirmations) confirm(idx int, c Click, conf *Confirmation, prompt func(string), expire func()) bool {
+	prev, ok := a[idx]
+	if ok {
+		prev.timer.Stop()
+		delete(a, idx)
+	}
+
+	switch {
+	case conf == nil:
+		return true
+	case ok && prev.button == c.Button && time.Now().Before(prev.until):
+		return true
+	}
+
+	a[idx] = armed{c.Button, time.Now().Add(conf.Within), time.AfterFunc(conf.Within, expire)}
+	prompt(conf.Prompt)
+
+	return false
+}
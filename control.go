@@ -0,0 +1,281 @@
+package openbar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoModule is returned when addressing a module that does not exist.
+var ErrNoModule = errors.New("no such module")
+
+// ErrNoGroup is returned when addressing a group without modules.
+var ErrNoGroup = errors.New("no such group")
+
+// Status is a snapshot of the state of a module.
+type Status struct {
+	Index    int           `json:"index"`
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Group    string        `json:"group,omitempty"`
+	Text     string        `json:"text"`
+	Updated  time.Time     `json:"updated"`
+	Error    string        `json:"error,omitempty"`
+	Stderr   string        `json:"stderr,omitempty"`
+	Urgent   bool          `json:"urgent,omitempty"`
+	Interval time.Duration `json:"interval"`
+	Disabled bool          `json:"disabled,omitempty"`
+	Value    *Value        `json:"value,omitempty"`
+}
+
+// Stderrer is implemented by modules running processes, to expose what they
+// wrote to standard error during their last run.
+type Stderrer interface {
+	Stderr() string
+}
+
+// MarshalJSON implements json.Marshaler for Status so that the interval is
+// human-readable.
+func (s Status) MarshalJSON() ([]byte, error) {
+	type alias Status
+	return json.Marshal(struct {
+		alias
+		Interval string `json:"interval"`
+	}{alias(s), s.Interval.String()})
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Status.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	type alias Status
+	aux := struct {
+		*alias
+		Interval string `json:"interval"`
+	}{alias: (*alias)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(aux.Interval)
+	if err != nil {
+		return err
+	}
+	s.Interval = d
+	return nil
+}
+
+// Build the status of a module from one of its results.
+func status(res result, c cell) Status {
+	s := Status{
+		Index:    res.idx,
+		ID:       c.id,
+		Name:     c.name,
+		Group:    c.group,
+		Text:     res.out,
+		Updated:  time.Now(),
+		Urgent:   res.urgent,
+		Interval: c.interval,
+		Value:    res.value,
+	}
+	if res.err != nil {
+		s.Error = res.err.Error()
+	}
+	if e, ok := c.source().(Stderrer); ok {
+		s.Stderr = e.Stderr()
+	}
+	return s
+}
+
+// Control gives access to a running bar from other goroutines, for instance to
+// expose its state over a socket.
+type Control struct {
+	mu       sync.Mutex
+	status   []Status
+	modules  []interface{}
+	triggers []chan bool
+	switches []chan switching
+	modes    chan PowerMode
+	low      bool
+	log      eventLog
+}
+
+// NewControl returns a control to be passed to Run with WithControl.
+func NewControl() *Control {
+	return new(Control)
+}
+
+// Status returns a snapshot of every module in display order.
+func (c *Control) Status() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]Status, len(c.status))
+	copy(res, c.status)
+	return res
+}
+
+// Reload refreshes the module at the given index, or all modules if it is
+// negative. Requests made while a refresh is already pending are merged.
+func (c *Control) Reload(idx int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx >= len(c.triggers) {
+		return fmt.Errorf("%w: %d", ErrNoModule, idx)
+	}
+
+	for i, t := range c.triggers {
+		if idx >= 0 && i != idx {
+			continue
+		}
+		select {
+		case t <- (idx < 0):
+		default:
+		}
+	}
+
+	return nil
+}
+
+// ReloadGroup refreshes every module of a group, like a reload of each of them.
+func (c *Control) ReloadGroup(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := false
+	for i, s := range c.status {
+		if s.Group != name || name == "" {
+			continue
+		}
+		found = true
+		select {
+		case c.triggers[i] <- false:
+		default:
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", ErrNoGroup, name)
+	}
+
+	return nil
+}
+
+// Disable stops running the module at the given index until it is enabled
+// again. Its block shows the indicator of the toggle meanwhile.
+func (c *Control) Disable(idx int) error {
+	return c.switchModule(idx, disable)
+}
+
+// Enable runs the module at the given index again after it was disabled, and
+// refreshes it right away.
+func (c *Control) Enable(idx int) error {
+	return c.switchModule(idx, enable)
+}
+
+// Ask a module to switch.
+func (c *Control) switchModule(idx int, s switching) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx < 0 || idx >= len(c.switches) {
+		return fmt.Errorf("%w: %d", ErrNoModule, idx)
+	}
+
+	request(c.switches[idx], s)
+
+	return nil
+}
+
+// SetLowPower changes the power mode of the bar. It can be called before the
+// bar runs.
+func (c *Control) SetLowPower(m PowerMode) error {
+	if _, err := ParsePowerMode(m.String()); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modes := c.powerModes()
+	select {
+	case <-modes:
+	default:
+	}
+	modes <- m
+
+	return nil
+}
+
+// LowPower returns whether the bar currently saves energy.
+func (c *Control) LowPower() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.low
+}
+
+// Return the channel of requested power modes. The caller holds the lock.
+func (c *Control) powerModes() chan PowerMode {
+	if c.modes == nil {
+		c.modes = make(chan PowerMode, 1)
+	}
+	return c.modes
+}
+
+// Lookup returns the index of the module with the given identifier.
+func (c *Control) Lookup(id string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, s := range c.status {
+		if s.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNoModule, id)
+}
+
+// Reset the state to the given cells.
+func (c *Control) init(cells []cell, triggers []chan bool, switches []chan switching) <-chan PowerMode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.triggers, c.switches, c.low = triggers, switches, false
+	c.status = make([]Status, len(cells))
+	c.modules = make([]interface{}, len(cells))
+	for i, cell := range cells {
+		c.status[i] = Status{Index: i, ID: cell.id, Name: cell.name, Group: cell.group, Interval: cell.interval}
+		c.modules[i] = cell.source()
+	}
+	return c.powerModes()
+}
+
+// Record whether the bar saves energy.
+func (c *Control) lowPower(low bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.low = low
+}
+
+// Record a module update. Placeholders and indicators are displayed but they
+// don't count as an update of the module itself.
+func (c *Control) update(res result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &c.status[res.idx]
+	switch res.kind {
+	case pending, disabled:
+		s.Text, s.Disabled = res.out, res.kind == disabled
+		return
+	case done:
+		s.Disabled = false
+	default:
+		return
+	}
+	s.Text, s.Value = res.out, res.value
+	s.Updated, s.Error = time.Now(), ""
+	if res.err != nil {
+		s.Error = res.err.Error()
+	}
+	if e, ok := c.modules[res.idx].(Stderrer); ok {
+		s.Stderr = e.Stderr()
+	}
+	c.log.add(Event{Time: s.Updated, Index: s.Index, ID: s.ID, Name: s.Name, Text: s.Text, Error: s.Error})
+}
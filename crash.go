@@ -0,0 +1,121 @@
+package openbar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// A crash recorder keeps the last frame and the state of modules so that they
+// can be written to a file when the bar crashes, along with the stack traces of
+// all goroutines. A nil recorder does nothing.
+type crashRecorder struct {
+	mu     sync.Mutex
+	dir    string
+	frame  []Block
+	status []Status
+}
+
+// Create a recorder writing to the given directory for the given cells.
+func newCrashRecorder(dir string, cells []cell) *crashRecorder {
+	if dir == "" {
+		return nil
+	}
+	c := &crashRecorder{dir: dir, status: make([]Status, len(cells))}
+	for i, cell := range cells {
+		c.status[i] = Status{Index: i, Name: cell.name, Interval: cell.interval}
+	}
+	return c
+}
+
+// Remember the last frame.
+func (c *crashRecorder) printed(b []Block) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frame = append(c.frame[:0], b...)
+}
+
+// Remember the last state of a module.
+func (c *crashRecorder) update(s Status) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status[s.Index] = s
+}
+
+// Write a crash file if the calling goroutine panics, then panic again. It must
+// be deferred.
+func (c *crashRecorder) guard() {
+	if c == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		debug(c.dump(fmt.Sprintf("panic: %v", r)))
+		panic(r)
+	}
+}
+
+// Write a crash file for the given reason.
+func (c *crashRecorder) dump(reason string) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "openbar crashed at %s\n%s\n\nlast frame:\n", now.Format(time.RFC3339), reason)
+
+	frame, err := json.Marshal(c.frame)
+	if err != nil {
+		return err
+	}
+
+	buf.Write(frame)
+	buf.WriteString("\n\nmodules:\n")
+
+	tw := tabwriter.NewWriter(buf, 0, 4, 2, 0x20, 0)
+	for _, s := range c.status {
+		fmt.Fprintf(tw, "[%d]\t%s\t%q\t%s\t%s\n", s.Index, s.Name, s.Text, s.Updated.Format(time.RFC3339), s.Error)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// Grow the buffer until all stacks fit.
+	stack := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(stack, true)
+		if n < len(stack) {
+			stack = stack[:n]
+			break
+		}
+		stack = make([]byte, 2*len(stack))
+	}
+
+	buf.WriteString("\ngoroutines:\n")
+	buf.Write(stack)
+
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+
+	name := filepath.Join(c.dir, "crash-"+now.Format("20060102T150405.000")+".txt")
+
+	return os.WriteFile(name, buf.Bytes(), 0o600)
+}
@@ -0,0 +1,421 @@
+// Package ctl serves the control of a running bar over a unix socket and
+// provides the matching client. The protocol is one command per connection: the
+// client writes a line of space-separated words and reads JSON lines back.
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"openbar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long a single exchange may take.
+const timeout = 10 * time.Second
+
+// ErrInUse is returned when another bar already serves the socket.
+var ErrInUse = errors.New("socket in use")
+
+// Report is the answer to the status command.
+type Report struct {
+	Modules  []openbar.Status `json:"modules"`
+	Children int              `json:"children"`
+	LowPower bool             `json:"low_power"`
+}
+
+// An ack is the answer to commands that have nothing to return.
+type ack struct {
+	OK bool `json:"ok"`
+}
+
+// A failure is sent instead of the expected answer when a command fails.
+type failure struct {
+	Error string `json:"error"`
+}
+
+// DefaultSocket returns the path of the socket in the user runtime directory.
+func DefaultSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("openbar-%d.sock", os.Getuid()))
+	}
+	return filepath.Join(dir, "openbar.sock")
+}
+
+// BarSocket returns the default path of the socket of a named bar, so that
+// several bars can run side by side. Unnamed bars use DefaultSocket.
+func BarSocket(name string) string {
+	path := DefaultSocket()
+	if name == "" {
+		return path
+	}
+	return strings.TrimSuffix(path, ".sock") + "-" + name + ".sock"
+}
+
+// Server answers commands for a bar.
+type Server struct {
+	Control *openbar.Control
+	// Children counts the processes spawned by modules, if set.
+	Children func() int
+	// Restart asks the bar to re-execute itself, if set. It must not wait for
+	// the restart to happen since the answer is sent once it returns.
+	Restart func() error
+	// Ready is called once the socket accepts connections, if set.
+	Ready func()
+}
+
+// ErrUnsupported is returned for commands the bar was not set up to handle.
+var ErrUnsupported = errors.New("unsupported command")
+
+// Serve listens on the given path until the context is done. A socket left by
+// a previous instance is replaced but a live one is not.
+func (s Server) Serve(ctx context.Context, path string) error {
+	if conn, err := net.DialTimeout("unix", path, timeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrInUse, path)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	if s.Ready != nil {
+		s.Ready()
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Answer one command.
+func (s Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+
+	line, err := bufio.NewReader(conn).ReadString(0x0A)
+	if err != nil {
+		return
+	}
+
+	enc := json.NewEncoder(conn)
+	words := strings.Fields(line)
+
+	// Following events holds the connection until the client leaves.
+	if len(words) == 2 && words[0] == "events" && words[1] == "follow" {
+		s.follow(conn, enc)
+		return
+	}
+
+	if err := s.exec(enc, words); err != nil {
+		_ = enc.Encode(failure{err.Error()})
+	}
+}
+
+// Stream events until the client closes the connection.
+func (s Server) follow(conn net.Conn, enc *json.Encoder) {
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	past, next, stop := s.Control.Follow()
+	defer stop()
+
+	for _, e := range past {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+
+	// Clients don't send anything else, so reading only returns when they leave.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case e := <-next:
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Execute a command and write its answer.
+func (s Server) exec(enc *json.Encoder, words []string) error {
+	if len(words) == 0 {
+		return errors.New("empty command")
+	}
+
+	switch words[0] {
+	case "status":
+		res := Report{Modules: s.Control.Status(), LowPower: s.Control.LowPower()}
+		if s.Children != nil {
+			res.Children = s.Children()
+		}
+		return enc.Encode(res)
+	case "events":
+		for _, e := range s.Control.Events() {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "reload":
+		idx := -1
+		if len(words) > 1 {
+			n, err := s.target(words[1])
+			if err != nil {
+				return err
+			}
+			idx = n
+		}
+		if err := s.Control.Reload(idx); err != nil {
+			return err
+		}
+		return enc.Encode(ack{true})
+	case "reload-group":
+		if len(words) != 2 {
+			return errors.New("usage: reload-group NAME")
+		}
+		if err := s.Control.ReloadGroup(words[1]); err != nil {
+			return err
+		}
+		return enc.Encode(ack{true})
+	case "disable", "enable":
+		if len(words) != 2 {
+			return fmt.Errorf("usage: %s INDEX|ID", words[0])
+		}
+		idx, err := s.target(words[1])
+		if err != nil {
+			return err
+		}
+		toggle := s.Control.Enable
+		if words[0] == "disable" {
+			toggle = s.Control.Disable
+		}
+		if err := toggle(idx); err != nil {
+			return err
+		}
+		return enc.Encode(ack{true})
+	case "restart":
+		if s.Restart == nil {
+			return fmt.Errorf("%w: %s", ErrUnsupported, words[0])
+		}
+		if err := s.Restart(); err != nil {
+			return err
+		}
+		return enc.Encode(ack{true})
+	case "lowpower":
+		if len(words) != 2 {
+			return errors.New("usage: lowpower on|off|auto")
+		}
+		m, err := openbar.ParsePowerMode(words[1])
+		if err != nil {
+			return err
+		}
+		if err := s.Control.SetLowPower(m); err != nil {
+			return err
+		}
+		return enc.Encode(ack{true})
+	default:
+		return fmt.Errorf("unknown command: %s", words[0])
+	}
+}
+
+// Return the index of the module addressed by its index or its identifier.
+func (s Server) target(word string) (int, error) {
+	if n, err := strconv.Atoi(word); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("invalid index: %s", word)
+		}
+		return n, nil
+	}
+	return s.Control.Lookup(word)
+}
+
+// Status asks the bar listening on the given socket for its status.
+func Status(path string) (*Report, error) {
+	res := new(Report)
+	if err := call(path, res, "status"); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload asks the bar listening on the given socket to refresh the module at
+// the given index, or all modules if it is negative.
+func Reload(path string, idx int) error {
+	words := []string{"reload"}
+	if idx >= 0 {
+		words = append(words, strconv.Itoa(idx))
+	}
+	return call(path, new(ack), words...)
+}
+
+// ReloadID asks the bar listening on the given socket to refresh the module
+// with the given identifier.
+func ReloadID(path string, id string) error {
+	return call(path, new(ack), "reload", id)
+}
+
+// ReloadGroup asks the bar listening on the given socket to refresh every
+// module of a group.
+func ReloadGroup(path string, name string) error {
+	return call(path, new(ack), "reload-group", name)
+}
+
+// Disable asks the bar listening on the given socket to stop running the module
+// at the given index until it is enabled again.
+func Disable(path string, idx int) error {
+	return call(path, new(ack), "disable", strconv.Itoa(idx))
+}
+
+// DisableID asks the bar listening on the given socket to stop running the
+// module with the given identifier until it is enabled again.
+func DisableID(path string, id string) error {
+	return call(path, new(ack), "disable", id)
+}
+
+// Enable asks the bar listening on the given socket to run the module at the
+// given index again.
+func Enable(path string, idx int) error {
+	return call(path, new(ack), "enable", strconv.Itoa(idx))
+}
+
+// EnableID asks the bar listening on the given socket to run the module with
+// the given identifier again.
+func EnableID(path string, id string) error {
+	return call(path, new(ack), "enable", id)
+}
+
+// Restart asks the bar listening on the given socket to re-execute itself.
+func Restart(path string) error {
+	return call(path, new(ack), "restart")
+}
+
+// SetLowPower asks the bar listening on the given socket to change its power
+// mode.
+func SetLowPower(path string, m openbar.PowerMode) error {
+	return call(path, new(ack), "lowpower", m.String())
+}
+
+// Events asks the bar listening on the given socket for its last events and
+// passes them to fn. When following, fn also gets new events as they happen
+// until it returns an error.
+func Events(path string, follow bool, fn func(openbar.Event) error) error {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	words := "events"
+	if follow {
+		words += " follow"
+	} else if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(conn, words); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if err := failed(raw); err != nil {
+			return err
+		}
+
+		var e openbar.Event
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// Send a command and decode its answer into v.
+func call(path string, v interface{}, words ...string) error {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(conn, strings.Join(words, " ")); err != nil {
+		return err
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(conn).Decode(&raw); err != nil {
+		return err
+	}
+
+	if err := failed(raw); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+// Return the error of an answer reporting a failure.
+func failed(raw json.RawMessage) error {
+	var f failure
+	if err := json.Unmarshal(raw, &f); err == nil && f.Error != "" {
+		return errors.New(f.Error)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package ctl_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"openbar"
+	"openbar/ctl"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Serve a bar on a socket of its own and return its path once it accepts
+// connections.
+func serve(ctx context.Context, t *testing.T, s ctl.Server) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "openbar.sock")
+	ready, errc := make(chan struct{}), make(chan error, 1)
+	s.Ready = func() { close(ready) }
+
+	go func() { errc <- s.Serve(ctx, path) }()
+
+	select {
+	case <-ready:
+	case err := <-errc:
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	control := openbar.NewControl()
+
+	var once sync.Once
+	updated := make(chan struct{})
+	module := openbar.ModuleFunc(func() (string, error) {
+		return "hello", nil
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithModule(module, time.Hour, openbar.Named("greeting")),
+			openbar.WithUpdateHook(func(openbar.Status) { once.Do(func() { close(updated) }) }),
+		)
+	}()
+
+	socket := serve(ctx, t, ctl.Server{Control: control})
+
+	// The control knows of updates before hooks are called.
+	<-updated
+
+	report, err := ctl.Status(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Modules) != 1 {
+		t.Fatalf("want: 1 module, got: %d", len(report.Modules))
+	}
+
+	got := report.Modules[0]
+
+	if got.Name != "greeting" || got.Text != "hello" || got.Interval != time.Hour {
+		t.Errorf("unexpected status: %+v", got)
+	}
+
+	if got.Updated.IsZero() {
+		t.Error("missing update time")
+	}
+}
+
+func TestReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	control := openbar.NewControl()
+
+	calls := make(chan struct{}, 10)
+	module := openbar.ModuleFunc(func() (string, error) {
+		calls <- struct{}{}
+		return "", nil
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithModule(module, time.Hour, openbar.Identified("clock"), openbar.Group("time")),
+		)
+	}()
+
+	socket := serve(ctx, t, ctl.Server{Control: control})
+
+	<-calls // Initial paint.
+
+	if err := ctl.Reload(socket, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Error("module not reloaded")
+	}
+
+	if err := ctl.ReloadID(socket, "clock"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Error("module not reloaded by identifier")
+	}
+
+	if err := ctl.ReloadGroup(socket, "time"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Error("module not reloaded by group")
+	}
+
+	if err := ctl.Reload(socket, 1); err == nil {
+		t.Error("want error for unknown module")
+	}
+
+	if err := ctl.ReloadGroup(socket, "network"); err == nil {
+		t.Error("want error for unknown group")
+	}
+
+	if err := ctl.ReloadID(socket, "calendar"); err == nil {
+		t.Error("want error for unknown identifier")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	restarted := make(chan struct{}, 1)
+
+	socket := serve(ctx, t, ctl.Server{
+		Control: openbar.NewControl(),
+		Restart: func() error {
+			restarted <- struct{}{}
+			return nil
+		},
+	})
+
+	if err := ctl.Restart(socket); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-restarted:
+	default:
+		t.Error("restart not requested")
+	}
+
+	// Bars that can't restart say so.
+	other := serve(ctx, t, ctl.Server{Control: openbar.NewControl()})
+
+	if err := ctl.Restart(other); err == nil || !strings.Contains(err.Error(), "unsupported command") {
+		t.Errorf("want: unsupported command, got: %v", err)
+	}
+}
+
+func TestLowPower(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	control := openbar.NewControl()
+
+	// The indicator of the mode is shown once the control knows of it.
+	indicated := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithModuleFunc(func() (string, error) { return "", nil }, time.Hour),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				if len(b) == 2 {
+					once.Do(func() { close(indicated) })
+				}
+			}),
+		)
+	}()
+
+	socket := serve(ctx, t, ctl.Server{Control: control})
+
+	if err := ctl.SetLowPower(socket, openbar.LowPowerOn); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-indicated:
+	case <-time.After(time.Second):
+		t.Fatal("want: low-power indicator, got: none")
+	}
+
+	if report, err := ctl.Status(socket); err != nil || !report.LowPower {
+		t.Errorf("want: low-power mode reported, got: %v", err)
+	}
+
+	if err := ctl.SetLowPower(socket, openbar.PowerMode(42)); err == nil {
+		t.Error("want: invalid mode rejected")
+	}
+}
+
+func TestToggle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	control := openbar.NewControl()
+
+	calls := make(chan struct{}, 10)
+	module := openbar.ModuleFunc(func() (string, error) {
+		calls <- struct{}{}
+		return "", nil
+	})
+
+	// The indicator is shown once the control knows the module is disabled.
+	off := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithModule(module, time.Hour, openbar.Identified("clock")),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				if b[0].FullText == "off" {
+					once.Do(func() { close(off) })
+				}
+			}),
+		)
+	}()
+
+	socket := serve(ctx, t, ctl.Server{Control: control})
+
+	<-calls // Initial paint.
+
+	if err := ctl.DisableID(socket, "clock"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-off:
+	case <-time.After(time.Second):
+		t.Fatal("want: disabled module, got: none")
+	}
+
+	if report, err := ctl.Status(socket); err != nil || !report.Modules[0].Disabled {
+		t.Errorf("want: disabled module reported, got: %v", err)
+	}
+
+	// Disabled modules ignore reloads.
+	if err := ctl.Reload(socket, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-calls:
+		t.Error("want: disabled module not reloaded")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := ctl.Enable(socket, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Error("module not enabled")
+	}
+
+	if err := ctl.Disable(socket, 1); err == nil {
+		t.Error("want error for unknown module")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	control := openbar.NewControl()
+
+	calls := make(chan struct{}, 10)
+	module := openbar.ModuleFunc(func() (string, error) {
+		calls <- struct{}{}
+		return "hello", nil
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithModule(module, time.Hour, openbar.Named("greeting")),
+		)
+	}()
+
+	socket := serve(ctx, t, ctl.Server{Control: control})
+
+	<-calls // Initial paint.
+
+	// Follow events in the background and stop after the second one.
+	events := make(chan openbar.Event, 10)
+	errc := make(chan error, 1)
+	stop := errors.New("stop")
+
+	go func() {
+		errc <- ctl.Events(socket, true, func(e openbar.Event) error {
+			events <- e
+			if e.Seq == 2 {
+				return stop
+			}
+			return nil
+		})
+	}()
+
+	first := <-events
+	if first.Seq != 1 || first.Name != "greeting" || first.Text != "hello" {
+		t.Errorf("unexpected event: %+v", first)
+	}
+
+	if err := ctl.Reload(socket, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Seq != 2 {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event followed")
+	}
+
+	if err := <-errc; !errors.Is(err, stop) {
+		t.Errorf("want: %v, got: %v", stop, err)
+	}
+
+	// Without following, the log is printed and the connection closed.
+	n := 0
+	if err := ctl.Events(socket, false, func(openbar.Event) error { n++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("want: 2 events, got: %d", n)
+	}
+}
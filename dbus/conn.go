@@ -0,0 +1,435 @@
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types.
+const (
+	methodCall   byte = 1
+	methodReturn byte = 2
+	errorReply   byte = 3
+	signal       byte = 4
+)
+
+// Header fields.
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+)
+
+// Messages larger than this are rejected, like the reference implementation
+// does.
+const maxMessage = 128 << 20
+
+// A message is a method call, a reply or a signal.
+type message struct {
+	kind        byte
+	serial      uint32
+	path        ObjectPath
+	iface       string
+	member      string
+	errName     string
+	replySerial uint32
+	dest        string
+	sender      string
+	body        []interface{}
+}
+
+// Encode a message with the given serial, always in little-endian order.
+func (m *message) marshal(serial uint32) ([]byte, error) {
+	body := &encoder{order: binary.LittleEndian}
+	sig, err := body.values(m.body...)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[byte]interface{}{}
+	if m.path != "" {
+		fields[fieldPath] = m.path
+	}
+	if m.iface != "" {
+		fields[fieldInterface] = m.iface
+	}
+	if m.member != "" {
+		fields[fieldMember] = m.member
+	}
+	if m.dest != "" {
+		fields[fieldDestination] = m.dest
+	}
+	if sig != "" {
+		fields[fieldSignature] = Signature(sig)
+	}
+
+	h := &encoder{order: binary.LittleEndian}
+	h.buf = append(h.buf, 'l', m.kind, 0, 1)
+	h.uint32(uint32(len(body.buf)))
+	h.uint32(serial)
+
+	codes := []byte{fieldPath, fieldInterface, fieldMember, fieldDestination, fieldSignature}
+	present := make([]byte, 0, len(codes))
+	for _, code := range codes {
+		if _, ok := fields[code]; ok {
+			present = append(present, code)
+		}
+	}
+
+	err = h.array(8, len(present), func(i int) error {
+		h.align(8)
+		h.buf = append(h.buf, present[i])
+		return h.value(Variant{Value: fields[present[i]]})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.align(8)
+
+	return append(h.buf, body.buf...), nil
+}
+
+// Read a message.
+func readMessage(r io.Reader) (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: byte order %q", ErrMessage, fixed[0])
+	}
+
+	bodyLen, fieldsLen := order.Uint32(fixed[4:]), order.Uint32(fixed[12:])
+	headerLen := 16 + int(fieldsLen)
+	if headerLen%8 != 0 {
+		headerLen += 8 - headerLen%8
+	}
+	if int64(headerLen)+int64(bodyLen) > maxMessage {
+		return nil, fmt.Errorf("%w: too large", ErrMessage)
+	}
+
+	data := make([]byte, headerLen+int(bodyLen))
+	copy(data, fixed)
+	if _, err := io.ReadFull(r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &message{kind: fixed[1], serial: order.Uint32(fixed[8:])}
+
+	h := &decoder{buf: data[:headerLen], pos: 12, order: order}
+	raw, err := h.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+
+	var sig Signature
+	for _, f := range raw.([]interface{}) {
+		field := f.([]interface{})
+		v := field[1].(Variant).Value
+		switch field[0].(byte) {
+		case fieldPath:
+			m.path, _ = v.(ObjectPath)
+		case fieldInterface:
+			m.iface, _ = v.(string)
+		case fieldMember:
+			m.member, _ = v.(string)
+		case fieldErrorName:
+			m.errName, _ = v.(string)
+		case fieldReplySerial:
+			m.replySerial, _ = v.(uint32)
+		case fieldDestination:
+			m.dest, _ = v.(string)
+		case fieldSender:
+			m.sender, _ = v.(string)
+		case fieldSignature:
+			sig, _ = v.(Signature)
+		}
+	}
+
+	body := &decoder{buf: data[headerLen:], order: order}
+	if m.body, err = body.values(string(sig)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Error is an error reply.
+type Error struct {
+	Name    string
+	Message string
+}
+
+// Error implements error for Error.
+func (e Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// ErrClosed is returned by calls on a connection that was lost.
+var ErrClosed = errors.New("connection closed")
+
+// A conn is one authenticated connection to a bus. A goroutine reads messages,
+// hands replies to the calls waiting for them and signals to the handler.
+type conn struct {
+	c       net.Conn
+	signals func(*message)
+
+	mu      sync.Mutex
+	serial  uint32
+	pending map[uint32]chan *message
+	done    chan struct{}
+	err     error
+}
+
+// Connect to the first reachable address and say hello to the bus.
+func dial(address string, signals func(*message)) (*conn, error) {
+	var errs []string
+
+	for _, addr := range strings.Split(address, ";") {
+		network, path, err := parseAddress(addr)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		c, err := net.DialTimeout(network, path, Timeout)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		res, err := handshake(c, signals)
+		if err != nil {
+			c.Close()
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNoBus, strings.Join(errs, "; "))
+}
+
+// Parse a unix address like "unix:path=/run/user/1000/bus". Abstract sockets
+// are prefixed with @ as the net package expects.
+func parseAddress(addr string) (string, string, error) {
+	i := strings.IndexByte(addr, ':')
+	if i < 0 || addr[:i] != "unix" {
+		return "", "", fmt.Errorf("unsupported address: %s", addr)
+	}
+
+	for _, kv := range strings.Split(addr[i+1:], ",") {
+		j := strings.IndexByte(kv, '=')
+		if j < 0 {
+			continue
+		}
+		value, err := unescape(kv[j+1:])
+		if err != nil {
+			return "", "", err
+		}
+		switch kv[:j] {
+		case "path":
+			return "unix", value, nil
+		case "abstract":
+			return "unix", "@" + value, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("unsupported address: %s", addr)
+}
+
+// Decode the percent-escaped bytes of an address value.
+func unescape(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("invalid escape in %s", s)
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", err
+		}
+		sb.Write(b)
+		i += 2
+	}
+	return sb.String(), nil
+}
+
+// Authenticate as the current user and register on the bus.
+func handshake(c net.Conn, signals func(*message)) (*conn, error) {
+	if err := c.SetDeadline(time.Now().Add(Timeout)); err != nil {
+		return nil, err
+	}
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(c, "\x00AUTH EXTERNAL %s\r\n", uid); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(c)
+	line, err := r.ReadString(0x0A)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return nil, fmt.Errorf("authentication rejected: %s", strings.TrimSpace(line))
+	}
+
+	if _, err := fmt.Fprint(c, "BEGIN\r\n"); err != nil {
+		return nil, err
+	}
+
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	res := &conn{
+		c:       c,
+		signals: signals,
+		pending: make(map[uint32]chan *message),
+		done:    make(chan struct{}),
+	}
+
+	go res.read(r)
+
+	if _, err := res.call(&message{
+		kind:   methodCall,
+		dest:   "org.freedesktop.DBus",
+		path:   "/org/freedesktop/DBus",
+		iface:  "org.freedesktop.DBus",
+		member: "Hello",
+	}); err != nil {
+		res.close(err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Dispatch incoming messages until the connection breaks.
+func (c *conn) read(r io.Reader) {
+	for {
+		m, err := readMessage(r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+
+		switch m.kind {
+		case methodReturn, errorReply:
+			c.mu.Lock()
+			reply, ok := c.pending[m.replySerial]
+			delete(c.pending, m.replySerial)
+			c.mu.Unlock()
+			if ok {
+				reply <- m
+			}
+		case signal:
+			if c.signals != nil {
+				c.signals(m)
+			}
+		}
+	}
+}
+
+// Call a method and wait for its reply.
+func (c *conn) call(m *message) ([]interface{}, error) {
+	reply := make(chan *message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.serial++
+	serial := c.serial
+	data, err := m.marshal(serial)
+	if err == nil {
+		c.pending[serial] = reply
+		_ = c.c.SetWriteDeadline(time.Now().Add(Timeout))
+		_, err = c.c.Write(data)
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		c.forget(serial)
+		return nil, err
+	}
+
+	t := time.NewTimer(Timeout)
+	defer t.Stop()
+
+	select {
+	case r := <-reply:
+		if r.kind == errorReply {
+			e := Error{Name: r.errName}
+			if len(r.body) > 0 {
+				e.Message, _ = r.body[0].(string)
+			}
+			return nil, e
+		}
+		return r.body, nil
+	case <-c.done:
+		return nil, c.failure()
+	case <-t.C:
+		c.forget(serial)
+		return nil, fmt.Errorf("%s.%s: no reply after %v", m.iface, m.member, Timeout)
+	}
+}
+
+// Stop waiting for a reply.
+func (c *conn) forget(serial uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, serial)
+}
+
+// Return why the connection was lost.
+func (c *conn) failure() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close the connection for the given reason. Only the first reason is kept.
+func (c *conn) close(reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = fmt.Errorf("%w: %v", ErrClosed, reason)
+	c.c.Close()
+	close(c.done)
+}
@@ -0,0 +1,341 @@
+// Package dbus is a minimal client for the D-Bus message bus, as described in
+// the D-Bus specification. It only covers what modules need: calling methods,
+// reading properties and watching signals.
+//
+// Modules share one connection per bus rather than holding their own. When the
+// bus restarts, the connection is established again and signal watches are
+// restored, so modules don't have to handle it.
+package dbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout bounds connections and method calls.
+const Timeout = 5 * time.Second
+
+// Retry is how long to wait before connecting again to a lost bus.
+const Retry = 5 * time.Second
+
+// ErrNoBus is returned when the bus can't be reached.
+var ErrNoBus = errors.New("bus unreachable")
+
+// Bus is a shared connection to a message bus, established on first use and
+// again after it is lost.
+type Bus struct {
+	address func() string
+
+	// The connection lock is held while connecting and the watch lock only
+	// while dispatching, so that signals never wait for a connection.
+	mu    sync.Mutex
+	conn  *conn
+	retry bool
+
+	wmu     sync.Mutex
+	watches map[*watch]struct{}
+}
+
+// A watch is a signal handler along with the signals it wants.
+type watch struct {
+	match Match
+	fn    func(Signal)
+}
+
+// New returns a bus at the given address, like "unix:path=/run/dbus/socket".
+func New(address string) *Bus {
+	return &Bus{address: func() string { return address }}
+}
+
+var system = &Bus{address: func() string {
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "unix:path=/run/dbus/system_bus_socket"
+}}
+
+var session = &Bus{address: func() string {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "unix:path=" + filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "bus")
+}}
+
+// System returns the system bus shared by all modules.
+func System() *Bus {
+	return system
+}
+
+// Session returns the session bus shared by all modules.
+func Session() *Bus {
+	return session
+}
+
+// Return the current connection, connecting if there is none. The caller holds
+// the connection lock.
+func (b *Bus) connect() (*conn, error) {
+	if b.conn != nil && b.conn.failure() == nil {
+		return b.conn, nil
+	}
+
+	c, err := dial(b.address(), b.dispatch)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range b.matches() {
+		if err := addMatch(c, m); err != nil {
+			c.close(err)
+			return nil, err
+		}
+	}
+
+	b.conn = c
+
+	go func() {
+		<-c.done
+		b.reconnect()
+	}()
+
+	return c, nil
+}
+
+// Connect again until it works, as long as signals are watched. Calls connect
+// on their own when needed. Only one loop runs at a time.
+func (b *Bus) reconnect() {
+	b.mu.Lock()
+	if b.retry {
+		b.mu.Unlock()
+		return
+	}
+	b.retry = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.retry = false
+		b.mu.Unlock()
+	}()
+
+	for {
+		if len(b.matches()) == 0 {
+			return
+		}
+
+		b.mu.Lock()
+		_, err := b.connect()
+		b.mu.Unlock()
+
+		if err == nil {
+			return
+		}
+
+		time.Sleep(Retry)
+	}
+}
+
+// Return the matches of the current watches.
+func (b *Bus) matches() []Match {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	res := make([]Match, 0, len(b.watches))
+	for w := range b.watches {
+		res = append(res, w.match)
+	}
+	return res
+}
+
+// Call calls a method and returns the values of its reply. A call made while
+// the connection is lost is retried once on a new connection.
+func (b *Bus) Call(dest string, path ObjectPath, iface, method string, args ...interface{}) ([]interface{}, error) {
+	m := &message{kind: methodCall, dest: dest, path: path, iface: iface, member: method, body: args}
+
+	for attempt := 0; ; attempt++ {
+		b.mu.Lock()
+		c, err := b.connect()
+		b.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.call(m)
+		if errors.Is(err, ErrClosed) && attempt == 0 {
+			continue
+		}
+		return res, err
+	}
+}
+
+// Get returns the value of a property.
+func (b *Bus) Get(dest string, path ObjectPath, iface, prop string) (interface{}, error) {
+	res, err := b.Call(dest, path, "org.freedesktop.DBus.Properties", "Get", iface, prop)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 {
+		return nil, fmt.Errorf("%w: Get returned %d values", ErrMessage, len(res))
+	}
+	v, ok := res[0].(Variant)
+	if !ok {
+		return nil, fmt.Errorf("%w: Get returned %T", ErrMessage, res[0])
+	}
+	return v.Value, nil
+}
+
+// GetAll returns the values of all the properties of an interface.
+func (b *Bus) GetAll(dest string, path ObjectPath, iface string) (map[string]interface{}, error) {
+	res, err := b.Call(dest, path, "org.freedesktop.DBus.Properties", "GetAll", iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 {
+		return nil, fmt.Errorf("%w: GetAll returned %d values", ErrMessage, len(res))
+	}
+	props, ok := res[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: GetAll returned %T", ErrMessage, res[0])
+	}
+	for k, v := range props {
+		if v, ok := v.(Variant); ok {
+			props[k] = v.Value
+		}
+	}
+	return props, nil
+}
+
+// Signal is a signal received from the bus.
+type Signal struct {
+	Sender    string
+	Path      ObjectPath
+	Interface string
+	Member    string
+	Body      []interface{}
+}
+
+// Match selects signals. Empty fields match anything. Sender is only used by
+// the bus since signals come from unique names rather than well-known ones.
+// PathNamespace selects an object along with those below it.
+type Match struct {
+	Sender        string
+	Path          ObjectPath
+	PathNamespace ObjectPath
+	Interface     string
+	Member        string
+}
+
+// The match rule of the bus.
+func (m Match) rule() string {
+	rule := "type='signal'"
+	for _, kv := range [][2]string{
+		{"sender", m.Sender},
+		{"path", string(m.Path)},
+		{"path_namespace", string(m.PathNamespace)},
+		{"interface", m.Interface},
+		{"member", m.Member},
+	} {
+		if kv[1] != "" {
+			rule += fmt.Sprintf(",%s='%s'", kv[0], kv[1])
+		}
+	}
+	return rule
+}
+
+// Tell whether a signal is selected.
+func (m Match) matches(s Signal) bool {
+	ns := string(m.PathNamespace)
+	return (m.Path == "" || m.Path == s.Path) &&
+		(ns == "" || ns == "/" || string(s.Path) == ns || strings.HasPrefix(string(s.Path), ns+"/")) &&
+		(m.Interface == "" || m.Interface == s.Interface) &&
+		(m.Member == "" || m.Member == s.Member)
+}
+
+// Ask the bus for the signals of a match.
+func addMatch(c *conn, m Match) error {
+	_, err := c.call(&message{
+		kind:   methodCall,
+		dest:   "org.freedesktop.DBus",
+		path:   "/org/freedesktop/DBus",
+		iface:  "org.freedesktop.DBus",
+		member: "AddMatch",
+		body:   []interface{}{m.rule()},
+	})
+	return err
+}
+
+// Ask the bus to stop sending the signals of a match.
+func removeMatch(c *conn, m Match) error {
+	_, err := c.call(&message{
+		kind:   methodCall,
+		dest:   "org.freedesktop.DBus",
+		path:   "/org/freedesktop/DBus",
+		iface:  "org.freedesktop.DBus",
+		member: "RemoveMatch",
+		body:   []interface{}{m.rule()},
+	})
+	return err
+}
+
+// Watch calls fn with every signal selected by the match until the context is
+// done. Signals are received even across bus restarts, except while the bus is
+// down. Handlers are called one at a time and must not block.
+func (b *Bus) Watch(ctx context.Context, m Match, fn func(Signal)) error {
+	w := &watch{m, fn}
+
+	b.mu.Lock()
+	c, err := b.connect()
+	b.wmu.Lock()
+	if b.watches == nil {
+		b.watches = make(map[*watch]struct{})
+	}
+	b.watches[w] = struct{}{}
+	b.wmu.Unlock()
+	if err == nil {
+		_ = addMatch(c, m)
+	}
+	b.mu.Unlock()
+
+	// Unreachable buses are retried in the background. Lost connections
+	// already are.
+	if err != nil {
+		go b.reconnect()
+	}
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.wmu.Lock()
+	delete(b.watches, w)
+	b.wmu.Unlock()
+
+	if b.conn != nil && b.conn.failure() == nil {
+		_ = removeMatch(b.conn, m)
+	}
+
+	return nil
+}
+
+// Hand a signal to the watches selecting it.
+func (b *Bus) dispatch(m *message) {
+	s := Signal{Sender: m.sender, Path: m.path, Interface: m.iface, Member: m.member, Body: m.body}
+
+	b.wmu.Lock()
+	fns := make([]func(Signal), 0, len(b.watches))
+	for w := range b.watches {
+		if w.match.matches(s) {
+			fns = append(fns, w.fn)
+		}
+	}
+	b.wmu.Unlock()
+
+	for _, fn := range fns {
+		fn(s)
+	}
+}
@@ -0,0 +1,147 @@
+package dbus_test
+
+import (
+	"bufio"
+	"context"
+	"openbar/dbus"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	busName  = "org.freedesktop.DBus"
+	busPath  = dbus.ObjectPath("/org/freedesktop/DBus")
+	busIface = "org.freedesktop.DBus"
+)
+
+// Start a private bus listening on the given socket, until stopped.
+func daemon(t *testing.T, socket string) (stop func()) {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+
+	//nolint:gosec
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address",
+		"--address=unix:path="+socket)
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The address is printed once the bus listens.
+	if _, err := bufio.NewReader(out).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	stop = func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	t.Cleanup(stop)
+
+	return stop
+}
+
+func TestCall(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "bus")
+	daemon(t, socket)
+
+	bus := dbus.New("unix:path=" + socket)
+
+	res, err := bus.Call(busName, busPath, busIface, "GetId")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res[0].(string); len(id) != 32 {
+		t.Errorf("want: 32 hex digits, got: %v", res)
+	}
+
+	res, err = bus.Call(busName, busPath, busIface, "ListNames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, _ := res[0].([]interface{})
+	if len(names) == 0 || names[0] != busName {
+		t.Errorf("want: %s first, got: %v", busName, res)
+	}
+
+	features, err := bus.Get(busName, busPath, busIface, "Features")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := features.([]interface{}); !ok {
+		t.Errorf("want: []interface{}, got: %T", features)
+	}
+
+	_, err = bus.Call(busName, busPath, busIface, "NoSuchMethod")
+	if e, ok := err.(dbus.Error); !ok || e.Name != "org.freedesktop.DBus.Error.UnknownMethod" {
+		t.Errorf("want: UnknownMethod, got: %v", err)
+	}
+}
+
+func TestNoBus(t *testing.T) {
+	bus := dbus.New("unix:path=" + filepath.Join(t.TempDir(), "bus"))
+	if _, err := bus.Call(busName, busPath, busIface, "GetId"); err == nil {
+		t.Error("want: error, got: nil")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "bus")
+	stop := daemon(t, socket)
+
+	bus := dbus.New("unix:path=" + socket)
+	other := dbus.New("unix:path=" + socket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	owners := make(chan string, 16)
+	go func() {
+		m := dbus.Match{Interface: busIface, Member: "NameOwnerChanged"}
+		_ = bus.Watch(ctx, m, func(s dbus.Signal) {
+			if name, _ := s.Body[0].(string); strings.HasPrefix(name, "org.openbar.") {
+				owners <- name
+			}
+		})
+	}()
+
+	// Names are requested until the watch receives one, since it may not be
+	// registered yet.
+	expect := func(name string) {
+		t.Helper()
+		deadline := time.After(dbus.Timeout + 2*dbus.Retry)
+		tick := time.NewTicker(100 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case got := <-owners:
+				if got == name {
+					return
+				}
+			case <-tick.C:
+				_, _ = other.Call(busName, busPath, busIface, "RequestName", name, uint32(0))
+				_, _ = other.Call(busName, busPath, busIface, "ReleaseName", name)
+			case <-deadline:
+				t.Fatalf("want: %s, got: nothing", name)
+			}
+		}
+	}
+
+	expect("org.openbar.First")
+
+	// Signals are received again once the bus is back.
+	stop()
+	daemon(t, socket)
+
+	expect("org.openbar.Second")
+}
@@ -0,0 +1,465 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ObjectPath is a value of type o.
+type ObjectPath string
+
+// Signature is a value of type g.
+type Signature string
+
+// Variant is a value of type v, along with its signature.
+type Variant struct {
+	Sig   Signature
+	Value interface{}
+}
+
+// MakeVariant wraps a value in a variant. It panics if the type of the value
+// can't be sent.
+func MakeVariant(v interface{}) Variant {
+	sig, err := signatureOf(v)
+	if err != nil {
+		panic(err)
+	}
+	return Variant{Signature(sig), v}
+}
+
+// ErrSignature is returned when a value can't be marshaled or unmarshaled.
+var ErrSignature = errors.New("invalid signature")
+
+// Return the signature of a Go value. Only the types needed by modules are
+// supported.
+func signatureOf(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case byte:
+		return "y", nil
+	case bool:
+		return "b", nil
+	case int16:
+		return "n", nil
+	case uint16:
+		return "q", nil
+	case int32, int:
+		return "i", nil
+	case uint32:
+		return "u", nil
+	case int64:
+		return "x", nil
+	case uint64:
+		return "t", nil
+	case float64:
+		return "d", nil
+	case string:
+		return "s", nil
+	case ObjectPath:
+		return "o", nil
+	case Signature:
+		return "g", nil
+	case Variant:
+		return "v", nil
+	case []string:
+		return "as", nil
+	case []ObjectPath:
+		return "ao", nil
+	case map[string]Variant:
+		return "a{sv}", nil
+	default:
+		return "", fmt.Errorf("%w: unsupported type %T", ErrSignature, v)
+	}
+}
+
+// Alignment of the values of a type, given by the first character of its
+// signature.
+func alignment(c byte) int {
+	switch c {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
+
+// Split the first complete type off a signature.
+func next(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("%w: empty", ErrSignature)
+	}
+
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := next(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		depth := 0
+		for i := 0; i < len(sig); i++ {
+			switch sig[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+			}
+			if depth == 0 {
+				return sig[:i+1], sig[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("%w: unbalanced %s", ErrSignature, sig)
+	default:
+		return sig[:1], sig[1:], nil
+	}
+}
+
+// An encoder writes values aligned from the start of its buffer, which is
+// also the start of the message or of its body, both aligned on 8 bytes.
+type encoder struct {
+	buf   []byte
+	order binary.ByteOrder
+}
+
+// Pad the buffer to the given alignment.
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.align(2)
+	var b [2]byte
+	e.order.PutUint16(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	var b [4]byte
+	e.order.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.align(8)
+	var b [8]byte
+	e.order.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(append(e.buf, s...), 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf = append(append(append(e.buf, byte(len(s))), s...), 0)
+}
+
+// Write the values with their signature.
+func (e *encoder) values(vs ...interface{}) (string, error) {
+	sig := ""
+	for _, v := range vs {
+		s, err := signatureOf(v)
+		if err != nil {
+			return "", err
+		}
+		if err := e.value(v); err != nil {
+			return "", err
+		}
+		sig += s
+	}
+	return sig, nil
+}
+
+// Write a single value.
+func (e *encoder) value(v interface{}) error {
+	switch v := v.(type) {
+	case byte:
+		e.buf = append(e.buf, v)
+	case bool:
+		var n uint32
+		if v {
+			n = 1
+		}
+		e.uint32(n)
+	case int16:
+		e.uint16(uint16(v))
+	case uint16:
+		e.uint16(v)
+	case int32:
+		e.uint32(uint32(v))
+	case int:
+		e.uint32(uint32(int32(v)))
+	case uint32:
+		e.uint32(v)
+	case int64:
+		e.uint64(uint64(v))
+	case uint64:
+		e.uint64(v)
+	case float64:
+		e.uint64(math.Float64bits(v))
+	case string:
+		e.string(v)
+	case ObjectPath:
+		e.string(string(v))
+	case Signature:
+		e.signature(string(v))
+	case Variant:
+		sig, err := signatureOf(v.Value)
+		if err != nil {
+			return err
+		}
+		e.signature(sig)
+		return e.value(v.Value)
+	case []string:
+		return e.array(4, len(v), func(i int) error { return e.value(v[i]) })
+	case []ObjectPath:
+		return e.array(4, len(v), func(i int) error { return e.value(v[i]) })
+	case map[string]Variant:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return e.array(8, len(keys), func(i int) error {
+			e.align(8)
+			e.string(keys[i])
+			return e.value(v[keys[i]])
+		})
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrSignature, v)
+	}
+	return nil
+}
+
+// Write an array of n elements with the given alignment. The length excludes
+// the padding between itself and the first element.
+func (e *encoder) array(align, n int, elem func(int) error) error {
+	e.align(4)
+	at := len(e.buf)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	e.align(align)
+	start := len(e.buf)
+	for i := 0; i < n; i++ {
+		if err := elem(i); err != nil {
+			return err
+		}
+	}
+	e.order.PutUint32(e.buf[at:], uint32(len(e.buf)-start))
+	return nil
+}
+
+// ErrMessage is returned when a message is malformed.
+var ErrMessage = errors.New("malformed message")
+
+// A decoder reads values aligned from the start of its buffer.
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+// Skip the padding up to the given alignment.
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.buf) {
+		return fmt.Errorf("%w: truncated", ErrMessage)
+	}
+	return nil
+}
+
+// Read n bytes.
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, fmt.Errorf("%w: truncated", ErrMessage)
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+// Read values until the signature is exhausted.
+func (d *decoder) values(sig string) ([]interface{}, error) {
+	var res []interface{}
+	for sig != "" {
+		head, rest, err := next(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(head)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+		sig = rest
+	}
+	return res, nil
+}
+
+// Read a value of a single complete type. Arrays of dictionary entries become
+// maps, keyed by string when keys are strings, and structs become slices.
+func (d *decoder) value(sig string) (interface{}, error) {
+	if err := d.align(alignment(sig[0])); err != nil {
+		return nil, err
+	}
+
+	switch sig[0] {
+	case 'y':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		n, err := d.uint32()
+		return n != 0, err
+	case 'n', 'q':
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		n, err := d.uint32()
+		return int32(n), err
+	case 'u', 'h':
+		return d.uint32()
+	case 'x', 't', 'd':
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		n := d.order.Uint64(b)
+		switch sig[0] {
+		case 'x':
+			return int64(n), nil
+		case 'd':
+			return math.Float64frombits(n), nil
+		default:
+			return n, nil
+		}
+	case 's', 'o':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'o' {
+			return ObjectPath(b[:n]), nil
+		}
+		return string(b[:n]), nil
+	case 'g':
+		return d.signature()
+	case 'v':
+		s, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		if _, rest, err := next(string(s)); err != nil || rest != "" {
+			return nil, fmt.Errorf("%w: variant of %q", ErrSignature, s)
+		}
+		v, err := d.value(string(s))
+		return Variant{s, v}, err
+	case 'a':
+		return d.array(sig[1:])
+	case '(':
+		return d.values(sig[1 : len(sig)-1])
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrSignature, sig)
+	}
+}
+
+func (d *decoder) signature() (Signature, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return "", err
+	}
+	s, err := d.read(int(b[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return Signature(s[:b[0]]), nil
+}
+
+// Read an array whose elements have the given signature.
+func (d *decoder) array(elem string) (interface{}, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.align(alignment(elem[0])); err != nil {
+		return nil, err
+	}
+	end := d.pos + int(n)
+	if end > len(d.buf) {
+		return nil, fmt.Errorf("%w: truncated", ErrMessage)
+	}
+
+	if elem[0] != '{' {
+		res := make([]interface{}, 0)
+		for d.pos < end {
+			v, err := d.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	}
+
+	kv := elem[1 : len(elem)-1]
+	byString := make(map[string]interface{})
+	others := make(map[interface{}]interface{})
+
+	for d.pos < end {
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		entry, err := d.values(kv)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, fmt.Errorf("%w: dictionary entry %q", ErrSignature, elem)
+		}
+		if k, ok := entry[0].(string); ok {
+			byString[k] = entry[1]
+		} else {
+			others[entry[0]] = entry[1]
+		}
+	}
+
+	if kv[0] == 's' {
+		return byString, nil
+	}
+	return others, nil
+}
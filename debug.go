@@ -0,0 +1,45 @@
+package openbar
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// A frame printer writes human-readable frames for diagnosis: a timestamp,
+// then one block per line with its index, name, content and error state.
+type framePrinter struct {
+	w     io.Writer
+	names []string
+	errs  []error
+}
+
+// Record the latest error state of a block.
+func (f *framePrinter) update(idx int, err error) {
+	f.errs[idx] = err
+}
+
+// Print the current frame, given the index of the module of each block. Blocks
+// without a module, like the low-power indicator, have a negative index.
+func (f *framePrinter) print(b []Block, owners []int) error {
+	tw := tabwriter.NewWriter(f.w, 0, 4, 2, 0x20, 0)
+
+	fmt.Fprintf(tw, "%s\n", time.Now().Format(time.RFC3339Nano))
+
+	for i, block := range b {
+		idx, name, state := owners[i], "-", "ok"
+		if idx >= 0 {
+			if f.names[idx] != "" {
+				name = f.names[idx]
+			}
+			if f.errs[idx] != nil {
+				state = "error: " + f.errs[idx].Error()
+			}
+		}
+
+		fmt.Fprintf(tw, "  [%d]\t%s\t%q\t%s\n", idx, name, block.FullText, state)
+	}
+
+	return tw.Flush()
+}
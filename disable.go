@@ -0,0 +1,77 @@
+package openbar
+
+import "strings"
+
+// Gesture is a click made with some modifier keys held, as named by the bar,
+// like "Shift" or "Mod4". Other modifiers may be held too, since lock keys
+// count as modifiers.
+type Gesture struct {
+	Button    int
+	Modifiers []string
+}
+
+// Tell whether a click is made with the gesture.
+func (g Gesture) matches(c Click) bool {
+	if c.Button != g.Button {
+		return false
+	}
+	for _, want := range g.Modifiers {
+		held := false
+		for _, m := range c.Modifiers {
+			if strings.EqualFold(m, want) {
+				held = true
+				break
+			}
+		}
+		if !held {
+			return false
+		}
+	}
+	return true
+}
+
+// Toggle describes how modules are disabled from the bar. Disabled modules
+// don't run until enabled again, and their block shows the indicator so that
+// it can still be clicked. Modules can always be disabled with a control.
+type Toggle struct {
+	// Gesture disables the module of the block it is made on, or enables it
+	// again. Without it, clicks don't disable anything.
+	Gesture *Gesture
+	// Indicator is the text of disabled blocks.
+	Indicator string
+}
+
+var defaultToggle = Toggle{Indicator: "off"}
+
+// A request to turn a module on or off.
+type switching int
+
+const (
+	enable  switching = iota // Run the module again.
+	disable                  // Stop running the module.
+	flip                     // Do the opposite of the current state.
+)
+
+// Apply a request to the state of a module.
+func (s switching) apply(off bool) bool {
+	switch s {
+	case enable:
+		return false
+	case disable:
+		return true
+	default:
+		return !off
+	}
+}
+
+// Ask a module to switch, replacing a request it didn't handle yet.
+func request(c chan switching, s switching) {
+	select {
+	case <-c:
+	default:
+	}
+	select {
+	case c <- s:
+	default:
+	}
+}
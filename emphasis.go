@@ -0,0 +1,111 @@
+package openbar
+
+import "time"
+
+// Emphasis is the style a block temporarily takes when its value changes, like
+// an on-screen display would when the volume or the brightness is adjusted.
+type Emphasis struct {
+	Duration   time.Duration
+	Color      string
+	MinWidth   *Width
+	Background string
+	Border     string
+}
+
+// A highlight tracks the values of modules and emphasizes the blocks of those
+// that changed. Its timer only runs while a block is emphasized. A quiet
+// highlight keeps tracking values without emphasizing anything.
+type highlight struct {
+	C      <-chan time.Time
+	quiet  bool
+	styles []Emphasis
+	base   []Block
+	prev   []string
+	seen   []bool
+	until  []time.Time
+	timer  *time.Timer
+}
+
+// Create a highlight for modules with the given styles. Modules with a zero
+// duration are never emphasized. Blocks get back their base style once their
+// emphasis is over.
+func newHighlight(styles []Emphasis, base []Block) *highlight {
+	h := &highlight{
+		styles: styles,
+		base:   base,
+		prev:   make([]string, len(styles)),
+		seen:   make([]bool, len(styles)),
+		until:  make([]time.Time, len(styles)),
+		timer:  time.NewTimer(time.Hour),
+	}
+	h.timer.Stop()
+	h.C = h.timer.C
+	return h
+}
+
+// Record the new value of a module and emphasize its block if the value
+// changed. The first value is not a change. Return whether the block changed.
+func (h *highlight) change(idx int, text string, b []Block) bool {
+	changed := h.seen[idx] && text != h.prev[idx]
+	h.prev[idx], h.seen[idx] = text, true
+
+	s := h.styles[idx]
+	if !changed || s.Duration <= 0 || h.quiet {
+		return false
+	}
+
+	h.until[idx] = time.Now().Add(s.Duration)
+	if s.Color != "" {
+		b[idx].Color = s.Color
+	}
+	if s.MinWidth != nil {
+		b[idx].MinWidth = s.MinWidth
+	}
+	if s.Background != "" {
+		b[idx].Background = s.Background
+	}
+	if s.Border != "" {
+		b[idx].Border = s.Border
+	}
+	h.arm()
+
+	return true
+}
+
+// Restore the blocks whose emphasis is over. Return whether any block changed.
+func (h *highlight) expire(b []Block) bool {
+	changed := false
+
+	for i, until := range h.until {
+		if !until.IsZero() && !time.Now().Before(until) {
+			h.until[i] = time.Time{}
+			b[i].Color, b[i].MinWidth = h.base[i].Color, h.base[i].MinWidth
+			b[i].Background, b[i].Border = h.base[i].Background, h.base[i].Border
+			changed = true
+		}
+	}
+
+	h.arm()
+
+	return changed
+}
+
+// Set the timer to the next expiration, if any.
+func (h *highlight) arm() {
+	var next time.Time
+	for _, until := range h.until {
+		if !until.IsZero() && (next.IsZero() || until.Before(next)) {
+			next = until
+		}
+	}
+
+	h.timer.Stop()
+	if !next.IsZero() {
+		h.timer.Reset(time.Until(next))
+	}
+}
+
+// Release the timer.
+func (h *highlight) close() {
+	h.timer.Stop()
+}
@@ -0,0 +1,89 @@
+package openbar
+
+import "time"
+
+// EventLogSize is the number of events kept by a Control.
+const EventLogSize = 256
+
+// Event is an update of a module as kept in the event log of a Control.
+type Event struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Index int       `json:"index"`
+	ID    string    `json:"id"`
+	Name  string    `json:"name"`
+	Text  string    `json:"text"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Followers get events on a buffered channel. Those too slow to keep up miss
+// events rather than slowing down the bar.
+const followBuffer = 64
+
+// A ring buffer of the last events along with the channels of followers.
+type eventLog struct {
+	ring      []Event
+	seq       uint64
+	followers map[chan Event]struct{}
+}
+
+// Add an event to the log and pass it to followers.
+func (l *eventLog) add(e Event) {
+	l.seq++
+	e.Seq = l.seq
+
+	if len(l.ring) < EventLogSize {
+		l.ring = append(l.ring, e)
+	} else {
+		l.ring[int((e.Seq-1)%EventLogSize)] = e
+	}
+
+	for c := range l.followers {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// Return the events of the log, oldest first.
+func (l *eventLog) events() []Event {
+	res := make([]Event, 0, len(l.ring))
+	if len(l.ring) < EventLogSize {
+		return append(res, l.ring...)
+	}
+	start := int(l.seq % EventLogSize)
+	res = append(res, l.ring[start:]...)
+	return append(res, l.ring[:start]...)
+}
+
+// Events returns the last module updates and errors, oldest first.
+func (c *Control) Events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.log.events()
+}
+
+// Follow returns the last events along with a channel receiving the following
+// ones until stop is called. Events are dropped if they are not received fast
+// enough.
+func (c *Control) Follow() (past []Event, next <-chan Event, stop func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan Event, followBuffer)
+
+	if c.log.followers == nil {
+		c.log.followers = make(map[chan Event]struct{})
+	}
+
+	c.log.followers[ch] = struct{}{}
+
+	stop = func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.log.followers, ch)
+	}
+
+	return c.log.events(), ch, stop
+}
@@ -0,0 +1,48 @@
+package openbar
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// WithExport configures a directory where the bar keeps its latest state in
+// files, for widgets and scripts that don't speak the protocol: frame.json
+// holds the blocks of the last frame printed and modules/ID.json the status
+// of each module after its last run, see Status. Files are replaced
+// atomically so readers never see them half-written.
+func WithExport(dir string) Option {
+	return func(cfg *config) {
+		cfg.hooks.frame = append(cfg.hooks.frame, func(b []Block) {
+			debug(export(filepath.Join(dir, "frame.json"), b))
+		})
+		cfg.hooks.update = append(cfg.hooks.update, func(s Status) {
+			debug(export(filepath.Join(dir, "modules", url.PathEscape(s.ID)+".json"), s))
+		})
+	}
+}
+
+// Marshal the given value to JSON and write it to a file.
+func export(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// Write a file atomically, creating its directory if needed: data goes to a
+// temporary file first, which then replaces the file.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,74 @@
+package openbar
+
+import "html/template"
+
+// ErrorDisplay is what the block of a module shows when it fails.
+type ErrorDisplay int
+
+const (
+	// ErrorOutput shows what the module returned along with the error,
+	// usually nothing. This is the default.
+	ErrorOutput ErrorDisplay = iota
+	// ErrorMessage shows the error message.
+	ErrorMessage
+	// ErrorPlaceholder shows the placeholder of the policy.
+	ErrorPlaceholder
+	// ErrorKeep keeps the last value the module returned without error, or
+	// nothing if there is none yet.
+	ErrorKeep
+	// ErrorBlank empties the block.
+	ErrorBlank
+)
+
+// ErrorPolicy tells what the block of a failing module shows. Errors are
+// logged and reported whatever the policy.
+type ErrorPolicy struct {
+	Display ErrorDisplay
+	// Placeholder is shown with ErrorPlaceholder, "⚠" when empty.
+	Placeholder string
+}
+
+const errorPlaceholder = "⚠"
+
+// Return the text of the block of a module that failed with the given text.
+// Modules keeping their last value have it put back by the bar, which alone
+// knows it.
+func (c cell) failure(text string, err error) string {
+	if c.onError == nil {
+		return c.escape(text)
+	}
+
+	// Messages and placeholders are plain text, even in markup blocks.
+	plain := func(s string) string {
+		if c.markup || c.format != nil {
+			return template.HTMLEscapeString(s)
+		}
+		return s
+	}
+
+	switch c.onError.Display {
+	case ErrorMessage:
+		return plain(sanitize(err.Error()))
+	case ErrorPlaceholder:
+		if c.onError.Placeholder == "" {
+			return errorPlaceholder
+		}
+		return plain(c.onError.Placeholder)
+	case ErrorKeep, ErrorBlank:
+		return ""
+	default:
+		return c.escape(text)
+	}
+}
+
+// Return what to show for a result given the last one without error: failing
+// modules keeping their last value get it back, along with their error.
+func (c cell) keep(res result, good *result) result {
+	if res.kind != done || res.err == nil || good == nil ||
+		c.onError == nil || c.onError.Display != ErrorKeep {
+		return res
+	}
+	kept := *good
+	kept.err = res.err
+	return kept
+}
@@ -0,0 +1,129 @@
+package openbar
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultIcons are the icons formats know by name.
+var DefaultIcons = map[string]string{
+	"bat":   "🔋",
+	"bolt":  "⚡",
+	"clock": "🕒",
+	"cpu":   "🖥",
+	"disk":  "💾",
+	"lock":  "🔒",
+	"mail":  "✉",
+	"mem":   "🧠",
+	"mic":   "🎤",
+	"mute":  "🔇",
+	"net":   "🌐",
+	"temp":  "🌡",
+	"vol":   "🔊",
+	"wifi":  "📶",
+}
+
+// Format rewrites the text of a module with a template, like
+// `{{icon "bat"}} {{.}}%`, whose dot is the text. Templates are those of
+// html/template since blocks are Pango markup once formatted, and the text is
+// escaped unless the module prints markup already. Helpers are:
+//
+//	icon NAME         the icon of the given name, see DefaultIcons
+//	pad N TEXT        the text right-aligned on N characters
+//	rpad N TEXT       the text left-aligned on N characters
+//	trunc N TEXT      the text cut to N characters, with an ellipsis
+//	color COLOR TEXT  the text in the given color, like "#ff0000"
+//	bg COLOR TEXT     the text on the given background
+//
+// Helpers take plain text, so they apply to the text of modules printing
+// markup only through literal text.
+type Format struct {
+	tmpl *template.Template
+}
+
+// ParseFormat reads a format. Icons are looked up in the given map, then in
+// DefaultIcons.
+func ParseFormat(text string, icons map[string]string) (*Format, error) {
+	funcs := template.FuncMap{
+		"icon": func(name string) (string, error) {
+			if icon, ok := icons[name]; ok {
+				return icon, nil
+			}
+			if icon, ok := DefaultIcons[name]; ok {
+				return icon, nil
+			}
+			return "", fmt.Errorf("unknown icon: %s", name)
+		},
+		"pad": func(n int, s string) string {
+			return spaces(n-utf8.RuneCountInString(s)) + s
+		},
+		"rpad": func(n int, s string) string {
+			return s + spaces(n-utf8.RuneCountInString(s))
+		},
+		"trunc": truncate,
+		"color": func(color, s string) template.HTML {
+			return span("foreground", color, s)
+		},
+		"bg": func(color, s string) template.HTML {
+			return span("background", color, s)
+		},
+	}
+
+	tmpl, err := template.New("format").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Format{tmpl}, nil
+}
+
+// Apply the format to the text of a module, which is markup or plain text.
+func (f *Format) apply(text string, markup bool) (string, error) {
+	var data interface{} = text
+	if markup {
+		data = template.HTML(text) //nolint:gosec
+	}
+
+	var sb strings.Builder
+	if err := f.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("format: %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+// Escape the text of a module whose block is markup only because of its
+// format.
+func (c cell) escape(text string) string {
+	if c.format == nil || c.markup {
+		return text
+	}
+	return template.HTMLEscapeString(text)
+}
+
+// Return n spaces, or none if n is negative.
+func spaces(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat(" ", n)
+}
+
+// Cut a text to at most n characters, the last one being an ellipsis when
+// something was cut.
+func truncate(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// Wrap escaped text in a Pango span with the given attribute.
+func span(attr, value, text string) template.HTML {
+	//nolint:gosec
+	return template.HTML(fmt.Sprintf(`<span %s="%s">%s</span>`,
+		attr, template.HTMLEscapeString(value), template.HTMLEscapeString(text)))
+}
@@ -0,0 +1,315 @@
+// Package httpcache is an HTTP transport persisting responses to disk, so that
+// restarting the bar does not re-fetch every API. Fresh responses are served
+// without touching the network and stale ones are revalidated with ETag and
+// Last-Modified when the server supports them. Private responses, those to
+// requests carrying credentials unless public, and large ones are never stored.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxBody is the size of the largest body stored.
+const MaxBody = 1 << 20
+
+// Transport is an http.RoundTripper caching GET responses in a directory.
+type Transport struct {
+	// Dir is where responses are stored.
+	Dir string
+	// Base performs the actual requests. It defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// New returns a transport storing responses in the given directory.
+func New(dir string) *Transport {
+	return &Transport{Dir: dir}
+}
+
+// DefaultDir returns the cache directory of the current user.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "openbar", "http")
+}
+
+// An entry is a stored response. Responses varying on request headers are
+// stored apart for each of their values, and the entry of their address only
+// lists those headers.
+type entry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Stored time.Time   `json:"stored"`
+	Vary   []string    `json:"vary,omitempty"`
+}
+
+// RoundTrip implements http.RoundTripper. Cache failures are never fatal: the
+// request is simply performed as if there was no cache.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" || nostore(req.Header) {
+		return t.base().RoundTrip(req)
+	}
+
+	path, cached := t.lookup(req)
+
+	// Requests asking for no-cache may only be answered once revalidated.
+	if cached != nil && cached.fresh() && !nocache(req.Header) {
+		return cached.response(req), nil
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	res, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The server confirmed the stored body is still valid: refresh its metadata.
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		res.Body.Close()
+		for k, v := range res.Header {
+			cached.Header[k] = v
+		}
+		cached.Stored = time.Now()
+		cached.save(path)
+		return cached.response(req), nil
+	}
+
+	vary := varying(res.Header)
+	if res.StatusCode != http.StatusOK || !cacheable(res.Header) || !allowed(req, res.Header) || contains(vary, "*") {
+		return res, nil
+	}
+
+	// Bodies too large to be stored are passed on as they are read.
+	body, err := io.ReadAll(io.LimitReader(res.Body, MaxBody+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if len(body) > MaxBody {
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return res, nil
+	}
+	res.Body.Close()
+
+	if len(vary) > 0 {
+		(&entry{Vary: vary}).save(t.path(req, nil))
+	}
+	e := &entry{res.StatusCode, res.Header, body, time.Now(), nil}
+	e.save(t.path(req, vary))
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	return res, nil
+}
+
+// Return the transport performing requests.
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// Return the file a request is stored in given the request headers its
+// response varies on.
+func (t *Transport) path(req *http.Request, vary []string) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, req.URL.String())
+	for _, name := range vary {
+		_, _ = fmt.Fprintf(h, "\n%s: %s", name, strings.Join(req.Header.Values(name), ", "))
+	}
+	return filepath.Join(t.Dir, hex.EncodeToString(h.Sum(nil)))
+}
+
+// Find the stored response to a request and the file it is stored in, which
+// is also where to store a new one when there is none. Responses the request
+// may not be served are left out.
+func (t *Transport) lookup(req *http.Request) (string, *entry) {
+	path := t.path(req, nil)
+	e := load(path)
+	if e != nil && len(e.Vary) > 0 {
+		path = t.path(req, e.Vary)
+		e = load(path)
+	}
+	if e == nil || e.Status == 0 || !allowed(req, e.Header) {
+		return path, nil
+	}
+	return path, e
+}
+
+// Read a stored response, if any.
+func load(path string) *entry {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil
+	}
+	e := new(entry)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil
+	}
+	return e
+}
+
+// Store a response atomically so a concurrent reader never sees half a file.
+func (e *entry) save(path string) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), path)
+}
+
+// Tell if a stored response can be used without asking the server.
+func (e *entry) fresh() bool {
+	cc := directives(e.Header.Get("Cache-Control"))
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+	if v, ok := cc["max-age"]; ok {
+		age, err := strconv.Atoi(v)
+		return err == nil && time.Since(e.Stored) < time.Duration(age)*time.Second
+	}
+	if expires, err := http.ParseTime(e.Header.Get("Expires")); err == nil {
+		return time.Now().Before(expires)
+	}
+	return false
+}
+
+// Build a response to the given request from a stored one.
+func (e *entry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(e.Status),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// Tell if a response is worth storing: either it can be revalidated or it has
+// an explicit lifetime.
+func cacheable(h http.Header) bool {
+	if nostore(h) {
+		return false
+	}
+	if _, ok := directives(h.Get("Cache-Control"))["max-age"]; ok {
+		return true
+	}
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != "" || h.Get("Expires") != ""
+}
+
+// Tell if a response may be stored for, or served to, a request. Private ones
+// never are, and those to requests carrying credentials, a token or cookies,
+// only when public, so that a token never gets the answer meant for another.
+func allowed(req *http.Request, h http.Header) bool {
+	cc := directives(h.Get("Cache-Control"))
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if req.Header.Get("Authorization") == "" && req.Header.Get("Cookie") == "" {
+		return true
+	}
+	_, ok := cc["public"]
+	return ok
+}
+
+// Return the request headers a response varies on, canonical and sorted.
+func varying(h http.Header) []string {
+	res := make([]string, 0)
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" && !contains(res, http.CanonicalHeaderKey(name)) {
+				res = append(res, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Tell if a list holds a value.
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Tell if the request asks not to be stored.
+func nostore(h http.Header) bool {
+	_, ok := directives(h.Get("Cache-Control"))["no-store"]
+	return ok
+}
+
+// Tell if the request asks for an answer the server confirmed.
+func nocache(h http.Header) bool {
+	_, ok := directives(h.Get("Cache-Control"))["no-cache"]
+	return ok || h.Get("Pragma") == "no-cache"
+}
+
+// Parse a Cache-Control header.
+func directives(h string) map[string]string {
+	res := make(map[string]string)
+	for _, part := range strings.Split(h, ",") {
+		k, v, _ := cut(strings.TrimSpace(part), "=")
+		if k != "" {
+			res[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return res
+}
+
+// Split a string around the first separator.
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
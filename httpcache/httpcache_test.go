@@ -0,0 +1,256 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"openbar/httpcache"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		header  map[string]string
+		hits    int32
+		uploads int32
+	}{
+		{
+			header:  map[string]string{"ETag": `"v1"`},
+			hits:    2,
+			uploads: 1,
+		},
+		{
+			header:  map[string]string{"Last-Modified": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			hits:    2,
+			uploads: 1,
+		},
+		{
+			header:  map[string]string{"Cache-Control": "max-age=3600"},
+			hits:    1,
+			uploads: 1,
+		},
+		{
+			header:  map[string]string{"Cache-Control": "no-store", "ETag": `"v1"`},
+			hits:    2,
+			uploads: 2,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var hits, uploads int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+				for k, v := range test.header {
+					w.Header().Set(k, v)
+				}
+				if r.Header.Get("If-None-Match") == test.header["ETag"] && test.header["ETag"] != "" ||
+					r.Header.Get("If-Modified-Since") == test.header["Last-Modified"] && test.header["Last-Modified"] != "" {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				atomic.AddInt32(&uploads, 1)
+				fmt.Fprint(w, "hello")
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+
+			// A new client each time simulates a bar restart.
+			for j := 0; j < 2; j++ {
+				client := &http.Client{Transport: httpcache.New(dir)}
+				res, err := client.Get(srv.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if string(body) != "hello" {
+					t.Errorf("want: %q, got: %q", "hello", string(body))
+				}
+			}
+
+			if hits != test.hits {
+				t.Errorf("want: %d hits, got: %d", test.hits, hits)
+			}
+			if uploads != test.uploads {
+				t.Errorf("want: %d uploads, got: %d", test.uploads, uploads)
+			}
+		})
+	}
+}
+
+func TestPrivate(t *testing.T) {
+	tests := []struct {
+		auth    string
+		cookie  string
+		control string
+		uploads int32
+	}{
+		{auth: "", control: "max-age=3600", uploads: 1},
+		{auth: "", control: "private, max-age=3600", uploads: 2},
+		{auth: "Bearer secret", control: "max-age=3600", uploads: 2},
+		{auth: "Bearer secret", control: "public, max-age=3600", uploads: 1},
+		{cookie: "session=secret", control: "max-age=3600", uploads: 2},
+		{cookie: "session=secret", control: "public, max-age=3600", uploads: 1},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var uploads int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&uploads, 1)
+				w.Header().Set("Cache-Control", test.control)
+				fmt.Fprint(w, "hello")
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+
+			for j := 0; j < 2; j++ {
+				req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if test.auth != "" {
+					req.Header.Set("Authorization", test.auth)
+				}
+				if test.cookie != "" {
+					req.Header.Set("Cookie", test.cookie)
+				}
+				client := &http.Client{Transport: httpcache.New(dir)}
+				res, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res.Body.Close()
+			}
+
+			if uploads != test.uploads {
+				t.Errorf("want: %d uploads, got: %d", test.uploads, uploads)
+			}
+		})
+	}
+}
+
+func TestVary(t *testing.T) {
+	var uploads int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&uploads, 1)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	get := func(lang string) string {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Language", lang)
+		client := &http.Client{Transport: httpcache.New(dir)}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		if got := get(lang); got != lang {
+			t.Errorf("want: %q, got: %q", lang, got)
+		}
+	}
+
+	if uploads != 2 {
+		t.Errorf("want: 2 uploads, got: %d", uploads)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	var hits, uploads int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&uploads, 1)
+		fmt.Fprint(w, "hello")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	// The fresh response is revalidated rather than served as is.
+	for _, control := range []string{"", "no-cache"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Cache-Control", control)
+		client := &http.Client{Transport: httpcache.New(dir)}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "hello" {
+			t.Errorf("want: %q, got: %q", "hello", string(body))
+		}
+	}
+
+	if hits != 2 {
+		t.Errorf("want: 2 hits, got: %d", hits)
+	}
+	if uploads != 1 {
+		t.Errorf("want: 1 uploads, got: %d", uploads)
+	}
+}
+
+func TestLarge(t *testing.T) {
+	var uploads int32
+
+	large := strings.Repeat("a", httpcache.MaxBody+1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&uploads, 1)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		fmt.Fprint(w, large)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	for j := 0; j < 2; j++ {
+		client := &http.Client{Transport: httpcache.New(dir)}
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if len(body) != len(large) {
+			t.Errorf("want: %d bytes, got: %d", len(large), len(body))
+		}
+	}
+
+	if uploads != 2 {
+		t.Errorf("want: 2 uploads, got: %d", uploads)
+	}
+}
@@ -0,0 +1,163 @@
+// Package httpclient builds the HTTP client shared by every network module so
+// that timeouts, proxy, user agent and TLS settings are configured once.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"openbar"
+	"openbar/httpcache"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DefaultUserAgent identifies requests made by the bar.
+const DefaultUserAgent = "openbar"
+
+// Config describes the shared client. The zero value is usable.
+type Config struct {
+	// Timeout bounds whole requests. Defaults to 10 seconds.
+	Timeout time.Duration
+	// Proxy is the URL of a proxy. Defaults to the environment settings.
+	Proxy string
+	// UserAgent is sent with every request. Defaults to DefaultUserAgent.
+	UserAgent string
+	// CAFile is a PEM bundle of additional trusted certificates.
+	CAFile string
+	// Insecure disables certificate verification.
+	Insecure bool
+	// CacheDir is where responses are cached. Defaults to httpcache.DefaultDir.
+	CacheDir string
+	// NoCache disables the on-disk cache.
+	NoCache bool
+}
+
+// Default is a client built from the zero configuration.
+var Default = mustNew(Config{})
+
+// New returns a client matching the configuration.
+func New(cfg Config) (*http.Client, error) {
+	base := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		TLSClientConfig:     &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		base.Proxy = http.ProxyURL(proxy)
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(filepath.Clean(cfg.CAFile))
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + cfg.CAFile)
+		}
+		base.TLSClientConfig.RootCAs = pool
+	}
+
+	//nolint:gosec
+	base.TLSClientConfig.InsecureSkipVerify = cfg.Insecure
+
+	var transport http.RoundTripper = base
+
+	if !cfg.NoCache {
+		dir := cfg.CacheDir
+		if dir == "" {
+			dir = httpcache.DefaultDir()
+		}
+		transport = &httpcache.Transport{Dir: dir, Base: transport}
+	}
+
+	ua := cfg.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: agent{ua, transport},
+	}, nil
+}
+
+// RetryAfter returns how long a server asks clients to wait before trying
+// again, zero unless it turned a request down for being made too often or
+// while it is unavailable.
+func RetryAfter(res *http.Response) time.Duration {
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	h := res.Header.Get("Retry-After")
+	if n, err := strconv.Atoi(h); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+// Refused tells the bar what to do about a request the server turned down with
+// the given response: servers asking to come back later rate limit the
+// module, see openbar.RateLimited, and rejected credentials disable it, see
+// openbar.Fatal. Other errors are returned as is. Network errors, which come
+// without response, are rather temporary, see openbar.Temporary.
+func Refused(res *http.Response, err error) error {
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return openbar.Fatal(err)
+	}
+	if d := RetryAfter(res); d > 0 {
+		return openbar.RateLimited(err, d)
+	}
+	return err
+}
+
+// Build a client from a configuration known to be valid.
+func mustNew(cfg Config) *http.Client {
+	c, err := New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// An agent sets the User-Agent header of requests that don't have one.
+type agent struct {
+	ua   string
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (a agent) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", a.ua)
+	}
+	return a.base.RoundTrip(req)
+}
@@ -0,0 +1,117 @@
+package httpclient_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"openbar"
+	"openbar/httpclient"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	tests := []struct {
+		cfg httpclient.Config
+		ua  string
+		err bool
+	}{
+		{
+			cfg: httpclient.Config{NoCache: true},
+			ua:  httpclient.DefaultUserAgent,
+			err: false,
+		},
+		{
+			cfg: httpclient.Config{UserAgent: "custom", CacheDir: "", NoCache: true},
+			ua:  "custom",
+			err: false,
+		},
+		{
+			cfg: httpclient.Config{Timeout: 10 * time.Millisecond, NoCache: true},
+			ua:  "",
+			err: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Answer too late, once the client gave up.
+				if test.err {
+					<-r.Context().Done()
+				}
+				fmt.Fprint(w, r.UserAgent())
+			}))
+			defer srv.Close()
+
+			client, err := httpclient.New(test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := client.Get(srv.URL)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+
+			buf := make([]byte, 64)
+			n, _ := res.Body.Read(buf)
+
+			if string(buf[:n]) != test.ua {
+				t.Errorf("want: %q, got: %q", test.ua, string(buf[:n]))
+			}
+		})
+	}
+}
+
+func TestRefused(t *testing.T) {
+	tests := []struct {
+		status int
+		after  string
+		kind   interface{}
+	}{
+		{status: http.StatusUnauthorized, after: "", kind: &openbar.FatalError{}},
+		{status: http.StatusForbidden, after: "", kind: &openbar.FatalError{}},
+		{status: http.StatusTooManyRequests, after: "120", kind: &openbar.RateLimitError{}},
+		{status: http.StatusServiceUnavailable, after: "120", kind: &openbar.RateLimitError{}},
+		{status: http.StatusTooManyRequests, after: "", kind: nil},
+		{status: http.StatusNotFound, after: "120", kind: nil},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			res := &http.Response{StatusCode: test.status, Header: http.Header{}}
+			if test.after != "" {
+				res.Header.Set("Retry-After", test.after)
+			}
+
+			cause := errors.New("refused")
+			err := httpclient.Refused(res, cause)
+
+			if !errors.Is(err, cause) {
+				t.Errorf("want: %v, got: %v", cause, err)
+			}
+			if test.kind == nil && err != cause {
+				t.Errorf("want: %v as is, got: %#v", cause, err)
+			}
+			if test.kind != nil && !errors.As(err, test.kind) {
+				t.Errorf("want: %T, got: %#v", test.kind, err)
+			}
+		})
+	}
+
+	limited := httpclient.Refused(&http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"120"}},
+	}, errors.New("refused"))
+
+	var limit openbar.RateLimitError
+	if !errors.As(limited, &limit) || time.Until(limit.Until) < time.Minute {
+		t.Errorf("want: rate limit for 2 minutes, got: %v", limit.Until)
+	}
+}
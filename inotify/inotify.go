@@ -0,0 +1,258 @@
+// Package inotify shares one inotify(7) instance between modules watching
+// files and directories, such as a maildir or a todo list. Paths watched by
+// several modules are only watched once.
+//
+// Files are watched through their directory so that files replaced by editors,
+// which write a new file and rename it over the old one, or created later are
+// still seen. When the kernel drops events because the queue overflowed, every
+// watcher is told that something changed since there is no way to know what.
+package inotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Events telling that the content of a directory or of a file changed.
+const events = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_ATTRIB | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// ErrClosed is returned when watching with a closed instance.
+var ErrClosed = errors.New("inotify instance closed")
+
+// Watcher is an inotify instance.
+type Watcher struct {
+	mu     sync.Mutex
+	fd     int
+	file   *os.File
+	dirs   map[string]*dir
+	wds    map[int32]*dir
+	closed bool
+}
+
+// A dir is a watched directory along with those waiting for its changes.
+type dir struct {
+	wd   int32
+	subs map[*sub]struct{}
+}
+
+// A sub waits for the changes of a directory, or of one of its entries only
+// when named.
+type sub struct {
+	name    string
+	changed func()
+}
+
+// New returns a watcher. The instance is created on first use.
+func New() *Watcher {
+	return &Watcher{dirs: make(map[string]*dir), wds: make(map[int32]*dir)}
+}
+
+var shared = New()
+
+// Shared returns the watcher shared by all modules.
+func Shared() *Watcher {
+	return shared
+}
+
+// Watch calls changed each time the given file or directory changes, until the
+// context is done. The directory of a file must exist, but the file itself may
+// not exist yet.
+func (w *Watcher) Watch(ctx context.Context, path string, changed func()) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// Directories are watched as is, anything else through its directory.
+	s := &sub{changed: changed}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		path, s.name = filepath.Dir(path), filepath.Base(path)
+	}
+
+	d, err := w.add(path, s)
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+
+	w.remove(d, s)
+
+	return nil
+}
+
+// Register a sub to a directory, watching it unless it already is.
+func (w *Watcher) add(path string, s *sub) (*dir, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	d, ok := w.dirs[path]
+	if !ok {
+		wd, err := syscall.InotifyAddWatch(w.fd, path, events|syscall.IN_ONLYDIR)
+		if err != nil {
+			return nil, fmt.Errorf("watch %s: %w", path, err)
+		}
+		// Paths reaching the same directory share its descriptor.
+		if d, ok = w.wds[int32(wd)]; !ok {
+			d = &dir{wd: int32(wd), subs: make(map[*sub]struct{})}
+			w.wds[d.wd] = d
+		}
+		w.dirs[path] = d
+	}
+
+	d.subs[s] = struct{}{}
+
+	return d, nil
+}
+
+// Unregister a sub, and stop watching its directory if it was the last one.
+func (w *Watcher) remove(d *dir, s *sub) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(d.subs, s)
+	if len(d.subs) > 0 {
+		return
+	}
+
+	for path, other := range w.dirs {
+		if other == d {
+			delete(w.dirs, path)
+		}
+	}
+
+	if w.wds[d.wd] == d {
+		delete(w.wds, d.wd)
+		if !w.closed {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(d.wd))
+		}
+	}
+}
+
+// Create the instance and start reading its events. The caller holds the lock.
+func (w *Watcher) open() error {
+	switch {
+	case w.closed:
+		return ErrClosed
+	case w.file != nil:
+		return nil
+	}
+
+	// A non-blocking descriptor is handled by the runtime poller, so that
+	// closing it wakes the reader up.
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+
+	// The descriptor is kept aside since asking the file for it would make it
+	// blocking again.
+	w.fd, w.file = fd, os.NewFile(uintptr(fd), "inotify")
+
+	go w.read()
+
+	return nil
+}
+
+// Close releases the instance. Pending watches return when their context is
+// done, and new ones fail.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// Read events until the instance is closed.
+func (w *Watcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			//nolint:gosec
+			e := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			end := start + int(e.Len)
+			if end > n {
+				break
+			}
+
+			name := string(buf[start:end])
+			for i := 0; i < len(name); i++ {
+				if name[i] == 0 {
+					name = name[:i]
+					break
+				}
+			}
+
+			w.dispatch(e.Wd, e.Mask, name)
+
+			off = end
+		}
+	}
+}
+
+// Call the subs concerned by an event. Handlers are called without the lock
+// so that they may watch or stop watching.
+func (w *Watcher) dispatch(wd int32, mask uint32, name string) {
+	var fns []func()
+
+	w.mu.Lock()
+	switch {
+	case mask&syscall.IN_Q_OVERFLOW != 0:
+		for _, d := range w.wds {
+			for s := range d.subs {
+				fns = append(fns, s.changed)
+			}
+		}
+	case w.wds[wd] != nil:
+		d := w.wds[wd]
+		for s := range d.subs {
+			// Events about the directory itself have no name and concern
+			// everyone.
+			if s.name == "" || name == "" || s.name == name {
+				fns = append(fns, s.changed)
+			}
+		}
+		// The directory is gone along with its watch. Watching it again
+		// starts over.
+		if mask&syscall.IN_IGNORED != 0 {
+			delete(w.wds, wd)
+			for path, other := range w.dirs {
+				if other == d {
+					delete(w.dirs, path)
+				}
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
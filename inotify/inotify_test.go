@@ -0,0 +1,110 @@
+package inotify_test
+
+import (
+	"context"
+	"openbar/inotify"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Wait for a change, failing after a while.
+func expect(t *testing.T, c <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("want: change of %s, got: nothing", what)
+	}
+}
+
+// Tell whether a change is pending.
+func pending(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+// Forget the changes seen so far.
+func drain(cs ...<-chan struct{}) {
+	for _, c := range cs {
+		for pending(c) {
+			continue
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	todo := filepath.Join(dir, "todo.txt")
+
+	w := inotify.New()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	files, dirs, others := make(chan struct{}, 16), make(chan struct{}, 16), make(chan struct{}, 16)
+	notify := func(c chan struct{}) func() {
+		return func() {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	errs := make(chan error, 3)
+	go func() { errs <- w.Watch(ctx, todo, notify(files)) }()
+	go func() { errs <- w.Watch(ctx, dir, notify(dirs)) }()
+	go func() { errs <- w.Watch(ctx, filepath.Join(dir, "other"), notify(others)) }()
+
+	// Watches are registered in the background: write until the file is seen.
+	deadline := time.Now().Add(5 * time.Second)
+	for !pending(files) {
+		if time.Now().After(deadline) {
+			t.Fatal("want: change of the file, got: nothing")
+		}
+		if err := os.WriteFile(todo, []byte("milk\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(t, dirs, "the directory")
+
+	// Files replaced by a rename are still seen.
+	drain(files, dirs, others)
+	tmp := filepath.Join(dir, ".todo.txt.swp")
+	if err := os.WriteFile(tmp, []byte("eggs\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, todo); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, files, "the replaced file")
+	expect(t, dirs, "the directory")
+
+	if pending(others) {
+		t.Error("want: no change of another file, got: change")
+	}
+
+	cancel()
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMissing(t *testing.T) {
+	w := inotify.New()
+	defer w.Close()
+
+	err := w.Watch(context.Background(), filepath.Join(t.TempDir(), "missing", "file"), func() {})
+	if err == nil {
+		t.Error("want: error, got: nil")
+	}
+}
@@ -0,0 +1,165 @@
+// Package location tells where the machine is, for modules depending on it
+// like weather or sunrise times, so that the location is configured once. It
+// is either given as coordinates or found with GeoClue, with coordinates as a
+// fallback when GeoClue is unavailable.
+package location
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknown is returned when the location can't be found.
+var ErrUnknown = errors.New("unknown location")
+
+// Coordinates are a position in decimal degrees.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// String implements fmt.Stringer for Coordinates.
+func (c Coordinates) String() string {
+	return fmt.Sprintf("%.4f,%.4f", c.Latitude, c.Longitude)
+}
+
+// Valid tells whether coordinates are within bounds.
+func (c Coordinates) Valid() bool {
+	return c.Latitude >= -90 && c.Latitude <= 90 && c.Longitude >= -180 && c.Longitude <= 180
+}
+
+// Provider returns the current location.
+type Provider interface {
+	Locate() (Coordinates, error)
+}
+
+// Fixed is a location that never changes.
+type Fixed Coordinates
+
+// Locate implements Provider for Fixed.
+func (f Fixed) Locate() (Coordinates, error) {
+	return Coordinates(f), nil
+}
+
+// DefaultCommand is the GeoClue demo agent printing one fix before exiting.
+var DefaultCommand = []string{"/usr/libexec/geoclue-2.0/demos/where-am-i", "-t", "30"}
+
+// MaxAge is how long a fix is reused before asking GeoClue again.
+const MaxAge = time.Hour
+
+// How long GeoClue may take to find the location.
+const timeout = time.Minute
+
+// GeoClue finds the location with the GeoClue service. Lookups are shared by
+// all modules and happen at most once per MaxAge, successful or not. When
+// GeoClue fails, the last fix is used, or the fallback if there is none yet.
+type GeoClue struct {
+	command  []string
+	fallback *Coordinates
+
+	mu    sync.Mutex
+	tried time.Time
+	found bool
+	last  Coordinates
+	err   error
+}
+
+// NewGeoClue returns a provider running the given command, DefaultCommand if
+// empty, which must print the location like where-am-i does. The fallback is
+// optional.
+func NewGeoClue(fallback *Coordinates, args ...string) *GeoClue {
+	if len(args) == 0 {
+		args = DefaultCommand
+	}
+	return &GeoClue{command: args, fallback: fallback}
+}
+
+// Locate implements Provider for GeoClue. Concurrent calls wait for the same
+// lookup rather than starting several of them.
+func (g *GeoClue) Locate() (Coordinates, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.tried.IsZero() || time.Since(g.tried) >= MaxAge {
+		g.tried = time.Now()
+		out, err := g.run()
+		if err == nil {
+			var c Coordinates
+			if c, err = Parse(string(out)); err == nil {
+				g.last, g.found = c, true
+			}
+		}
+		g.err = err
+	}
+
+	switch {
+	case g.found:
+		return g.last, nil
+	case g.fallback != nil:
+		return *g.fallback, nil
+	default:
+		return Coordinates{}, fmt.Errorf("%w: %v", ErrUnknown, g.err)
+	}
+}
+
+// Run the agent until it prints a fix.
+func (g *GeoClue) run() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	//nolint:gosec
+	cmd := exec.CommandContext(ctx, g.command[0], g.command[1:]...)
+
+	// Labels must not be translated since they are parsed.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	return cmd.Output()
+}
+
+// Parse reads the last fix printed by where-am-i:
+//
+//	Latitude:    48.856600°
+//	Longitude:   2.352200°
+func Parse(out string) (Coordinates, error) {
+	var c Coordinates
+	var lat, lon bool
+
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := field(line)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "°"), 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "Latitude":
+			c.Latitude, lat = n, true
+		case "Longitude":
+			c.Longitude, lon = n, true
+		}
+	}
+
+	if !lat || !lon || !c.Valid() {
+		return Coordinates{}, fmt.Errorf("%w: no coordinates in output", ErrUnknown)
+	}
+
+	return c, nil
+}
+
+// Split a "key: value" line.
+func field(line string) (string, string, bool) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
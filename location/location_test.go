@@ -0,0 +1,81 @@
+package location_test
+
+import (
+	"errors"
+	"fmt"
+	"openbar/location"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const fix = `Client object: /org/freedesktop/GeoClue2/Client/1
+
+New location:
+Latitude:    48.856600°
+Longitude:   2.352200°
+Accuracy:    25000.000000 meters
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		out  string
+		want location.Coordinates
+		err  bool
+	}{
+		{out: fix, want: location.Coordinates{Latitude: 48.8566, Longitude: 2.3522}},
+		{out: "Latitude: 48.8566°\n", err: true},
+		{out: "Latitude: 148°\nLongitude: 2°\n", err: true},
+		{out: "", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, err := location.Parse(test.out)
+			if (err != nil) != test.err {
+				t.Fatalf("want error: %v, got: %v", test.err, err)
+			}
+			if got != test.want {
+				t.Errorf("want: %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGeoClue(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+
+	// Lookups are shared: the agent only runs once.
+	agent := []string{"sh", "-c", fmt.Sprintf("echo >> %s; printf '%%s' '%s'", calls, fix)}
+	g := location.NewGeoClue(nil, agent...)
+
+	for i := 0; i < 2; i++ {
+		c, err := g.Locate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.String() != "48.8566,2.3522" {
+			t.Errorf("want: 48.8566,2.3522, got: %v", c)
+		}
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 {
+		t.Errorf("want: 1 lookup, got: %d", len(data))
+	}
+
+	// Without GeoClue, the fallback is used if any.
+	fallback := location.Coordinates{Latitude: 1, Longitude: 2}
+
+	if c, err := location.NewGeoClue(&fallback, "false").Locate(); err != nil || c != fallback {
+		t.Errorf("want: %v, got: %v, %v", fallback, c, err)
+	}
+
+	if _, err := location.NewGeoClue(nil, "false").Locate(); !errors.Is(err, location.ErrUnknown) {
+		t.Errorf("want: %v, got: %v", location.ErrUnknown, err)
+	}
+}
@@ -0,0 +1,300 @@
+// Package audio is an OpenBar module printing the active audio output and
+// switching between outputs, which is handy when going back and forth between
+// speakers and a headset. It talks to PipeWire (or PulseAudio) through pactl,
+// or follows PipeWire along with the other audio modules.
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"openbar"
+	"openbar/modules"
+	"openbar/pipewire"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultCommand is the pactl executable.
+var DefaultCommand = []string{"pactl"}
+
+// DefaultTimeout bounds a single pactl call.
+const DefaultTimeout = 5 * time.Second
+
+// ErrNoSink is returned when there is no output to show or switch to.
+var ErrNoSink = errors.New("no sink")
+
+// Sink is an audio output.
+type Sink struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "audio",
+		Description: "default audio output, cycling between outputs",
+		Options: []modules.Option{
+			{Name: "command", Type: modules.Strings, Default: `["pactl"]`, Description: "pactl command line"},
+			{Name: "backend", Type: modules.String, Default: `"pactl"`, Description: "pactl or pipewire"},
+		},
+		Requires: []string{"pactl or pw-dump"},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			switch {
+			case err != nil:
+				return nil, err
+			case opts.Backend == "pipewire":
+				return pipewire.Commands(), nil
+			default:
+				return [][]string{opts.Command}, nil
+			}
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+		switch opts.Backend {
+		case "pactl":
+		case "pipewire":
+			return PipeWire(pipewire.Shared()), nil
+		default:
+			return nil, fmt.Errorf("unknown backend: %s", opts.Backend)
+		}
+		if len(opts.Command) == 0 {
+			return nil, errors.New("empty command")
+		}
+		return New(opts.Command...), nil
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Command []string `json:"command"`
+	Backend string   `json:"backend"`
+}
+
+// Read the options of the module, falling back to defaults.
+func parse(options json.RawMessage) (settings, error) {
+	res := settings{Command: DefaultCommand, Backend: "pactl"}
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// Switcher shows the default sink and cycles through sinks.
+type Switcher struct {
+	command []string
+}
+
+// New returns a switcher running the given pactl command.
+func New(command ...string) *Switcher {
+	return &Switcher{command: command}
+}
+
+// FullText prints the description of the default sink.
+func (s *Switcher) FullText() (string, error) {
+	sinks, current, err := s.state()
+	if err != nil {
+		return "", err
+	}
+
+	for _, sink := range sinks {
+		if sink.Name == current {
+			return sink.Description, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNoSink, current)
+}
+
+// Cycle makes the sink following the current one the default.
+func (s *Switcher) Cycle() error {
+	sinks, current, err := s.state()
+	if err != nil {
+		return err
+	}
+
+	if len(sinks) == 0 {
+		return ErrNoSink
+	}
+
+	next := sinks[0]
+	for i, sink := range sinks {
+		if sink.Name == current {
+			next = sinks[(i+1)%len(sinks)]
+			break
+		}
+	}
+
+	_, err = s.pactl("set-default-sink", next.Name)
+
+	return err
+}
+
+// Click implements openbar.ClickHandler: a left click switches to the next
+// sink.
+func (s *Switcher) Click(c openbar.Click) error {
+	if c.Button != openbar.LeftButton {
+		return nil
+	}
+	return s.Cycle()
+}
+
+// Fetch the sinks along with the name of the default one.
+func (s *Switcher) state() ([]Sink, string, error) {
+	info, err := s.pactl("info")
+	if err != nil {
+		return nil, "", err
+	}
+
+	list, err := s.pactl("list", "sinks")
+	if err != nil {
+		return nil, "", err
+	}
+
+	sinks, err := Parse(bytes.NewReader(list))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sinks, field(info, "Default Sink"), nil
+}
+
+// Run pactl with the given arguments.
+func (s *Switcher) pactl(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	args = append(append([]string{}, s.command[1:]...), args...)
+
+	//nolint:gosec
+	cmd := exec.CommandContext(ctx, s.command[0], args...)
+
+	// Labels must not be translated since they are parsed.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	return cmd.Output()
+}
+
+// Daemon is the part of PipeWire the module relies on.
+type Daemon interface {
+	Graph() (pipewire.Graph, error)
+	SetDefault(class, name string) error
+	Notify(ctx context.Context, changed func()) error
+}
+
+// Module shows the default sink of PipeWire and cycles through sinks. Unlike
+// Switcher, it is refreshed as soon as the default sink changes.
+type Module struct {
+	daemon Daemon
+}
+
+// PipeWire returns a module following the given daemon.
+func PipeWire(d Daemon) *Module {
+	return &Module{d}
+}
+
+// FullText prints the description of the default sink.
+func (m *Module) FullText() (string, error) {
+	g, err := m.daemon.Graph()
+	if err != nil {
+		return "", err
+	}
+
+	sink, err := g.Default(pipewire.Sink)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoSink, err)
+	}
+
+	return sink.Description, nil
+}
+
+// Cycle makes the sink following the current one the default.
+func (m *Module) Cycle() error {
+	g, err := m.daemon.Graph()
+	if err != nil {
+		return err
+	}
+
+	sinks := g.Class(pipewire.Sink)
+	if len(sinks) == 0 {
+		return ErrNoSink
+	}
+
+	next := sinks[0]
+	for i, sink := range sinks {
+		if sink.Name == g.Defaults[pipewire.Sink] {
+			next = sinks[(i+1)%len(sinks)]
+			break
+		}
+	}
+
+	return m.daemon.SetDefault(pipewire.Sink, next.Name)
+}
+
+// Click implements openbar.ClickHandler: a left click switches to the next
+// sink.
+func (m *Module) Click(c openbar.Click) error {
+	if c.Button != openbar.LeftButton {
+		return nil
+	}
+	return m.Cycle()
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.daemon.Notify(ctx, changed)
+}
+
+// Parse reads the output of `pactl list sinks`.
+func Parse(r io.Reader) ([]Sink, error) {
+	res := make([]Sink, 0)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "Sink #") {
+			res = append(res, Sink{})
+			continue
+		}
+
+		if len(res) == 0 {
+			continue
+		}
+
+		cur := &res[len(res)-1]
+
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "Name":
+			cur.Name = strings.TrimSpace(parts[1])
+		case "Description":
+			cur.Description = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return res, scanner.Err()
+}
+
+// Find the value of a "Key: value" line.
+func field(data []byte, key string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return ""
+}
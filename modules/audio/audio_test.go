@@ -0,0 +1,117 @@
+package audio_test
+
+import (
+	"context"
+	"openbar"
+	"openbar/modules/audio"
+	"openbar/pipewire"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A fake pactl keeping the default sink in a file.
+const script = `#!/bin/sh
+state="$(dirname "$0")/default"
+case "$1" in
+info) echo "Server Name: PulseAudio (on PipeWire 1.0.0)"; echo "Default Sink: $(cat "$state")" ;;
+list) cat <<EOF
+Sink #48
+	State: RUNNING
+	Name: alsa_output.pci-0000_00_1f.3.analog-stereo
+	Description: Built-in Audio Analog Stereo
+Sink #63
+	State: SUSPENDED
+	Name: bluez_output.00_11_22_33_44_55.1
+	Description: WH-1000XM4
+EOF
+;;
+set-default-sink) echo "$2" > "$state" ;;
+esac
+`
+
+func TestSwitcher(t *testing.T) {
+	dir := t.TempDir()
+	pactl := filepath.Join(dir, "pactl")
+
+	if err := os.WriteFile(pactl, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	state := []byte("alsa_output.pci-0000_00_1f.3.analog-stereo\n")
+	if err := os.WriteFile(filepath.Join(dir, "default"), state, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := audio.New(pactl)
+
+	for _, want := range []string{
+		"Built-in Audio Analog Stereo",
+		"WH-1000XM4",
+		"Built-in Audio Analog Stereo",
+	} {
+		out, err := s.FullText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("want: %q, got: %q", want, out)
+		}
+		if err := s.Cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// A PipeWire daemon keeping the default sink.
+type daemon struct {
+	graph pipewire.Graph
+}
+
+func (d *daemon) Graph() (pipewire.Graph, error) {
+	return d.graph, nil
+}
+
+func (d *daemon) SetDefault(class, name string) error {
+	d.graph.Defaults[class] = name
+	return nil
+}
+
+func (d *daemon) Notify(ctx context.Context, _ func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestPipeWire(t *testing.T) {
+	d := &daemon{pipewire.Graph{
+		Nodes: []pipewire.Node{
+			{Name: "speakers", Description: "Built-in Audio Analog Stereo", Class: pipewire.Sink},
+			{Name: "mic", Description: "Microphone", Class: pipewire.Source},
+			{Name: "headset", Description: "WH-1000XM4", Class: pipewire.Sink},
+		},
+		Defaults: map[string]string{pipewire.Sink: "speakers", pipewire.Source: "mic"},
+	}}
+
+	m := audio.PipeWire(d)
+
+	for _, want := range []string{
+		"Built-in Audio Analog Stereo",
+		"WH-1000XM4",
+		"Built-in Audio Analog Stereo",
+	} {
+		out, err := m.FullText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("want: %q, got: %q", want, out)
+		}
+		if err := m.Click(openbar.Click{Button: openbar.LeftButton}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d.graph.Defaults[pipewire.Source] != "mic" {
+		t.Errorf("want: mic, got: %s", d.graph.Defaults[pipewire.Source])
+	}
+}
@@ -0,0 +1,169 @@
+// Package battery is an OpenBar module printing the charge of a laptop battery
+// from sysfs or UPower. The verbose format adds charge cycles, health and power
+// draw.
+package battery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"openbar/upower"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultDir is where the kernel exposes power supplies.
+const DefaultDir = "/sys/class/power_supply"
+
+// DefaultName is the battery read unless told otherwise.
+const DefaultName = "BAT0"
+
+// ErrMissing is returned when an attribute isn't exposed by the battery.
+var ErrMissing = errors.New("missing attribute")
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "battery",
+		Description: "laptop battery charge, health and power draw",
+		Options: []modules.Option{
+			{Name: "name", Type: modules.String, Default: `"BAT0"`, Description: "power supply in /sys/class/power_supply"},
+			{Name: "verbose", Type: modules.Bool, Default: "false", Description: "add cycles, health and power draw"},
+			{Name: "backend", Type: modules.String, Default: `"sysfs"`, Description: "sysfs, or upower to refresh on changes"},
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Name    string `json:"name"`
+			Verbose bool   `json:"verbose"`
+			Backend string `json:"backend"`
+		}{Name: DefaultName, Backend: "sysfs"}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		switch opts.Backend {
+		case "sysfs":
+			return openbar.ModuleFunc(New(filepath.Join(DefaultDir, opts.Name), opts.Verbose)), nil
+		case "upower":
+			return UPower(upower.System(), opts.Name, opts.Verbose), nil
+		default:
+			return nil, fmt.Errorf("unknown backend: %s", opts.Backend)
+		}
+	})
+}
+
+// New returns a module reading the battery at the given sysfs directory. Verbose
+// output is "85% Discharging 312 cycles 91% health 7.5W", where values the
+// battery doesn't report are left out.
+func New(dir string, verbose bool) func() (string, error) {
+	return func() (string, error) {
+		b := battery(dir)
+
+		capacity, err := b.int("capacity")
+		if err != nil {
+			return "", err
+		}
+
+		status, err := b.string("status")
+		if err != nil {
+			return "", err
+		}
+
+		fields := []string{fmt.Sprintf("%d%%", capacity), status}
+
+		if verbose {
+			fields = append(fields, b.details()...)
+		}
+
+		return strings.Join(fields, " "), nil
+	}
+}
+
+// A battery is its sysfs directory.
+type battery string
+
+// Optional attributes, each skipped when unavailable.
+func (b battery) details() []string {
+	res := make([]string, 0, 3)
+
+	if cycles, err := b.int("cycle_count"); err == nil && cycles > 0 {
+		res = append(res, fmt.Sprintf("%d cycles", cycles))
+	}
+
+	if health, err := b.health(); err == nil {
+		res = append(res, fmt.Sprintf("%.0f%% health", health))
+	}
+
+	if watts, err := b.power(); err == nil {
+		res = append(res, fmt.Sprintf("%.1fW", watts))
+	}
+
+	return res
+}
+
+// Health is the full capacity compared to the design capacity. Batteries report
+// either energy (µWh) or charge (µAh).
+func (b battery) health() (float64, error) {
+	for _, unit := range []string{"energy", "charge"} {
+		full, err := b.int(unit + "_full")
+		if err != nil {
+			continue
+		}
+		design, err := b.int(unit + "_full_design")
+		if err != nil || design <= 0 {
+			continue
+		}
+		return 100 * float64(full) / float64(design), nil
+	}
+	return 0, ErrMissing
+}
+
+// Power draw in watts, from power (µW) or from current (µA) and voltage (µV).
+func (b battery) power() (float64, error) {
+	if power, err := b.int("power_now"); err == nil {
+		return float64(abs(power)) / 1e6, nil
+	}
+
+	current, err := b.int("current_now")
+	if err != nil {
+		return 0, err
+	}
+
+	voltage, err := b.int("voltage_now")
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(abs(current)) * float64(voltage) / 1e12, nil
+}
+
+// Read an attribute as text.
+func (b battery) string(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(string(b), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrMissing, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Read an attribute as an integer.
+func (b battery) int(name string) (int64, error) {
+	s, err := b.string(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Some drivers report negative values when discharging.
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
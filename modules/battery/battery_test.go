@@ -0,0 +1,133 @@
+package battery_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openbar/modules/battery"
+	"openbar/upower"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBattery(t *testing.T) {
+	tests := []struct {
+		attrs   map[string]string
+		verbose bool
+		out     string
+		err     error
+	}{
+		{
+			attrs:   map[string]string{"capacity": "85", "status": "Discharging"},
+			verbose: false,
+			out:     "85% Discharging",
+			err:     nil,
+		},
+		{
+			attrs: map[string]string{
+				"capacity":           "85",
+				"status":             "Discharging",
+				"cycle_count":        "312",
+				"energy_full":        "45500000",
+				"energy_full_design": "50000000",
+				"power_now":          "7512000",
+			},
+			verbose: true,
+			out:     "85% Discharging 312 cycles 91% health 7.5W",
+			err:     nil,
+		},
+		{
+			attrs: map[string]string{
+				"capacity":           "100",
+				"status":             "Full",
+				"cycle_count":        "0",
+				"charge_full":        "4000000",
+				"charge_full_design": "5000000",
+				"current_now":        "-1000000",
+				"voltage_now":        "12000000",
+			},
+			verbose: true,
+			out:     "100% Full 80% health 12.0W",
+			err:     nil,
+		},
+		{
+			attrs:   map[string]string{"status": "Full"},
+			verbose: false,
+			out:     "",
+			err:     battery.ErrMissing,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			dir := t.TempDir()
+			for name, value := range test.attrs {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			out, err := battery.New(dir, test.verbose)()
+
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+// A daemon knowing a fixed set of devices.
+type daemon []upower.Device
+
+func (d daemon) Devices() ([]upower.Device, error) { return d, nil }
+
+func (d daemon) Notify(ctx context.Context, _ func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestUPower(t *testing.T) {
+	devices := daemon{
+		{NativePath: "AC", Kind: upower.LinePower, PowerSupply: true, Online: true},
+		{NativePath: "hidpp_battery_0", Kind: upower.Kind(5), Percentage: 40},
+		{
+			NativePath:   "BAT0",
+			Kind:         upower.Battery,
+			PowerSupply:  true,
+			Percentage:   85,
+			State:        upower.Discharging,
+			ChargeCycles: 312,
+			Capacity:     91,
+			EnergyRate:   7.512,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		verbose bool
+		out     string
+		err     error
+	}{
+		{name: "BAT0", verbose: false, out: "85% Discharging", err: nil},
+		{name: "BAT0", verbose: true, out: "85% Discharging 312 cycles 91% health 7.5W", err: nil},
+		{name: "BAT1", verbose: false, out: "", err: battery.ErrNotFound},
+		{name: "hidpp_battery_0", verbose: false, out: "", err: battery.ErrNotFound},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := battery.UPower(devices, test.name, test.verbose).FullText()
+
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package battery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openbar/upower"
+	"strings"
+)
+
+// ErrNotFound is returned when UPower doesn't know the battery.
+var ErrNotFound = errors.New("battery not found")
+
+// Daemon is the part of UPower the module relies on.
+type Daemon interface {
+	Devices() ([]upower.Device, error)
+	Notify(ctx context.Context, changed func()) error
+}
+
+// Statuses of the charging states, named like sysfs does.
+var statuses = map[upower.State]string{
+	upower.Charging:         "Charging",
+	upower.Discharging:      "Discharging",
+	upower.Empty:            "Empty",
+	upower.FullyCharged:     "Full",
+	upower.PendingCharge:    "Not charging",
+	upower.PendingDischarge: "Not charging",
+}
+
+// Module reads a battery from UPower and is refreshed as soon as it changes.
+type Module struct {
+	daemon  Daemon
+	name    string
+	verbose bool
+}
+
+// UPower returns a module reading the battery with the given native path, like
+// BAT0. Its output is the same as the one read from sysfs.
+func UPower(d Daemon, name string, verbose bool) *Module {
+	return &Module{d, name, verbose}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	devices, err := m.daemon.Devices()
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range devices {
+		if d.Kind == upower.Battery && d.PowerSupply && d.NativePath == m.name {
+			return m.format(d), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNotFound, m.name)
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.daemon.Notify(ctx, changed)
+}
+
+// Print a battery like New does, leaving out what UPower doesn't report.
+func (m *Module) format(d upower.Device) string {
+	status, ok := statuses[d.State]
+	if !ok {
+		status = "Unknown"
+	}
+
+	fields := []string{fmt.Sprintf("%.0f%%", d.Percentage), status}
+
+	if m.verbose {
+		if d.ChargeCycles > 0 {
+			fields = append(fields, fmt.Sprintf("%d cycles", d.ChargeCycles))
+		}
+		if d.Capacity > 0 {
+			fields = append(fields, fmt.Sprintf("%.0f%% health", d.Capacity))
+		}
+		if d.EnergyRate > 0 {
+			fields = append(fields, fmt.Sprintf("%.1fW", d.EnergyRate))
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,16 @@
+// Package builtin links the built-in modules into the binary. Modules with
+// heavier requirements are grouped behind build tags so that a minimal binary
+// only contains what is needed:
+//
+//	nosway      outputs, lock (Sway IPC, swayidle)
+//	nodesktop   audio, camera, clipboard, mic, peripherals, power, presentation,
+//	            volume (session services)
+//	nonetwork   cert, connectivity, dns, homeassistant, httpjson, matrix,
+//	            mentions, mqtt, nextcloud, port, speedtest, vpn, wifi,
+//	            wsjson
+//	nohardware  battery, hog, powerprofile
+//
+// Modules without requirements, like sun, are always there. Modules left out
+// are still known by name so that configurations using them fail with an
+// explanation rather than an unknown module error.
+package builtin
@@ -0,0 +1,5 @@
+package builtin
+
+import (
+	_ "openbar/modules/sun"
+)
@@ -0,0 +1,13 @@
+//go:build !nodesktop
+
+package builtin
+
+import (
+	_ "openbar/modules/audio"
+	_ "openbar/modules/camera"
+	_ "openbar/modules/clipboard"
+	_ "openbar/modules/peripherals"
+	_ "openbar/modules/power"
+	_ "openbar/modules/presentation"
+	_ "openbar/modules/volume"
+)
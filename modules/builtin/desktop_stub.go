@@ -0,0 +1,16 @@
+//go:build nodesktop
+
+package builtin
+
+import "openbar/modules"
+
+func init() {
+	modules.Disable("audio", "nodesktop")
+	modules.Disable("camera", "nodesktop")
+	modules.Disable("clipboard", "nodesktop")
+	modules.Disable("mic", "nodesktop")
+	modules.Disable("peripherals", "nodesktop")
+	modules.Disable("power", "nodesktop")
+	modules.Disable("presentation", "nodesktop")
+	modules.Disable("volume", "nodesktop")
+}
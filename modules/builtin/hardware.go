@@ -0,0 +1,9 @@
+//go:build !nohardware
+
+package builtin
+
+import (
+	_ "openbar/modules/battery"
+	_ "openbar/modules/hog"
+	_ "openbar/modules/powerprofile"
+)
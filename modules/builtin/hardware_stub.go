@@ -0,0 +1,11 @@
+//go:build nohardware
+
+package builtin
+
+import "openbar/modules"
+
+func init() {
+	modules.Disable("battery", "nohardware")
+	modules.Disable("hog", "nohardware")
+	modules.Disable("powerprofile", "nohardware")
+}
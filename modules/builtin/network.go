@@ -0,0 +1,20 @@
+//go:build !nonetwork
+
+package builtin
+
+import (
+	_ "openbar/modules/cert"
+	_ "openbar/modules/connectivity"
+	_ "openbar/modules/dns"
+	_ "openbar/modules/homeassistant"
+	_ "openbar/modules/httpjson"
+	_ "openbar/modules/matrix"
+	_ "openbar/modules/mentions"
+	_ "openbar/modules/nextcloud"
+	_ "openbar/modules/port"
+	_ "openbar/modules/speedtest"
+	_ "openbar/modules/topic"
+	_ "openbar/modules/vpn"
+	_ "openbar/modules/wifi"
+	_ "openbar/modules/wsjson"
+)
@@ -0,0 +1,22 @@
+//go:build nonetwork
+
+package builtin
+
+import "openbar/modules"
+
+func init() {
+	modules.Disable("cert", "nonetwork")
+	modules.Disable("connectivity", "nonetwork")
+	modules.Disable("dns", "nonetwork")
+	modules.Disable("homeassistant", "nonetwork")
+	modules.Disable("httpjson", "nonetwork")
+	modules.Disable("matrix", "nonetwork")
+	modules.Disable("mentions", "nonetwork")
+	modules.Disable("mqtt", "nonetwork")
+	modules.Disable("nextcloud", "nonetwork")
+	modules.Disable("port", "nonetwork")
+	modules.Disable("speedtest", "nonetwork")
+	modules.Disable("vpn", "nonetwork")
+	modules.Disable("wifi", "nonetwork")
+	modules.Disable("wsjson", "nonetwork")
+}
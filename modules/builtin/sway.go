@@ -0,0 +1,8 @@
+//go:build !nosway
+
+package builtin
+
+import (
+	_ "openbar/modules/lock"
+	_ "openbar/modules/outputs"
+)
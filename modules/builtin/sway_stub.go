@@ -0,0 +1,10 @@
+//go:build nosway
+
+package builtin
+
+import "openbar/modules"
+
+func init() {
+	modules.Disable("outputs", "nosway")
+	modules.Disable("lock", "nosway")
+}
@@ -0,0 +1,66 @@
+// Package camera is an OpenBar module printing the cameras in use, as a
+// reminder that someone may be watching. It shares the connection to PipeWire
+// with the audio modules and is refreshed as soon as a camera starts or stops.
+package camera
+
+import (
+	"context"
+	"encoding/json"
+	"openbar"
+	"openbar/modules"
+	"openbar/pipewire"
+	"strings"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "camera",
+		Description: "cameras in use",
+		Requires:    []string{"pw-dump"},
+		Commands: func(json.RawMessage) ([][]string, error) {
+			return pipewire.Commands(), nil
+		},
+	}, func(_ modules.Env, _ json.RawMessage) (openbar.Module, error) {
+		return New(pipewire.Shared()), nil
+	})
+}
+
+// Daemon is the part of PipeWire the module relies on.
+type Daemon interface {
+	Graph() (pipewire.Graph, error)
+	Notify(ctx context.Context, changed func()) error
+}
+
+// Module prints the cameras in use.
+type Module struct {
+	daemon Daemon
+}
+
+// New returns a module reading the given daemon. The output lists the
+// descriptions of the cameras in use, like "Webcam", and is empty while none
+// is.
+func New(d Daemon) *Module {
+	return &Module{d}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	g, err := m.daemon.Graph()
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0)
+	for _, n := range g.Class(pipewire.Camera) {
+		if n.State == "running" {
+			names = append(names, n.Description)
+		}
+	}
+
+	return strings.Join(names, ", "), nil
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.daemon.Notify(ctx, changed)
+}
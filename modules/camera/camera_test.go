@@ -0,0 +1,56 @@
+package camera_test
+
+import (
+	"context"
+	"fmt"
+	"openbar/modules/camera"
+	"openbar/pipewire"
+	"testing"
+)
+
+// A daemon with a fixed graph.
+type daemon struct {
+	graph pipewire.Graph
+}
+
+func (d daemon) Graph() (pipewire.Graph, error) {
+	return d.graph, nil
+}
+
+func (d daemon) Notify(ctx context.Context, _ func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestCamera(t *testing.T) {
+	tests := []struct {
+		nodes []pipewire.Node
+		want  string
+	}{
+		{
+			nodes: []pipewire.Node{{Class: pipewire.Camera, Description: "Webcam", State: "suspended"}},
+			want:  "",
+		},
+		{
+			nodes: []pipewire.Node{
+				{Class: pipewire.Camera, Description: "Webcam", State: "running"},
+				{Class: pipewire.Camera, Description: "IR Camera", State: "idle"},
+				{Class: pipewire.Source, Description: "Microphone", State: "running"},
+				{Class: pipewire.Camera, Description: "Capture Card", State: "running"},
+			},
+			want: "Webcam, Capture Card",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := camera.New(daemon{pipewire.Graph{Nodes: test.nodes}}).FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.want {
+				t.Errorf("want: %q, got: %q", test.want, out)
+			}
+		})
+	}
+}
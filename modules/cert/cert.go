@@ -0,0 +1,157 @@
+// Package cert is an OpenBar module printing how many days are left before the
+// TLS certificates of some hosts expire, so that self-hosted services don't
+// break by surprise.
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"openbar"
+	"openbar/modules"
+	"sync"
+	"time"
+)
+
+// Expired is printed once a certificate expired.
+const Expired = "expired"
+
+// DefaultWarn is how many days before expiry the block turns urgent.
+const DefaultWarn = 14
+
+// DefaultTimeout bounds the handshake with a single host.
+const DefaultTimeout = 10 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "cert",
+		Description: "days left before TLS certificates expire",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "hosts", Type: modules.Strings, Description: "HOST[:PORT] to check, port 443 by default"},
+			{Name: "warn", Type: modules.Int, Default: "14", Description: "days left under which the block is urgent"},
+			{Name: "timeout", Type: modules.Duration, Default: `"10s"`, Description: "maximum time for a single host"},
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Hosts   []string `json:"hosts"`
+			Warn    *int     `json:"warn"`
+			Timeout string   `json:"timeout"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if len(opts.Hosts) == 0 {
+			return nil, errors.New("missing hosts")
+		}
+		warn := DefaultWarn
+		if opts.Warn != nil {
+			warn = *opts.Warn
+		}
+		timeout := DefaultTimeout
+		if opts.Timeout != "" {
+			d, err := time.ParseDuration(opts.Timeout)
+			if err != nil {
+				return nil, err
+			}
+			timeout = d
+		}
+		return New(opts.Hosts, warn, timeout), nil
+	})
+}
+
+// Module prints the days left before the first certificate of its hosts
+// expires, preceded by the host when there are several.
+type Module struct {
+	hosts   []string
+	warn    int
+	timeout time.Duration
+
+	mu   sync.Mutex
+	days int
+}
+
+// New returns a module checking the given hosts, urgent when a certificate
+// expires in less than warn days.
+func New(hosts []string, warn int, timeout time.Duration) *Module {
+	return &Module{hosts: hosts, warn: warn, timeout: timeout}
+}
+
+// FullText implements openbar.Module.
+func (m *Module) FullText() (string, error) {
+	return m.FullTextContext(context.Background())
+}
+
+// FullTextContext implements openbar.ContextModule. Hosts are checked one
+// after the other and the first failure is returned.
+func (m *Module) FullTextContext(ctx context.Context) (string, error) {
+	first, host := time.Time{}, ""
+	for _, h := range m.hosts {
+		expiry, err := m.expiry(ctx, h)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", h, err)
+		}
+		if first.IsZero() || expiry.Before(first) {
+			first, host = expiry, h
+		}
+	}
+
+	left := time.Until(first)
+	days := int(left / (24 * time.Hour))
+
+	m.mu.Lock()
+	m.days = days
+	m.mu.Unlock()
+
+	text := fmt.Sprintf("%dd", days)
+	if left <= 0 {
+		text = Expired
+	}
+	if len(m.hosts) > 1 {
+		text = host + " " + text
+	}
+
+	return text, nil
+}
+
+// Urgent implements openbar.Urgenter.
+func (m *Module) Urgent() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.days < m.warn
+}
+
+// Return when the first certificate a host presents expires. Certificates are
+// not verified: the module is about expiry, and self-signed ones expire too.
+func (m *Module) expiry(ctx context.Context, host string) (time.Time, error) {
+	addr := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(host, "443")
+	}
+	name, _, _ := net.SplitHostPort(addr)
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	d := tls.Dialer{Config: &tls.Config{ServerName: name, InsecureSkipVerify: true}} //nolint:gosec
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+
+	var first time.Time
+	for _, c := range conn.(*tls.Conn).ConnectionState().PeerCertificates {
+		if first.IsZero() || c.NotAfter.Before(first) {
+			first = c.NotAfter
+		}
+	}
+	if first.IsZero() {
+		return time.Time{}, errors.New("no certificate")
+	}
+
+	return first, nil
+}
@@ -0,0 +1,102 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"openbar/modules/cert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a TLS server whose certificate expires after the given time and
+// return its address.
+func serve(t *testing.T, left time.Duration) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(left),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestCert(t *testing.T) {
+	soon, later := serve(t, 3*24*time.Hour+time.Hour), serve(t, 100*24*time.Hour+time.Hour)
+
+	tests := []struct {
+		hosts  []string
+		out    string
+		urgent bool
+	}{
+		{hosts: []string{later}, out: "100d", urgent: false},
+		{hosts: []string{later, soon}, out: soon + " 3d", urgent: true},
+		{hosts: []string{serve(t, -time.Hour)}, out: cert.Expired, urgent: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			m := cert.New(test.hosts, cert.DefaultWarn, time.Second)
+
+			out, err := m.FullTextContext(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out || m.Urgent() != test.urgent {
+				t.Errorf("want: %q (urgent: %v), got: %q (urgent: %v)", test.out, test.urgent, out, m.Urgent())
+			}
+		})
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err = cert.New([]string{addr}, cert.DefaultWarn, time.Second).FullText()
+	if err == nil || !strings.HasPrefix(err.Error(), addr+": ") {
+		t.Errorf("want: an error about %s, got: %v", addr, err)
+	}
+}
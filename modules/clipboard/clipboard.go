@@ -0,0 +1,153 @@
+// Package clipboard is an OpenBar module printing how many entries a Wayland
+// clipboard manager keeps, and clearing them on demand. Both cliphist and
+// clipman are supported.
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DefaultTimeout bounds a single call to the clipboard manager.
+const DefaultTimeout = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "clipboard",
+		Description: "number of clipboard history entries",
+		Options: []modules.Option{
+			{Name: "manager", Type: modules.String, Default: `"cliphist"`, Description: "cliphist or clipman"},
+			{Name: "history", Type: modules.String, Default: `"~/.local/share/clipman.json"`, Description: "history file of clipman"},
+		},
+		Requires: []string{"cliphist or clipman"},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			if err != nil {
+				return nil, err
+			}
+			return [][]string{{opts.Manager}}, nil
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+		switch opts.Manager {
+		case "cliphist":
+			return Cliphist(), nil
+		case "clipman":
+			if opts.History == "" {
+				opts.History = DefaultClipmanHistory()
+			}
+			return Clipman(opts.History), nil
+		default:
+			return nil, fmt.Errorf("unknown manager: %s", opts.Manager)
+		}
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Manager string `json:"manager"`
+	History string `json:"history"`
+}
+
+// Read the options of the module, falling back to defaults.
+func parse(options json.RawMessage) (settings, error) {
+	res := settings{Manager: "cliphist"}
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// Module shows the number of entries in the clipboard history.
+type Module struct {
+	count func() (int, error)
+	clear []string
+}
+
+// Cliphist returns a module for cliphist.
+func Cliphist() *Module {
+	return &Module{
+		count: func() (int, error) {
+			out, err := run("cliphist", "list")
+			if err != nil {
+				return 0, err
+			}
+			return bytes.Count(out, []byte{0x0A}), nil
+		},
+		clear: []string{"cliphist", "wipe"},
+	}
+}
+
+// Clipman returns a module for clipman storing its history at the given path.
+func Clipman(history string) *Module {
+	return &Module{
+		count: func() (int, error) {
+			data, err := os.ReadFile(filepath.Clean(history))
+			if os.IsNotExist(err) {
+				return 0, nil
+			}
+			if err != nil {
+				return 0, err
+			}
+			entries := make([]string, 0)
+			if err := json.Unmarshal(data, &entries); err != nil {
+				return 0, err
+			}
+			return len(entries), nil
+		},
+		clear: []string{"clipman", "clear", "--all", "--histpath=" + history},
+	}
+}
+
+// DefaultClipmanHistory is where clipman keeps its history by default.
+func DefaultClipmanHistory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "clipman.json")
+}
+
+// FullText prints the number of entries, like "12 clips".
+func (m *Module) FullText() (string, error) {
+	n, err := m.count()
+	if err != nil {
+		return "", err
+	}
+	if n == 1 {
+		return "1 clip", nil
+	}
+	return fmt.Sprintf("%d clips", n), nil
+}
+
+// Clear removes every entry from the history.
+func (m *Module) Clear() error {
+	_, err := run(m.clear...)
+	return err
+}
+
+// Click implements openbar.ClickHandler: a middle click clears the history.
+func (m *Module) Click(c openbar.Click) error {
+	if c.Button != openbar.MiddleButton {
+		return nil
+	}
+	return m.Clear()
+}
+
+// Run a command and return its output.
+func run(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	//nolint:gosec
+	return exec.CommandContext(ctx, args[0], args[1:]...).Output()
+}
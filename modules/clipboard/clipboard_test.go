@@ -0,0 +1,69 @@
+package clipboard_test
+
+import (
+	"openbar/modules/clipboard"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Install a fake executable in a directory prepended to PATH.
+func fake(t *testing.T, name, script string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCliphist(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(state, []byte("1\tfoo\n2\tbar\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake(t, "cliphist", `case "$1" in
+list) cat "`+state+`" ;;
+wipe) : > "`+state+`" ;;
+esac
+`)
+
+	m := clipboard.Cliphist()
+
+	for _, want := range []string{"2 clips", "0 clips"} {
+		out, err := m.FullText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("want: %q, got: %q", want, out)
+		}
+		if err := m.Clear(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClipman(t *testing.T) {
+	history := filepath.Join(t.TempDir(), "clipman.json")
+	if err := os.WriteFile(history, []byte(`["foo"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake(t, "clipman", `rm -f "${3#--histpath=}"`)
+
+	m := clipboard.Clipman(history)
+
+	for _, want := range []string{"1 clip", "0 clips"} {
+		out, err := m.FullText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("want: %q, got: %q", want, out)
+		}
+		if err := m.Clear(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -3,21 +3,177 @@ package command
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// ErrTimeout is returned when a command is killed for running too long.
+var ErrTimeout = errors.New("timeout")
+
+// Commands currently running, so they can be killed on shutdown.
+var children = struct {
+	sync.Mutex
+	running map[*exec.Cmd]struct{}
+}{running: make(map[*exec.Cmd]struct{})}
+
+// Kill terminates every command still running along with the processes they
+// spawned. It is meant to be called on shutdown so that no process outlives the
+// bar.
+func Kill() {
+	children.Lock()
+	defer children.Unlock()
+	for cmd := range children.running {
+		kill(cmd)
+	}
+}
+
+// Live returns the number of commands currently running.
+func Live() int {
+	children.Lock()
+	defer children.Unlock()
+	return len(children.running)
+}
+
+// Spawn starts a command without waiting for it, for instance to open an
+// application on click. It is not killed along with the bar. The returned
+// channel gets the result of the command once it exits.
+func Spawn(args ...string) (<-chan error, error) {
+	//nolint:gosec
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	return done, nil
+}
+
+// Options are the settings of a command module.
+type Options struct {
+	// Timeout kills the command if it runs for longer. Zero means no timeout.
+	Timeout time.Duration
+	// Nice is the CPU priority of the command, from -20 to 19, like nice(1).
+	Nice int
+	// IOPriority sets the IO scheduling of the command, like ionice(1).
+	IOPriority IOPriority
+	// Name attributes log lines to the module. It defaults to the executable.
+	Name string
+}
+
 // New returns a new command module.
 func New(args ...string) func() (string, error) {
+	return NewWithOptions(Options{}, args...)
+}
+
+// NewWithOptions returns a new command module with the given settings.
+func NewWithOptions(opts Options, args ...string) func() (string, error) {
 	return func() (string, error) {
-		return do(args...)
+		out, err := do(context.Background(), opts, args...)
+		return out.full, err
+	}
+}
+
+// Module is a command module keeping what the command wrote to standard error.
+// Each line is also logged, at a limited rate so that a noisy command can't
+// flood the log.
+type Module struct {
+	opts Options
+	args []string
+
+	mu     sync.Mutex
+	stderr string
+	short  string
+	limit  limiter
+}
+
+// NewModule returns a command module keeping track of standard error.
+func NewModule(opts Options, args ...string) *Module {
+	if opts.Name == "" {
+		opts.Name = filepath.Base(args[0])
+	}
+	return &Module{opts: opts, args: args, limit: limiter{burst: logBurst, period: logPeriod}}
+}
+
+// FullText implements openbar.Module. Like i3blocks, the first line of output
+// is the text of the block and the second one its short text.
+func (m *Module) FullText() (string, error) {
+	return m.FullTextContext(context.Background())
+}
+
+// FullTextContext implements openbar.ContextModule: the command is killed
+// once the context is done, for instance when the bar shuts down.
+func (m *Module) FullTextContext(ctx context.Context) (string, error) {
+	out, err := do(ctx, m.opts, m.args...)
+	m.record(out.stderr)
+	m.mu.Lock()
+	m.short = out.short
+	m.mu.Unlock()
+	return out.full, err
+}
+
+// ShortText implements openbar.ShortTexter.
+func (m *Module) ShortText() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.short
+}
+
+// Stderr returns what the command wrote to standard error during its last run.
+func (m *Module) Stderr() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stderr
+}
+
+// Keep and log the standard error of a run.
+func (m *Module) record(stderr string) {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stderr = stderr
+
+	if stderr == "" {
+		return
+	}
+
+	for _, l := range strings.Split(stderr, "\n") {
+		if !m.limit.allow(time.Now()) {
+			continue
+		}
+		if n := m.limit.flush(); n > 0 {
+			log.Printf("%s: %d stderr lines dropped", m.opts.Name, n)
+		}
+		log.Printf("%s: %s", m.opts.Name, l)
 	}
 }
 
-func do(args ...string) (string, error) {
+// What a run printed: the first two lines of standard output and the whole
+// standard error.
+type output struct {
+	full   string
+	short  string
+	stderr string
+}
+
+func do(ctx context.Context, opts Options, args ...string) (output, error) {
 	//nolint:gosec
 	cmd := exec.Command(args[0], args[1:]...)
 
@@ -25,12 +181,96 @@ func do(args ...string) (string, error) {
 	stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
 	cmd.Stdout, cmd.Stderr = stdout, stderr
 
+	// Run the command in its own process group so that killing it also kills
+	// whatever it spawned.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := run(ctx, cmd, opts)
+	res := output{stderr: stderr.String()}
+
 	// If the command fails, include full error in message.
-	if err := cmd.Run(); err != nil {
-		return "", verbose(err, line(stderr))
+	if err != nil {
+		return res, verbose(err, line(stderr))
+	}
+
+	res.full = strings.TrimSpace(line(stdout))
+	res.short = strings.TrimSpace(line(stdout))
+
+	return res, nil
+}
+
+// Run a command while keeping track of it. It is killed once it times out or
+// the context is done, whichever comes first.
+func run(ctx context.Context, cmd *exec.Cmd, opts Options) error {
+	children.Lock()
+	if err := cmd.Start(); err != nil {
+		children.Unlock()
+		return err
+	}
+	children.running[cmd] = struct{}{}
+	children.Unlock()
+
+	prioritize(cmd.Process.Pid, opts)
+
+	defer func() {
+		children.Lock()
+		delete(children.running, cmd)
+		children.Unlock()
+	}()
+
+	timeout := opts.Timeout
+	if timeout <= 0 && ctx.Done() == nil {
+		return cmd.Wait()
 	}
 
-	return strings.TrimSpace(line(stdout)), nil
+	// Whatever kills the command first tells why, unless it already exited.
+	var cause error
+	var exited bool
+	var mu sync.Mutex
+
+	stop := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if exited || cause != nil {
+			return
+		}
+		cause = err
+		kill(cmd)
+	}
+
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			stop(fmt.Errorf("%w after %v", ErrTimeout, timeout))
+		})
+		defer t.Stop()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	exited = true
+	if cause != nil {
+		return cause
+	}
+
+	return err
+}
+
+// Kill the process group of a started command.
+func kill(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 }
 
 // Read the first line of text until carriage return or EOF.
@@ -1,10 +1,18 @@
 package command_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"openbar/modules/command"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestCommand(t *testing.T) {
@@ -56,6 +64,84 @@ func TestCommand(t *testing.T) {
 	}
 }
 
+func TestKill(t *testing.T) {
+	// The command tells it started through a FIFO, which opens once both ends
+	// are.
+	fifo := filepath.Join(t.TempDir(), "started")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+
+	go func() {
+		_, err := command.New("sh", "-c", `echo > "$0"; exec sleep 10`, fifo)()
+		errc <- err
+	}()
+
+	started, err := os.ReadFile(fifo)
+	if err != nil || len(started) == 0 {
+		t.Fatalf("want: command started, got: %v", err)
+	}
+
+	command.Kill()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("want error from killed command")
+		}
+	case <-time.After(time.Second):
+		t.Error("command not killed")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cmd := command.NewWithOptions(
+		command.Options{Timeout: 100 * time.Millisecond},
+		"sh", "-c", "sleep 10 & wait",
+	)
+
+	start := time.Now()
+
+	_, err := cmd()
+
+	if !errors.Is(err, command.ErrTimeout) {
+		t.Errorf("want: %v, got: %v", command.ErrTimeout, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("command took %v to be killed", elapsed)
+	}
+
+	if n := command.Live(); n != 0 {
+		t.Errorf("want: 0 live commands, got: %d", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := command.NewModule(command.Options{Timeout: time.Minute}, "sh", "-c", "sleep 10 & wait")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+
+	_, err := m.FullTextContext(ctx)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("command took %v to be killed", elapsed)
+	}
+
+	if n := command.Live(); n != 0 {
+		t.Errorf("want: 0 live commands, got: %d", n)
+	}
+}
+
 func comp(a, b error) bool {
 	switch {
 	case a == nil && b == nil:
@@ -68,3 +154,43 @@ func comp(a, b error) bool {
 		return a.Error() == b.Error()
 	}
 }
+
+func TestStderr(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	m := command.NewModule(command.Options{Name: "noisy"},
+		"sh", "-c", "echo out; for i in $(seq 12); do echo warning $i >&2; done")
+
+	out, err := m.FullText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "out" {
+		t.Errorf("want: %q, got: %q", "out", out)
+	}
+
+	if !strings.HasPrefix(m.Stderr(), "warning 1\n") || !strings.HasSuffix(m.Stderr(), "\nwarning 12") {
+		t.Errorf("unexpected stderr: %q", m.Stderr())
+	}
+
+	// Lines past the limit are not logged.
+	if n := strings.Count(buf.String(), "noisy: warning"); n != 10 {
+		t.Errorf("want: 10 lines logged, got: %d", n)
+	}
+}
+
+func TestShortText(t *testing.T) {
+	m := command.NewModule(command.Options{}, "printf", "45%% of 16GiB\n45%%\n#ff0000\n")
+
+	out, err := m.FullText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "45% of 16GiB" || m.ShortText() != "45%" {
+		t.Errorf("want: %q and %q, got: %q and %q", "45% of 16GiB", "45%", out, m.ShortText())
+	}
+}
@@ -0,0 +1,38 @@
+package command
+
+import "time"
+
+const (
+	logBurst  = 10          // Stderr lines logged per period and per module.
+	logPeriod = time.Minute // Period of the stderr rate limit.
+	maxStderr = 4096        // Bytes of stderr kept per module.
+)
+
+// A limiter allows a burst of events per period and counts the others.
+type limiter struct {
+	burst   int
+	period  time.Duration
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// Tell whether an event happening at the given time is allowed.
+func (l *limiter) allow(now time.Time) bool {
+	if now.Sub(l.start) >= l.period {
+		l.start, l.count = now, 0
+	}
+	if l.count >= l.burst {
+		l.dropped++
+		return false
+	}
+	l.count++
+	return true
+}
+
+// Return how many events were dropped since the last call.
+func (l *limiter) flush() int {
+	n := l.dropped
+	l.dropped = 0
+	return n
+}
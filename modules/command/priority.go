@@ -0,0 +1,97 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrPriority is returned for invalid IO priorities.
+var ErrPriority = errors.New("invalid io priority")
+
+// IOClass is an IO scheduling class as understood by ionice(1).
+type IOClass int
+
+// IO scheduling classes. The zero value leaves the priority untouched.
+const (
+	IONone IOClass = iota
+	IORealtime
+	IOBestEffort
+	IOIdle
+)
+
+// IOPriority is an IO scheduling class along with its level, from 0 (highest)
+// to 7 (lowest). The level is ignored by the idle class.
+type IOPriority struct {
+	Class IOClass
+	Level int
+}
+
+// ParseIOPriority reads a priority written as "idle", "best-effort",
+// "best-effort:7", "realtime" or "realtime:0".
+func ParseIOPriority(s string) (IOPriority, error) {
+	classes := map[string]IOClass{
+		"realtime":    IORealtime,
+		"best-effort": IOBestEffort,
+		"idle":        IOIdle,
+	}
+
+	parts := strings.SplitN(s, ":", 2)
+
+	class, ok := classes[parts[0]]
+	if !ok {
+		return IOPriority{}, fmt.Errorf("%w: %s", ErrPriority, s)
+	}
+
+	res := IOPriority{Class: class}
+
+	if len(parts) == 2 {
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 || n > 7 {
+			return IOPriority{}, fmt.Errorf("%w: %s", ErrPriority, s)
+		}
+		res.Level = n
+	}
+
+	return res, nil
+}
+
+// Value of the priority as expected by ioprio_set(2).
+func (p IOPriority) value() uintptr {
+	const shift = 13
+	return uintptr(p.Class)<<shift | uintptr(p.Level)
+}
+
+// Targets of ioprio_set(2).
+const (
+	ioprioWhoProcess = 1
+	ioprioWhoPgrp    = 2
+)
+
+// SetIOPriority changes the IO priority of a thread or process.
+func SetIOPriority(tid int, p IOPriority) error {
+	return setIOPriority(ioprioWhoProcess, tid, p)
+}
+
+func setIOPriority(who, id int, p IOPriority) error {
+	if p.Class == IONone {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, uintptr(who), uintptr(id), p.value())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Lower the priority of the process group of a started command. Commands can
+// fork before this happens but most of their work is done with the new
+// priority. Failures are not worth failing the module for.
+func prioritize(pgid int, opts Options) {
+	if opts.Nice != 0 {
+		_ = syscall.Setpriority(syscall.PRIO_PGRP, pgid, opts.Nice)
+	}
+	_ = setIOPriority(ioprioWhoPgrp, pgid, opts.IOPriority)
+}
@@ -0,0 +1,66 @@
+package command_test
+
+import (
+	"errors"
+	"fmt"
+	"openbar/modules/command"
+	"testing"
+)
+
+func TestParseIOPriority(t *testing.T) {
+	tests := []struct {
+		in  string
+		out command.IOPriority
+		err error
+	}{
+		{
+			in:  "idle",
+			out: command.IOPriority{Class: command.IOIdle},
+			err: nil,
+		},
+		{
+			in:  "best-effort:7",
+			out: command.IOPriority{Class: command.IOBestEffort, Level: 7},
+			err: nil,
+		},
+		{
+			in:  "best-effort:8",
+			out: command.IOPriority{},
+			err: command.ErrPriority,
+		},
+		{
+			in:  "lazy",
+			out: command.IOPriority{},
+			err: command.ErrPriority,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := command.ParseIOPriority(test.in)
+
+			if out != test.out {
+				t.Errorf("want: %v, got: %v", test.out, out)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestNice(t *testing.T) {
+	cmd := command.NewWithOptions(
+		command.Options{Nice: 5},
+		"sh", "-c", "sleep 0.1; cut -d ' ' -f 19 /proc/self/stat",
+	)
+
+	out, err := cmd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "5" {
+		t.Errorf("want: %q, got: %q", "5", out)
+	}
+}
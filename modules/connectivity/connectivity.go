@@ -0,0 +1,72 @@
+// Package connectivity is an OpenBar module printing how far the machine can
+// reach, from behind a captive portal to the whole internet, as reported by
+// NetworkManager, iwd or the kernel.
+package connectivity
+
+import (
+	"context"
+	"encoding/json"
+	"openbar"
+	"openbar/modules"
+	"openbar/network"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "connectivity",
+		Description: "internet connectivity",
+		Options: []modules.Option{
+			{Name: "backend", Type: modules.String, Default: `"networkmanager"`, Description: "networkmanager, iwd or netlink"},
+		},
+		Requires: []string{"NetworkManager or iwd"},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Backend string `json:"backend"`
+		}{Backend: "networkmanager"}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		b, err := network.Lookup(opts.Backend)
+		if err != nil {
+			return nil, err
+		}
+		return New(b), nil
+	})
+}
+
+// Texts of the connectivity levels.
+var texts = map[network.Connectivity]string{
+	network.Unknown: "unknown",
+	network.None:    "offline",
+	network.Portal:  "portal",
+	network.Limited: "limited",
+	network.Full:    "online",
+}
+
+// Module prints the connectivity and is refreshed as soon as it changes.
+type Module struct {
+	backend network.Backend
+}
+
+// New returns a module reading the given backend. The output is one of online,
+// limited, portal, offline and unknown.
+func New(b network.Backend) *Module {
+	return &Module{b}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	s, err := m.backend.State()
+	if err != nil {
+		return "", err
+	}
+	if text, ok := texts[s.Connectivity]; ok {
+		return text, nil
+	}
+	return texts[network.Unknown], nil
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.backend.Notify(ctx, changed)
+}
@@ -0,0 +1,32 @@
+package connectivity_test
+
+import (
+	"fmt"
+	"openbar/modules/connectivity"
+	"openbar/network"
+	"testing"
+)
+
+func TestConnectivity(t *testing.T) {
+	tests := []struct {
+		level network.Connectivity
+		out   string
+	}{
+		{level: network.Full, out: "online"},
+		{level: network.Portal, out: "portal"},
+		{level: network.None, out: "offline"},
+		{level: network.Connectivity(42), out: "unknown"},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := connectivity.New(network.Static{Connectivity: test.level}).FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+		})
+	}
+}
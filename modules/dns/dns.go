@@ -0,0 +1,90 @@
+// Package dns is an OpenBar module resolving a hostname and printing how long
+// it took, to spot flaky name resolution at a glance.
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"openbar"
+	"openbar/modules"
+	"time"
+)
+
+// Failed is printed when the hostname can't be resolved.
+const Failed = "failed"
+
+// DefaultTimeout bounds a single resolution.
+const DefaultTimeout = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "dns",
+		Description: "time taken to resolve a hostname",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "host", Type: modules.String, Description: "hostname to resolve"},
+			{Name: "server", Type: modules.String, Description: "server to query instead of the system resolver"},
+			{Name: "timeout", Type: modules.Duration, Default: `"5s"`, Description: "maximum time for a resolution"},
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Host    string `json:"host"`
+			Server  string `json:"server"`
+			Timeout string `json:"timeout"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.Host == "" {
+			return nil, errors.New("missing host")
+		}
+		timeout := DefaultTimeout
+		if opts.Timeout != "" {
+			d, err := time.ParseDuration(opts.Timeout)
+			if err != nil {
+				return nil, err
+			}
+			timeout = d
+		}
+		return openbar.ModuleFunc(New(opts.Host, opts.Server, timeout)), nil
+	})
+}
+
+// New returns a module resolving host. If server is empty the system resolver
+// is used, otherwise the query goes to that server ("1.1.1.1" or "1.1.1.1:53").
+func New(host, server string, timeout time.Duration) func() (string, error) {
+	resolver := net.DefaultResolver
+
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return func() (string, error) {
+		return resolve(resolver, host, timeout)
+	}
+}
+
+// Time one resolution.
+func resolve(r *net.Resolver, host string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	if _, err := r.LookupHost(ctx, host); err != nil {
+		return Failed, err
+	}
+
+	return time.Since(start).Round(100 * time.Microsecond).String(), nil
+}
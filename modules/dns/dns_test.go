@@ -0,0 +1,40 @@
+package dns_test
+
+import (
+	"fmt"
+	"openbar/modules/dns"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNS(t *testing.T) {
+	tests := []struct {
+		host   string
+		server string
+		fail   bool
+	}{
+		{host: "localhost", server: "", fail: false},
+		{host: "openbar.invalid", server: "127.0.0.1:1", fail: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := dns.New(test.host, test.server, time.Second)()
+
+			if test.fail {
+				if err == nil || out != dns.Failed {
+					t.Errorf("want failure, got: %q, %v", out, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(out, "s") {
+				t.Errorf("want a duration, got: %q", out)
+			}
+		})
+	}
+}
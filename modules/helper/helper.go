@@ -0,0 +1,185 @@
+// Package helper is a small privileged server answering a fixed set of queries
+// that require root (SMART status, restricted hwmon sensors, NUT variables),
+// along with the OpenBar module talking to it. The bar itself stays
+// unprivileged and only ever reads one line of text over a local socket.
+package helper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"openbar"
+	"openbar/modules"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultSocket is where the helper listens when not socket-activated.
+const DefaultSocket = "/run/openbar-helper.sock"
+
+// How long a single exchange may take on either side.
+const timeout = 30 * time.Second
+
+// Limits of the server: how many clients it answers at once, and how long a
+// request may be.
+const (
+	maxClients = 8
+	maxRequest = 4 << 10
+)
+
+// ErrUnknown is returned when asking for a reading the helper does not provide.
+var ErrUnknown = errors.New("unknown reading")
+
+// A request names a reading and its arguments.
+type request struct {
+	Reading string   `json:"reading"`
+	Args    []string `json:"args"`
+}
+
+// A response holds either the text of the reading or an error message.
+type response struct {
+	Out string `json:"out"`
+	Err string `json:"err,omitempty"`
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "helper",
+		Description: "privileged readings from the openbar helper",
+		Options: []modules.Option{
+			{Name: "socket", Type: modules.String, Default: `"/run/openbar-helper.sock"`, Description: "socket of the helper"},
+			{Name: "reading", Type: modules.String, Description: "smart, hwmon or nut"},
+			{Name: "args", Type: modules.Strings, Description: "arguments of the reading"},
+		},
+		Requires: []string{"openbar helper"},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Socket  string   `json:"socket"`
+			Reading string   `json:"reading"`
+			Args    []string `json:"args"`
+		}{Socket: DefaultSocket}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		return openbar.ModuleFunc(New(opts.Socket, opts.Reading, opts.Args...)), nil
+	})
+}
+
+// New returns a module querying the helper listening on the given socket.
+func New(socket, reading string, args ...string) func() (string, error) {
+	return func() (string, error) {
+		return query(socket, request{reading, args})
+	}
+}
+
+// Send one request to the helper and wait for its answer.
+func query(socket string, req request) (string, error) {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return "", err
+	}
+
+	var res response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return "", err
+	}
+
+	if res.Err != "" {
+		return "", errors.New(res.Err)
+	}
+
+	return res.Out, nil
+}
+
+// Listen returns the socket passed by systemd when socket-activated, or
+// creates one at the given path otherwise.
+func Listen(path string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err == nil && pid == os.Getpid() {
+		// File descriptors passed by systemd start right after stderr.
+		return net.FileListener(os.NewFile(3, "LISTEN_FD_3"))
+	}
+
+	// Remove a stale socket left by a previous instance.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return net.Listen("unix", path)
+}
+
+// Server answers queries with readings from the local system.
+type Server struct {
+	// Hwmon is the directory hwmon readings are relative to.
+	Hwmon string
+}
+
+// Serve accepts connections until the listener is closed. Connections wait
+// while too many are being answered.
+func (s Server) Serve(l net.Listener) error {
+	slots := make(chan struct{}, maxClients)
+	for {
+		slots <- struct{}{}
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer func() { <-slots }()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Answer exactly one request per connection.
+func (s Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+
+	var req request
+
+	line, err := bufio.NewReader(io.LimitReader(conn, maxRequest)).ReadBytes(0x0A)
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+
+	var res response
+	if err == nil {
+		res.Out, err = s.read(req)
+	}
+	if err != nil {
+		res.Err = err.Error()
+	}
+
+	_ = json.NewEncoder(conn).Encode(res)
+}
+
+// Dispatch a request to the matching reading.
+func (s Server) read(req request) (string, error) {
+	switch req.Reading {
+	case "smart":
+		return smart(req.Args)
+	case "hwmon":
+		return s.hwmon(req.Args)
+	case "nut":
+		return nut(req.Args)
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknown, req.Reading)
+	}
+}
@@ -0,0 +1,107 @@
+package helper_test
+
+import (
+	"fmt"
+	"openbar/modules/helper"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHelper(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "hwmon0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hwmon0", "temp1_input"), []byte("42000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "helper.sock")
+
+	l, err := helper.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	go func() { _ = helper.Server{Hwmon: dir}.Serve(l) }()
+
+	tests := []struct {
+		reading string
+		args    []string
+		out     string
+		err     bool
+	}{
+		{
+			reading: "hwmon",
+			args:    []string{"hwmon0/temp1_input"},
+			out:     "42000",
+			err:     false,
+		},
+		{
+			reading: "hwmon",
+			args:    []string{"../../../etc/passwd"},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "hwmon",
+			args:    []string{"hwmon0/device/../temp1_input"},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "hwmon",
+			args:    []string{"hwmon0/subsystem"},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "nut",
+			args:    []string{"-l", "battery.charge"},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "hwmon",
+			args:    []string{"hwmon0/temp1_input" + strings.Repeat(" ", 8<<10)},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "smart",
+			args:    []string{"/dev/../etc/shadow"},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "nut",
+			args:    []string{"ups; reboot", "battery.charge"},
+			out:     "",
+			err:     true,
+		},
+		{
+			reading: "shell",
+			args:    []string{"id"},
+			out:     "",
+			err:     true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := helper.New(socket, test.reading, test.args...)()
+
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+			if (err != nil) != test.err {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
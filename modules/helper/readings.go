@@ -0,0 +1,84 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrArgs is returned when a reading is called with invalid arguments. The
+// helper runs as root so arguments are validated strictly.
+var ErrArgs = errors.New("invalid arguments")
+
+var (
+	device = regexp.MustCompile(`^/dev/[A-Za-z0-9_-]+(/[A-Za-z0-9_.:-]+)*$`)
+	sensor = regexp.MustCompile(`^hwmon[0-9]+/[a-z]+[0-9]*_input$`)
+	// Names never start like options.
+	name = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@:-]*$`)
+)
+
+// Read the overall health assessment of a drive with smartctl(8).
+func smart(args []string) (string, error) {
+	if len(args) != 1 || !device.MatchString(args[0]) || strings.Contains(args[0], "..") {
+		return "", ErrArgs
+	}
+
+	// Exit status is a bit mask that is non-zero as soon as anything is
+	// slightly off, so rely on the output instead.
+	//nolint:gosec
+	out, _ := exec.Command("smartctl", "-H", args[0]).Output()
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, "overall-health") || strings.HasPrefix(line, "SMART Health Status") {
+			if i := strings.LastIndexByte(line, ':'); i >= 0 {
+				return strings.TrimSpace(line[i+1:]), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no health status for %s", args[0])
+}
+
+// Read a sensor input of the hwmon directory, like "hwmon0/temp1_input".
+// Nothing else is readable, since the links of the directory lead to every
+// attribute of the devices.
+func (s Server) hwmon(args []string) (string, error) {
+	if len(args) != 1 || !sensor.MatchString(args[0]) {
+		return "", ErrArgs
+	}
+
+	root := s.Hwmon
+	if root == "" {
+		root = "/sys/class/hwmon"
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, args[0]))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0]), nil
+}
+
+// Read a variable of a UPS with upsc(8).
+func nut(args []string) (string, error) {
+	if len(args) != 2 || !name.MatchString(args[0]) || !name.MatchString(args[1]) {
+		return "", ErrArgs
+	}
+
+	//nolint:gosec
+	out, err := exec.Command("upsc", args[0], args[1]).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,258 @@
+// Package hog is an OpenBar module printing the process of the user using the
+// most CPU, like "firefox 87%", which a click kills once confirmed. Runaway
+// processes are dealt with without opening a terminal.
+//
+// Usage is measured between two runs from /proc, so it is averaged over the
+// interval of the module.
+package hog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"openbar"
+	"openbar/modules"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDir is where the kernel exposes processes.
+const DefaultDir = "/proc"
+
+// Probe is how long the first run measures usage for, since it has no previous
+// run to compare with.
+const Probe = 250 * time.Millisecond
+
+// Ticks of the CPU time counters per second, which is USER_HZ on every
+// architecture Linux supports.
+const ticks = 100
+
+// ErrGone is returned when the process to kill is no longer the one shown.
+var ErrGone = errors.New("process gone")
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "hog",
+		Description: "process using the most CPU, killed when clicked",
+		Options: []modules.Option{
+			{Name: "above", Type: modules.Int, Default: "0", Description: "CPU percentage under which nothing is printed"},
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Above int `json:"above"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.Above < 0 {
+			return nil, fmt.Errorf("negative threshold: %d", opts.Above)
+		}
+		return New(DefaultDir, float64(opts.Above)), nil
+	})
+}
+
+// A process as read from its stat file. Start tells processes apart when
+// identifiers are reused.
+type process struct {
+	pid   int
+	name  string
+	time  uint64
+	start uint64
+}
+
+// Module follows the CPU usage of the processes of the user.
+type Module struct {
+	dir   string
+	above float64
+
+	mu    sync.Mutex
+	last  map[int]process
+	at    time.Time
+	top   *process
+	usage float64
+	// The process named by the last confirmation prompt, which the next click
+	// kills whatever is shown by then.
+	confirmed *process
+}
+
+// New returns a module reading processes from the given directory, usually
+// /proc. Nothing is printed while the top process uses less CPU than the given
+// percentage, where 100 is one core.
+func New(dir string, above float64) *Module {
+	return &Module{dir: dir, above: above}
+}
+
+// FullText prints the name of the top process and its CPU usage.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.last == nil {
+		procs, err := m.scan()
+		if err != nil {
+			return "", err
+		}
+		m.last, m.at = procs, time.Now()
+		time.Sleep(Probe)
+	}
+
+	procs, err := m.scan()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	elapsed := now.Sub(m.at).Seconds()
+
+	var top *process
+	usage := 0.0
+	for pid, p := range procs {
+		prev, ok := m.last[pid]
+		if !ok || prev.start != p.start || p.time < prev.time {
+			continue
+		}
+		u := float64(p.time-prev.time) / ticks / elapsed * 100
+		if top == nil || u > usage {
+			p := p
+			top, usage = &p, u
+		}
+	}
+
+	m.last, m.at, m.top = procs, now, nil
+
+	if top == nil || usage < m.above || usage == 0 {
+		return "", nil
+	}
+
+	m.top, m.usage = top, usage
+
+	return fmt.Sprintf("%s %d%%", top.name, int(math.Round(usage))), nil
+}
+
+// Value implements openbar.Valuer for Module: the CPU usage of the process
+// shown, or zero.
+func (m *Module) Value() openbar.Value {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.top == nil {
+		return openbar.Value{Unit: "%"}
+	}
+	return openbar.Value{Number: m.usage, Unit: "%"}
+}
+
+// Click implements openbar.ClickHandler for Module: a left click terminates the
+// process named when confirmation was asked, or the one shown when it wasn't.
+func (m *Module) Click(c openbar.Click) error {
+	if c.Button != openbar.LeftButton {
+		return nil
+	}
+
+	m.mu.Lock()
+	top := m.top
+	if m.confirmed != nil {
+		top, m.confirmed = m.confirmed, nil
+	}
+	m.mu.Unlock()
+
+	if top == nil {
+		return nil
+	}
+
+	// The identifier may have been given to another process since.
+	p, err := m.read(top.pid)
+	if err != nil || p.start != top.start {
+		return fmt.Errorf("%w: %s (%d)", ErrGone, top.name, top.pid)
+	}
+
+	return syscall.Kill(top.pid, syscall.SIGTERM)
+}
+
+// Confirm implements openbar.Confirmer for Module: killing a process needs a
+// second click.
+func (m *Module) Confirm(c openbar.Click) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c.Button != openbar.LeftButton {
+		return "", false
+	}
+
+	// A prompt left unanswered doesn't count.
+	m.confirmed = nil
+	if m.top == nil {
+		return "", false
+	}
+
+	p := *m.top
+	m.confirmed = &p
+	return "kill " + p.name + "?", true
+}
+
+// Read the processes of the user, since others can't be killed anyway.
+// Processes exiting meanwhile are skipped.
+func (m *Module) scan() (map[int]process, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	uid := uint32(os.Getuid())
+	res := make(map[int]process, len(entries))
+
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); !ok || st.Uid != uid {
+			continue
+		}
+		p, err := m.read(pid)
+		if err != nil {
+			continue
+		}
+		res[pid] = p
+	}
+
+	return res, nil
+}
+
+// Read the stat file of a process, see proc(5). The name is between
+// parentheses and may hold spaces, so fields are counted from its end.
+func (m *Module) read(pid int) (process, error) {
+	b, err := os.ReadFile(filepath.Join(m.dir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return process{}, err
+	}
+
+	s := string(b)
+	open, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if open < 0 || end < open {
+		return process{}, fmt.Errorf("invalid stat: %d", pid)
+	}
+
+	// Fields after the name start with the state, the third one.
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 20 {
+		return process{}, fmt.Errorf("invalid stat: %d", pid)
+	}
+
+	var n [3]uint64
+	for i, f := range []string{fields[11], fields[12], fields[19]} {
+		if n[i], err = strconv.ParseUint(f, 10, 64); err != nil {
+			return process{}, fmt.Errorf("invalid stat: %d: %w", pid, err)
+		}
+	}
+
+	return process{pid, s[open+1 : end], n[0] + n[1], n[2]}, nil
+}
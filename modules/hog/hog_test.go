@@ -0,0 +1,183 @@
+package hog_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"openbar"
+	"openbar/modules/hog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// Write the stat file of a fake process with the given CPU time and start time.
+func stat(t *testing.T, dir string, pid int, name string, time, start uint64) {
+	t.Helper()
+	p := filepath.Join(dir, fmt.Sprint(pid))
+	if err := os.MkdirAll(p, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	s := fmt.Sprintf("%d (%s) R 1 1 1 0 -1 0 0 0 0 0 %d 0 0 0 20 0 1 0 %d 0 0\n", pid, name, time, start)
+	if err := os.WriteFile(filepath.Join(p, "stat"), []byte(s), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHog(t *testing.T) {
+	// CPU times grow by far more than the interval between runs, so that the
+	// order of processes doesn't depend on timing.
+	tests := []struct {
+		procs map[int]uint64
+		above float64
+		want  string
+	}{
+		{map[int]uint64{1: 0, 2: 0}, 0, ""},
+		{map[int]uint64{1: 1e6, 2: 2e6}, 0, "web content"},
+		{map[int]uint64{1: 3e6, 2: 2e6}, 0, "make"},
+		{map[int]uint64{1: 3e6, 2: 2e6}, 0, ""},
+		{map[int]uint64{1: 4e6, 2: 2e6}, math.MaxFloat64, ""},
+	}
+
+	names := map[int]string{1: "make", 2: "web content"}
+	dir := t.TempDir()
+
+	for pid, name := range names {
+		stat(t, dir, pid, name, 0, 10)
+	}
+
+	m := hog.New(dir, 0)
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			m := m
+			if test.above > 0 {
+				m = hog.New(dir, test.above)
+				if _, err := m.FullText(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for pid, time := range test.procs {
+				stat(t, dir, pid, names[pid], time, 10)
+			}
+
+			got, err := m.FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.want == "" {
+				if got != "" {
+					t.Errorf("want: %q, got: %q", test.want, got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, test.want+" ") || !strings.HasSuffix(got, "%") {
+				t.Errorf("want: %q, got: %q", test.want+" N%", got)
+			}
+		})
+	}
+}
+
+func TestKill(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Process.Kill() //nolint:errcheck
+
+	pid := cmd.Process.Pid
+	dir := t.TempDir()
+
+	stat(t, dir, pid, "sleep", 0, 10)
+	m := hog.New(dir, 0)
+	if _, err := m.FullText(); err != nil {
+		t.Fatal(err)
+	}
+
+	if prompt, ok := m.Confirm(openbar.Click{Button: openbar.LeftButton}); ok {
+		t.Errorf("want: no confirmation, got: %q", prompt)
+	}
+
+	stat(t, dir, pid, "sleep", 1e6, 10)
+	if _, err := m.FullText(); err != nil {
+		t.Fatal(err)
+	}
+
+	if prompt, _ := m.Confirm(openbar.Click{Button: openbar.LeftButton}); prompt != "kill sleep?" {
+		t.Errorf("want: %q, got: %q", "kill sleep?", prompt)
+	}
+	if _, ok := m.Confirm(openbar.Click{Button: openbar.RightButton}); ok {
+		t.Error("want: no confirmation for right clicks")
+	}
+
+	// The identifier now belongs to another process.
+	stat(t, dir, pid, "sleep", 1e6, 20)
+	if err := m.Click(openbar.Click{Button: openbar.LeftButton}); !errors.Is(err, hog.ErrGone) {
+		t.Errorf("want: %v, got: %v", hog.ErrGone, err)
+	}
+
+	stat(t, dir, pid, "sleep", 1e6, 10)
+	if err := m.Click(openbar.Click{Button: openbar.LeftButton}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := cmd.Wait()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		t.Fatalf("want: killed, got: %v", err)
+	}
+	if ws, ok := exit.Sys().(syscall.WaitStatus); !ok || ws.Signal() != syscall.SIGTERM {
+		t.Errorf("want: %v, got: %v", syscall.SIGTERM, exit)
+	}
+}
+
+func TestKillConfirmed(t *testing.T) {
+	cmds := make([]*exec.Cmd, 2)
+	for i := range cmds {
+		cmds[i] = exec.Command("sleep", "60")
+		if err := cmds[i].Start(); err != nil {
+			t.Skip(err)
+		}
+		defer cmds[i].Process.Kill() //nolint:errcheck
+	}
+
+	first, second := cmds[0].Process.Pid, cmds[1].Process.Pid
+	dir := t.TempDir()
+
+	stat(t, dir, first, "first", 0, 10)
+	stat(t, dir, second, "second", 0, 10)
+	m := hog.New(dir, 0)
+	if _, err := m.FullText(); err != nil {
+		t.Fatal(err)
+	}
+
+	stat(t, dir, first, "first", 1e6, 10)
+	if _, err := m.FullText(); err != nil {
+		t.Fatal(err)
+	}
+	if prompt, _ := m.Confirm(openbar.Click{Button: openbar.LeftButton}); prompt != "kill first?" {
+		t.Fatalf("want: %q, got: %q", "kill first?", prompt)
+	}
+
+	// Another process takes the lead before the confirmation.
+	stat(t, dir, second, "second", 1e7, 10)
+	if got, err := m.FullText(); err != nil || !strings.HasPrefix(got, "second ") {
+		t.Fatalf("want: second N%%, got: %q, %v", got, err)
+	}
+
+	if err := m.Click(openbar.Click{Button: openbar.LeftButton}); err != nil {
+		t.Fatal(err)
+	}
+
+	var exit *exec.ExitError
+	if err := cmds[0].Wait(); !errors.As(err, &exit) {
+		t.Fatalf("want: first killed, got: %v", err)
+	}
+	if err := syscall.Kill(second, 0); err != nil {
+		t.Errorf("want: second alive, got: %v", err)
+	}
+}
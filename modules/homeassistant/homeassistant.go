@@ -0,0 +1,189 @@
+// Package homeassistant is an OpenBar module printing the state of a Home
+// Assistant entity, like the temperature of a room, and toggling it when
+// clicked, like a light. It uses the REST API with a long-lived access token.
+package homeassistant
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/modules"
+	"openbar/modules/httpjson"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "homeassistant",
+		Description: "state of a Home Assistant entity, toggled when clicked",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "url", Type: modules.String, Description: "address of Home Assistant, like http://homeassistant.local:8123"},
+			{Name: "token", Type: modules.String, Description: "long-lived access token"},
+			{Name: "token_file", Type: modules.String, Description: "file holding the token, instead of token, ~ being the home directory"},
+			{Name: "entity", Type: modules.String, Description: "identifier of the entity, like sensor.living_room_temperature"},
+			{Name: "attribute", Type: modules.String, Description: "dot-separated path of the attribute printed instead of the state"},
+			{Name: "toggle", Type: modules.Bool, Default: "false", Description: "toggle the entity on left click"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			URL       string `json:"url"`
+			Token     string `json:"token"`
+			TokenFile string `json:"token_file"`
+			Entity    string `json:"entity"`
+			Attribute string `json:"attribute"`
+			Toggle    bool   `json:"toggle"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		switch {
+		case opts.URL == "":
+			return nil, errors.New("missing url")
+		case opts.Entity == "":
+			return nil, errors.New("missing entity")
+		case opts.Token != "" && opts.TokenFile != "":
+			return nil, errors.New("token and token_file are exclusive")
+		}
+		token := opts.Token
+		if opts.TokenFile != "" {
+			path := opts.TokenFile
+			if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+				path = filepath.Join(home, path[2:])
+			}
+			data, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, err
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		if token == "" {
+			return nil, errors.New("missing token")
+		}
+		client := env.HTTP
+		if client == nil {
+			client = httpclient.Default
+		}
+		return New(client, opts.URL, token, Entity{opts.Entity, opts.Attribute, opts.Toggle}), nil
+	})
+}
+
+// Entity tells what the module shows and does.
+type Entity struct {
+	ID string
+	// Attribute is printed instead of the state when set, like "temperature"
+	// for a thermostat.
+	Attribute string
+	// Toggle makes left clicks toggle the entity.
+	Toggle bool
+}
+
+// Module follows an entity.
+type Module struct {
+	client *http.Client
+	url    string
+	token  string
+	entity Entity
+}
+
+// New returns a module following an entity of the Home Assistant instance at
+// the given address.
+func New(client *http.Client, url, token string, e Entity) *Module {
+	return &Module{client, strings.TrimSuffix(url, "/"), token, e}
+}
+
+// FullText implements openbar.Module. States are followed by their unit, if
+// any, like "21.5°C".
+func (m *Module) FullText() (string, error) {
+	res, err := m.do(http.MethodGet, "/api/states/"+m.entity.ID, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	dec := json.NewDecoder(res.Body)
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", err
+	}
+
+	if m.entity.Attribute != "" {
+		return httpjson.Extract(doc, "attributes."+m.entity.Attribute)
+	}
+
+	state, err := httpjson.Extract(doc, "state")
+	if err != nil {
+		return "", err
+	}
+
+	// Missing units are no error.
+	unit, _ := httpjson.Extract(doc, "attributes.unit_of_measurement")
+
+	return state + unit, nil
+}
+
+// Click implements openbar.ClickHandler: left clicks toggle the entity if the
+// module is configured to.
+func (m *Module) Click(c openbar.Click) error {
+	if !m.entity.Toggle || c.Button != openbar.LeftButton {
+		return nil
+	}
+
+	// Services belong to the domain of the entity, like "light".
+	domain := m.entity.ID
+	if i := strings.Index(domain, "."); i > 0 {
+		domain = domain[:i]
+	}
+
+	body, err := json.Marshal(map[string]string{"entity_id": m.entity.ID})
+	if err != nil {
+		return err
+	}
+
+	res, err := m.do(http.MethodPost, "/api/services/"+domain+"/toggle", body)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// Call the API. Answers other than 200 OK are errors.
+func (m *Module) do(method, path string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, m.url+path, r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	req.Header.Set("Content-Type", "application/json")
+	// States change all the time and answers are private.
+	req.Header.Set("Cache-Control", "no-store")
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, openbar.Temporary(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, httpclient.Refused(res, fmt.Errorf("%s %s: %s", method, path, res.Status))
+	}
+
+	return res, nil
+}
@@ -0,0 +1,81 @@
+package homeassistant_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"openbar"
+	"openbar/modules/homeassistant"
+	"testing"
+)
+
+// A Home Assistant instance with a thermostat and a light.
+func serve(t *testing.T, toggled *string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/states/climate.living":
+			fmt.Fprint(w, `{"state": "heat", "attributes": {"current_temperature": 21.5}}`)
+		case "GET /api/states/sensor.living":
+			fmt.Fprint(w, `{"state": "21.5", "attributes": {"unit_of_measurement": "°C"}}`)
+		case "GET /api/states/light.desk":
+			fmt.Fprint(w, `{"state": "on", "attributes": {"friendly_name": "Desk"}}`)
+		case "POST /api/services/light/toggle":
+			body, _ := io.ReadAll(r.Body)
+			*toggled = string(body)
+			fmt.Fprint(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestState(t *testing.T) {
+	var toggled string
+	srv := serve(t, &toggled)
+
+	tests := []struct {
+		token  string
+		entity homeassistant.Entity
+		out    string
+		err    bool
+	}{
+		{token: "secret", entity: homeassistant.Entity{ID: "sensor.living"}, out: "21.5°C"},
+		{token: "secret", entity: homeassistant.Entity{ID: "light.desk"}, out: "on"},
+		{token: "secret", entity: homeassistant.Entity{ID: "climate.living", Attribute: "current_temperature"}, out: "21.5"},
+		{token: "secret", entity: homeassistant.Entity{ID: "climate.living", Attribute: "humidity"}, err: true},
+		{token: "secret", entity: homeassistant.Entity{ID: "sensor.missing"}, err: true},
+		{token: "wrong", entity: homeassistant.Entity{ID: "sensor.living"}, err: true},
+	}
+
+	for i, test := range tests {
+		out, err := homeassistant.New(srv.Client(), srv.URL+"/", test.token, test.entity).FullText()
+		if out != test.out || (err != nil) != test.err {
+			t.Errorf("%d: want: %q (error: %v), got: %q, %v", i, test.out, test.err, out, err)
+		}
+	}
+}
+
+func TestToggle(t *testing.T) {
+	var toggled string
+	srv := serve(t, &toggled)
+
+	m := homeassistant.New(srv.Client(), srv.URL, "secret", homeassistant.Entity{ID: "light.desk", Toggle: true})
+
+	if err := m.Click(openbar.Click{Button: openbar.RightButton}); err != nil || toggled != "" {
+		t.Errorf("right click: want: nothing, got: %q, %v", toggled, err)
+	}
+
+	if err := m.Click(openbar.Click{Button: openbar.LeftButton}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"entity_id":"light.desk"}`; toggled != want {
+		t.Errorf("want: %s, got: %s", want, toggled)
+	}
+}
@@ -0,0 +1,159 @@
+// Package httpjson is an OpenBar module fetching a JSON document over HTTP and
+// printing one of its values. Responses go through the shared on-disk cache,
+// and servers asking to come back later are left alone until then.
+package httpjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/modules"
+	"strconv"
+	"strings"
+)
+
+// ErrPath is returned when the document does not contain the requested value.
+var ErrPath = errors.New("no such path")
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "httpjson",
+		Description: "value extracted from a JSON document fetched over HTTP",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "url", Type: modules.String, Description: "address of the document"},
+			{Name: "path", Type: modules.String, Description: "dot-separated path of the value"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			URL  string `json:"url"`
+			Path string `json:"path"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		return New(opts.URL, opts.Path, WithClient(env.HTTP)), nil
+	})
+}
+
+// Option is a setting of the module.
+type Option func(*settings)
+
+type settings struct {
+	client *http.Client
+}
+
+// WithClient configures the HTTP client. Nil means the default shared client.
+func WithClient(c *http.Client) Option {
+	return func(s *settings) {
+		if c != nil {
+			s.client = c
+		}
+	}
+}
+
+// New returns a module printing the value at the given dot-separated path of
+// the document served at url, such as "current.temperature" or "items.0.name".
+// When the server turns a request down with Retry-After, the module waits as
+// long as asked before trying again, see httpclient.Refused.
+func New(url, path string, opts ...Option) openbar.ContextModuleFunc {
+	s := settings{client: httpclient.Default}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return func(ctx context.Context) (string, error) {
+		return fetch(ctx, s.client, url, path)
+	}
+}
+
+// Download a document and extract the value.
+func fetch(ctx context.Context, client *http.Client, url, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", openbar.Temporary(err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", httpclient.Refused(res, fmt.Errorf("%s: %s", url, res.Status))
+	}
+
+	dec := json.NewDecoder(res.Body)
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", err
+	}
+
+	return Extract(doc, path)
+}
+
+// Extract returns the value at the given path of a decoded document as text.
+// An empty path designates the whole document.
+func Extract(doc interface{}, path string) (string, error) {
+	cur, err := Lookup(doc, path)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := cur.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		buf := bytes.NewBuffer(nil)
+		if err := json.NewEncoder(buf).Encode(v); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+}
+
+// Lookup returns the value at the given path of a decoded document, as
+// decoded. An empty path designates the whole document.
+func Lookup(doc interface{}, path string) (interface{}, error) {
+	cur := doc
+
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch node := cur.(type) {
+			case map[string]interface{}:
+				v, ok := node[key]
+				if !ok {
+					return nil, fmt.Errorf("%w: %s", ErrPath, path)
+				}
+				cur = v
+			case []interface{}:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(node) {
+					return nil, fmt.Errorf("%w: %s", ErrPath, path)
+				}
+				cur = node[i]
+			default:
+				return nil, fmt.Errorf("%w: %s", ErrPath, path)
+			}
+		}
+	}
+
+	return cur, nil
+}
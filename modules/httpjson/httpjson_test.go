@@ -0,0 +1,90 @@
+package httpjson_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"openbar"
+	"openbar/modules/httpjson"
+	"strings"
+	"testing"
+	"time"
+)
+
+const document = `{"current": {"temperature": 21.5, "raining": false}, "items": [{"name": "foo"}, {"name": "bar"}], "none": null}`
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		path string
+		out  string
+		err  error
+	}{
+		{path: "current.temperature", out: "21.5", err: nil},
+		{path: "current.raining", out: "false", err: nil},
+		{path: "items.1.name", out: "bar", err: nil},
+		{path: "none", out: "", err: nil},
+		{path: "items.0", out: `{"name":"foo"}`, err: nil},
+		{path: "items.2.name", out: "", err: httpjson.ErrPath},
+		{path: "current.wind", out: "", err: httpjson.ErrPath},
+		{path: "current.temperature.value", out: "", err: httpjson.ErrPath},
+	}
+
+	dec := json.NewDecoder(strings.NewReader(document))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := httpjson.Extract(doc, test.path)
+
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestHTTPJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, document)
+	}))
+	defer srv.Close()
+
+	out, err := httpjson.New(srv.URL, "items.0.name")(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "foo" {
+		t.Errorf("want: %q, got: %q", "foo", out)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := httpjson.New(srv.URL, "")(context.Background())
+
+	var limit openbar.RateLimitError
+	if !errors.As(err, &limit) {
+		t.Fatalf("want: rate limit, got: %v", err)
+	}
+
+	if d := time.Until(limit.Until); d <= time.Minute || d > 2*time.Minute {
+		t.Errorf("want: %v, got: %v", 2*time.Minute, d)
+	}
+}
@@ -0,0 +1,176 @@
+// Package lock is an OpenBar module counting down until swayidle locks the
+// screen. It runs a swayidle instance of its own to learn when the user goes
+// idle and when activity resumes.
+package lock
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe is the idle time after which swayidle reports the user as idle. It is
+// subtracted from the countdown.
+const Probe = time.Second
+
+// DefaultCommand is swayidle reporting idleness and activity on its output.
+var DefaultCommand = []string{
+	"swayidle", "timeout", "1", "echo idle", "resume", "echo active",
+}
+
+// Retry is how long to wait before running swayidle again if it exits.
+const Retry = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "lock",
+		Description: "countdown until the screen locks",
+		Options: []modules.Option{
+			{Name: "timeout", Type: modules.Duration, Description: "idle time after which swayidle locks"},
+			{Name: "command", Type: modules.Strings, Default: `["swayidle", "timeout", "1", "echo idle", "resume", "echo active"]`, Description: "swayidle printing idle and active"},
+		},
+		Requires: []string{"swayidle"},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			if err != nil {
+				return nil, err
+			}
+			return [][]string{opts.Command}, nil
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Timeout == "" {
+			return nil, errors.New("missing timeout")
+		}
+		timeout, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		if len(opts.Command) == 0 {
+			return nil, errors.New("empty command")
+		}
+		return New(timeout, opts.Command...), nil
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Timeout string   `json:"timeout"`
+	Command []string `json:"command"`
+}
+
+// Read the options of the module, falling back to defaults.
+func parse(options json.RawMessage) (settings, error) {
+	res := settings{Command: DefaultCommand}
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// Module shows the time left before the screen locks.
+type Module struct {
+	timeout time.Duration
+	command []string
+
+	mu    sync.Mutex
+	since time.Time
+}
+
+// New returns a module for a screen locked after the given idle time. The
+// command must print "idle" once the user is idle for one second and "active"
+// when activity resumes, which DefaultCommand does.
+func New(timeout time.Duration, command ...string) *Module {
+	return &Module{timeout: timeout, command: command}
+}
+
+// FullText prints "lock in 4:32" while the user is idle, and nothing otherwise.
+// Refresh the module every second for a live countdown.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	since := m.since
+	m.mu.Unlock()
+
+	if since.IsZero() {
+		return "", nil
+	}
+
+	left := m.timeout - time.Since(since)
+	if left < 0 {
+		left = 0
+	}
+
+	left = left.Round(time.Second)
+
+	return fmt.Sprintf("lock in %d:%02d", int(left.Minutes()), int(left.Seconds())%60), nil
+}
+
+// Notify implements openbar.Notifier by following the output of swayidle.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	for {
+		err := m.follow(ctx, changed)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// The user can't be considered idle without swayidle running.
+		m.set(time.Time{})
+		changed()
+
+		if errors.Is(err, exec.ErrNotFound) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(Retry):
+		}
+	}
+}
+
+// Run swayidle until it exits or the context is done.
+func (m *Module) follow(ctx context.Context, changed func()) error {
+	//nolint:gosec
+	cmd := exec.CommandContext(ctx, m.command[0], m.command[1:]...)
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "idle":
+			m.set(time.Now().Add(-Probe))
+		case "active":
+			m.set(time.Time{})
+		default:
+			continue
+		}
+		changed()
+	}
+
+	return cmd.Wait()
+}
+
+// Record when the user went idle, zero meaning active.
+func (m *Module) set(since time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.since = since
+}
@@ -0,0 +1,45 @@
+package lock_test
+
+import (
+	"context"
+	"openbar/modules/lock"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Go idle, then come back after a while.
+	m := lock.New(5*time.Minute, "sh", "-c", "echo idle; sleep 0.2; echo active; sleep 10")
+
+	out, err := m.FullText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "" {
+		t.Errorf("want: empty, got: %q", out)
+	}
+
+	changed := make(chan struct{})
+	go func() { _ = m.Notify(ctx, func() { changed <- struct{}{} }) }()
+
+	for _, want := range []string{"lock in 4:59", ""} {
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+			t.Fatal("no change notified")
+		}
+
+		out, err := m.FullText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if out != want {
+			t.Errorf("want: %q, got: %q", want, out)
+		}
+	}
+}
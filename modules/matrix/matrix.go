@@ -0,0 +1,312 @@
+// Package matrix is an OpenBar module printing the number of unread
+// notifications in Matrix rooms. It follows the sync stream of the homeserver,
+// so counts change as soon as messages arrive or are read elsewhere.
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/modules"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the homeserver may hold a sync, on top of the time the shared
+// client waits for an answer.
+const poll = 30 * time.Second
+
+// How long the module waits before syncing again after a failure.
+const retry = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "matrix",
+		Description: "unread notifications in Matrix rooms",
+		Network:     true,
+		Stream:      true,
+		Options: []modules.Option{
+			{Name: "homeserver", Type: modules.String, Description: "address of the homeserver, like https://matrix.example.org"},
+			{Name: "token", Type: modules.String, Description: "access token of the account"},
+			{Name: "token_file", Type: modules.String, Description: "file holding the token, instead of token, ~ being the home directory"},
+			{Name: "rooms", Type: modules.Strings, Default: "all joined rooms", Description: "identifiers or aliases of the rooms counted"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Homeserver string   `json:"homeserver"`
+			Token      string   `json:"token"`
+			TokenFile  string   `json:"token_file"`
+			Rooms      []string `json:"rooms"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		switch {
+		case opts.Homeserver == "":
+			return nil, errors.New("missing homeserver")
+		case opts.Token != "" && opts.TokenFile != "":
+			return nil, errors.New("token and token_file are exclusive")
+		}
+		token := opts.Token
+		if opts.TokenFile != "" {
+			path := opts.TokenFile
+			if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+				path = filepath.Join(home, path[2:])
+			}
+			data, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, err
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		if token == "" {
+			return nil, errors.New("missing token")
+		}
+		client := env.HTTP
+		if client == nil {
+			client = httpclient.Default
+		}
+		return New(client, opts.Homeserver, token, opts.Rooms), nil
+	})
+}
+
+// Module counts the unread notifications of an account.
+type Module struct {
+	client *http.Client
+	url    string
+	token  string
+	rooms  []string
+
+	mu         sync.Mutex
+	text       string
+	highlights bool
+}
+
+// New returns a module counting unread notifications in the given rooms,
+// given by identifier like "!abc:example.org" or by alias like
+// "#chat:example.org", or in all joined rooms when there are none.
+func New(client *http.Client, homeserver, token string, rooms []string) *Module {
+	// Syncs are held by the homeserver before it answers.
+	c := *client
+	if c.Timeout > 0 {
+		c.Timeout += poll
+	}
+	return &Module{client: &c, url: strings.TrimSuffix(homeserver, "/"), token: token, rooms: rooms}
+}
+
+// FullText implements openbar.Module: it returns the last count sent.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.text, nil
+}
+
+// Urgent implements openbar.Urgenter: mentions make the block urgent.
+func (m *Module) Urgent() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.highlights
+}
+
+// Stream implements openbar.StreamModule: the count is sent after the first
+// sync, then each time it changes. Failures are sent too, and syncing starts
+// over a few seconds later, unless the token was rejected.
+func (m *Module) Stream(ctx context.Context) <-chan openbar.Update {
+	updates := make(chan openbar.Update)
+
+	go func() {
+		defer close(updates)
+
+		send := func(u openbar.Update) bool {
+			select {
+			case updates <- u:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			err := m.follow(ctx, func(text string) bool {
+				return send(openbar.Update{Text: text})
+			})
+			if ctx.Err() != nil || !send(openbar.Update{Text: m.last(), Err: err}) {
+				return
+			}
+
+			// A rejected token won't do better next time, and a server asking
+			// to come back later is left alone until then.
+			wait := retry
+			var limit openbar.RateLimitError
+			switch {
+			case errors.As(err, new(openbar.FatalError)):
+				return
+			case errors.As(err, &limit):
+				wait = time.Until(limit.Until)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return updates
+}
+
+// Return the last count.
+func (m *Module) last() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.text
+}
+
+// The unread notifications of a room.
+type room struct {
+	UnreadNotifications struct {
+		NotificationCount int `json:"notification_count"`
+		HighlightCount    int `json:"highlight_count"`
+	} `json:"unread_notifications"`
+}
+
+// Sync until it fails or the context is done, calling changed with the count
+// after the first sync and whenever it changes.
+func (m *Module) follow(ctx context.Context, changed func(string) bool) error {
+	filter, err := m.filter(ctx)
+	if err != nil {
+		return err
+	}
+
+	counts, highlights := make(map[string]int), make(map[string]int)
+	since, text := "", ""
+
+	for {
+		q := url.Values{"filter": {filter}, "timeout": {"0"}}
+		if since != "" {
+			q.Set("since", since)
+			q.Set("timeout", strconv.Itoa(int(poll/time.Millisecond)))
+		}
+
+		var res struct {
+			NextBatch string `json:"next_batch"`
+			Rooms     struct {
+				Join  map[string]room            `json:"join"`
+				Leave map[string]json.RawMessage `json:"leave"`
+			} `json:"rooms"`
+		}
+		if err := m.get(ctx, "/_matrix/client/v3/sync?"+q.Encode(), &res); err != nil {
+			return err
+		}
+
+		// Only rooms where something happened are part of a sync.
+		for id, r := range res.Rooms.Join {
+			counts[id] = r.UnreadNotifications.NotificationCount
+			highlights[id] = r.UnreadNotifications.HighlightCount
+		}
+		for id := range res.Rooms.Leave {
+			delete(counts, id)
+			delete(highlights, id)
+		}
+
+		total, mentioned := 0, false
+		for id, n := range counts {
+			total += n
+			mentioned = mentioned || highlights[id] > 0
+		}
+
+		m.mu.Lock()
+		m.text, m.highlights = strconv.Itoa(total), mentioned
+		m.mu.Unlock()
+
+		if t := strconv.Itoa(total); since == "" || t != text {
+			text = t
+			if !changed(text) {
+				return nil
+			}
+		}
+		since = res.NextBatch
+	}
+}
+
+// Return the filter of syncs, keeping only what counts are made of.
+func (m *Module) filter(ctx context.Context) (string, error) {
+	type types struct {
+		Types []string `json:"types"`
+	}
+	type timeline struct {
+		Limit int `json:"limit"`
+	}
+
+	var rooms []string
+	for _, r := range m.rooms {
+		if !strings.HasPrefix(r, "#") {
+			rooms = append(rooms, r)
+			continue
+		}
+		var alias struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := m.get(ctx, "/_matrix/client/v3/directory/room/"+url.PathEscape(r), &alias); err != nil {
+			return "", err
+		}
+		rooms = append(rooms, alias.RoomID)
+	}
+
+	none := types{Types: []string{}}
+	f := struct {
+		Presence    types `json:"presence"`
+		AccountData types `json:"account_data"`
+		Room        struct {
+			Rooms       []string `json:"rooms,omitempty"`
+			State       types    `json:"state"`
+			Timeline    timeline `json:"timeline"`
+			Ephemeral   types    `json:"ephemeral"`
+			AccountData types    `json:"account_data"`
+		} `json:"room"`
+	}{Presence: none, AccountData: none}
+	f.Room.Rooms = rooms
+	f.Room.State, f.Room.Ephemeral, f.Room.AccountData = none, none, none
+	f.Room.Timeline.Limit = 1
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Call the API and decode the answer. Answers other than 200 OK are errors.
+func (m *Module) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	// Syncs depend on the state of the account, and answers are private.
+	req.Header.Set("Cache-Control", "no-store")
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return openbar.Temporary(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return httpclient.Refused(res, fmt.Errorf("GET %s: %s", strings.SplitN(path, "?", 2)[0], res.Status))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,125 @@
+package matrix_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"openbar"
+	"openbar/modules/matrix"
+	"testing"
+	"time"
+)
+
+// A homeserver where a room is mentioned, then read, after which syncs wait
+// for news that never come. Filters are sent to the given channel.
+func serve(t *testing.T, filters chan<- []string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/_matrix/client/v3/directory/room/#chat:example.org":
+			fmt.Fprint(w, `{"room_id": "!chat:example.org"}`)
+			return
+		case "/_matrix/client/v3/sync":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var f struct {
+			Room struct {
+				Rooms []string `json:"rooms"`
+			} `json:"room"`
+		}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filter")), &f); err != nil {
+			t.Error(err)
+		}
+		filters <- f.Room.Rooms
+
+		switch r.URL.Query().Get("since") {
+		case "":
+			fmt.Fprint(w, `{"next_batch": "s1", "rooms": {"join": {
+				"!chat:example.org": {"unread_notifications": {"notification_count": 2, "highlight_count": 1}},
+				"!news:example.org": {"unread_notifications": {"notification_count": 1, "highlight_count": 0}}
+			}}}`)
+		case "s1":
+			fmt.Fprint(w, `{"next_batch": "s2", "rooms": {"join": {
+				"!chat:example.org": {"unread_notifications": {"notification_count": 0, "highlight_count": 0}}
+			}}}`)
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	filters := make(chan []string, 10)
+	srv := serve(t, filters)
+
+	m := matrix.New(srv.Client(), srv.URL+"/", "secret", []string{"#chat:example.org", "!news:example.org"})
+	updates := m.Stream(ctx)
+
+	// Counts come with the first sync, then as they change, mentions making
+	// the block urgent.
+	tests := []struct {
+		text   string
+		urgent bool
+	}{
+		{text: "3", urgent: true},
+		{text: "1", urgent: false},
+	}
+
+	for i, test := range tests {
+		select {
+		case u := <-updates:
+			if u.Text != test.text || u.Err != nil || m.Urgent() != test.urgent {
+				t.Errorf("%d: want: %q (urgent: %v), got: %q, %v (urgent: %v)", i, test.text, test.urgent, u.Text, u.Err, m.Urgent())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d: no update", i)
+		}
+	}
+
+	if rooms := <-filters; fmt.Sprint(rooms) != "[!chat:example.org !news:example.org]" {
+		t.Errorf("want: rooms resolved, got: %v", rooms)
+	}
+
+	// The stream ends with the context.
+	cancel()
+	for range updates {
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := serve(t, make(chan []string, 10))
+
+	updates := matrix.New(srv.Client(), srv.URL, "wrong", nil).Stream(ctx)
+	u := <-updates
+	if !errors.As(u.Err, new(openbar.FatalError)) {
+		t.Errorf("want: a fatal error, got: %q, %v", u.Text, u.Err)
+	}
+
+	// A rejected token is not tried again.
+	select {
+	case u, ok := <-updates:
+		if ok {
+			t.Errorf("want: stream ended, got: %q, %v", u.Text, u.Err)
+		}
+	case <-time.After(time.Second):
+		t.Error("want: stream ended")
+	}
+}
@@ -0,0 +1,320 @@
+package mentions
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"openbar"
+	"openbar/httpclient"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSlackAPI is the address of the Slack Web API.
+const DefaultSlackAPI = "https://slack.com/api"
+
+// Errors of the Web API telling the token is no good.
+var revoked = map[string]bool{
+	"not_authed":       true,
+	"invalid_auth":     true,
+	"account_inactive": true,
+	"token_revoked":    true,
+	"token_expired":    true,
+}
+
+// How long the IRC backend waits before connecting again after losing the
+// bouncer.
+const retry = 5 * time.Second
+
+// Slack counts unread direct messages, group ones included, with a user token
+// allowed to read them (scopes im:read and mpim:read).
+type Slack struct {
+	Client *http.Client
+	Token  string
+	// API is the address of the Web API, DefaultSlackAPI when empty.
+	API string
+}
+
+// Count implements Backend.
+func (s *Slack) Count(ctx context.Context) (int, error) {
+	total, cursor := 0, ""
+	for {
+		var list struct {
+			Channels []struct {
+				ID string `json:"id"`
+			} `json:"channels"`
+			Metadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		q := url.Values{"types": {"im,mpim"}, "exclude_archived": {"true"}, "limit": {"200"}}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		if err := s.call(ctx, "conversations.list", q, &list); err != nil {
+			return 0, err
+		}
+
+		for _, c := range list.Channels {
+			var info struct {
+				Channel struct {
+					Unread int `json:"unread_count_display"`
+				} `json:"channel"`
+			}
+			if err := s.call(ctx, "conversations.info", url.Values{"channel": {c.ID}}, &info); err != nil {
+				return 0, err
+			}
+			total += info.Channel.Unread
+		}
+
+		if cursor = list.Metadata.NextCursor; cursor == "" {
+			return total, nil
+		}
+	}
+}
+
+// Call a method of the Web API, which tells about failures in the answer.
+func (s *Slack) call(ctx context.Context, method string, q url.Values, v interface{}) error {
+	api := s.API
+	if api == "" {
+		api = DefaultSlackAPI
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(api, "/")+"/"+method+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	// Counts change all the time and answers are private.
+	req.Header.Set("Cache-Control", "no-store")
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return openbar.Temporary(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return httpclient.Refused(res, fmt.Errorf("%s: %s", method, res.Status))
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		return err
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		err := fmt.Errorf("%s: %s", method, status.Error)
+		if revoked[status.Error] {
+			return openbar.Fatal(err)
+		}
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+// IRC counts the private messages and the messages mentioning the nickname
+// received from a bouncer, like ZNC or soju, starting with those it plays back
+// on connection. IRC keeping no read state, the count starts over on Reset.
+type IRC struct {
+	Server   string
+	TLS      bool
+	Nick     string
+	Password string
+
+	once  sync.Once
+	mu    sync.Mutex
+	count int
+	err   error
+}
+
+// Count implements Backend. The connection is made on the first call and kept
+// for the lifetime of the backend; the count is that of the messages received
+// so far, and the error that of the connection while it is lost.
+func (i *IRC) Count(ctx context.Context) (int, error) {
+	i.once.Do(func() { go i.run() })
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.count, i.err
+}
+
+// Reset implements Resetter.
+func (i *IRC) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.count = 0
+}
+
+// Stay connected to the bouncer.
+func (i *IRC) run() {
+	for {
+		err := i.session()
+
+		i.mu.Lock()
+		i.err = err
+		i.mu.Unlock()
+
+		time.Sleep(retry)
+	}
+}
+
+// Follow the messages of a single connection until it fails.
+func (i *IRC) session() error {
+	addr := i.Server
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port := "6667"
+		if i.TLS {
+			port = "6697"
+		}
+		addr = net.JoinHostPort(addr, port)
+	}
+
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if i.TLS {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	send := func(format string, args ...interface{}) error {
+		_, err := fmt.Fprintf(conn, format+"\r\n", args...)
+		return err
+	}
+
+	if i.Password != "" {
+		if err := send("PASS %s", i.Password); err != nil {
+			return err
+		}
+	}
+	if err := send("NICK %s", i.Nick); err != nil {
+		return err
+	}
+	if err := send("USER %s 0 * :openbar", i.Nick); err != nil {
+		return err
+	}
+
+	// The bouncer may change the nickname, which mentions then refer to.
+	nick := i.Nick
+	r := bufio.NewReader(conn)
+	for {
+		// Servers ping idle clients, so a connection silent for longer is
+		// dead.
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Minute)); err != nil {
+			return err
+		}
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		prefix, cmd, params := parse(strings.TrimRight(line, "\r\n"))
+		switch cmd {
+		case "PING":
+			if err := send("PONG :%s", strings.Join(params, " ")); err != nil {
+				return err
+			}
+		case "001":
+			if len(params) > 0 {
+				nick = params[0]
+			}
+			i.mu.Lock()
+			i.err = nil
+			i.mu.Unlock()
+		case "NICK":
+			if len(params) > 0 && strings.EqualFold(source(prefix), nick) {
+				nick = params[0]
+			}
+		case "PRIVMSG":
+			if len(params) < 2 || strings.EqualFold(source(prefix), nick) {
+				continue
+			}
+			if strings.EqualFold(params[0], nick) || mentions(params[1], nick) {
+				i.mu.Lock()
+				i.count++
+				i.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Split a line into its prefix, command and parameters, the trailing one
+// included. Message tags are left out.
+func parse(line string) (string, string, []string) {
+	if strings.HasPrefix(line, "@") {
+		if n := strings.IndexByte(line, ' '); n > 0 {
+			line = line[n+1:]
+		}
+	}
+
+	prefix := ""
+	if strings.HasPrefix(line, ":") {
+		n := strings.IndexByte(line, ' ')
+		if n < 0 {
+			return line[1:], "", nil
+		}
+		prefix, line = line[1:n], line[n+1:]
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if n := strings.Index(line, " :"); n >= 0 {
+		trailing, hasTrailing, line = line[n+2:], true, line[:n]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return prefix, "", nil
+	}
+
+	params := fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+
+	return prefix, strings.ToUpper(fields[0]), params
+}
+
+// Return the nickname of a prefix like "nick!user@host".
+func source(prefix string) string {
+	if n := strings.IndexByte(prefix, '!'); n >= 0 {
+		return prefix[:n]
+	}
+	return prefix
+}
+
+// Tell whether a message mentions a nickname as a word of its own.
+func mentions(text, nick string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-_[]\\`^{}|", r))
+	})
+	for _, w := range words {
+		if w == strings.ToLower(nick) {
+			return true
+		}
+	}
+	return false
+}
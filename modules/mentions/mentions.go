@@ -0,0 +1,170 @@
+// Package mentions is an OpenBar module counting unread mentions and direct
+// messages on a chat service, through a backend: Slack or an IRC bouncer. The
+// block is empty when there are none.
+package mentions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/modules"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Backend counts unread mentions and direct messages.
+type Backend interface {
+	Count(ctx context.Context) (int, error)
+}
+
+// Resetter is implemented by backends keeping no read state of their own,
+// whose count starts over when the block is clicked.
+type Resetter interface {
+	Reset()
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "mentions",
+		Description: "unread mentions and direct messages on Slack or IRC",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "backend", Type: modules.String, Description: "slack or irc"},
+			{Name: "token", Type: modules.String, Description: "user token of the slack backend"},
+			{Name: "token_file", Type: modules.String, Description: "file holding the token, instead of token, ~ being the home directory"},
+			{Name: "server", Type: modules.String, Description: "HOST[:PORT] of the bouncer of the irc backend"},
+			{Name: "tls", Type: modules.Bool, Default: "true", Description: "connect to the bouncer with TLS"},
+			{Name: "nick", Type: modules.String, Description: "nickname of the irc backend"},
+			{Name: "password", Type: modules.String, Description: "password of the bouncer"},
+			{Name: "password_file", Type: modules.String, Description: "file holding the password, instead of password"},
+			{Name: "warn", Type: modules.Int, Default: "0", Description: "count from which the block is urgent, never when 0"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Backend      string `json:"backend"`
+			Token        string `json:"token"`
+			TokenFile    string `json:"token_file"`
+			Server       string `json:"server"`
+			TLS          bool   `json:"tls"`
+			Nick         string `json:"nick"`
+			Password     string `json:"password"`
+			PasswordFile string `json:"password_file"`
+			Warn         int    `json:"warn"`
+		}{TLS: true}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+
+		var b Backend
+		switch opts.Backend {
+		case "slack":
+			token, err := secret("token", opts.Token, opts.TokenFile)
+			if err != nil {
+				return nil, err
+			}
+			if token == "" {
+				return nil, errors.New("missing token")
+			}
+			client := env.HTTP
+			if client == nil {
+				client = httpclient.Default
+			}
+			b = &Slack{Client: client, Token: token}
+		case "irc":
+			password, err := secret("password", opts.Password, opts.PasswordFile)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case opts.Server == "":
+				return nil, errors.New("missing server")
+			case opts.Nick == "":
+				return nil, errors.New("missing nick")
+			}
+			b = &IRC{Server: opts.Server, TLS: opts.TLS, Nick: opts.Nick, Password: password}
+		default:
+			return nil, fmt.Errorf("unknown backend: %q", opts.Backend)
+		}
+
+		return New(b, opts.Warn), nil
+	})
+}
+
+// Read a secret given either in the configuration or in a file.
+func secret(name, value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("%s and %s_file are exclusive", name, name)
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(file, "~/") {
+		file = filepath.Join(home, file[2:])
+	}
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Module prints the count of a backend.
+type Module struct {
+	backend Backend
+	warn    int
+
+	mu    sync.Mutex
+	count int
+}
+
+// New returns a module printing the count of the given backend, urgent from
+// warn on unless it is zero.
+func New(b Backend, warn int) *Module {
+	return &Module{backend: b, warn: warn}
+}
+
+// FullText implements openbar.Module.
+func (m *Module) FullText() (string, error) {
+	return m.FullTextContext(context.Background())
+}
+
+// FullTextContext implements openbar.ContextModule. Nothing is printed when
+// the count is zero.
+func (m *Module) FullTextContext(ctx context.Context) (string, error) {
+	n, err := m.backend.Count(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.count = n
+	m.mu.Unlock()
+
+	if n == 0 {
+		return "", nil
+	}
+
+	return strconv.Itoa(n), nil
+}
+
+// Urgent implements openbar.Urgenter.
+func (m *Module) Urgent() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.warn > 0 && m.count >= m.warn
+}
+
+// Click implements openbar.ClickHandler: left clicks reset the count of
+// backends keeping no read state.
+func (m *Module) Click(c openbar.Click) error {
+	if r, ok := m.backend.(Resetter); ok && c.Button == openbar.LeftButton {
+		r.Reset()
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package mentions_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"openbar"
+	"openbar/modules/mentions"
+	"strings"
+	"testing"
+)
+
+func TestSlack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxp-secret" {
+			fmt.Fprint(w, `{"ok": false, "error": "invalid_auth"}`)
+			return
+		}
+		q := r.URL.Query()
+		switch r.URL.Path + " " + q.Get("cursor") + q.Get("channel") {
+		case "/conversations.list ":
+			fmt.Fprint(w, `{"ok": true, "channels": [{"id": "D1"}], "response_metadata": {"next_cursor": "next"}}`)
+		case "/conversations.list next":
+			fmt.Fprint(w, `{"ok": true, "channels": [{"id": "G2"}, {"id": "D3"}], "response_metadata": {"next_cursor": ""}}`)
+		case "/conversations.info D1":
+			fmt.Fprint(w, `{"ok": true, "channel": {"unread_count_display": 2}}`)
+		case "/conversations.info G2":
+			fmt.Fprint(w, `{"ok": true, "channel": {"unread_count_display": 3}}`)
+		case "/conversations.info D3":
+			fmt.Fprint(w, `{"ok": true, "channel": {"unread_count_display": 0}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		token  string
+		warn   int
+		out    string
+		urgent bool
+		err    bool
+	}{
+		{token: "xoxp-secret", warn: 0, out: "5", urgent: false, err: false},
+		{token: "xoxp-secret", warn: 5, out: "5", urgent: true, err: false},
+		{token: "wrong", warn: 0, out: "", urgent: false, err: true},
+	}
+
+	for i, test := range tests {
+		m := mentions.New(&mentions.Slack{Client: srv.Client(), Token: test.token, API: srv.URL}, test.warn)
+		out, err := m.FullText()
+		if out != test.out || m.Urgent() != test.urgent || (err != nil) != test.err {
+			t.Errorf("%d: want: %q (urgent: %v, error: %v), got: %q (urgent: %v), %v", i, test.out, test.urgent, test.err, out, m.Urgent(), err)
+		}
+	}
+}
+
+func TestIRC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done, ponged := make(chan struct{}), make(chan struct{})
+	defer close(done)
+
+	// A bouncer playing back a mention, a private message, a message
+	// mentioning someone else and one sent by the user. Lines are handled in
+	// order, so once the ping is answered the messages are counted.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for _, want := range []string{"PASS secret", "NICK alice", "USER alice 0 * :openbar"} {
+			if line, _ := r.ReadString('\n'); strings.TrimSpace(line) != want {
+				t.Errorf("want: %q, got: %q", want, line)
+			}
+		}
+		fmt.Fprint(conn, ":bnc 001 alice_ :Welcome\r\n")
+		fmt.Fprint(conn, "@time=2024-01-01T00:00:00Z :bob!b@host PRIVMSG #chan :alice_: lunch?\r\n")
+		fmt.Fprint(conn, ":carol!c@host PRIVMSG alice_ :hi\r\n")
+		fmt.Fprint(conn, ":bob!b@host PRIVMSG #chan :malice_ is not a mention\r\n")
+		fmt.Fprint(conn, ":alice_!a@host PRIVMSG #chan :alice_ talking about herself\r\n")
+		fmt.Fprint(conn, "PING :bnc\r\n")
+		if line, _ := r.ReadString('\n'); strings.TrimSpace(line) != "PONG :bnc" {
+			t.Errorf("want: PONG, got: %q", line)
+		}
+		close(ponged)
+		<-done
+	}()
+
+	b := &mentions.IRC{Server: ln.Addr().String(), TLS: false, Nick: "alice", Password: "secret"}
+	m := mentions.New(b, 0)
+
+	// The first call connects to the bouncer.
+	if _, err := m.FullTextContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	<-ponged
+
+	out, err := m.FullTextContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "2" {
+		t.Errorf("want: %q, got: %q", "2", out)
+	}
+
+	// Clicks start the count over, which hides the block.
+	if err := m.Click(openbar.Click{Button: openbar.LeftButton}); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := m.FullText(); out != "" || err != nil {
+		t.Errorf("want: nothing, got: %q, %v", out, err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package modules is the registry of built-in modules that can be referenced by
+// name from the configuration file. Module packages register themselves when
+// they are imported.
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"openbar"
+	"openbar/location"
+	"openbar/mqtt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Env holds the resources shared by all modules.
+type Env struct {
+	// HTTP is the client network modules must use.
+	HTTP *http.Client
+	// Location tells where the machine is. It is nil unless configured.
+	Location location.Provider
+	// MQTT is the broker modules subscribe to by default. It is nil unless
+	// configured.
+	MQTT *mqtt.Broker
+}
+
+// Factory builds a module from its raw JSON options.
+type Factory func(env Env, options json.RawMessage) (openbar.Module, error)
+
+// Info describes a module for listings, so that documentation comes from the
+// code rather than from separate files.
+type Info struct {
+	Name        string
+	Description string
+	Options     []Option
+	// Requires lists the external programs or services the module relies on.
+	Requires []string
+	// Network is set for modules that reach the network, which pause while the
+	// bar saves energy.
+	Network bool
+	// Stream is set for modules pushing their values, which implement
+	// openbar.StreamModule and need no interval.
+	Stream bool
+	// Disabled is the build tag that left the module out of the binary.
+	Disabled string
+	// Commands lists the command lines the module may run with the given
+	// options, defaults included, so that hardened configurations can check
+	// them. It is nil for modules running none.
+	Commands func(options json.RawMessage) ([][]string, error)
+}
+
+// Option is a setting accepted by a module. The default is written as it would
+// be in the configuration, or described when too long to be, and empty when
+// there is none.
+type Option struct {
+	Name        string
+	Type        Type
+	Default     string
+	Description string
+}
+
+// Type is the JSON type of an option.
+type Type string
+
+// Option types.
+const (
+	String   Type = "string"
+	Bool     Type = "bool"
+	Int      Type = "int"
+	Duration Type = "duration"
+	Strings  Type = "[]string"
+	Objects  Type = "[]object"
+)
+
+// ErrOption is returned when options don't match the schema of a module.
+var ErrOption = errors.New("invalid option")
+
+// Check a JSON value is of the given type.
+func (t Type) check(raw json.RawMessage) error {
+	var err error
+
+	switch t {
+	case String:
+		var v string
+		err = json.Unmarshal(raw, &v)
+	case Bool:
+		var v bool
+		err = json.Unmarshal(raw, &v)
+	case Int:
+		var v int
+		err = json.Unmarshal(raw, &v)
+	case Duration:
+		var v string
+		if err = json.Unmarshal(raw, &v); err == nil {
+			_, err = time.ParseDuration(v)
+		}
+	case Strings:
+		var v []string
+		err = json.Unmarshal(raw, &v)
+	case Objects:
+		var v []map[string]json.RawMessage
+		err = json.Unmarshal(raw, &v)
+	default:
+		return fmt.Errorf("unknown type: %s", t)
+	}
+
+	if err != nil {
+		return fmt.Errorf("want %s", t)
+	}
+
+	return nil
+}
+
+type entry struct {
+	info    Info
+	factory Factory
+}
+
+var registry = make(map[string]entry)
+
+// Register makes a module available under the name of its info. It is meant to
+// be called from init functions and panics if the name is already taken.
+// Modules must describe themselves and each of their options.
+func Register(info Info, f Factory) {
+	if _, ok := registry[info.Name]; ok {
+		panic(fmt.Sprintf("modules: %s registered twice", info.Name))
+	}
+	if info.Disabled == "" && info.Description == "" {
+		panic(fmt.Sprintf("modules: %s has no description", info.Name))
+	}
+	for _, o := range info.Options {
+		if o.Type == "" || o.Description == "" {
+			panic(fmt.Sprintf("modules: option %s of %s is not described", o.Name, info.Name))
+		}
+	}
+	registry[info.Name] = entry{info, f}
+}
+
+// ErrDisabled is returned when building a module left out of the binary.
+var ErrDisabled = errors.New("module not compiled in")
+
+// Disable registers a module left out of the binary with the given build tag.
+// Building it fails with an explanation instead of an unknown module error.
+func Disable(name, tag string) {
+	Register(Info{Name: name, Disabled: tag}, func(Env, json.RawMessage) (openbar.Module, error) {
+		return nil, fmt.Errorf("%w: rebuild without -tags %s", ErrDisabled, tag)
+	})
+}
+
+// Lookup returns the factory registered under the given name.
+func Lookup(name string) (Factory, bool) {
+	e, ok := registry[name]
+	return e.factory, ok
+}
+
+// Describe returns the info of the module registered under the given name.
+func Describe(name string) (Info, bool) {
+	e, ok := registry[name]
+	return e.info, ok
+}
+
+// Commands returns the command lines the module registered under the given
+// name may run with the given options. Modules left out of the binary run
+// none.
+func Commands(name string, options json.RawMessage) ([][]string, error) {
+	e, ok := registry[name]
+	if !ok || e.info.Commands == nil {
+		return nil, nil
+	}
+	return e.info.Commands(options)
+}
+
+// Validate checks options against the schema of the module registered under the
+// given name. Modules left out of the binary are not checked.
+func Validate(name string, options json.RawMessage) error {
+	e, ok := registry[name]
+	if !ok || e.info.Disabled != "" {
+		return nil
+	}
+
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(options, &values); err != nil {
+		return fmt.Errorf("%w: options must be an object", ErrOption)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		o, ok := e.info.option(k)
+		if !ok {
+			return fmt.Errorf("%w: unknown option %q (known options: %s)", ErrOption, k, e.info.names())
+		}
+		if err := o.Type.check(values[k]); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrOption, k, err)
+		}
+	}
+
+	return nil
+}
+
+// Find an option by name.
+func (i Info) option(name string) (Option, bool) {
+	for _, o := range i.Options {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
+
+// List the option names.
+func (i Info) names() string {
+	if len(i.Options) == 0 {
+		return "none"
+	}
+	res := make([]string, 0, len(i.Options))
+	for _, o := range i.Options {
+		res = append(res, o.Name)
+	}
+	return strings.Join(res, ", ")
+}
+
+// Names returns the sorted list of registered modules.
+func Names() []string {
+	res := make([]string, 0, len(registry))
+	for name := range registry {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// List returns the info of every registered module, sorted by name.
+func List() []Info {
+	res := make([]Info, 0, len(registry))
+	for _, name := range Names() {
+		res = append(res, registry[name].info)
+	}
+	return res
+}
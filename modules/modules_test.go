@@ -0,0 +1,67 @@
+package modules_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"testing"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "test",
+		Description: "a test",
+		Options: []modules.Option{
+			{Name: "text", Type: modules.String, Description: "text to print"},
+			{Name: "timeout", Type: modules.Duration, Default: `"1s"`, Description: "how long to wait"},
+		},
+	}, func(modules.Env, json.RawMessage) (openbar.Module, error) {
+		return openbar.ModuleFunc(func() (string, error) { return "", nil }), nil
+	})
+	modules.Disable("left-out", "notest")
+}
+
+func TestRegistry(t *testing.T) {
+	list := modules.List()
+	if len(list) != 2 || list[0].Name != "left-out" || list[1].Description != "a test" {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	f, ok := modules.Lookup("left-out")
+	if !ok {
+		t.Fatal("disabled module not found")
+	}
+
+	if _, err := f(modules.Env{}, nil); !errors.Is(err, modules.ErrDisabled) {
+		t.Errorf("want: %v, got: %v", modules.ErrDisabled, err)
+	}
+
+	if _, ok := modules.Lookup("unknown"); ok {
+		t.Error("unknown module found")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		options string
+		err     error
+	}{
+		{options: `{}`, err: nil},
+		{options: `{"text": "hello", "timeout": "2s"}`, err: nil},
+		{options: `{"txt": "hello"}`, err: modules.ErrOption},
+		{options: `{"text": 42}`, err: modules.ErrOption},
+		{options: `{"timeout": "soon"}`, err: modules.ErrOption},
+		{options: `[]`, err: modules.ErrOption},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := modules.Validate("test", json.RawMessage(test.options))
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
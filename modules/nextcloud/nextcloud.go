@@ -0,0 +1,184 @@
+// Package nextcloud is an OpenBar module printing the number of unread
+// notifications of a Nextcloud account, or whether the server is down or in
+// maintenance, and opening Nextcloud when clicked. It uses the OCS API with an
+// app password.
+package nextcloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/modules"
+	"openbar/modules/command"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Offline is printed when the server can't be reached.
+const Offline = "offline"
+
+// Maintenance is printed while the server is in maintenance mode.
+const Maintenance = "maintenance"
+
+// DefaultOpener opens Nextcloud on left click, given its address.
+var DefaultOpener = []string{"xdg-open"}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "nextcloud",
+		Description: "unread Nextcloud notifications, opening Nextcloud when clicked",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "url", Type: modules.String, Description: "address of Nextcloud, like https://cloud.example.org"},
+			{Name: "user", Type: modules.String, Description: "login of the account"},
+			{Name: "password", Type: modules.String, Description: "app password of the account"},
+			{Name: "password_file", Type: modules.String, Description: "file holding the password, instead of password, ~ being the home directory"},
+			{Name: "opener", Type: modules.Strings, Default: `["xdg-open"]`, Description: "command opening Nextcloud on left click, given its address"},
+		},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts := struct {
+				Opener []string `json:"opener"`
+			}{}
+			if err := json.Unmarshal(options, &opts); err != nil {
+				return nil, err
+			}
+			if len(opts.Opener) == 0 {
+				return [][]string{DefaultOpener}, nil
+			}
+			return [][]string{opts.Opener}, nil
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			URL          string   `json:"url"`
+			User         string   `json:"user"`
+			Password     string   `json:"password"`
+			PasswordFile string   `json:"password_file"`
+			Opener       []string `json:"opener"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		switch {
+		case opts.URL == "":
+			return nil, errors.New("missing url")
+		case opts.User == "":
+			return nil, errors.New("missing user")
+		case opts.Password != "" && opts.PasswordFile != "":
+			return nil, errors.New("password and password_file are exclusive")
+		}
+		password := opts.Password
+		if opts.PasswordFile != "" {
+			path := opts.PasswordFile
+			if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+				path = filepath.Join(home, path[2:])
+			}
+			data, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, err
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		if password == "" {
+			return nil, errors.New("missing password")
+		}
+		client := env.HTTP
+		if client == nil {
+			client = httpclient.Default
+		}
+		m := New(client, opts.URL, opts.User, password)
+		if len(opts.Opener) > 0 {
+			m.Opener = opts.Opener
+		}
+		return m, nil
+	})
+}
+
+// Module follows the notifications of an account.
+type Module struct {
+	// Opener is the command opening Nextcloud on left click, given its
+	// address. Nothing is opened when empty.
+	Opener []string
+
+	client   *http.Client
+	url      string
+	user     string
+	password string
+}
+
+// New returns a module following the notifications of an account of the
+// Nextcloud instance at the given address. Nextcloud is opened with
+// DefaultOpener.
+func New(client *http.Client, url, user, password string) *Module {
+	return &Module{DefaultOpener, client, strings.TrimSuffix(url, "/"), user, password}
+}
+
+// FullText implements openbar.Module. The state of the server comes first, so
+// that an unreachable server or one in maintenance is told apart from an
+// account error.
+func (m *Module) FullText() (string, error) {
+	var status struct {
+		Maintenance bool `json:"maintenance"`
+	}
+	if err := m.get("/status.php", false, &status); err != nil {
+		return Offline, err
+	}
+	if status.Maintenance {
+		return Maintenance, nil
+	}
+
+	var notifications struct {
+		OCS struct {
+			Data []json.RawMessage `json:"data"`
+		} `json:"ocs"`
+	}
+	if err := m.get("/ocs/v2.php/apps/notifications/api/v2/notifications?format=json", true, &notifications); err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(len(notifications.OCS.Data)), nil
+}
+
+// Click implements openbar.ClickHandler: left clicks open Nextcloud.
+func (m *Module) Click(c openbar.Click) error {
+	if len(m.Opener) == 0 || c.Button != openbar.LeftButton {
+		return nil
+	}
+
+	args := append(append([]string{}, m.Opener...), m.url)
+	_, err := command.Spawn(args...)
+
+	return err
+}
+
+// Call the API and decode the answer. Answers other than 200 OK are errors.
+func (m *Module) get(path string, auth bool, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, m.url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if auth {
+		req.SetBasicAuth(m.user, m.password)
+		req.Header.Set("OCS-APIRequest", "true")
+	}
+	req.Header.Set("Accept", "application/json")
+	// Notifications come and go, and answers are private.
+	req.Header.Set("Cache-Control", "no-store")
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return openbar.Temporary(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return httpclient.Refused(res, fmt.Errorf("GET %s: %s", strings.SplitN(path, "?", 2)[0], res.Status))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
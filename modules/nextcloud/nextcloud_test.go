@@ -0,0 +1,87 @@
+package nextcloud_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"openbar"
+	"openbar/modules/nextcloud"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// A Nextcloud instance with two notifications for alice, in maintenance when
+// asked to.
+func serve(t *testing.T, maintenance bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status.php":
+			fmt.Fprintf(w, `{"installed": true, "maintenance": %v}`, maintenance)
+		case "/ocs/v2.php/apps/notifications/api/v2/notifications":
+			user, password, _ := r.BasicAuth()
+			if user != "alice" || password != "secret" || r.Header.Get("OCS-APIRequest") != "true" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"ocs": {"meta": {"status": "ok"}, "data": [{"notification_id": 1}, {"notification_id": 2}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNotifications(t *testing.T) {
+	up, down := serve(t, false), serve(t, false)
+	down.Close()
+
+	tests := []struct {
+		url      string
+		password string
+		out      string
+		err      bool
+	}{
+		{url: up.URL + "/", password: "secret", out: "2", err: false},
+		{url: up.URL, password: "wrong", out: "", err: true},
+		{url: serve(t, true).URL, password: "secret", out: nextcloud.Maintenance, err: false},
+		{url: down.URL, password: "secret", out: nextcloud.Offline, err: true},
+	}
+
+	for i, test := range tests {
+		out, err := nextcloud.New(http.DefaultClient, test.url, "alice", test.password).FullText()
+		if out != test.out || (err != nil) != test.err {
+			t.Errorf("%d: want: %q (error: %v), got: %q, %v", i, test.out, test.err, out, err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	srv := serve(t, false)
+	// Reading the pipe waits for the opener to run.
+	opened := filepath.Join(t.TempDir(), "opened")
+	if err := syscall.Mkfifo(opened, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := nextcloud.New(srv.Client(), srv.URL, "alice", "secret")
+	m.Opener = []string{"sh", "-c", `echo "$1" > "$0"`, opened}
+
+	if err := m.Click(openbar.Click{Button: openbar.RightButton}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Click(openbar.Click{Button: openbar.LeftButton}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != srv.URL {
+		t.Errorf("want: %s, got: %s", srv.URL, got)
+	}
+}
@@ -0,0 +1,184 @@
+// Package outputs is an OpenBar module printing how many monitors Sway uses,
+// disabled ones left out, along with the active profile if there is a way to
+// know it. It refreshes as soon as an output is plugged or unplugged.
+package outputs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"openbar/modules/command"
+	"openbar/swayipc"
+	"time"
+)
+
+// Retry is how long to wait before listening to Sway again after losing the
+// connection, for instance when Sway is restarted.
+const Retry = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "outputs",
+		Description: "number of monitors connected to Sway and active profile",
+		Options: []modules.Option{
+			{Name: "socket", Type: modules.String, Default: `"$SWAYSOCK"`, Description: "Sway IPC socket"},
+			{Name: "profile", Type: modules.Strings, Description: "command printing the active profile"},
+		},
+		Requires: []string{"sway"},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			if err != nil || len(opts.Profile) == 0 {
+				return nil, err
+			}
+			return [][]string{opts.Profile}, nil
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+		return New(opts.Socket, opts.Profile...), nil
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Socket  string   `json:"socket"`
+	Profile []string `json:"profile"`
+}
+
+// Read the options of the module.
+func parse(options json.RawMessage) (settings, error) {
+	var res settings
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// Module shows the outputs of Sway.
+type Module struct {
+	socket  string
+	profile func() (string, error)
+}
+
+// New returns a module talking to Sway on the given socket, or on $SWAYSOCK if
+// empty. If a command is given, its output is the name of the active profile,
+// for instance ["kanshictl", "status"] or a script reading kanshi's state.
+func New(socket string, profile ...string) *Module {
+	m := &Module{socket: socket}
+	if len(profile) > 0 {
+		m.profile = command.New(profile...)
+	}
+	return m
+}
+
+// FullText prints "2 outputs" or "2 outputs docked" if there is a profile.
+func (m *Module) FullText() (string, error) {
+	c, err := m.dial()
+	if err != nil {
+		return "", err
+	}
+
+	defer c.Close()
+
+	outputs, err := c.Outputs()
+	if err != nil {
+		return "", err
+	}
+
+	// Disabled outputs are connected but show nothing.
+	active := 0
+	for _, o := range outputs {
+		if o.Active {
+			active++
+		}
+	}
+
+	res := fmt.Sprintf("%d outputs", active)
+	if active == 1 {
+		res = "1 output"
+	}
+
+	if m.profile == nil {
+		return res, nil
+	}
+
+	profile, err := m.profile()
+	if err != nil {
+		return res, err
+	}
+
+	if profile != "" {
+		res += " " + profile
+	}
+
+	return res, nil
+}
+
+// Notify implements openbar.Notifier by listening to output events.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	for {
+		m.watch(ctx, changed)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Sway may come back, and the value shown is probably stale anyway.
+		changed()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(Retry):
+		}
+	}
+}
+
+// Call changed for each output event until the connection is lost or the
+// context is done.
+func (m *Module) watch(ctx context.Context, changed func()) {
+	c, err := m.dial()
+	if err != nil {
+		return
+	}
+
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	if err := c.Subscribe("output"); err != nil {
+		return
+	}
+
+	for {
+		kind, _, err := c.Next()
+		if err != nil {
+			return
+		}
+		if kind == swayipc.OutputEvent {
+			changed()
+		}
+	}
+}
+
+// Connect to Sway.
+func (m *Module) dial() (*swayipc.Conn, error) {
+	socket := m.socket
+	if socket == "" {
+		var err error
+		if socket, err = swayipc.Socket(); err != nil {
+			return nil, err
+		}
+	}
+	return swayipc.Dial(socket)
+}
@@ -0,0 +1,83 @@
+package outputs_test
+
+import (
+	"context"
+	"net"
+	"openbar/modules/outputs"
+	"openbar/swayipc"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Fake Sway answering requests and sending an output event to subscribers. One
+// of its outputs is disabled.
+func fake(t *testing.T, path string) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				c := &swayipc.Conn{Conn: conn}
+				for {
+					kind, _, err := c.Next()
+					if err != nil {
+						return
+					}
+					switch kind {
+					case swayipc.GetOutputs:
+						_ = swayipc.Write(conn, kind, []byte(`[{"name": "eDP-1", "active": true}, {"name": "DP-1", "active": true}, {"name": "HDMI-A-1", "active": false}]`))
+					case swayipc.Subscribe:
+						_ = swayipc.Write(conn, kind, []byte(`{"success": true}`))
+						_ = swayipc.Write(conn, swayipc.OutputEvent, []byte(`{"change": "unspecified"}`))
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func TestOutputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sway.sock")
+	fake(t, path)
+
+	m := outputs.New(path, "echo", "docked")
+
+	out, err := m.FullText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "2 outputs docked" {
+		t.Errorf("want: %q, got: %q", "2 outputs docked", out)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		_ = m.Notify(ctx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Error("no change notified")
+	}
+}
@@ -0,0 +1,233 @@
+// Package peripherals is an OpenBar module printing the battery levels of
+// wireless devices such as mice, keyboards and headsets as reported by UPower,
+// either through upower(1) or directly over D-Bus. It complements the battery
+// module which reads the laptop battery.
+package peripherals
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"openbar"
+	"openbar/modules"
+	"openbar/upower"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCommand dumps every device known to UPower.
+var DefaultCommand = []string{"upower", "--dump"}
+
+// DefaultTimeout bounds a single query.
+const DefaultTimeout = 5 * time.Second
+
+// Device is a peripheral with a battery.
+type Device struct {
+	Path       string
+	Kind       string
+	Model      string
+	Percentage float64
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "peripherals",
+		Description: "battery levels of wireless devices",
+		Options: []modules.Option{
+			{Name: "kinds", Type: modules.Strings, Description: "kinds of devices to show, all if empty"},
+			{Name: "command", Type: modules.Strings, Default: `["upower", "--dump"]`, Description: "command dumping devices like upower"},
+			{Name: "backend", Type: modules.String, Default: `"command"`, Description: "command, or upower to read D-Bus and refresh on changes"},
+		},
+		Requires: []string{"upower"},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			if err != nil || opts.Backend != "command" {
+				return nil, err
+			}
+			return [][]string{opts.Command}, nil
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+		switch opts.Backend {
+		case "command":
+			if len(opts.Command) == 0 {
+				return nil, fmt.Errorf("empty command")
+			}
+			return openbar.ModuleFunc(New(opts.Kinds, opts.Command...)), nil
+		case "upower":
+			return UPower(upower.System(), opts.Kinds), nil
+		default:
+			return nil, fmt.Errorf("unknown backend: %s", opts.Backend)
+		}
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Kinds   []string `json:"kinds"`
+	Command []string `json:"command"`
+	Backend string   `json:"backend"`
+}
+
+// Read the options of the module, falling back to defaults.
+func parse(options json.RawMessage) (settings, error) {
+	res := settings{Command: DefaultCommand, Backend: "command"}
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// New returns a module running a command printing devices like `upower --dump`
+// does. Only devices of the given kinds are shown, or all peripherals if none
+// is given. The output looks like "mouse 80% headset 40%".
+func New(kinds []string, args ...string) func() (string, error) {
+	return func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer cancel()
+
+		//nolint:gosec
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			return "", err
+		}
+
+		devices, err := Parse(bytes.NewReader(out))
+		if err != nil {
+			return "", err
+		}
+
+		return format(filter(devices, kinds)), nil
+	}
+}
+
+// Parse reads the output of `upower --dump`. Power supplies of the system, such
+// as the laptop battery or the AC adapter, are left out.
+func Parse(r io.Reader) ([]Device, error) {
+	res := make([]Device, 0)
+
+	var cur *Device
+	supply := false
+
+	flush := func() {
+		if cur != nil && !supply && cur.Kind != "" {
+			res = append(res, *cur)
+		}
+		cur, supply = nil, false
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "Device:"):
+			flush()
+			cur = &Device{Path: strings.TrimSpace(strings.TrimPrefix(line, "Device:"))}
+		case cur == nil || trimmed == "":
+		case strings.HasPrefix(line, "Daemon:"):
+			flush()
+		case !strings.Contains(trimmed, ":"):
+			// The kind is the only line without a colon, e.g. "  mouse".
+			cur.Kind = trimmed
+		default:
+			parts := strings.SplitN(trimmed, ":", 2)
+			value := strings.TrimSpace(parts[1])
+			switch parts[0] {
+			case "model":
+				cur.Model = value
+			case "power supply":
+				supply = value == "yes"
+			case "percentage":
+				// Values are like "80%" or "80.5%" and sometimes followed by a
+				// comment between parentheses.
+				fields := strings.Fields(value)
+				if len(fields) == 0 {
+					continue
+				}
+				p, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", cur.Path, err)
+				}
+				cur.Percentage = p
+			}
+		}
+	}
+
+	flush()
+
+	return res, scanner.Err()
+}
+
+// Daemon is the part of UPower the module relies on.
+type Daemon interface {
+	Devices() ([]upower.Device, error)
+	Notify(ctx context.Context, changed func()) error
+}
+
+// Module reads devices from UPower and is refreshed as soon as one changes.
+type Module struct {
+	daemon Daemon
+	kinds  []string
+}
+
+// UPower returns a module reading devices from UPower, filtered like New does.
+func UPower(d Daemon, kinds []string) *Module {
+	return &Module{d, kinds}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	all, err := m.daemon.Devices()
+	if err != nil {
+		return "", err
+	}
+
+	devices := make([]Device, 0, len(all))
+	for _, d := range all {
+		if d.PowerSupply || d.Kind == upower.LinePower {
+			continue
+		}
+		devices = append(devices, Device{string(d.Path), d.Kind.String(), d.Model, d.Percentage})
+	}
+
+	return format(filter(devices, m.kinds)), nil
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.daemon.Notify(ctx, changed)
+}
+
+// Keep devices of the given kinds, or all of them.
+func filter(devices []Device, kinds []string) []Device {
+	if len(kinds) == 0 {
+		return devices
+	}
+	res := make([]Device, 0, len(devices))
+	for _, d := range devices {
+		for _, k := range kinds {
+			if d.Kind == k {
+				res = append(res, d)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Print devices one after another.
+func format(devices []Device) string {
+	fields := make([]string, 0, len(devices))
+	for _, d := range devices {
+		fields = append(fields, fmt.Sprintf("%s %.0f%%", d.Kind, d.Percentage))
+	}
+	return strings.Join(fields, " ")
+}
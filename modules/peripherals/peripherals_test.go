@@ -0,0 +1,130 @@
+package peripherals_test
+
+import (
+	"context"
+	"fmt"
+	"openbar/modules/peripherals"
+	"openbar/upower"
+	"strings"
+	"testing"
+)
+
+const dump = `Device: /org/freedesktop/UPower/devices/line_power_AC
+  native-path:          AC
+  power supply:         yes
+  line-power
+    online:              yes
+
+Device: /org/freedesktop/UPower/devices/battery_BAT0
+  native-path:          BAT0
+  power supply:         yes
+  battery
+    percentage:          85%
+
+Device: /org/freedesktop/UPower/devices/mouse_hidpp_battery_0
+  native-path:          hidpp_battery_0
+  model:                MX Master 3
+  power supply:         no
+  mouse
+    present:             yes
+    percentage:          80% (should be ignored)
+
+Device: /org/freedesktop/UPower/devices/headset_dev_00_11_22
+  model:                WH-1000XM4
+  power supply:         no
+  headset
+    percentage:          40.4%
+
+Daemon:
+  daemon-version:  1.90.2
+  on-battery:      no
+`
+
+func TestParse(t *testing.T) {
+	devices, err := peripherals.Parse(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []peripherals.Device{
+		{
+			Path:       "/org/freedesktop/UPower/devices/mouse_hidpp_battery_0",
+			Kind:       "mouse",
+			Model:      "MX Master 3",
+			Percentage: 80,
+		},
+		{
+			Path:       "/org/freedesktop/UPower/devices/headset_dev_00_11_22",
+			Kind:       "headset",
+			Model:      "WH-1000XM4",
+			Percentage: 40.4,
+		},
+	}
+
+	if fmt.Sprint(devices) != fmt.Sprint(want) {
+		t.Errorf("want: %v, got: %v", want, devices)
+	}
+}
+
+func TestPeripherals(t *testing.T) {
+	tests := []struct {
+		kinds []string
+		out   string
+	}{
+		{kinds: nil, out: "mouse 80% headset 40%"},
+		{kinds: []string{"headset"}, out: "headset 40%"},
+		{kinds: []string{"keyboard"}, out: ""},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := peripherals.New(test.kinds, "printf", "%s", dump)()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+		})
+	}
+}
+
+// A daemon knowing the devices of the dump.
+type daemon []upower.Device
+
+func (d daemon) Devices() ([]upower.Device, error) { return d, nil }
+
+func (d daemon) Notify(ctx context.Context, _ func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestUPower(t *testing.T) {
+	devices := daemon{
+		{Path: "/org/freedesktop/UPower/devices/line_power_AC", Kind: upower.LinePower, PowerSupply: true},
+		{Path: "/org/freedesktop/UPower/devices/battery_BAT0", Kind: upower.Battery, PowerSupply: true, Percentage: 85},
+		{Path: "/org/freedesktop/UPower/devices/mouse_hidpp_battery_0", Kind: upower.Kind(5), Model: "MX Master 3", Percentage: 80},
+		{Path: "/org/freedesktop/UPower/devices/headset_dev_00_11_22", Kind: upower.Kind(17), Model: "WH-1000XM4", Percentage: 40.4},
+	}
+
+	tests := []struct {
+		kinds []string
+		out   string
+	}{
+		{kinds: nil, out: "mouse 80% headset 40%"},
+		{kinds: []string{"headset"}, out: "headset 40%"},
+		{kinds: []string{"keyboard"}, out: ""},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := peripherals.UPower(devices, test.kinds).FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package port is an OpenBar module connecting to a TCP or UDP port and
+// printing whether it answered and how fast, a lighter alternative to ping for
+// watching home servers since it needs no privileges.
+package port
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"openbar"
+	"openbar/modules"
+	"time"
+)
+
+// Down is printed when the port doesn't answer.
+const Down = "down"
+
+// DefaultTimeout bounds a single check.
+const DefaultTimeout = 5 * time.Second
+
+// ErrNoReply is returned when a UDP service doesn't answer the probe.
+var ErrNoReply = errors.New("no reply")
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "port",
+		Description: "whether a TCP or UDP port answers, with the connection latency",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "address", Type: modules.String, Description: "HOST:PORT to connect to"},
+			{Name: "network", Type: modules.String, Default: `"tcp"`, Description: "tcp or udp"},
+			{Name: "probe", Type: modules.String, Description: "datagram sent to UDP services, which must answer it"},
+			{Name: "timeout", Type: modules.Duration, Default: `"5s"`, Description: "maximum time for a check"},
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Address string `json:"address"`
+			Network string `json:"network"`
+			Probe   string `json:"probe"`
+			Timeout string `json:"timeout"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if _, _, err := net.SplitHostPort(opts.Address); err != nil {
+			return nil, fmt.Errorf("invalid address: %w", err)
+		}
+		timeout := DefaultTimeout
+		if opts.Timeout != "" {
+			d, err := time.ParseDuration(opts.Timeout)
+			if err != nil {
+				return nil, err
+			}
+			timeout = d
+		}
+		check, err := New(opts.Network, opts.Address, []byte(opts.Probe), timeout)
+		if err != nil {
+			return nil, err
+		}
+		return openbar.ContextModuleFunc(check), nil
+	})
+}
+
+// New returns a module connecting to address over network, "tcp" (the default)
+// or "udp". TCP ports are up once the connection is established. UDP being
+// connectionless, the probe is sent instead and the port is up once the
+// service replies, so it must be something the service answers.
+func New(network, address string, probe []byte, timeout time.Duration) (func(context.Context) (string, error), error) {
+	switch network {
+	case "", "tcp":
+		network = "tcp"
+	case "udp":
+	default:
+		return nil, fmt.Errorf("unknown network: %s", network)
+	}
+
+	return func(ctx context.Context) (string, error) {
+		return check(ctx, network, address, probe, timeout)
+	}, nil
+}
+
+// Time one check.
+func check(ctx context.Context, network, address string, probe []byte, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return Down, err
+	}
+	defer conn.Close()
+
+	if network == "udp" {
+		if err := exchange(ctx, conn, probe); err != nil {
+			return Down, err
+		}
+	}
+
+	return "up " + time.Since(start).Round(100*time.Microsecond).String(), nil
+}
+
+// Send the probe and wait for a reply. Closed ports usually make the next
+// read fail right away.
+func exchange(ctx context.Context, conn net.Conn, probe []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err := conn.Write(probe); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1)
+	if _, err := conn.Read(buf); err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return ErrNoReply
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package port_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"openbar/modules/port"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return the address of a TCP listener, closed right away when down.
+func listenTCP(t *testing.T, down bool) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if down {
+		ln.Close()
+	} else {
+		t.Cleanup(func() { ln.Close() })
+	}
+	return ln.Addr().String()
+}
+
+// Return the address of a UDP service, echoing what it gets unless silent.
+func listenUDP(t *testing.T, silent bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if !silent {
+				_, _ = conn.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestPort(t *testing.T) {
+	tests := []struct {
+		network string
+		address string
+		up      bool
+		err     error
+	}{
+		{network: "", address: listenTCP(t, false), up: true, err: nil},
+		{network: "tcp", address: listenTCP(t, true), up: false, err: nil},
+		{network: "udp", address: listenUDP(t, false), up: true, err: nil},
+		{network: "udp", address: listenUDP(t, true), up: false, err: port.ErrNoReply},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			check, err := port.New(test.network, test.address, []byte("ping"), 200*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := check(context.Background())
+
+			switch {
+			case test.up && (err != nil || !strings.HasPrefix(out, "up ")):
+				t.Errorf("want: up, got: %q, %v", out, err)
+			case !test.up && (err == nil || out != port.Down):
+				t.Errorf("want: %q with an error, got: %q, %v", port.Down, out, err)
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+
+	if _, err := port.New("icmp", "127.0.0.1:0", nil, time.Second); err == nil {
+		t.Error("want: unknown network, got: nil")
+	}
+}
@@ -0,0 +1,54 @@
+package power
+
+import (
+	"fmt"
+	"openbar/dbus"
+)
+
+const (
+	service      = "org.freedesktop.login1"
+	root         = dbus.ObjectPath("/org/freedesktop/login1")
+	managerIface = "org.freedesktop.login1.Manager"
+	sessionIface = "org.freedesktop.login1.Session"
+	// The session of the caller.
+	session = dbus.ObjectPath("/org/freedesktop/login1/session/auto")
+)
+
+// A call is a method of logind running an action.
+type call struct {
+	path   dbus.ObjectPath
+	iface  string
+	method string
+	args   []interface{}
+}
+
+// Methods of the actions. Actions are not interactive since there is nobody to
+// answer polkit from the bar.
+var logind = map[string]call{
+	Lock:      {session, sessionIface, "Lock", nil},
+	Logout:    {session, sessionIface, "Terminate", nil},
+	Suspend:   {root, managerIface, "Suspend", []interface{}{false}},
+	Hibernate: {root, managerIface, "Hibernate", []interface{}{false}},
+	Reboot:    {root, managerIface, "Reboot", []interface{}{false}},
+	PowerOff:  {root, managerIface, "PowerOff", []interface{}{false}},
+}
+
+// Logind runs actions through systemd-logind.
+type Logind struct {
+	bus *dbus.Bus
+}
+
+// NewLogind returns a client of systemd-logind on the given bus.
+func NewLogind(bus *dbus.Bus) *Logind {
+	return &Logind{bus}
+}
+
+// Run implements Daemon for Logind.
+func (d *Logind) Run(action string) error {
+	c, ok := logind[action]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAction, action)
+	}
+	_, err := d.bus.Call(service, c.path, c.iface, c.method, c.args...)
+	return err
+}
@@ -0,0 +1,139 @@
+// Package power is an OpenBar module showing a power icon that doubles as a
+// menu: scrolling over it cycles between actions like suspending or rebooting,
+// and clicking runs the chosen one through systemd-logind once confirmed.
+package power
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/dbus"
+	"openbar/modules"
+	"sync"
+)
+
+// Actions the module offers.
+const (
+	Lock      = "lock"
+	Logout    = "logout"
+	Suspend   = "suspend"
+	Hibernate = "hibernate"
+	Reboot    = "reboot"
+	PowerOff  = "poweroff"
+)
+
+// DefaultActions are offered unless configured otherwise.
+var DefaultActions = []string{Lock, Suspend, Reboot, PowerOff}
+
+// DefaultIcon is printed while no action is chosen.
+const DefaultIcon = "⏻"
+
+// ErrAction is returned for actions the module doesn't know.
+var ErrAction = errors.New("unknown action")
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "power",
+		Description: "power menu locking, suspending or shutting down",
+		Options: []modules.Option{
+			{Name: "actions", Type: modules.Strings, Default: `["lock", "suspend", "reboot", "poweroff"]`, Description: "actions to cycle through, among logout and hibernate too"},
+			{Name: "icon", Type: modules.String, Default: `"⏻"`, Description: "text shown while no action is chosen"},
+		},
+		Requires: []string{"systemd-logind"},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Actions []string `json:"actions"`
+			Icon    string   `json:"icon"`
+		}{Actions: DefaultActions, Icon: DefaultIcon}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		return New(NewLogind(dbus.System()), opts.Icon, opts.Actions...)
+	})
+}
+
+// Daemon runs the actions.
+type Daemon interface {
+	Run(action string) error
+}
+
+// Module is a power menu. Scrolling chooses an action, a left click runs it
+// once confirmed and a right click closes the menu.
+type Module struct {
+	daemon  Daemon
+	icon    string
+	actions []string
+
+	mu sync.Mutex
+	// Index of the chosen action, or -1 while the menu is closed.
+	cur int
+}
+
+// New returns a menu offering the given actions.
+func New(d Daemon, icon string, actions ...string) (*Module, error) {
+	if len(actions) == 0 {
+		return nil, errors.New("no actions")
+	}
+	for _, a := range actions {
+		if _, ok := logind[a]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrAction, a)
+		}
+	}
+	return &Module{daemon: d, icon: icon, actions: actions, cur: -1}, nil
+}
+
+// FullText prints the icon, followed by the chosen action while the menu is
+// open, like "⏻ reboot".
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cur < 0 {
+		return m.icon, nil
+	}
+	return m.icon + " " + m.actions[m.cur], nil
+}
+
+// Click implements openbar.ClickHandler for Module. A left click on the closed
+// menu opens it on the first action.
+func (m *Module) Click(c openbar.Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.actions)
+
+	switch c.Button {
+	case openbar.ScrollDown:
+		m.cur = (m.cur + 1) % n
+	case openbar.ScrollUp:
+		if m.cur <= 0 {
+			m.cur = n
+		}
+		m.cur--
+	case openbar.RightButton:
+		m.cur = -1
+	case openbar.LeftButton:
+		if m.cur < 0 {
+			m.cur = 0
+			return nil
+		}
+		action := m.actions[m.cur]
+		m.cur = -1
+		return m.daemon.Run(action)
+	}
+
+	return nil
+}
+
+// Confirm implements openbar.Confirmer for Module: running an action needs a
+// second click.
+func (m *Module) Confirm(c openbar.Click) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c.Button != openbar.LeftButton || m.cur < 0 {
+		return "", false
+	}
+	return m.actions[m.cur] + "?", true
+}
@@ -0,0 +1,77 @@
+package power_test
+
+import (
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/modules/power"
+	"testing"
+)
+
+// A daemon recording the actions it runs.
+type daemon struct {
+	ran []string
+}
+
+func (d *daemon) Run(action string) error {
+	d.ran = append(d.ran, action)
+	return nil
+}
+
+func TestPower(t *testing.T) {
+	d := new(daemon)
+	m, err := power.New(d, "P", power.Lock, power.Suspend, power.PowerOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var _ openbar.ClickHandler = m
+	var _ openbar.Confirmer = m
+
+	// Confirm tells what a left click would need after each click.
+	tests := []struct {
+		button  int
+		want    string
+		confirm string
+	}{
+		{openbar.LeftButton, "P lock", "lock?"},
+		{openbar.ScrollDown, "P suspend", "suspend?"},
+		{openbar.ScrollDown, "P poweroff", "poweroff?"},
+		{openbar.ScrollDown, "P lock", "lock?"},
+		{openbar.ScrollUp, "P poweroff", "poweroff?"},
+		{openbar.RightButton, "P", ""},
+		{openbar.ScrollUp, "P poweroff", "poweroff?"},
+		{openbar.LeftButton, "P", ""},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			c := openbar.Click{Button: test.button}
+			if err := m.Click(c); err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("want: %q, got: %q", test.want, got)
+			}
+			if prompt, _ := m.Confirm(openbar.Click{Button: openbar.LeftButton}); prompt != test.confirm {
+				t.Errorf("want: %q, got: %q", test.confirm, prompt)
+			}
+		})
+	}
+
+	if fmt.Sprint(d.ran) != "[poweroff]" {
+		t.Errorf("want: [poweroff], got: %v", d.ran)
+	}
+
+	if _, ok := m.Confirm(openbar.Click{Button: openbar.ScrollDown}); ok {
+		t.Error("want: scrolls not confirmed")
+	}
+
+	if _, err := power.New(d, "P", "nap"); !errors.Is(err, power.ErrAction) {
+		t.Errorf("want: %v, got: %v", power.ErrAction, err)
+	}
+}
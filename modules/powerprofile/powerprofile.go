@@ -0,0 +1,48 @@
+// Package powerprofile is an OpenBar module printing the active power profile
+// of power-profiles-daemon, like "balanced", through UPower.
+package powerprofile
+
+import (
+	"context"
+	"encoding/json"
+	"openbar"
+	"openbar/modules"
+	"openbar/upower"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "powerprofile",
+		Description: "active power profile",
+		Requires:    []string{"power-profiles-daemon"},
+	}, func(_ modules.Env, _ json.RawMessage) (openbar.Module, error) {
+		return New(upower.System()), nil
+	})
+}
+
+// Daemon is the part of UPower the module relies on.
+type Daemon interface {
+	Profile() (string, error)
+	Notify(ctx context.Context, changed func()) error
+}
+
+// Module prints the active power profile and is refreshed as soon as it
+// changes.
+type Module struct {
+	daemon Daemon
+}
+
+// New returns a module reading the active profile from the given daemon.
+func New(d Daemon) *Module {
+	return &Module{d}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	return m.daemon.Profile()
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.daemon.Notify(ctx, changed)
+}
@@ -0,0 +1,58 @@
+package powerprofile_test
+
+import (
+	"context"
+	"errors"
+	"openbar"
+	"openbar/modules/powerprofile"
+	"testing"
+)
+
+// A daemon whose profile changes on demand.
+type daemon struct {
+	profile chan string
+	changed chan func()
+}
+
+func (d daemon) Profile() (string, error) {
+	select {
+	case p := <-d.profile:
+		return p, nil
+	default:
+		return "", errors.New("no profile")
+	}
+}
+
+func (d daemon) Notify(ctx context.Context, changed func()) error {
+	d.changed <- changed
+	<-ctx.Done()
+	return nil
+}
+
+func TestPowerProfile(t *testing.T) {
+	d := daemon{make(chan string, 1), make(chan func(), 1)}
+	m := powerprofile.New(d)
+
+	var _ openbar.Notifier = m
+
+	d.profile <- "balanced"
+	out, err := m.FullText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "balanced" {
+		t.Errorf("want: balanced, got: %q", out)
+	}
+
+	if _, err := m.FullText(); err == nil {
+		t.Error("want: error, got: nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = m.Notify(ctx, func() {}) }()
+	defer cancel()
+
+	if changed := <-d.changed; changed == nil {
+		t.Error("want: changes passed to the daemon, got: nil")
+	}
+}
@@ -0,0 +1,242 @@
+// Package presentation is an OpenBar module toggling a "meeting mode" that
+// changes several settings at once: by default it inhibits idleness, enables
+// do-not-disturb in mako and switches to the performance power profile.
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultTimeout bounds each command run when toggling.
+const DefaultTimeout = 5 * time.Second
+
+// ErrNoSteps is returned when the mode has nothing to do.
+var ErrNoSteps = errors.New("no steps")
+
+// DefaultLabel is printed while the mode is on. Nothing is printed when off.
+const DefaultLabel = "presenting"
+
+// Step is one integration of the mode. Enable and Disable are run when the mode
+// is toggled. Hold is a command kept running while the mode is on and killed
+// when it is turned off, which is how inhibitors work. Any of them can be empty.
+type Step struct {
+	Enable  []string `json:"enable"`
+	Disable []string `json:"disable"`
+	Hold    []string `json:"hold"`
+}
+
+// DefaultSteps inhibit idleness, silence notifications and favor performance.
+var DefaultSteps = []Step{
+	{Hold: []string{"systemd-inhibit", "--what=idle", "--who=openbar", "--why=Presentation mode", "sleep", "infinity"}},
+	{Enable: []string{"makoctl", "mode", "-a", "do-not-disturb"}, Disable: []string{"makoctl", "mode", "-r", "do-not-disturb"}},
+	{Enable: []string{"powerprofilesctl", "set", "performance"}, Disable: []string{"powerprofilesctl", "set", "balanced"}},
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "presentation",
+		Description: "meeting mode toggling several settings at once",
+		Options: []modules.Option{
+			{Name: "label", Type: modules.String, Default: `"presenting"`, Description: "text shown while the mode is on"},
+			{Name: "steps", Type: modules.Objects, Default: "idle inhibitor, do-not-disturb, performance profile", Description: "enable, disable and hold commands"},
+		},
+		Requires: []string{"systemd-inhibit", "makoctl", "powerprofilesctl"},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			if err != nil {
+				return nil, err
+			}
+			res := make([][]string, 0, 3*len(opts.Steps))
+			for _, s := range opts.Steps {
+				for _, args := range [][]string{s.Enable, s.Disable, s.Hold} {
+					if len(args) > 0 {
+						res = append(res, args)
+					}
+				}
+			}
+			return res, nil
+		},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+		if len(opts.Steps) == 0 {
+			return nil, ErrNoSteps
+		}
+		return New(opts.Label, opts.Steps...), nil
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Label string `json:"label"`
+	Steps []Step `json:"steps"`
+}
+
+// Read the options of the module, falling back to defaults.
+func parse(options json.RawMessage) (settings, error) {
+	res := settings{Label: DefaultLabel, Steps: DefaultSteps}
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// Module toggles the mode and shows whether it is on.
+type Module struct {
+	label string
+	steps []Step
+
+	mu    sync.Mutex
+	on    bool
+	holds []*exec.Cmd
+}
+
+// New returns a module printing the given label while the steps are enabled.
+func New(label string, steps ...Step) *Module {
+	return &Module{label: label, steps: steps}
+}
+
+// FullText prints the label while the mode is on.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.on {
+		return m.label, nil
+	}
+	return "", nil
+}
+
+// Toggle turns the mode on or off. Every step is attempted even if one fails,
+// and the first failure is returned.
+func (m *Module) Toggle() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.on {
+		return m.disable()
+	}
+	return m.enable()
+}
+
+// Click implements openbar.ClickHandler: a left click toggles the mode.
+func (m *Module) Click(c openbar.Click) error {
+	if c.Button != openbar.LeftButton {
+		return nil
+	}
+	return m.Toggle()
+}
+
+// Notify implements openbar.Notifier, only to turn the mode off when the bar
+// stops so that no inhibitor outlives it.
+func (m *Module) Notify(ctx context.Context, _ func()) error {
+	<-ctx.Done()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.on {
+		return nil
+	}
+	return m.disable()
+}
+
+func (m *Module) enable() error {
+	var errs failures
+
+	for _, s := range m.steps {
+		if len(s.Hold) > 0 {
+			cmd, err := hold(s.Hold)
+			errs.add(s.Hold, err)
+			if err == nil {
+				m.holds = append(m.holds, cmd)
+			}
+		}
+		if len(s.Enable) > 0 {
+			errs.add(s.Enable, run(s.Enable))
+		}
+	}
+
+	m.on = true
+
+	return errs.first()
+}
+
+func (m *Module) disable() error {
+	var errs failures
+
+	for _, cmd := range m.holds {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+
+	m.holds = nil
+
+	for _, s := range m.steps {
+		if len(s.Disable) > 0 {
+			errs.add(s.Disable, run(s.Disable))
+		}
+	}
+
+	m.on = false
+
+	return errs.first()
+}
+
+// Run a command to completion.
+func run(args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	//nolint:gosec
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return err
+}
+
+// Start a command kept running in its own process group. It is also killed if
+// the bar dies without turning the mode off. The signal is sent when the
+// thread which started the command exits rather than the bar, so the command
+// gets a locked thread of its own, kept until it exits.
+func hold(args []string) (*exec.Cmd, error) {
+	//nolint:gosec
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGTERM}
+
+	started := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		err := cmd.Start()
+		started <- err
+		if err == nil {
+			_ = cmd.Wait()
+		}
+	}()
+
+	return cmd, <-started
+}
+
+// Failures of the commands of a toggle.
+type failures []error
+
+func (f *failures) add(args []string, err error) {
+	if err != nil {
+		*f = append(*f, fmt.Errorf("%s: %w", args[0], err))
+	}
+}
+
+func (f failures) first() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return f[0]
+}
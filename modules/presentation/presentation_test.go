@@ -0,0 +1,78 @@
+package presentation_test
+
+import (
+	"context"
+	"openbar/modules/presentation"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestToggle(t *testing.T) {
+	dir := t.TempDir()
+	flag, held := filepath.Join(dir, "flag"), filepath.Join(dir, "held")
+
+	// The held command writes to a pipe once it runs and once it is
+	// stopped, so reading it waits for either.
+	if err := syscall.Mkfifo(held, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := presentation.New("meeting",
+		presentation.Step{Enable: []string{"touch", flag}, Disable: []string{"rm", flag}},
+		presentation.Step{Hold: []string{"sh", "-c", `trap 'echo stopped > "$0"; exit' TERM; echo started > "$0"; while :; do sleep 0.01; done`, held}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := m.Notify(ctx, func() {}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := m.Toggle(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, _ := m.FullText(); out != "meeting" {
+		t.Errorf("want: %q, got: %q", "meeting", out)
+	}
+
+	exists(t, flag, true)
+	read(t, held, "started")
+
+	// Stopping the bar turns the mode off.
+	cancel()
+	<-stopped
+
+	if out, _ := m.FullText(); out != "" {
+		t.Errorf("want: empty, got: %q", out)
+	}
+
+	exists(t, flag, false)
+	read(t, held, "stopped")
+}
+
+// Check whether a file exists, steps being run to completion.
+func exists(t *testing.T, path string, want bool) {
+	t.Helper()
+	if _, err := os.Stat(path); (err == nil) != want {
+		t.Errorf("%s: want exists: %v, got: %v", path, want, err)
+	}
+}
+
+// Read a line from a pipe, waiting for a command to write it.
+func read(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
@@ -0,0 +1,262 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Default endpoints of the HTTP provider.
+const (
+	DefaultDownload = "https://speed.cloudflare.com/__down?bytes=25000000"
+	DefaultUpload   = "https://speed.cloudflare.com/__up"
+)
+
+// How much data the HTTP provider uploads.
+const uploadSize = 10 << 20
+
+// How often partial rates are reported during transfers.
+const reportEvery = 500 * time.Millisecond
+
+// DefaultTransfer bounds each transfer of the HTTP provider.
+const DefaultTransfer = 20 * time.Second
+
+// HTTP measures bandwidth by transferring data with an HTTP server. Latency is
+// the time to the first byte of the download. Transfers still going on after
+// Transfer, or DefaultTransfer when zero, are cut short and rates are those of
+// the data transferred until then, so that slow links can be measured too.
+type HTTP struct {
+	Client   *http.Client
+	Download string
+	Upload   string
+	Transfer time.Duration
+}
+
+// Measure implements Provider.
+func (h HTTP) Measure(ctx context.Context, progress func(Result)) (Result, error) {
+	var res Result
+
+	limit := h.Transfer
+	if limit <= 0 {
+		limit = DefaultTransfer
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(dctx, http.MethodGet, h.Download, nil)
+	if err != nil {
+		return res, err
+	}
+
+	// Never let a cache answer instead of the server.
+	req.Header.Set("Cache-Control", "no-store")
+
+	start := time.Now()
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return res, err
+	}
+
+	defer resp.Body.Close()
+
+	res.Latency = time.Since(start)
+	progress(res)
+
+	down := res
+	body := newMeter(resp.Body, func(r float64) {
+		down.Download = r
+		progress(down)
+	})
+	if _, err := io.Copy(io.Discard, body); err != nil && !cut(ctx, dctx) {
+		return res, err
+	}
+
+	res.Download = rate(body.count(), time.Since(start)-res.Latency)
+	progress(res)
+
+	if h.Upload == "" {
+		return res, nil
+	}
+
+	payload := make([]byte, uploadSize)
+	if _, err := rand.Read(payload); err != nil {
+		return res, err
+	}
+
+	uctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	// The transport reads the payload from its own goroutine, and may still
+	// report once the upload is over.
+	up := res
+	body = newMeter(bytes.NewReader(payload), func(r float64) {
+		up.Upload = r
+		progress(up)
+	})
+
+	req, err = http.NewRequestWithContext(uctx, http.MethodPost, h.Upload, body)
+	if err != nil {
+		return res, err
+	}
+	req.ContentLength = uploadSize
+
+	start = time.Now()
+
+	resp, err = h.Client.Do(req)
+	switch {
+	case err == nil:
+		resp.Body.Close()
+	case !cut(ctx, uctx):
+		return res, err
+	}
+
+	res.Upload = rate(body.count(), time.Since(start))
+
+	return res, nil
+}
+
+// Tell whether a transfer failed because it lasted too long, rather than
+// because the whole test did or because of the network.
+func cut(test, transfer context.Context) bool {
+	return errors.Is(transfer.Err(), context.DeadlineExceeded) && test.Err() == nil
+}
+
+// A reader reporting the rate at which it is read, at most every reportEvery.
+// It may be read from another goroutine than the one counting.
+type meter struct {
+	io.Reader
+	n      int64
+	start  time.Time
+	last   time.Time
+	report func(rate float64)
+}
+
+// Start measuring the rate at which r is read.
+func newMeter(r io.Reader, report func(rate float64)) *meter {
+	now := time.Now()
+	return &meter{Reader: r, start: now, last: now, report: report}
+}
+
+// Read implements io.Reader.
+func (m *meter) Read(p []byte) (int, error) {
+	n, err := m.Reader.Read(p)
+	total := atomic.AddInt64(&m.n, int64(n))
+	if now := time.Now(); now.Sub(m.last) >= reportEvery {
+		m.last = now
+		m.report(rate(total, now.Sub(m.start)))
+	}
+	return n, err
+}
+
+// Return how many bytes were read so far.
+func (m *meter) count() int64 {
+	return atomic.LoadInt64(&m.n)
+}
+
+// Compute a rate in bits per second.
+func rate(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n*8) / d.Seconds()
+}
+
+// Command runs an external tool printing results in the format of
+// `speedtest-cli --simple`.
+type Command []string
+
+// Measure implements Provider. Results are reported as the tool prints them.
+func (c Command) Measure(ctx context.Context, progress func(Result)) (Result, error) {
+	//nolint:gosec
+	cmd := exec.CommandContext(ctx, c[0], c[1:]...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return Result{}, err
+	}
+
+	var out bytes.Buffer
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		out.Write(scanner.Bytes())
+		out.WriteByte('\n')
+		res, _ := scan(out.Bytes())
+		progress(res)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return Result{}, err
+	}
+
+	return Parse(out.Bytes())
+}
+
+// Parse reads results in the format of `speedtest-cli --simple`.
+func Parse(out []byte) (Result, error) {
+	res, found := scan(out)
+	if !found {
+		return res, errors.New("no download rate in output")
+	}
+	return res, nil
+}
+
+// Read the results known so far, and whether the download rate is one of them.
+func scan(out []byte) (Result, bool) {
+	var res Result
+
+	found := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+
+		switch strings.TrimSuffix(fields[0], ":") {
+		case "Ping":
+			res.Latency = time.Duration(v * float64(time.Millisecond))
+		case "Download":
+			res.Download, found = v*unit(fields[2]), true
+		case "Upload":
+			res.Upload = v * unit(fields[2])
+		}
+	}
+
+	return res, found
+}
+
+// Return the multiplier of a rate unit.
+func unit(u string) float64 {
+	switch u {
+	case "Gbit/s":
+		return 1e9
+	case "Mbit/s":
+		return 1e6
+	case "Kbit/s", "kbit/s":
+		return 1e3
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,210 @@
+// Package speedtest is a manual OpenBar module measuring bandwidth on demand.
+// It stays idle until its signal is received, runs a test through a pluggable
+// provider while showing partial results, prints the result and waits for the
+// next signal.
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"openbar"
+	"openbar/httpclient"
+	"openbar/modules"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Idle is printed before the first test.
+const Idle = "speedtest"
+
+// Testing is printed while a test runs, along with partial results.
+const Testing = "testing"
+
+// DefaultTimeout bounds a whole test.
+const DefaultTimeout = time.Minute
+
+// Result is the outcome of a test. Rates are in bits per second and zero
+// values are unknown.
+type Result struct {
+	Latency  time.Duration
+	Download float64
+	Upload   float64
+}
+
+// String formats a result for the bar, leaving unknown values out.
+func (r Result) String() string {
+	var rates []string
+	if r.Download > 0 {
+		rates = append(rates, fmt.Sprintf("↓%.1f", r.Download/1e6))
+	}
+	if r.Upload > 0 {
+		rates = append(rates, fmt.Sprintf("↑%.1f", r.Upload/1e6))
+	}
+	var s []string
+	if len(rates) > 0 {
+		s = append(s, strings.Join(rates, " ")+" Mbit/s")
+	}
+	if r.Latency > 0 {
+		s = append(s, fmt.Sprintf("%dms", r.Latency.Milliseconds()))
+	}
+	return strings.Join(s, " ")
+}
+
+// Provider performs bandwidth tests. Measure calls progress with partial
+// results as they are known.
+type Provider interface {
+	Measure(ctx context.Context, progress func(Result)) (Result, error)
+}
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "speedtest",
+		Description: "bandwidth measured on demand",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "provider", Type: modules.String, Default: `"http"`, Description: "http or command"},
+			{Name: "download", Type: modules.String, Default: `"https://speed.cloudflare.com/__down?bytes=25000000"`, Description: "download endpoint of the http provider"},
+			{Name: "upload", Type: modules.String, Default: `"https://speed.cloudflare.com/__up"`, Description: "upload endpoint of the http provider"},
+			{Name: "command", Type: modules.Strings, Description: "tool of the command provider"},
+		},
+		Commands: func(options json.RawMessage) ([][]string, error) {
+			opts, err := parse(options)
+			if err != nil || opts.Provider != "command" || len(opts.Command) == 0 {
+				return nil, err
+			}
+			return [][]string{opts.Command}, nil
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts, err := parse(options)
+		if err != nil {
+			return nil, err
+		}
+
+		var p Provider
+		switch opts.Provider {
+		case "http":
+			// Reuse the shared transport, but tests are bounded by their
+			// context rather than by the timeout of quick requests.
+			shared := env.HTTP
+			if shared == nil {
+				shared = httpclient.Default
+			}
+			client := &http.Client{Transport: shared.Transport}
+			p = HTTP{Client: client, Download: opts.Download, Upload: opts.Upload}
+		case "command":
+			if len(opts.Command) == 0 {
+				return nil, fmt.Errorf("missing command")
+			}
+			p = Command(opts.Command)
+		default:
+			return nil, fmt.Errorf("unknown provider: %s", opts.Provider)
+		}
+
+		return New(p), nil
+	})
+}
+
+// The options of the module.
+type settings struct {
+	Provider string   `json:"provider"`
+	Download string   `json:"download"`
+	Upload   string   `json:"upload"`
+	Command  []string `json:"command"`
+}
+
+// Read the options of the module, falling back to defaults.
+func parse(options json.RawMessage) (settings, error) {
+	res := settings{Provider: "http", Download: DefaultDownload, Upload: DefaultUpload}
+	err := json.Unmarshal(options, &res)
+	return res, err
+}
+
+// Module runs a test each time it is signaled. Tests run from Notify, which
+// refreshes the block as they make progress.
+type Module struct {
+	provider Provider
+	start    chan struct{}
+
+	mu      sync.Mutex
+	running bool
+	fresh   bool
+	last    Result
+	err     error
+}
+
+// New returns a module using the given provider. It must be scheduled as a
+// manual module.
+func New(p Provider) *Module {
+	return &Module{provider: p, start: make(chan struct{}, 1)}
+}
+
+// IdleText implements openbar.Idler: no test runs for the initial paint.
+func (m *Module) IdleText() string {
+	return Idle
+}
+
+// FullText implements openbar.Module. It starts a test unless one is running,
+// or has just ended and its result was not shown yet.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case m.running:
+		return progress(m.last), nil
+	case m.fresh:
+		m.fresh = false
+		if m.err != nil {
+			return Idle, m.err
+		}
+		return m.last.String(), nil
+	}
+
+	m.running, m.last = true, Result{}
+	select {
+	case m.start <- struct{}{}:
+	default:
+	}
+
+	return Testing, nil
+}
+
+// Notify implements openbar.Notifier: it runs the tests FullText starts.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.start:
+		}
+
+		tctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		res, err := m.provider.Measure(tctx, func(r Result) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			// Providers may report late, once the test is over.
+			if m.running {
+				m.last = r
+			}
+			changed()
+		})
+		cancel()
+
+		m.mu.Lock()
+		m.running, m.fresh, m.last, m.err = false, true, res, err
+		m.mu.Unlock()
+
+		changed()
+	}
+}
+
+// Format partial results.
+func progress(r Result) string {
+	if s := r.String(); s != "" {
+		return Testing + " " + s
+	}
+	return Testing
+}
@@ -0,0 +1,186 @@
+package speedtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"openbar/modules"
+	"openbar/modules/speedtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		out string
+		res speedtest.Result
+		err bool
+	}{
+		{
+			out: "Ping: 12.5 ms\nDownload: 93.12 Mbit/s\nUpload: 10.00 Mbit/s\n",
+			res: speedtest.Result{Latency: 12500 * time.Microsecond, Download: 93.12e6, Upload: 10e6},
+			err: false,
+		},
+		{
+			out: "Cannot retrieve speedtest configuration\n",
+			res: speedtest.Result{},
+			err: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			res, err := speedtest.Parse([]byte(test.out))
+
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res != test.res {
+				t.Errorf("want: %+v, got: %+v", test.res, res)
+			}
+		})
+	}
+}
+
+// A provider reporting the results it is given, the last one once closed.
+type stepped chan speedtest.Result
+
+func (s stepped) Measure(ctx context.Context, progress func(speedtest.Result)) (speedtest.Result, error) {
+	var last speedtest.Result
+	for r := range s {
+		progress(r)
+		last = r
+	}
+	if last == (speedtest.Result{}) {
+		return last, errors.New("offline")
+	}
+	return last, nil
+}
+
+func TestModule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	steps := make(stepped)
+	m := speedtest.New(steps)
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		_ = m.Notify(ctx, func() {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// Wait for the module to be refreshed, then run it.
+	refresh := func() (string, error) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(time.Second):
+			t.Fatal("no change")
+		}
+		return m.FullText()
+	}
+
+	if out := m.IdleText(); out != speedtest.Idle {
+		t.Errorf("want: %q, got: %q", speedtest.Idle, out)
+	}
+
+	if out, err := m.FullText(); out != speedtest.Testing || err != nil {
+		t.Errorf("want: %q, got: %q, %v", speedtest.Testing, out, err)
+	}
+
+	partial := speedtest.Result{Latency: 12 * time.Millisecond}
+	steps <- partial
+	if out, _ := refresh(); out != "testing 12ms" {
+		t.Errorf("want: %q, got: %q", "testing 12ms", out)
+	}
+
+	// Signals received meanwhile don't start another test.
+	if out, _ := m.FullText(); out != "testing 12ms" {
+		t.Errorf("want: %q, got: %q", "testing 12ms", out)
+	}
+
+	partial.Download = 93.12e6
+	steps <- partial
+	close(steps)
+	for out, _ := refresh(); out != "↓93.1 Mbit/s 12ms"; out, _ = refresh() {
+		if out != "testing ↓93.1 Mbit/s 12ms" {
+			t.Fatalf("unexpected text: %q", out)
+		}
+	}
+
+	// The next run starts a new test, failing since the provider is done.
+	if out, _ := m.FullText(); out != speedtest.Testing {
+		t.Errorf("want: %q, got: %q", speedtest.Testing, out)
+	}
+	out, err := refresh()
+	for out == speedtest.Testing {
+		out, err = refresh()
+	}
+	if out != speedtest.Idle || err == nil {
+		t.Errorf("want idle with error, got: %q, %v", out, err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 1<<16))
+	}))
+	defer srv.Close()
+
+	p := speedtest.HTTP{Client: srv.Client(), Download: srv.URL, Upload: srv.URL}
+
+	var reports []speedtest.Result
+	res, err := p.Measure(context.Background(), func(r speedtest.Result) {
+		reports = append(reports, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Latency <= 0 || res.Download <= 0 || res.Upload <= 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(reports) < 2 || reports[0].Download != 0 || reports[0].Latency != res.Latency {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+}
+
+func TestSlowLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 1<<10))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	// The download never ends, and is measured until it is cut short.
+	p := speedtest.HTTP{Client: srv.Client(), Download: srv.URL, Transfer: 200 * time.Millisecond}
+
+	res, err := p.Measure(context.Background(), func(speedtest.Result) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Download <= 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestFactory(t *testing.T) {
+	factory, ok := modules.Lookup("speedtest")
+	if !ok {
+		t.Fatal("speedtest is not registered")
+	}
+
+	// Without a shared client, the default one is used.
+	if _, err := factory(modules.Env{}, json.RawMessage(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,218 @@
+// Package sun is an OpenBar module printing the next sunrise or sunset, computed
+// from the position of the sun where the machine is. It runs exactly when the
+// event it announces happens rather than at intervals.
+package sun
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"openbar"
+	"openbar/location"
+	"openbar/modules"
+	"sync"
+	"time"
+)
+
+// Elevations of the center of the sun at which events happen, in degrees.
+// Sunrise and sunset account for refraction and the radius of the sun.
+const (
+	Horizon  = -0.833
+	Twilight = -6.0
+)
+
+// Refresh is how often the elevation is printed again when shown.
+const Refresh = 10 * time.Minute
+
+// How far ahead events are looked for, and how fine the search is before
+// narrowing it down. Beyond polar circles, there may be none for months.
+const (
+	horizon = 48 * time.Hour
+	step    = 10 * time.Minute
+)
+
+// Event is when the sun crosses some elevation, rising or setting.
+type Event struct {
+	Name      string
+	Elevation float64
+	Rising    bool
+}
+
+// Events are those printed by default, and Twilights those added on request.
+var (
+	Events    = []Event{{"sunrise", Horizon, true}, {"sunset", Horizon, false}}
+	Twilights = []Event{{"dawn", Twilight, true}, {"dusk", Twilight, false}}
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "sun",
+		Description: "next sunrise or sunset, refreshed when it happens",
+		Options: []modules.Option{
+			{Name: "twilight", Type: modules.Bool, Default: "false", Description: "also print civil dawn and dusk"},
+			{Name: "elevation", Type: modules.Bool, Default: "false", Description: "print the elevation of the sun first"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Twilight  bool `json:"twilight"`
+			Elevation bool `json:"elevation"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if env.Location == nil {
+			return nil, errors.New("no location configured")
+		}
+		events := Events
+		if opts.Twilight {
+			events = append(append([]Event{}, Events...), Twilights...)
+		}
+		return New(env.Location, events, opts.Elevation), nil
+	})
+}
+
+// Module prints the next event, like "sunset 18:42", and plans its next run
+// for when it happens.
+type Module struct {
+	where     location.Provider
+	events    []Event
+	elevation bool
+	now       func() time.Time
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// New returns a module printing the next of the given events, preceded by the
+// elevation of the sun if asked to.
+func New(where location.Provider, events []Event, elevation bool) *Module {
+	return &Module{where: where, events: events, elevation: elevation, now: time.Now}
+}
+
+// FullText implements openbar.Module.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next = time.Time{}
+
+	c, err := m.where.Locate()
+	if err != nil {
+		return "", err
+	}
+
+	now := m.now()
+	e, at, ok := Next(c, now, m.events)
+
+	// Without event coming, the sun stays up or down: only the elevation
+	// can change.
+	text := "polar night"
+	if Elevation(c, now) > Horizon {
+		text = "polar day"
+	}
+	if ok {
+		text = fmt.Sprintf("%s %s", e.Name, at.In(now.Location()).Format("15:04"))
+		m.next = at
+	}
+
+	if m.elevation {
+		text = fmt.Sprintf("%.0f° %s", Elevation(c, now), text)
+		if refresh := now.Add(Refresh); !ok || refresh.Before(m.next) {
+			m.next = refresh
+		}
+	}
+
+	return text, nil
+}
+
+// NextRun implements openbar.NextRunner: the module runs again once the event
+// it prints happened. Without location, it runs at its interval.
+func (m *Module) NextRun() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.next
+}
+
+// Elevation returns the angle between the center of the sun and the horizon
+// at the given place and time, in degrees, as given by the approximations of
+// the Astronomical Almanac. They are good to a hundredth of a degree or so.
+func Elevation(c location.Coordinates, t time.Time) float64 {
+	// Days since the J2000 epoch.
+	n := float64(t.Unix())/86400 - 10957.5
+
+	// Ecliptic longitude of the sun from its mean longitude and anomaly.
+	l := 280.460 + 0.9856474*n
+	g := radians(357.528 + 0.9856003*n)
+	lambda := radians(l + 1.915*math.Sin(g) + 0.020*math.Sin(2*g))
+	epsilon := radians(23.439 - 0.0000004*n)
+
+	// Equatorial coordinates, then hour angle from the sidereal time.
+	ra := math.Atan2(math.Cos(epsilon)*math.Sin(lambda), math.Cos(lambda))
+	decl := math.Asin(math.Sin(epsilon) * math.Sin(lambda))
+	gmst := 280.46061837 + 360.98564736629*n
+	h := radians(gmst+c.Longitude) - ra
+
+	lat := radians(c.Latitude)
+
+	return degrees(math.Asin(math.Sin(lat)*math.Sin(decl) + math.Cos(lat)*math.Cos(decl)*math.Cos(h)))
+}
+
+// Next returns the first of the events happening after t, to the second, and
+// whether there is one within two days.
+func Next(c location.Coordinates, t time.Time, events []Event) (Event, time.Time, bool) {
+	from, prev := t, Elevation(c, t)
+	for to := t.Add(step); to.Sub(t) <= horizon; to = to.Add(step) {
+		cur := Elevation(c, to)
+
+		// Events of a single step are told apart by when they happen.
+		var first Event
+		var at time.Time
+		for _, e := range events {
+			if !crosses(e, prev, cur) {
+				continue
+			}
+			if when := narrow(c, e, from, to); at.IsZero() || when.Before(at) {
+				first, at = e, when
+			}
+		}
+		if !at.IsZero() {
+			return first, at, true
+		}
+
+		from, prev = to, cur
+	}
+
+	return Event{}, time.Time{}, false
+}
+
+// Tell whether the sun goes past the elevation of an event, in its direction,
+// between two elevations.
+func crosses(e Event, before, after float64) bool {
+	if e.Rising {
+		return before <= e.Elevation && after > e.Elevation
+	}
+	return before > e.Elevation && after <= e.Elevation
+}
+
+// Find when an event happens within a step by bisection. The time returned is
+// the first second past it, so that running then doesn't find it again.
+func narrow(c location.Coordinates, e Event, from, to time.Time) time.Time {
+	for to.Sub(from) > time.Second {
+		mid := from.Add(to.Sub(from) / 2)
+		if crosses(e, Elevation(c, from), Elevation(c, mid)) {
+			to = mid
+		} else {
+			from = mid
+		}
+	}
+	return to
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
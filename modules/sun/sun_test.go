@@ -0,0 +1,80 @@
+package sun_test
+
+import (
+	"math"
+	"openbar/location"
+	"openbar/modules/sun"
+	"strings"
+	"testing"
+	"time"
+)
+
+var paris = location.Coordinates{Latitude: 48.8566, Longitude: 2.3522}
+
+func TestElevation(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		// Solar noon of the summer solstice, then midnight.
+		{time.Date(2024, 6, 21, 11, 52, 0, 0, time.UTC), 64.6},
+		{time.Date(2024, 6, 21, 23, 52, 0, 0, time.UTC), -17.7},
+		// Solar noon of the winter solstice.
+		{time.Date(2024, 12, 21, 11, 41, 0, 0, time.UTC), 17.7},
+	}
+
+	for _, test := range tests {
+		if got := sun.Elevation(paris, test.at); math.Abs(got-test.want) > 0.3 {
+			t.Errorf("%v: want: %.1f, got: %.1f", test.at, test.want, got)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	events := append(append([]sun.Event{}, sun.Events...), sun.Twilights...)
+
+	tests := []struct {
+		from time.Time
+		name string
+		want time.Time
+	}{
+		{time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), "dawn", time.Date(2024, 6, 21, 3, 6, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 21, 3, 10, 0, 0, time.UTC), "sunrise", time.Date(2024, 6, 21, 3, 47, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC), "sunset", time.Date(2024, 6, 21, 19, 58, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 21, 20, 0, 0, 0, time.UTC), "dusk", time.Date(2024, 6, 21, 20, 39, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		e, at, ok := sun.Next(paris, test.from, events)
+		if !ok || e.Name != test.name || at.Sub(test.want) > 2*time.Minute || test.want.Sub(at) > 2*time.Minute {
+			t.Errorf("%v: want: %s at %v, got: %s at %v", test.from, test.name, test.want, e.Name, at)
+		}
+
+		// Looking again from then finds what comes next.
+		if again, _, _ := sun.Next(paris, at, events); again.Name == e.Name {
+			t.Errorf("%v: want: another event than %s", at, e.Name)
+		}
+	}
+
+	// The sun doesn't set near the pole in summer.
+	if e, _, ok := sun.Next(location.Coordinates{Latitude: 80}, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), sun.Events); ok {
+		t.Errorf("want: no event, got: %s", e.Name)
+	}
+}
+
+func TestModule(t *testing.T) {
+	m := sun.New(location.Fixed(paris), sun.Events, true)
+
+	text, err := m.FullText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "° sun") {
+		t.Errorf("want: elevation and event, got: %q", text)
+	}
+
+	// With the elevation shown, the module runs again before long.
+	if next := time.Until(m.NextRun()); next <= 0 || next > sun.Refresh {
+		t.Errorf("want: next run within %v, got: %v", sun.Refresh, next)
+	}
+}
@@ -0,0 +1,130 @@
+// Package topic is an OpenBar module printing the last message published on an
+// MQTT topic, like the reading of a sensor. Messages are shown as soon as they
+// arrive.
+package topic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"openbar"
+	"openbar/modules"
+	"openbar/modules/httpjson"
+	"openbar/mqtt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the module waits before subscribing again after losing the broker.
+const retry = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "mqtt",
+		Description: "last message published on an MQTT topic",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "topic", Type: modules.String, Description: "topic to subscribe to, wildcards allowed"},
+			{Name: "path", Type: modules.String, Description: "dot-separated path of the value in JSON messages"},
+			{Name: "broker", Type: modules.String, Default: "the one of the bar", Description: "HOST[:PORT] or mqtts://HOST[:PORT]"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Topic  string `json:"topic"`
+			Path   string `json:"path"`
+			Broker string `json:"broker"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.Topic == "" {
+			return nil, errors.New("missing topic")
+		}
+		var b mqtt.Broker
+		switch {
+		case opts.Broker != "":
+			b.Addr = opts.Broker
+		case env.MQTT != nil:
+			b = *env.MQTT
+		default:
+			return nil, errors.New("no broker, set one here or under mqtt")
+		}
+		return New(b, opts.Topic, opts.Path), nil
+	})
+}
+
+// Subscriber gives the messages published on topics, see mqtt.Broker.
+type Subscriber interface {
+	Subscribe(ctx context.Context, filter string, received func(mqtt.Message)) error
+}
+
+// Module prints the last message of a topic.
+type Module struct {
+	source Subscriber
+	topic  string
+	path   string
+
+	mu   sync.Mutex
+	text string
+	err  error
+}
+
+// New returns a module subscribing to the topic. With a path, messages are
+// JSON documents and the value at the path is printed, see httpjson.Extract.
+func New(s Subscriber, topic, path string) *Module {
+	return &Module{source: s, topic: topic, path: path}
+}
+
+// FullText implements openbar.Module. It is empty until a message arrives and
+// tells why the broker was lost until it is back.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.text, m.err
+}
+
+// Notify implements openbar.Notifier: the module is refreshed on each message.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	for {
+		err := m.source.Subscribe(ctx, m.topic, func(msg mqtt.Message) {
+			text, err := m.extract(msg.Payload)
+			m.mu.Lock()
+			m.text, m.err = text, err
+			m.mu.Unlock()
+			changed()
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+		changed()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+	}
+}
+
+// Return the text of a message.
+func (m *Module) extract(payload []byte) (string, error) {
+	if m.path == "" {
+		return strings.TrimSpace(string(payload)), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", err
+	}
+
+	return httpjson.Extract(doc, m.path)
+}
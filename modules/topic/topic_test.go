@@ -0,0 +1,63 @@
+package topic_test
+
+import (
+	"context"
+	"errors"
+	"openbar/modules/httpjson"
+	"openbar/modules/topic"
+	"openbar/mqtt"
+	"testing"
+)
+
+// A broker delivering the given payloads, then failing.
+type broker [][]byte
+
+func (b broker) Subscribe(ctx context.Context, filter string, received func(mqtt.Message)) error {
+	for _, p := range b {
+		received(mqtt.Message{Topic: filter, Payload: p})
+	}
+	return errors.New("connection lost")
+}
+
+func TestTopic(t *testing.T) {
+	tests := []struct {
+		path     string
+		payloads []string
+		out      string
+		err      error
+	}{
+		{path: "", payloads: []string{"20.5\n", "21.5\n"}, out: "21.5", err: nil},
+		{path: "temperature", payloads: []string{`{"temperature": 21.5}`}, out: "21.5", err: nil},
+		{path: "humidity", payloads: []string{`{"temperature": 21.5}`}, out: "", err: httpjson.ErrPath},
+	}
+
+	for i, test := range tests {
+		b := make(broker, 0)
+		for _, p := range test.payloads {
+			b = append(b, []byte(p))
+		}
+
+		m := topic.New(b, "sensors/living", test.path)
+
+		// The module is refreshed with each message, then with the failure
+		// which keeps the last value.
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		_ = m.Notify(ctx, func() {
+			calls++
+			out, err := m.FullText()
+			switch calls {
+			case len(test.payloads):
+				if out != test.out || !errors.Is(err, test.err) {
+					t.Errorf("%d: want: %q, %v, got: %q, %v", i, test.out, test.err, out, err)
+				}
+			case len(test.payloads) + 1:
+				if out != test.out || err == nil {
+					t.Errorf("%d: want: %q with an error, got: %q, %v", i, test.out, out, err)
+				}
+				cancel()
+			}
+		})
+		cancel()
+	}
+}
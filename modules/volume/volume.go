@@ -0,0 +1,105 @@
+// Package volume is an OpenBar module printing the volume of the default audio
+// output or input of PipeWire, like "45%" or "muted", which scrolling over the
+// block changes. The volume and mic modules share the connection to PipeWire
+// with the other audio modules and are refreshed as soon as the volume
+// changes.
+package volume
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"openbar/pipewire"
+	"sync"
+)
+
+// Muted is printed instead of the volume of muted devices.
+const Muted = "muted"
+
+func init() {
+	for _, m := range []struct {
+		name, description, class string
+	}{
+		{"volume", "volume of the default audio output", pipewire.Sink},
+		{"mic", "volume of the default microphone", pipewire.Source},
+	} {
+		class := m.class
+		modules.Register(modules.Info{
+			Name:        m.name,
+			Description: m.description,
+			Requires:    []string{"pw-dump", "wpctl"},
+			Commands: func(json.RawMessage) ([][]string, error) {
+				return pipewire.Commands(), nil
+			},
+		}, func(_ modules.Env, _ json.RawMessage) (openbar.Module, error) {
+			return New(pipewire.Shared(), class), nil
+		})
+	}
+}
+
+// Daemon is the part of PipeWire the module relies on.
+type Daemon interface {
+	Graph() (pipewire.Graph, error)
+	Notify(ctx context.Context, changed func()) error
+	Adjust(class string, delta int) error
+}
+
+// Module prints the volume of the default node of a class.
+type Module struct {
+	daemon Daemon
+	class  string
+
+	mu    sync.Mutex
+	value openbar.Value
+}
+
+// New returns a module reading the default node of the given class,
+// pipewire.Sink or pipewire.Source.
+func New(d Daemon, class string) *Module {
+	return &Module{daemon: d, class: class}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	g, err := m.daemon.Graph()
+	if err != nil {
+		return "", err
+	}
+
+	n, err := g.Default(m.class)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.value = openbar.Value{Number: n.Volume, Unit: "%", Max: 100}
+	if n.Muted {
+		m.value.Number = 0
+	}
+	m.mu.Unlock()
+
+	if n.Muted {
+		return Muted, nil
+	}
+	return fmt.Sprintf("%.0f%%", n.Volume), nil
+}
+
+// Value implements openbar.Valuer for Module. Muted devices are at zero.
+func (m *Module) Value() openbar.Value {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.value
+}
+
+// Adjust implements openbar.Adjuster for Module: scrolling changes the volume
+// by percents.
+func (m *Module) Adjust(delta int) error {
+	return m.daemon.Adjust(m.class, delta)
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.daemon.Notify(ctx, changed)
+}
@@ -0,0 +1,85 @@
+package volume_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openbar"
+	"openbar/modules/volume"
+	"openbar/pipewire"
+	"testing"
+)
+
+// A daemon with a fixed graph, recording adjustments.
+type daemon struct {
+	graph    pipewire.Graph
+	changed  chan func()
+	adjusted chan string
+}
+
+func (d daemon) Graph() (pipewire.Graph, error) {
+	return d.graph, nil
+}
+
+func (d daemon) Notify(ctx context.Context, changed func()) error {
+	d.changed <- changed
+	<-ctx.Done()
+	return nil
+}
+
+func (d daemon) Adjust(class string, delta int) error {
+	d.adjusted <- fmt.Sprint(class, " ", delta)
+	return nil
+}
+
+func TestVolume(t *testing.T) {
+	d := daemon{pipewire.Graph{
+		Nodes: []pipewire.Node{
+			{ID: 50, Name: "speakers", Class: pipewire.Sink, Volume: 45},
+			{ID: 51, Name: "headset", Class: pipewire.Sink, Volume: 80},
+			{ID: 52, Name: "mic", Class: pipewire.Source, Volume: 100, Muted: true},
+		},
+		Defaults: map[string]string{pipewire.Sink: "headset", pipewire.Source: "mic"},
+	}, make(chan func(), 1), make(chan string, 1)}
+
+	tests := []struct {
+		class string
+		want  string
+		err   error
+	}{
+		{class: pipewire.Sink, want: "80%"},
+		{class: pipewire.Source, want: volume.Muted},
+		{class: pipewire.Camera, err: pipewire.ErrNoNode},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := volume.New(d, test.class).FullText()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("want: %v, got: %v", test.err, err)
+			}
+			if out != test.want {
+				t.Errorf("want: %q, got: %q", test.want, out)
+			}
+		})
+	}
+
+	m := volume.New(d, pipewire.Sink)
+	var _ openbar.Notifier = m
+	var _ openbar.Adjuster = m
+
+	if err := m.Adjust(-10); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-d.adjusted, pipewire.Sink+" -10"; got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = m.Notify(ctx, func() {}) }()
+	defer cancel()
+
+	if changed := <-d.changed; changed == nil {
+		t.Error("want: changes passed to the daemon, got: nil")
+	}
+}
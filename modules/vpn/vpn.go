@@ -0,0 +1,75 @@
+// Package vpn is an OpenBar module printing the active VPNs, WireGuard
+// included, as reported by NetworkManager.
+package vpn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"openbar/network"
+	"strings"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "vpn",
+		Description: "active VPN connections",
+		Options: []modules.Option{
+			{Name: "backend", Type: modules.String, Default: `"networkmanager"`, Description: "networkmanager, the only one knowing VPNs"},
+		},
+		Requires: []string{"NetworkManager"},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Backend string `json:"backend"`
+		}{Backend: "networkmanager"}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.Backend != "networkmanager" {
+			return nil, fmt.Errorf("%w: %s doesn't manage VPNs", network.ErrBackend, opts.Backend)
+		}
+		b, err := network.Lookup(opts.Backend)
+		if err != nil {
+			return nil, err
+		}
+		return New(b), nil
+	})
+}
+
+// Module prints VPNs and is refreshed as soon as they change.
+type Module struct {
+	backend network.Backend
+}
+
+// New returns a module reading the given backend. The output lists the names
+// of the VPNs, like "work home...", where those still connecting end with an
+// ellipsis. It is empty when there is none.
+func New(b network.Backend) *Module {
+	return &Module{b}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	s, err := m.backend.State()
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(s.VPNs))
+	for _, v := range s.VPNs {
+		if v.Connected {
+			names = append(names, v.Name)
+		} else {
+			names = append(names, v.Name+"...")
+		}
+	}
+
+	return strings.Join(names, " "), nil
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.backend.Notify(ctx, changed)
+}
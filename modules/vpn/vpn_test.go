@@ -0,0 +1,31 @@
+package vpn_test
+
+import (
+	"fmt"
+	"openbar/modules/vpn"
+	"openbar/network"
+	"testing"
+)
+
+func TestVPN(t *testing.T) {
+	tests := []struct {
+		vpns []network.VPN
+		out  string
+	}{
+		{vpns: nil, out: ""},
+		{vpns: []network.VPN{{Name: "work", Connected: true}}, out: "work"},
+		{vpns: []network.VPN{{Name: "work", Connected: true}, {Name: "home"}}, out: "work home..."},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := vpn.New(network.Static{VPNs: test.vpns}).FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package wifi is an OpenBar module printing the wireless networks the machine
+// is connected to and the quality of their signal, as reported by
+// NetworkManager, iwd or the kernel.
+package wifi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"openbar"
+	"openbar/modules"
+	"openbar/network"
+	"strings"
+)
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "wifi",
+		Description: "wireless network and signal quality",
+		Options: []modules.Option{
+			{Name: "interface", Type: modules.String, Description: "wireless interface to show, all if empty"},
+			{Name: "backend", Type: modules.String, Default: `"networkmanager"`, Description: "networkmanager, iwd or netlink"},
+		},
+		Requires: []string{"NetworkManager or iwd"},
+	}, func(_ modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			Interface string `json:"interface"`
+			Backend   string `json:"backend"`
+		}{Backend: "networkmanager"}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		b, err := network.Lookup(opts.Backend)
+		if err != nil {
+			return nil, err
+		}
+		return New(b, opts.Interface), nil
+	})
+}
+
+// Module prints wireless networks and is refreshed as soon as they change.
+type Module struct {
+	backend network.Backend
+	iface   string
+}
+
+// New returns a module reading the given backend. Only the network of the
+// given interface is shown, or all of them if empty. The output looks like
+// "home 70%", and is empty while disconnected.
+func New(b network.Backend, iface string) *Module {
+	return &Module{b, iface}
+}
+
+// FullText implements openbar.Module for Module.
+func (m *Module) FullText() (string, error) {
+	s, err := m.backend.State()
+	if err != nil {
+		return "", err
+	}
+
+	fields := make([]string, 0, len(s.Wifi))
+	for _, w := range s.Wifi {
+		if m.iface == "" || w.Interface == m.iface {
+			fields = append(fields, fmt.Sprintf("%s %d%%", w.SSID, w.Strength))
+		}
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+// Notify implements openbar.Notifier for Module.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	return m.backend.Notify(ctx, changed)
+}
@@ -0,0 +1,41 @@
+package wifi_test
+
+import (
+	"fmt"
+	"openbar/modules/wifi"
+	"openbar/network"
+	"testing"
+)
+
+func TestWifi(t *testing.T) {
+	state := network.Static{
+		Connectivity: network.Full,
+		Wifi: []network.Wifi{
+			{Interface: "wlan0", SSID: "home", Strength: 70},
+			{Interface: "wlan1", SSID: "guest", Strength: 30},
+		},
+	}
+
+	tests := []struct {
+		state network.Static
+		iface string
+		out   string
+	}{
+		{state: state, iface: "", out: "home 70% guest 30%"},
+		{state: state, iface: "wlan1", out: "guest 30%"},
+		{state: state, iface: "wlan2", out: ""},
+		{state: network.Static{Connectivity: network.None}, iface: "", out: ""},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			out, err := wifi.New(test.state, test.iface).FullText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("want: %q, got: %q", test.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package wsjson is an OpenBar module printing the last message received over
+// a WebSocket, or a value extracted from it when messages are JSON. It is the
+// counterpart of httpjson for services pushing their updates.
+package wsjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"openbar"
+	"openbar/modules"
+	"openbar/modules/httpjson"
+	"openbar/websocket"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// How long the module waits before connecting again after losing the server.
+const retry = 5 * time.Second
+
+func init() {
+	modules.Register(modules.Info{
+		Name:        "wsjson",
+		Description: "value extracted from JSON messages received over a WebSocket",
+		Network:     true,
+		Options: []modules.Option{
+			{Name: "url", Type: modules.String, Description: "ws:// or wss:// address of the server"},
+			{Name: "send", Type: modules.String, Description: "message sent once connected, like a subscription request"},
+			{Name: "headers", Type: modules.Strings, Description: "additional headers of the handshake, like \"Authorization: Bearer TOKEN\""},
+			{Name: "path", Type: modules.String, Description: "dot-separated path of the value"},
+			{Name: "template", Type: modules.String, Description: "Go template printing the value, or the whole message without a path"},
+		},
+	}, func(env modules.Env, options json.RawMessage) (openbar.Module, error) {
+		opts := struct {
+			URL      string   `json:"url"`
+			Send     string   `json:"send"`
+			Headers  []string `json:"headers"`
+			Path     string   `json:"path"`
+			Template string   `json:"template"`
+		}{}
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		e := websocket.Endpoint{URL: opts.URL, Header: http.Header{}, Send: []byte(opts.Send)}
+		for _, h := range opts.Headers {
+			i := strings.Index(h, ":")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid header: %s", h)
+			}
+			e.Header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+		}
+		return New(e, opts.Path, opts.Template)
+	})
+}
+
+// Subscriber gives the messages of a server, see websocket.Endpoint.
+type Subscriber interface {
+	Subscribe(ctx context.Context, received func([]byte)) error
+}
+
+// Module prints the last message of a server.
+type Module struct {
+	source Subscriber
+	path   string
+	tmpl   *template.Template
+
+	mu   sync.Mutex
+	text string
+	err  error
+}
+
+// New returns a module reading the messages of a server. With a path or a
+// template, messages are JSON documents: the value at the path is printed, see
+// httpjson.Extract, or given to the template as its dot, the whole document
+// being used without a path.
+func New(s Subscriber, path, tmpl string) (*Module, error) {
+	m := &Module{source: s, path: path}
+
+	if tmpl != "" {
+		t, err := template.New("wsjson").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		m.tmpl = t
+	}
+
+	return m, nil
+}
+
+// FullText implements openbar.Module. It is empty until a message arrives and
+// tells why the server was lost until it is back.
+func (m *Module) FullText() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.text, m.err
+}
+
+// Notify implements openbar.Notifier: the module is refreshed on each message.
+// Messages without a value at the path, like acknowledgements or heartbeats
+// sent along, are skipped.
+func (m *Module) Notify(ctx context.Context, changed func()) error {
+	for {
+		err := m.source.Subscribe(ctx, func(msg []byte) {
+			text, err := m.extract(msg)
+			if errors.Is(err, httpjson.ErrPath) {
+				return
+			}
+			m.mu.Lock()
+			m.text, m.err = text, err
+			m.mu.Unlock()
+			changed()
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+		changed()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+	}
+}
+
+// Return the text of a message.
+func (m *Module) extract(msg []byte) (string, error) {
+	if m.path == "" && m.tmpl == nil {
+		return strings.TrimSpace(string(msg)), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", err
+	}
+
+	if m.tmpl == nil {
+		return httpjson.Extract(doc, m.path)
+	}
+
+	v, err := httpjson.Lookup(doc, m.path)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := m.tmpl.Execute(&sb, v); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
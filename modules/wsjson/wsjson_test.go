@@ -0,0 +1,70 @@
+package wsjson_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openbar/modules/wsjson"
+	"testing"
+)
+
+// A server sending the given messages, then closing the connection.
+type server [][]byte
+
+func (s server) Subscribe(ctx context.Context, received func([]byte)) error {
+	for _, msg := range s {
+		received(msg)
+	}
+	return errors.New("connection closed")
+}
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		path     string
+		tmpl     string
+		messages []string
+		skipped  int
+		out      string
+		err      error
+	}{
+		{path: "", tmpl: "", messages: []string{"20.5\n", "21.5\n"}, skipped: 0, out: "21.5", err: nil},
+		{path: "data.price", tmpl: "", messages: []string{`{"data": {"price": 42.1}}`}, skipped: 0, out: "42.1", err: nil},
+		{path: "data", tmpl: "{{.price}} {{.currency}}", messages: []string{`{"data": {"price": 42.1, "currency": "EUR"}}`}, skipped: 0, out: "42.1 EUR", err: nil},
+		{path: "", tmpl: "{{index .items 0}}", messages: []string{`{"items": ["a", "b"]}`}, skipped: 0, out: "a", err: nil},
+		{path: "price", tmpl: "", messages: []string{`{"price": 42.1}`, `{"event": "heartbeat"}`}, skipped: 1, out: "42.1", err: nil},
+		{path: "price", tmpl: "", messages: []string{`not json`}, skipped: 0, out: "", err: &json.SyntaxError{}},
+	}
+
+	for i, test := range tests {
+		s := make(server, 0)
+		for _, msg := range test.messages {
+			s = append(s, []byte(msg))
+		}
+
+		m, err := wsjson.New(s, test.path, test.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The module is refreshed with each message, then with the failure
+		// which keeps the last value.
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		_ = m.Notify(ctx, func() {
+			calls++
+			out, err := m.FullText()
+			switch calls {
+			case len(test.messages) - test.skipped:
+				if out != test.out || (err == nil) != (test.err == nil) {
+					t.Errorf("%d: want: %q, %v, got: %q, %v", i, test.out, test.err, out, err)
+				}
+			case len(test.messages) - test.skipped + 1:
+				if out != test.out || err == nil {
+					t.Errorf("%d: want: %q with an error, got: %q, %v", i, test.out, out, err)
+				}
+				cancel()
+			}
+		})
+		cancel()
+	}
+}
@@ -0,0 +1,202 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"openbar"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the bridge waits before connecting again after losing the broker.
+const retry = 5 * time.Second
+
+// Bridge connects a bar to a broker. The status of each module is published,
+// retained, to PREFIX/ID as JSON (see openbar.Status) and clicks on its block
+// to PREFIX/ID/click. With commands, "reload", "enable" and "disable" sent to
+// PREFIX/ID/command act on the module. Slashes and wildcards in identifiers
+// are replaced with underscores.
+type Bridge struct {
+	Broker Broker
+	Prefix string
+	// Control gives the identifiers of modules, which clicks and commands
+	// need. Both are left out without it.
+	Control *openbar.Control
+	// Commands lets whoever can publish to the broker drive the bar.
+	Commands bool
+
+	queue chan publication
+
+	mu   sync.Mutex
+	last map[string][]byte
+}
+
+// A message waiting to be published.
+type publication struct {
+	Message
+	retain bool
+}
+
+// NewBridge returns a bridge publishing under the given prefix.
+func NewBridge(b Broker, prefix string) *Bridge {
+	return &Bridge{Broker: b, Prefix: prefix, queue: make(chan publication, 64), last: make(map[string][]byte)}
+}
+
+// Update publishes the status of a module, see openbar.WithUpdateHook.
+func (b *Bridge) Update(s openbar.Status) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		log.Printf("mqtt: %v", err)
+		return
+	}
+
+	topic := b.topic(s.ID)
+
+	b.mu.Lock()
+	b.last[topic] = data
+	b.mu.Unlock()
+
+	b.send(publication{Message{topic, data}, true})
+}
+
+// Click publishes a click on the block of a module, see
+// openbar.WithClickHook.
+func (b *Bridge) Click(idx int, c openbar.Click) {
+	if b.Control == nil {
+		return
+	}
+
+	status := b.Control.Status()
+	if idx >= len(status) {
+		return
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		log.Printf("mqtt: %v", err)
+		return
+	}
+
+	b.send(publication{Message{b.topic(status[idx].ID) + "/click", data}, false})
+}
+
+// Queue a message without blocking the bar. Messages are dropped while the
+// broker is too slow: statuses are published again on reconnection anyway.
+func (b *Bridge) send(m publication) {
+	select {
+	case b.queue <- m:
+	default:
+	}
+}
+
+// Run publishes until the context is done, connecting again whenever the
+// broker is lost.
+func (b *Bridge) Run(ctx context.Context) error {
+	for {
+		if err := b.session(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("mqtt: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+	}
+}
+
+// Publish messages over a single connection until it fails or the context is
+// done. Statuses published so far come first since the broker may have lost
+// them.
+func (b *Bridge) session(ctx context.Context) error {
+	c, err := b.Broker.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	failed := make(chan error, 1)
+	if b.Control != nil && b.Commands {
+		if err := c.Subscribe(b.topic("+") + "/command"); err != nil {
+			return err
+		}
+		go func() { failed <- b.listen(c) }()
+	}
+
+	b.mu.Lock()
+	retained := make([]Message, 0, len(b.last))
+	for topic, data := range b.last {
+		retained = append(retained, Message{topic, data})
+	}
+	b.mu.Unlock()
+
+	for _, m := range retained {
+		if err := c.Publish(m.Topic, m.Payload, true); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-failed:
+			return err
+		case m := <-b.queue:
+			if err := c.Publish(m.Topic, m.Payload, m.retain); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Act on the commands received until the connection fails.
+func (b *Bridge) listen(c *Client) error {
+	for {
+		m, err := c.Next()
+		if err != nil {
+			return err
+		}
+
+		if err := b.command(m); err != nil {
+			log.Printf("mqtt: %s: %v", m.Topic, err)
+		}
+	}
+}
+
+// Act on a command sent to a module.
+func (b *Bridge) command(m Message) error {
+	topic := strings.TrimSuffix(m.Topic, "/command")
+
+	idx := -1
+	for _, s := range b.Control.Status() {
+		if b.topic(s.ID) == topic {
+			idx = s.Index
+		}
+	}
+	if idx < 0 {
+		return openbar.ErrNoModule
+	}
+
+	switch cmd := strings.TrimSpace(string(m.Payload)); cmd {
+	case "reload":
+		return b.Control.Reload(idx)
+	case "enable":
+		return b.Control.Enable(idx)
+	case "disable":
+		return b.Control.Disable(idx)
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+}
+
+// Return the topic of a module.
+func (b *Bridge) topic(id string) string {
+	if id != "+" {
+		id = strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(id)
+	}
+	return b.Prefix + "/" + id
+}
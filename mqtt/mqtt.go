@@ -0,0 +1,423 @@
+// Package mqtt is a minimal client for MQTT 3.1.1 brokers, as used by home
+// automation. It only covers what the bar needs: messages are published and
+// received at most once (QoS 0), and sessions are clean.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Packet types.
+const (
+	connect    byte = 1
+	connack    byte = 2
+	publish    byte = 3
+	puback     byte = 4
+	subscribe  byte = 8
+	suback     byte = 9
+	pingreq    byte = 12
+	pingresp   byte = 13
+	disconnect byte = 14
+)
+
+// DefaultKeepAlive is how long the connection may stay silent.
+const DefaultKeepAlive = 30 * time.Second
+
+// How long a single write or the handshake may take.
+const timeout = 10 * time.Second
+
+// ErrMalformed is returned when a packet can't be read.
+var ErrMalformed = errors.New("malformed packet")
+
+// ErrRefused is returned when the broker turns down a connection or a
+// subscription.
+var ErrRefused = errors.New("refused")
+
+// Reasons a broker gives for refusing a connection.
+var reasons = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Connections made so far, to give each its own client identifier: brokers
+// drop a client when another one connects with the same identifier.
+var clients uint32
+
+// Broker is where to connect and how. The address is HOST[:PORT], or a URL
+// like mqtt://HOST[:PORT] or mqtts://HOST[:PORT] for TLS.
+type Broker struct {
+	Addr     string
+	Username string
+	Password string
+	// KeepAlive is how often the client makes itself heard, DefaultKeepAlive
+	// when zero.
+	KeepAlive time.Duration
+}
+
+// Message is what was published on a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Client is a connection to a broker. Its methods may be called from several
+// goroutines, except Next which belongs to a single reader.
+type Client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+
+	mu  sync.Mutex
+	ids uint16
+
+	done chan struct{}
+	once sync.Once
+}
+
+// Dial connects to the broker. The connection is kept alive until Close is
+// called or it fails, in which case Next returns an error.
+func (b Broker) Dial(ctx context.Context) (*Client, error) {
+	addr, secure, err := address(b.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		host, _, _ := net.SplitHostPort(addr)
+		conn = tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn), keepAlive: b.KeepAlive, done: make(chan struct{})}
+	if c.keepAlive <= 0 {
+		c.keepAlive = DefaultKeepAlive
+	}
+
+	if err := c.connect(ctx, b); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.ping()
+
+	return c, nil
+}
+
+// Return the host and port of an address and whether it uses TLS.
+func address(s string) (string, bool, error) {
+	secure := false
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		switch u.Scheme {
+		case "mqtt", "tcp":
+		case "mqtts", "ssl", "tls":
+			secure = true
+		default:
+			return "", false, fmt.Errorf("unknown scheme: %s", u.Scheme)
+		}
+		s = u.Host
+	}
+
+	if s == "" {
+		return "", false, errors.New("no broker")
+	}
+
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		s = net.JoinHostPort(s, port)
+	}
+
+	return s, secure, nil
+}
+
+// Open the session and wait for the broker to accept it.
+func (c *Client) connect(ctx context.Context, b Broker) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	id := fmt.Sprintf("openbar-%d-%d", os.Getpid(), atomic.AddUint32(&clients, 1))
+
+	// Protocol name and level, flags asking for a clean session and keep
+	// alive in seconds.
+	ka := int(c.keepAlive / time.Second)
+	body := append(str("MQTT"), 4, 0x02, byte(ka>>8), byte(ka))
+	body = append(body, str(id)...)
+	if b.Username != "" {
+		body[7] |= 0x80
+		body = append(body, str(b.Username)...)
+	}
+	if b.Password != "" {
+		body[7] |= 0x40
+		body = append(body, str(b.Password)...)
+	}
+
+	if _, err := c.conn.Write(encode(connect, 0, body)); err != nil {
+		return err
+	}
+
+	kind, _, res, err := read(c.r)
+	switch {
+	case err != nil:
+		return err
+	case kind != connack || len(res) != 2:
+		return fmt.Errorf("%w: want connack", ErrMalformed)
+	case res[1] != 0:
+		reason, ok := reasons[res[1]]
+		if !ok {
+			reason = fmt.Sprintf("code %d", res[1])
+		}
+		return fmt.Errorf("connection %w: %s", ErrRefused, reason)
+	}
+
+	return c.conn.SetDeadline(time.Time{})
+}
+
+// Let the broker know the client is alive, until the connection is closed.
+func (c *Client) ping() {
+	t := time.NewTicker(c.keepAlive / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.write(encode(pingreq, 0, nil)); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Subscribe connects to the broker and calls received with each message of
+// topics matching the filter, until the context is done or the connection
+// fails.
+func (b Broker) Subscribe(ctx context.Context, filter string, received func(Message)) error {
+	c, err := b.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	if err := c.Subscribe(filter); err != nil {
+		return err
+	}
+
+	for {
+		m, err := c.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		received(m)
+	}
+}
+
+// Publish sends a message to a topic. Retained messages are kept by the broker
+// and given to those subscribing later.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	return c.write(encode(publish, flags, append(str(topic), payload...)))
+}
+
+// Subscribe asks for the messages of topics matching the given filters, which
+// may have wildcards. They can then be read with Next.
+func (c *Client) Subscribe(filters ...string) error {
+	c.mu.Lock()
+	c.ids++
+	if c.ids == 0 {
+		c.ids++
+	}
+	id := c.ids
+	c.mu.Unlock()
+
+	body := []byte{byte(id >> 8), byte(id)}
+	for _, f := range filters {
+		body = append(append(body, str(f)...), 0)
+	}
+
+	return c.write(encode(subscribe, 0x02, body))
+}
+
+// Next waits for the next message. It fails once the connection is lost, or
+// if a subscription was refused.
+func (c *Client) Next() (Message, error) {
+	for {
+		// The broker answers pings, so a connection silent for longer is dead.
+		if err := c.conn.SetReadDeadline(time.Now().Add(2 * c.keepAlive)); err != nil {
+			return Message{}, err
+		}
+
+		kind, flags, body, err := read(c.r)
+		if err != nil {
+			return Message{}, err
+		}
+
+		switch kind {
+		case publish:
+			return c.received(flags, body)
+		case suback:
+			if len(body) < 2 {
+				return Message{}, fmt.Errorf("%w: no packet identifier", ErrMalformed)
+			}
+			for _, code := range body[2:] {
+				if code == 0x80 {
+					return Message{}, fmt.Errorf("subscription %w", ErrRefused)
+				}
+			}
+		}
+	}
+}
+
+// Decode a message, acknowledging it if the broker asks to.
+func (c *Client) received(flags byte, body []byte) (Message, error) {
+	topic, rest, err := readStr(body)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if qos := flags >> 1 & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, fmt.Errorf("%w: no packet identifier", ErrMalformed)
+		}
+		if qos == 1 {
+			if err := c.write(encode(puback, 0, rest[:2])); err != nil {
+				return Message{}, err
+			}
+		}
+		rest = rest[2:]
+	}
+
+	return Message{topic, rest}, nil
+}
+
+// Close ends the session.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.write(encode(disconnect, 0, nil))
+	})
+	return c.conn.Close()
+}
+
+// Write a packet.
+func (c *Client) write(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write(p)
+
+	return err
+}
+
+// Frame a packet: its type and flags, then the length of its body encoded on
+// seven bits per byte.
+func encode(kind, flags byte, body []byte) []byte {
+	res := []byte{kind<<4 | flags}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		res = append(res, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(res, body...)
+}
+
+// Read a packet and return its type, flags and body.
+func read(r *bufio.Reader) (byte, byte, []byte, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, 0, nil, fmt.Errorf("%w: length too long", ErrMalformed)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		mult *= 128
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return h >> 4, h & 0x0f, body, nil
+}
+
+// Encode a string prefixed with its length.
+func str(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// Decode a string prefixed with its length and return what follows.
+func readStr(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, fmt.Errorf("%w: truncated string", ErrMalformed)
+	}
+	n := int(b[0])<<8 | int(b[1])
+	if len(b) < 2+n {
+		return "", nil, fmt.Errorf("%w: truncated string", ErrMalformed)
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
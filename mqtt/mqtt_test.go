@@ -0,0 +1,207 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"openbar"
+	"openbar/mqtt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A client connected to the fake broker.
+type peer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Start a fake broker answering connections with the given code and return its
+// address along with the clients it accepted.
+func serve(t *testing.T, code byte) (string, <-chan *peer) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	peers := make(chan *peer, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			p := &peer{t, conn, bufio.NewReader(conn)}
+			if kind, _, _ := p.read(); kind != 1 {
+				t.Errorf("want: connect, got: %d", kind)
+			}
+			p.write(2, 0, []byte{0, code})
+			peers <- p
+		}
+	}()
+
+	return ln.Addr().String(), peers
+}
+
+// Read a packet, skipping pings.
+func (p *peer) read() (byte, byte, []byte) {
+	for {
+		_ = p.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		h, err := p.r.ReadByte()
+		if err != nil {
+			p.t.Error(err)
+			return 0, 0, nil
+		}
+		n, mult := 0, 1
+		for {
+			b, _ := p.r.ReadByte()
+			n += int(b&0x7f) * mult
+			if b&0x80 == 0 {
+				break
+			}
+			mult *= 128
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			p.t.Error(err)
+		}
+		if h>>4 != 12 {
+			return h >> 4, h & 0x0f, body
+		}
+	}
+}
+
+// Write a packet with a short body.
+func (p *peer) write(kind, flags byte, body []byte) {
+	msg := append([]byte{kind<<4 | flags, byte(len(body))}, body...)
+	if _, err := p.conn.Write(msg); err != nil {
+		p.t.Error(err)
+	}
+}
+
+// Read a message published by the client.
+func (p *peer) published() (string, string, bool) {
+	kind, flags, body := p.read()
+	if kind != 3 || len(body) < 2 {
+		p.t.Errorf("want: publish, got: %d", kind)
+		return "", "", false
+	}
+	n := int(body[0])<<8 | int(body[1])
+	return string(body[2 : 2+n]), string(body[2+n:]), flags&1 == 1
+}
+
+// Encode a string prefixed with its length.
+func str(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+func TestClient(t *testing.T) {
+	addr, peers := serve(t, 0)
+
+	c, err := mqtt.Broker{Addr: "mqtt://" + addr}.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := <-peers
+
+	if err := c.Subscribe("sensors/#"); err != nil {
+		t.Fatal(err)
+	}
+	kind, flags, body := p.read()
+	if want := append([]byte{0, 1}, append(str("sensors/#"), 0)...); kind != 8 || flags != 2 || string(body) != string(want) {
+		t.Errorf("want: subscribe %v, got: %d/%d %v", want, kind, flags, body)
+	}
+
+	// The subscription is granted, then a message comes asking for an
+	// acknowledgement.
+	p.write(9, 0, []byte{0, 1, 0})
+	p.write(3, 2, append(append(str("sensors/temp"), 0, 7), "21.5"...))
+
+	m, err := c.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Topic != "sensors/temp" || string(m.Payload) != "21.5" {
+		t.Errorf("want: sensors/temp 21.5, got: %s %s", m.Topic, m.Payload)
+	}
+	if kind, _, body := p.read(); kind != 4 || string(body) != string([]byte{0, 7}) {
+		t.Errorf("want: puback 7, got: %d %v", kind, body)
+	}
+
+	if err := c.Publish("bar/state", []byte("on"), true); err != nil {
+		t.Fatal(err)
+	}
+	if topic, payload, retained := p.published(); topic != "bar/state" || payload != "on" || !retained {
+		t.Errorf("want: retained bar/state on, got: %s %s %v", topic, payload, retained)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	addr, _ := serve(t, 4)
+
+	_, err := mqtt.Broker{Addr: addr, Username: "user", Password: "wrong"}.Dial(context.Background())
+	if !errors.Is(err, mqtt.ErrRefused) {
+		t.Errorf("want: %v, got: %v", mqtt.ErrRefused, err)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, peers := serve(t, 0)
+
+	control := openbar.NewControl()
+	bridge := mqtt.NewBridge(mqtt.Broker{Addr: addr}, "bar")
+	bridge.Control = control
+	bridge.Commands = true
+
+	var runs int32
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithUpdateHook(bridge.Update),
+			openbar.WithModuleFunc(func() (string, error) {
+				return strconv.Itoa(int(atomic.AddInt32(&runs, 1))), nil
+			}, time.Hour),
+		)
+	}()
+
+	go func() { _ = bridge.Run(ctx) }()
+
+	p := <-peers
+
+	if kind, _, body := p.read(); kind != 8 || string(body[2:]) != string(append(str("bar/+/command"), 0)) {
+		t.Fatalf("want: subscription to commands, got: %d %q", kind, body)
+	}
+
+	// Each run of the module is published, the second one being asked for.
+	for i := 0; ; i++ {
+		topic, payload, retained := p.published()
+		var s openbar.Status
+		if err := json.Unmarshal([]byte(payload), &s); err != nil {
+			t.Fatal(err)
+		}
+		if topic != "bar/0" || !retained {
+			t.Fatalf("want: retained status on bar/0, got: %s %s %v", topic, payload, retained)
+		}
+		if s.Text == "2" {
+			break
+		}
+		if i == 0 {
+			p.write(3, 0, append(str("bar/0/command"), "reload"...))
+		}
+	}
+}
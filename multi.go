@@ -0,0 +1,81 @@
+package openbar
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MultiModule is a bar module emitting several blocks, like one per battery
+// or per disk, as many as it needs on each run. Blocks are styled like those
+// of BlockModule. Their instance tells them apart when clicked: the module
+// gets clicks with the instance of the block they were made on, or with its
+// position when the module left it empty.
+type MultiModule interface {
+	Blocks() ([]Block, error)
+}
+
+// MultiModuleFunc is a function for the single-method interface MultiModule.
+type MultiModuleFunc func() ([]Block, error)
+
+// Blocks implements MultiModule for MultiModuleFunc.
+func (f MultiModuleFunc) Blocks() ([]Block, error) {
+	return f()
+}
+
+// Run a module emitting several blocks, keeping them aside for the result.
+// The text of the blocks joined together stands for the output of the module,
+// for thresholds and statuses.
+func (c cell) renderMulti(blocks *[]Block) func() (Block, error) {
+	return func() (Block, error) {
+		res, err := c.multi.Blocks()
+		texts := make([]string, 0, len(res))
+		for i := range res {
+			res[i].FullText = sanitize(res[i].FullText)
+			res[i].ShortText = sanitize(res[i].ShortText)
+			if res[i].FullText != "" {
+				texts = append(texts, res[i].FullText)
+			}
+		}
+		if err == nil && res == nil {
+			res = make([]Block, 0)
+		}
+		*blocks = res
+		return Block{FullText: strings.Join(texts, " ")}, err
+	}
+}
+
+// Style the blocks emitted by a module after the block standing for it. They
+// keep its name and their instance is nested in its own.
+func nest(slot Block, blocks []Block) []Block {
+	res := make([]Block, len(blocks))
+	for i, b := range blocks {
+		res[i] = overlay(slot, b)
+		res[i].FullText, res[i].ShortText = b.FullText, b.ShortText
+		res[i].Urgent = slot.Urgent || b.Urgent
+		res[i].Instance = b.Instance
+		if res[i].Instance == "" {
+			res[i].Instance = strconv.Itoa(i)
+		}
+		if slot.Instance != "" {
+			res[i].Instance = slot.Instance + "/" + res[i].Instance
+		}
+	}
+	return res
+}
+
+// Lay out the body of the bar: modules emitting several blocks take the place
+// of their own block once they returned them. Return the index of the module
+// of each block along with the blocks.
+func expand(b []Block, nested [][]Block) ([]Block, []int) {
+	frame, owners := make([]Block, 0, len(b)), make([]int, 0, len(b))
+	for i := range b {
+		if nested[i] == nil {
+			frame, owners = append(frame, b[i]), append(owners, i)
+			continue
+		}
+		for _, block := range nested[i] {
+			frame, owners = append(frame, block), append(owners, i)
+		}
+	}
+	return frame, owners
+}
@@ -0,0 +1,207 @@
+// Package netlink shares the netlink(7) sockets of the bar between modules
+// interested in the network: links going up or down, addresses and routes
+// coming and going, and wireless interfaces connecting to or disconnecting from
+// their network. Modules are told as soon as the kernel announces a change
+// instead of polling /proc or /sys.
+//
+// Link, address and route events come from rtnetlink(7), and wireless ones from
+// nl80211, the generic netlink family of wireless drivers. Sockets are opened
+// on first use and shared by every subscriber. When the kernel drops events
+// because a socket buffer overflowed, every subscriber of that socket is told
+// that something changed since there is no way to know what.
+package netlink
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Kind is a kind of event. Kinds are combined to subscribe to several of them.
+type Kind uint
+
+// Kinds of events.
+const (
+	Link Kind = 1 << iota
+	Address
+	Route
+	Wireless
+)
+
+// Names of the kinds.
+var kinds = []string{"link", "address", "route", "wireless"}
+
+// String implements fmt.Stringer for Kind.
+func (k Kind) String() string {
+	names := make([]string, 0, len(kinds))
+	for i, name := range kinds {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a change of the network. Index is the index of the interface
+// concerned, or zero when unknown, for instance after an overflow.
+type Event struct {
+	Kind  Kind
+	Index int
+}
+
+// Multicast groups of rtnetlink, missing from the syscall package.
+const (
+	groupLink       = 0x1
+	groupIPv4Addr   = 0x10
+	groupIPv4Route  = 0x40
+	groupIPv6Addr   = 0x100
+	groupIPv6Route  = 0x400
+	rtnetlinkGroups = groupLink | groupIPv4Addr | groupIPv4Route | groupIPv6Addr | groupIPv6Route
+)
+
+// ErrClosed is returned when subscribing with a closed instance.
+var ErrClosed = errors.New("netlink subscriber closed")
+
+// Subscriber listens to the kernel on behalf of modules.
+type Subscriber struct {
+	mu       sync.Mutex
+	route    *socket
+	wireless *socket
+	subs     map[*sub]struct{}
+	closed   bool
+}
+
+// A sub waits for some kinds of events.
+type sub struct {
+	kinds Kind
+	fn    func(Event)
+}
+
+// New returns a subscriber. Sockets are opened on first use.
+func New() *Subscriber {
+	return &Subscriber{subs: make(map[*sub]struct{})}
+}
+
+var shared = New()
+
+// Shared returns the subscriber shared by all modules.
+func Shared() *Subscriber {
+	return shared
+}
+
+// Subscribe calls fn for each event of the given kinds until the context is
+// done. Subscribing to wireless events fails on machines without wireless
+// drivers.
+func (s *Subscriber) Subscribe(ctx context.Context, kinds Kind, fn func(Event)) error {
+	sb := &sub{kinds, fn}
+
+	if err := s.add(sb); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	delete(s.subs, sb)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Register a sub, opening the sockets it needs.
+func (s *Subscriber) add(sb *sub) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	if sb.kinds&(Link|Address|Route) != 0 && s.route == nil {
+		sock, err := dial(syscall.NETLINK_ROUTE, rtnetlinkGroups)
+		if err != nil {
+			return err
+		}
+		s.route = sock
+		go s.read(sock, Link|Address|Route, routeEvent)
+	}
+
+	if sb.kinds&Wireless != 0 && s.wireless == nil {
+		sock, err := listen80211()
+		if err != nil {
+			return err
+		}
+		s.wireless = sock
+		go s.read(sock, Wireless, wirelessEvent)
+	}
+
+	s.subs[sb] = struct{}{}
+
+	return nil
+}
+
+// Close releases the sockets. Pending subscriptions return when their context
+// is done, and new ones fail.
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	for _, sock := range []*socket{s.route, s.wireless} {
+		if sock == nil {
+			continue
+		}
+		if e := sock.close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Read the events of a socket until it is closed. Messages the socket receives
+// are converted to events by decode, which tells whether they are events at
+// all.
+func (s *Subscriber) read(sock *socket, all Kind, decode func(syscall.NetlinkMessage) (Event, bool)) {
+	for {
+		msgs, err := sock.receive()
+		switch {
+		case errors.Is(err, ErrOverflow):
+			s.dispatch(Event{Kind: all})
+			continue
+		case err != nil:
+			return
+		}
+
+		for _, m := range msgs {
+			if e, ok := decode(m); ok {
+				s.dispatch(e)
+			}
+		}
+	}
+}
+
+// Call the subs concerned by an event, telling each of them about the kinds it
+// subscribed to. Handlers are called without the lock so that they may
+// subscribe or unsubscribe.
+func (s *Subscriber) dispatch(e Event) {
+	var subs []sub
+
+	s.mu.Lock()
+	for sb := range s.subs {
+		if sb.kinds&e.Kind != 0 {
+			subs = append(subs, *sb)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sb := range subs {
+		sb.fn(Event{e.Kind & sb.kinds, e.Index})
+	}
+}
@@ -0,0 +1,100 @@
+package netlink_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"openbar/netlink"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestKind(t *testing.T) {
+	if want, got := "link|wireless", (netlink.Link | netlink.Wireless).String(); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// Adding an address to the loopback interface is the least intrusive
+	// change there is, but it takes privileges.
+	const addr = "198.51.100.7/32"
+	ip := func(op string) error {
+		return exec.Command("ip", "addr", op, addr, "dev", "lo").Run()
+	}
+	if err := ip("add"); err != nil {
+		t.Skipf("can't change addresses: %v", err)
+	}
+	_ = ip("del")
+
+	s := netlink.New()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addrs, links := make(chan netlink.Event, 16), make(chan netlink.Event, 16)
+	notify := func(c chan netlink.Event) func(netlink.Event) {
+		return func(e netlink.Event) {
+			select {
+			case c <- e:
+			default:
+			}
+		}
+	}
+
+	go func() { _ = s.Subscribe(ctx, netlink.Address, notify(addrs)) }()
+	go func() { _ = s.Subscribe(ctx, netlink.Link, notify(links)) }()
+
+	// Subscriptions are registered in the background: change the address
+	// until the change is seen.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("want: address event, got: nothing")
+		}
+		_ = ip("add")
+		_ = ip("del")
+
+		select {
+		case e := <-addrs:
+			if e.Kind != netlink.Address || e.Index != lo.Index {
+				t.Errorf("want: %v, got: %v", netlink.Event{Kind: netlink.Address, Index: lo.Index}, e)
+			}
+		case <-time.After(100 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	select {
+	case e := <-links:
+		t.Errorf("want: no link event, got: %v", e)
+	default:
+	}
+}
+
+func TestClosed(t *testing.T) {
+	s := netlink.New()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(context.Background(), netlink.Route, func(netlink.Event) {}); !errors.Is(err, netlink.ErrClosed) {
+		t.Errorf("want: %v, got: %v", netlink.ErrClosed, err)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	if _, err := netlink.DefaultRoutes(); err != nil {
+		t.Error(err)
+	}
+	if _, err := netlink.Interfaces(); err != nil && !errors.Is(err, netlink.ErrNoWireless) {
+		t.Error(err)
+	}
+}
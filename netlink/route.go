@@ -0,0 +1,72 @@
+package netlink
+
+import "syscall"
+
+// Decode the event announced by an rtnetlink message. The interface of links
+// and addresses comes from their header, and the one of routes from their
+// output interface, unknown for routes through several of them.
+func routeEvent(m syscall.NetlinkMessage) (Event, bool) {
+	switch m.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		if len(m.Data) < syscall.SizeofIfInfomsg {
+			return Event{}, false
+		}
+		return Event{Link, int(int32(native.Uint32(m.Data[4:8])))}, true
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(m.Data) < syscall.SizeofIfAddrmsg {
+			return Event{}, false
+		}
+		return Event{Address, int(native.Uint32(m.Data[4:8]))}, true
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		if len(m.Data) < syscall.SizeofRtMsg {
+			return Event{}, false
+		}
+		a := attrs(m.Data[syscall.SizeofRtMsg:])
+		return Event{Route, int(number(a[syscall.RTA_OIF]))}, true
+	}
+	return Event{}, false
+}
+
+// DefaultRoutes returns the indexes of the interfaces holding a default route of
+// the main table, IPv4 or IPv6. The index of routes through several interfaces
+// is zero.
+func DefaultRoutes() ([]int, error) {
+	sock, err := dial(syscall.NETLINK_ROUTE, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.close()
+
+	msgs, err := sock.query(syscall.RTM_GETROUTE, syscall.NLM_F_DUMP, make([]byte, syscall.SizeofRtMsg))
+	if err != nil {
+		return nil, err
+	}
+
+	res, seen := make([]int, 0), make(map[int]bool)
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+
+		// The table is given in the header unless its number is too large
+		// for it.
+		dst, table, typ := m.Data[1], uint32(m.Data[4]), m.Data[7]
+		a := attrs(m.Data[syscall.SizeofRtMsg:])
+		if t, ok := a[syscall.RTA_TABLE]; ok {
+			table = number(t)
+		}
+
+		if dst != 0 || table != syscall.RT_TABLE_MAIN || typ != syscall.RTN_UNICAST {
+			continue
+		}
+
+		// Interfaces holding both an IPv4 and an IPv6 route are listed once.
+		index := int(number(a[syscall.RTA_OIF]))
+		if !seen[index] {
+			seen[index] = true
+			res = append(res, index)
+		}
+	}
+
+	return res, nil
+}
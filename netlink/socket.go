@@ -0,0 +1,189 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Options of netlink sockets, missing from the syscall package.
+const (
+	solNetlink   = 270
+	nlaTypeMask  = 0x3fff
+	queryTimeout = 5 * time.Second
+)
+
+// Netlink speaks the byte order of the machine.
+var native binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	//nolint:gosec
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// ErrOverflow is returned by receive when the kernel dropped messages because
+// the socket buffer was full.
+var ErrOverflow = errors.New("netlink buffer overflow")
+
+// A socket is a netlink socket, either listening to multicast groups or
+// querying the kernel.
+type socket struct {
+	mu   sync.Mutex
+	fd   int
+	file *os.File
+	seq  uint32
+	buf  []byte
+}
+
+// Open a socket of the given protocol, member of the given groups. A
+// non-blocking descriptor is handled by the runtime poller, so that closing it
+// wakes the reader up and queries can time out.
+func dial(proto int, groups uint32) (*socket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, proto)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: %w", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("netlink: %w", err)
+	}
+
+	// The descriptor is kept aside since asking the file for it would make it
+	// blocking again.
+	return &socket{fd: fd, file: os.NewFile(uintptr(fd), "netlink"), buf: make([]byte, 1<<16)}, nil
+}
+
+// Join a multicast group past the first 32 ones, like those of generic
+// families.
+func (s *socket) join(group uint32) error {
+	return syscall.SetsockoptInt(s.fd, solNetlink, syscall.NETLINK_ADD_MEMBERSHIP, int(group))
+}
+
+// Receive the next batch of messages.
+func (s *socket) receive() ([]syscall.NetlinkMessage, error) {
+	n, err := s.file.Read(s.buf)
+	switch {
+	case errors.Is(err, syscall.ENOBUFS):
+		return nil, ErrOverflow
+	case err != nil:
+		return nil, err
+	}
+	return syscall.ParseNetlinkMessage(s.buf[:n])
+}
+
+// Send a request and collect the messages answering it, until the end of a
+// dump or the single reply of other requests.
+func (s *socket) query(typ, flags uint16, data []byte) ([]syscall.NetlinkMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	req := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(data))
+	native.PutUint32(req[0:4], uint32(syscall.NLMSG_HDRLEN+len(data)))
+	native.PutUint16(req[4:6], typ)
+	native.PutUint16(req[6:8], flags|syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	native.PutUint32(req[8:12], s.seq)
+	req = append(req, data...)
+
+	if err := syscall.Sendto(s.fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("netlink: %w", err)
+	}
+
+	if err := s.file.SetReadDeadline(time.Now().Add(queryTimeout)); err != nil {
+		return nil, err
+	}
+
+	var res []syscall.NetlinkMessage
+	for {
+		msgs, err := s.receive()
+		if err != nil {
+			return nil, fmt.Errorf("netlink: %w", err)
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != s.seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return res, nil
+			case syscall.NLMSG_ERROR:
+				// The error is followed by the request it answers, and
+				// is zero for acknowledgements.
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("netlink: %w", syscall.EINVAL)
+				}
+				if code := int32(native.Uint32(m.Data[:4])); code != 0 {
+					return nil, fmt.Errorf("netlink: %w", syscall.Errno(-code))
+				}
+				return res, nil
+			}
+			res = append(res, m)
+		}
+	}
+}
+
+// Close the socket.
+func (s *socket) close() error {
+	return s.file.Close()
+}
+
+// Parse netlink attributes by type. Nested attributes are left to parse again.
+func attrs(b []byte) map[uint16][]byte {
+	res := make(map[uint16][]byte)
+	for len(b) >= syscall.SizeofRtAttr {
+		l := int(native.Uint16(b[0:2]))
+		typ := native.Uint16(b[2:4]) & nlaTypeMask
+		if l < syscall.SizeofRtAttr || l > len(b) {
+			break
+		}
+		res[typ] = b[syscall.SizeofRtAttr:l]
+		// Attributes are aligned on four bytes.
+		next := (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if next > len(b) {
+			break
+		}
+		b = b[next:]
+	}
+	return res
+}
+
+// Encode an attribute.
+func attr(typ uint16, value []byte) []byte {
+	l := syscall.SizeofRtAttr + len(value)
+	res := make([]byte, (l+syscall.RTA_ALIGNTO-1)&^(syscall.RTA_ALIGNTO-1))
+	native.PutUint16(res[0:2], uint16(l))
+	native.PutUint16(res[2:4], typ)
+	copy(res[syscall.SizeofRtAttr:], value)
+	return res
+}
+
+// Decode the number of an attribute, whatever its size.
+func number(b []byte) uint32 {
+	switch len(b) {
+	case 1:
+		return uint32(b[0])
+	case 2:
+		return uint32(native.Uint16(b))
+	case 4:
+		return native.Uint32(b)
+	}
+	return 0
+}
+
+// Decode a string attribute, which ends with a null byte.
+func str(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
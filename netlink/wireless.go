@@ -0,0 +1,188 @@
+package netlink
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Generic netlink controller, which resolves the names of families.
+const (
+	genlHeader           = 4
+	genlIDCtrl           = 0x10
+	ctrlCmdGetFamily     = 3
+	ctrlAttrFamilyID     = 1
+	ctrlAttrFamilyName   = 2
+	ctrlAttrMcastGroups  = 7
+	ctrlAttrMcastGrpName = 1
+	ctrlAttrMcastGrpID   = 2
+)
+
+// Commands and attributes of nl80211.
+const (
+	nl80211CmdGetInterface = 5
+	nl80211CmdGetStation   = 17
+	nl80211AttrIfindex     = 3
+	nl80211AttrIfname      = 4
+	nl80211AttrStaInfo     = 21
+	nl80211AttrSSID        = 52
+	nl80211StaInfoSignal   = 7
+)
+
+// Multicast groups of nl80211 announcing connections and new interfaces. Scans
+// are left out since they happen all the time.
+var nl80211Groups = []string{"mlme", "config"}
+
+// ErrNoWireless is returned on machines without wireless drivers.
+var ErrNoWireless = errors.New("nl80211 not available")
+
+// Interface is a wireless interface. SSID is empty while disconnected, and
+// Signal is the signal of the access point in dBm.
+type Interface struct {
+	Index  int
+	Name   string
+	SSID   string
+	Signal int
+}
+
+// A family is a resolved generic netlink family.
+type family struct {
+	id     uint16
+	groups map[string]uint32
+}
+
+// Encode a generic netlink request.
+func genl(cmd uint8, attrs ...[]byte) []byte {
+	res := []byte{cmd, 1, 0, 0}
+	for _, a := range attrs {
+		res = append(res, a...)
+	}
+	return res
+}
+
+// Resolve nl80211 along with its multicast groups.
+func resolve(sock *socket) (family, error) {
+	msgs, err := sock.query(genlIDCtrl, 0, genl(ctrlCmdGetFamily, attr(ctrlAttrFamilyName, []byte("nl80211\x00"))))
+	switch {
+	case errors.Is(err, syscall.ENOENT):
+		return family{}, ErrNoWireless
+	case err != nil:
+		return family{}, err
+	case len(msgs) != 1 || len(msgs[0].Data) < genlHeader:
+		return family{}, fmt.Errorf("netlink: %w", syscall.EINVAL)
+	}
+
+	a := attrs(msgs[0].Data[genlHeader:])
+	f := family{id: uint16(number(a[ctrlAttrFamilyID])), groups: make(map[string]uint32)}
+	for _, g := range attrs(a[ctrlAttrMcastGroups]) {
+		group := attrs(g)
+		f.groups[str(group[ctrlAttrMcastGrpName])] = number(group[ctrlAttrMcastGrpID])
+	}
+
+	return f, nil
+}
+
+// Open a socket listening to the connections of wireless interfaces.
+func listen80211() (*socket, error) {
+	sock, err := dial(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := resolve(sock)
+	if err != nil {
+		_ = sock.close()
+		return nil, err
+	}
+
+	for _, name := range nl80211Groups {
+		id, ok := f.groups[name]
+		if !ok {
+			continue
+		}
+		if err := sock.join(id); err != nil {
+			_ = sock.close()
+			return nil, fmt.Errorf("netlink: join %s: %w", name, err)
+		}
+	}
+
+	return sock, nil
+}
+
+// Decode the event announced by an nl80211 message. Control messages are not
+// events.
+func wirelessEvent(m syscall.NetlinkMessage) (Event, bool) {
+	if m.Header.Type < syscall.NLMSG_MIN_TYPE || len(m.Data) < genlHeader {
+		return Event{}, false
+	}
+	a := attrs(m.Data[genlHeader:])
+	return Event{Wireless, int(number(a[nl80211AttrIfindex]))}, true
+}
+
+// Interfaces returns the wireless interfaces of the machine along with the
+// network they are connected to.
+func Interfaces() ([]Interface, error) {
+	sock, err := dial(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.close()
+
+	f, err := resolve(sock)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := sock.query(f.id, syscall.NLM_F_DUMP, genl(nl80211CmdGetInterface))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Interface, 0, len(msgs))
+	for _, m := range msgs {
+		if len(m.Data) < genlHeader {
+			continue
+		}
+		a := attrs(m.Data[genlHeader:])
+		// Devices without a network interface, like P2P ones, have no name.
+		name, ok := a[nl80211AttrIfname]
+		if !ok {
+			continue
+		}
+		i := Interface{
+			Index: int(number(a[nl80211AttrIfindex])),
+			Name:  str(name),
+			SSID:  string(a[nl80211AttrSSID]),
+		}
+		if i.SSID != "" {
+			i.Signal = signal(sock, f, i.Index)
+		}
+		res = append(res, i)
+	}
+
+	return res, nil
+}
+
+// Read the signal of the access point an interface is connected to, or zero if
+// unknown.
+func signal(sock *socket, f family, index int) int {
+	idx := make([]byte, 4)
+	native.PutUint32(idx, uint32(index))
+
+	msgs, err := sock.query(f.id, syscall.NLM_F_DUMP, genl(nl80211CmdGetStation, attr(nl80211AttrIfindex, idx)))
+	if err != nil {
+		return 0
+	}
+
+	for _, m := range msgs {
+		if len(m.Data) < genlHeader {
+			continue
+		}
+		info := attrs(attrs(m.Data[genlHeader:])[nl80211AttrStaInfo])
+		if s := info[nl80211StaInfoSignal]; len(s) == 1 {
+			return int(int8(s[0]))
+		}
+	}
+
+	return 0
+}
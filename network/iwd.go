@@ -0,0 +1,126 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"openbar/dbus"
+	"sort"
+)
+
+const iwdService = "net.connman.iwd"
+
+// Interfaces of iwd objects.
+const (
+	iwdStation = "net.connman.iwd.Station"
+	iwdDevice  = "net.connman.iwd.Device"
+	iwdNetwork = "net.connman.iwd.Network"
+	objects    = "org.freedesktop.DBus.ObjectManager"
+)
+
+type iwd struct {
+	bus *dbus.Bus
+}
+
+// IWD returns a backend reading iwd on the given bus. Since iwd only manages
+// wireless devices, the connectivity is full as soon as a station is connected
+// and none otherwise, and there are never VPNs.
+func IWD(bus *dbus.Bus) Backend {
+	return iwd{bus}
+}
+
+// State implements Backend for iwd.
+func (d iwd) State() (State, error) {
+	res, err := d.bus.Call(iwdService, "/", objects, "GetManagedObjects")
+	if err != nil {
+		return State{}, err
+	}
+	if len(res) != 1 {
+		return State{}, fmt.Errorf("%w: GetManagedObjects returned %d values", dbus.ErrMessage, len(res))
+	}
+
+	tree := managed(res[0])
+
+	// Objects are sorted so that devices always come in the same order.
+	paths := make([]string, 0, len(tree))
+	for path := range tree {
+		paths = append(paths, string(path))
+	}
+	sort.Strings(paths)
+
+	s := State{Connectivity: None}
+	for _, p := range paths {
+		path := dbus.ObjectPath(p)
+		station, ok := tree[path][iwdStation]
+		if !ok || station["State"] != "connected" {
+			continue
+		}
+
+		network, _ := station["ConnectedNetwork"].(dbus.ObjectPath)
+		w := Wifi{}
+		w.Interface, _ = tree[path][iwdDevice]["Name"].(string)
+		w.SSID, _ = tree[network][iwdNetwork]["Name"].(string)
+		w.Strength = d.strength(path, network)
+
+		s.Connectivity = Full
+		s.Wifi = append(s.Wifi, w)
+	}
+
+	return s, nil
+}
+
+// Read the signal of the network a station is connected to. It is only given
+// along with the other networks in range, in hundredths of dBm.
+func (d iwd) strength(station, network dbus.ObjectPath) int {
+	res, err := d.bus.Call(iwdService, station, iwdStation, "GetOrderedNetworks")
+	if err != nil || len(res) != 1 {
+		return 0
+	}
+	networks, _ := res[0].([]interface{})
+	for _, n := range networks {
+		fields, _ := n.([]interface{})
+		if len(fields) != 2 || fields[0] != network {
+			continue
+		}
+		if signal, ok := fields[1].(int16); ok {
+			return quality(int(signal) / 100)
+		}
+	}
+	return 0
+}
+
+// Convert the reply of GetManagedObjects to properties by interface by object,
+// without variants.
+func managed(v interface{}) map[dbus.ObjectPath]map[string]map[string]interface{} {
+	res := make(map[dbus.ObjectPath]map[string]map[string]interface{})
+	tree, _ := v.(map[interface{}]interface{})
+	for k, v := range tree {
+		path, ok := k.(dbus.ObjectPath)
+		if !ok {
+			continue
+		}
+		ifaces, _ := v.(map[string]interface{})
+		res[path] = make(map[string]map[string]interface{}, len(ifaces))
+		for name, v := range ifaces {
+			props, _ := v.(map[string]interface{})
+			res[path][name] = make(map[string]interface{}, len(props))
+			for prop, v := range props {
+				if v, ok := v.(dbus.Variant); ok {
+					res[path][name][prop] = v.Value
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Notify implements Backend for iwd. Objects report their changes, while
+// devices and networks coming and going are announced by the object manager.
+func (d iwd) Notify(ctx context.Context, changed func()) error {
+	fn := func(dbus.Signal) { changed() }
+
+	go func() {
+		_ = d.bus.Watch(ctx, dbus.Match{Sender: iwdService, Path: "/", Interface: objects}, fn)
+	}()
+
+	return d.bus.Watch(ctx, dbus.Match{Sender: iwdService, PathNamespace: "/net/connman/iwd"}, fn)
+}
@@ -0,0 +1,60 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"openbar/netlink"
+)
+
+type kernel struct {
+	sub *netlink.Subscriber
+}
+
+// Netlink returns a backend asking the kernel directly, for machines managed by
+// neither NetworkManager nor iwd. The connectivity is full as soon as there is
+// a default route and none otherwise, and there are never VPNs.
+func Netlink(sub *netlink.Subscriber) Backend {
+	return kernel{sub}
+}
+
+// State implements Backend for kernel. Machines without wireless drivers have
+// no wireless networks.
+func (k kernel) State() (State, error) {
+	routes, err := netlink.DefaultRoutes()
+	if err != nil {
+		return State{}, err
+	}
+
+	s := State{Connectivity: None}
+	if len(routes) > 0 {
+		s.Connectivity = Full
+	}
+
+	ifaces, err := netlink.Interfaces()
+	switch {
+	case errors.Is(err, netlink.ErrNoWireless):
+		return s, nil
+	case err != nil:
+		return State{}, err
+	}
+
+	for _, i := range ifaces {
+		if i.SSID != "" {
+			s.Wifi = append(s.Wifi, Wifi{i.Name, i.SSID, quality(i.Signal)})
+		}
+	}
+
+	return s, nil
+}
+
+// Notify implements Backend for kernel. Wireless events are missed on machines
+// without wireless drivers, where there is nothing to miss.
+func (k kernel) Notify(ctx context.Context, changed func()) error {
+	fn := func(netlink.Event) { changed() }
+
+	go func() {
+		_ = k.sub.Subscribe(ctx, netlink.Wireless, fn)
+	}()
+
+	return k.sub.Subscribe(ctx, netlink.Link|netlink.Address|netlink.Route, fn)
+}
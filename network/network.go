@@ -0,0 +1,113 @@
+// Package network reads the state of network connections from NetworkManager
+// or iwd over D-Bus, or from the kernel over netlink: whether the machine is
+// online, the wireless networks it is connected to and its VPNs. Modules share
+// the connection to the system bus and the netlink sockets, and are told when
+// anything changes instead of polling sysfs.
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openbar/dbus"
+	"openbar/netlink"
+)
+
+// Connectivity tells how far the machine can reach.
+type Connectivity int
+
+// Connectivity levels, in the order of NetworkManager.
+const (
+	Unknown Connectivity = iota
+	None
+	Portal
+	Limited
+	Full
+)
+
+// Names of the connectivity levels.
+var levels = []string{"unknown", "none", "portal", "limited", "full"}
+
+// String implements fmt.Stringer for Connectivity.
+func (c Connectivity) String() string {
+	if c >= 0 && int(c) < len(levels) {
+		return levels[c]
+	}
+	return levels[Unknown]
+}
+
+// Wifi is a wireless network the machine is connected to.
+type Wifi struct {
+	Interface string
+	SSID      string
+	// Strength is the quality of the signal, in percent.
+	Strength int
+}
+
+// VPN is an active virtual private network. Connections still being
+// established are not connected yet.
+type VPN struct {
+	Name      string
+	Connected bool
+}
+
+// State is the state of the network at some point.
+type State struct {
+	Connectivity Connectivity
+	Wifi         []Wifi
+	VPNs         []VPN
+}
+
+// Backend is a network daemon.
+type Backend interface {
+	// State returns the current state of the network.
+	State() (State, error)
+	// Notify calls changed each time the state may have changed, until the
+	// context is done.
+	Notify(ctx context.Context, changed func()) error
+}
+
+// ErrBackend is returned for unknown backends.
+var ErrBackend = errors.New("unknown backend")
+
+// Backends by configuration name.
+var backends = map[string]Backend{
+	"networkmanager": NetworkManager(dbus.System()),
+	"iwd":            IWD(dbus.System()),
+	"netlink":        Netlink(netlink.Shared()),
+}
+
+// Lookup returns the backend with the given name, networkmanager, iwd or
+// netlink. They use the system bus or the netlink sockets shared by all
+// modules.
+func Lookup(name string) (Backend, error) {
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBackend, name)
+	}
+	return b, nil
+}
+
+// Decode an SSID, which is an array of bytes.
+func ssid(v interface{}) string {
+	raw, _ := v.([]interface{})
+	b := make([]byte, 0, len(raw))
+	for _, c := range raw {
+		if c, ok := c.(byte); ok {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// Convert a signal in dBm to a quality percentage, like NetworkManager does.
+func quality(dbm int) int {
+	switch {
+	case dbm <= -100:
+		return 0
+	case dbm >= -50:
+		return 100
+	default:
+		return 2 * (dbm + 100)
+	}
+}
@@ -0,0 +1,44 @@
+package network_test
+
+import (
+	"errors"
+	"fmt"
+	"openbar/network"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "networkmanager", err: nil},
+		{name: "iwd", err: nil},
+		{name: "netlink", err: nil},
+		{name: "connman", err: network.ErrBackend},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			b, err := network.Lookup(test.name)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("want: %v, got: %v", test.err, err)
+			}
+			if err == nil && b == nil {
+				t.Error("want: backend, got: nil")
+			}
+		})
+	}
+}
+
+func TestConnectivity(t *testing.T) {
+	for c, want := range map[network.Connectivity]string{
+		network.Full:            "full",
+		network.None:            "none",
+		network.Connectivity(9): "unknown",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("want: %s, got: %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"context"
+	"openbar/dbus"
+)
+
+const (
+	nmService = "org.freedesktop.NetworkManager"
+	nmRoot    = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+	nmIface   = "org.freedesktop.NetworkManager"
+)
+
+// Interfaces of NetworkManager objects.
+const (
+	nmActive   = "org.freedesktop.NetworkManager.Connection.Active"
+	nmDevice   = "org.freedesktop.NetworkManager.Device"
+	nmWireless = "org.freedesktop.NetworkManager.Device.Wireless"
+	nmAP       = "org.freedesktop.NetworkManager.AccessPoint"
+)
+
+// Active connections are activated once established.
+const nmActivated = 2
+
+type networkManager struct {
+	bus *dbus.Bus
+}
+
+// NetworkManager returns a backend reading NetworkManager on the given bus.
+func NetworkManager(bus *dbus.Bus) Backend {
+	return networkManager{bus}
+}
+
+// State implements Backend for networkManager.
+func (nm networkManager) State() (State, error) {
+	props, err := nm.bus.GetAll(nmService, nmRoot, nmIface)
+	if err != nil {
+		return State{}, err
+	}
+
+	var s State
+	if c, ok := props["Connectivity"].(uint32); ok {
+		s.Connectivity = Connectivity(c)
+	}
+
+	paths, _ := props["ActiveConnections"].([]interface{})
+	for _, p := range paths {
+		path, ok := p.(dbus.ObjectPath)
+		if !ok {
+			continue
+		}
+
+		// Connections may go away while they are listed.
+		active, err := nm.bus.GetAll(nmService, path, nmActive)
+		if err != nil {
+			continue
+		}
+
+		kind, _ := active["Type"].(string)
+		vpn, _ := active["Vpn"].(bool)
+		state, _ := active["State"].(uint32)
+
+		switch {
+		case vpn || kind == "wireguard":
+			name, _ := active["Id"].(string)
+			s.VPNs = append(s.VPNs, VPN{name, state == nmActivated})
+		case kind == "802-11-wireless" && state == nmActivated:
+			devices, _ := active["Devices"].([]interface{})
+			for _, d := range devices {
+				if device, ok := d.(dbus.ObjectPath); ok {
+					if w, err := nm.wifi(device); err == nil {
+						s.Wifi = append(s.Wifi, w)
+					}
+				}
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Read the access point a wireless device is connected to.
+func (nm networkManager) wifi(device dbus.ObjectPath) (Wifi, error) {
+	iface, err := nm.bus.Get(nmService, device, nmDevice, "Interface")
+	if err != nil {
+		return Wifi{}, err
+	}
+
+	ap, err := nm.bus.Get(nmService, device, nmWireless, "ActiveAccessPoint")
+	if err != nil {
+		return Wifi{}, err
+	}
+
+	path, _ := ap.(dbus.ObjectPath)
+	props, err := nm.bus.GetAll(nmService, path, nmAP)
+	if err != nil {
+		return Wifi{}, err
+	}
+
+	w := Wifi{SSID: ssid(props["Ssid"])}
+	w.Interface, _ = iface.(string)
+	if strength, ok := props["Strength"].(byte); ok {
+		w.Strength = int(strength)
+	}
+
+	return w, nil
+}
+
+// Notify implements Backend for networkManager. Every object of NetworkManager
+// reports its changes, access points included.
+func (nm networkManager) Notify(ctx context.Context, changed func()) error {
+	return nm.bus.Watch(ctx, dbus.Match{Sender: nmService, PathNamespace: nmRoot}, func(dbus.Signal) {
+		changed()
+	})
+}
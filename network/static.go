@@ -0,0 +1,18 @@
+package network
+
+import "context"
+
+// Static is a backend in a fixed state, like a fake one in tests. Its state
+// never changes.
+type Static State
+
+// State implements Backend.
+func (s Static) State() (State, error) {
+	return State(s), nil
+}
+
+// Notify implements Backend: it waits for the context to be done.
+func (s Static) Notify(ctx context.Context, _ func()) error {
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,101 @@
+package openbar
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Once runs every module a single time, prints the resulting bar and returns,
+// which helps trying a configuration or using the bar from scripts. Without
+// backend, the bar is printed to the output as a single line of JSON: the
+// body of the protocol, without header. Modules sleeping outside of their
+// active hours are left empty instead of being waited for.
+func Once(ctx context.Context, opts ...Option) error {
+	cfg := &config{header: defaultHeader}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	out := cfg.backend
+	if out == nil {
+		out = line{cfg.out}
+	}
+
+	now := time.Now()
+	left := make(map[int]bool, len(cfg.cells))
+	for i, c := range cfg.cells {
+		if len(c.windows) == 0 || active(c.windows, now) {
+			left[i] = true
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(left) == 0 {
+		cancel()
+	}
+
+	// The bar stops as soon as every module returned, then its last frame is
+	// the one printed. Hooks run from the loop of the bar, one at a time.
+	var frame []Block
+	err := Run(
+		ctx,
+		append(
+			opts,
+			WithBackend(capture{&frame}),
+			WithJitter(0),
+			WithUpdateHook(func(s Status) {
+				delete(left, s.Index)
+				if len(left) == 0 {
+					cancel()
+				}
+			}),
+		)...,
+	)
+	if err != nil {
+		return err
+	}
+
+	if frame == nil {
+		frame = []Block{}
+	}
+
+	if err := out.Start(cfg.header); err != nil {
+		return err
+	}
+
+	return out.Frame(frame)
+}
+
+// A backend keeping the last frame instead of printing it.
+type capture struct {
+	last *[]Block
+}
+
+// Start implements Backend. There is nothing to keep.
+func (c capture) Start(Header) error {
+	return nil
+}
+
+// Frame implements Backend.
+func (c capture) Frame(b []Block) error {
+	*c.last = append((*c.last)[:0], b...)
+	return nil
+}
+
+// The default backend of a single run prints the frame as a line of its own.
+type line struct {
+	w io.Writer
+}
+
+// Start implements Backend. The header is left out.
+func (l line) Start(Header) error {
+	return nil
+}
+
+// Frame implements Backend.
+func (l line) Frame(b []Block) error {
+	return write(l.w, b, 0x0A)
+}
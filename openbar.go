@@ -3,13 +3,20 @@
 package openbar
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
 	"io"
 	"log"
 	"math/rand"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -30,10 +37,73 @@ var defaultHeader = Header{
 	StopSignal:  int(syscall.SIGSTOP),
 }
 
-// Block is one entry of the bar body according to sway-protocol(7).
-// Only the required field is implemented.
+// Protocol is the bar the status is written for. Swaybar and i3bar speak the
+// same protocol, with the same header and clicks, and only differ by the stop
+// signal they are best given.
+type Protocol int
+
+const (
+	// Sway speaks swaybar-protocol(7). This is the default.
+	Sway Protocol = iota
+	// I3 advertises SIGTSTP as stop signal instead of SIGSTOP: i3bar sends it
+	// whenever the bar is hidden in hide mode, and modules are better paused
+	// than frozen.
+	I3
+)
+
+// Trigger is what caused a module to be refreshed outside of its schedule.
+type Trigger int
+
+const (
+	// Broadcast is a refresh of all modules with SIGUSR1.
+	Broadcast Trigger = iota
+	// Single is a refresh of one module with its own signal.
+	Single
+	// Remote is a refresh requested through a Control.
+	Remote
+)
+
+// Feedback is what a block shows until a triggered refresh completes.
+type Feedback int
+
+const (
+	// Keep leaves the previous value in place.
+	Keep Feedback = iota
+	// Placeholder replaces the value with a placeholder text.
+	Placeholder
+	// Spinner replaces the value with the busy animation.
+	Spinner
+)
+
+// Broadcasts can take a few seconds because of jitter so they are the only ones
+// giving visual feedback by default.
+var defaultFeedback = [3]Feedback{
+	Broadcast: Placeholder,
+	Single:    Keep,
+	Remote:    Keep,
+}
+
+// Block is one entry of the bar body according to swaybar-protocol(7). Fields
+// where zero is meaningful, like a border of zero pixels, are pointers so that
+// unset fields are left to the bar defaults.
 type Block struct {
-	FullText string `json:"full_text"`
+	FullText            string `json:"full_text"`
+	ShortText           string `json:"short_text,omitempty"`
+	Color               string `json:"color,omitempty"`
+	Background          string `json:"background,omitempty"`
+	Border              string `json:"border,omitempty"`
+	BorderTop           *int   `json:"border_top,omitempty"`
+	BorderRight         *int   `json:"border_right,omitempty"`
+	BorderBottom        *int   `json:"border_bottom,omitempty"`
+	BorderLeft          *int   `json:"border_left,omitempty"`
+	MinWidth            *Width `json:"min_width,omitempty"`
+	Align               string `json:"align,omitempty"`
+	Name                string `json:"name,omitempty"`
+	Instance            string `json:"instance,omitempty"`
+	Urgent              bool   `json:"urgent,omitempty"`
+	Separator           *bool  `json:"separator,omitempty"`
+	SeparatorBlockWidth *int   `json:"separator_block_width,omitempty"`
+	Markup              string `json:"markup,omitempty"`
 }
 
 // Module is a bar module that emits the content of a block.
@@ -41,6 +111,36 @@ type Module interface {
 	FullText() (string, error)
 }
 
+// Notifier is implemented by modules that know when their value changes, for
+// instance by listening to system events. Notify blocks until the context is
+// done and calls changed each time the module must be refreshed, on top of its
+// regular schedule.
+type Notifier interface {
+	Notify(ctx context.Context, changed func()) error
+}
+
+// NotifierFunc is a function for the single-method interface Notifier.
+type NotifierFunc func(ctx context.Context, changed func()) error
+
+// Notify implements Notifier for NotifierFunc.
+func (f NotifierFunc) Notify(ctx context.Context, changed func()) error {
+	return f(ctx, changed)
+}
+
+// ShortTexter is implemented by modules having a shorter version of their
+// text, which the bar displays when it runs out of space. ShortText is called
+// after each successful run and describes the value FullText just returned.
+type ShortTexter interface {
+	ShortText() string
+}
+
+// Idler is implemented by manual modules too costly to run for the initial
+// paint, like a bandwidth test. The bar shows their idle text instead, until
+// their signal is first received.
+type Idler interface {
+	IdleText() string
+}
+
 // ModuleFunc is a function for the single-method interface Module.
 type ModuleFunc func() (string, error)
 
@@ -49,64 +149,677 @@ func (f ModuleFunc) FullText() (string, error) {
 	return f()
 }
 
-// Run starts emitting the JSON infinite array with the given configuration.
-func Run(ctx context.Context, opts ...Option) error {
-	cfg := new(config)
+// ContextModule is implemented by modules able to give up on a run, for
+// instance because they wait for a process or the network. The bar then calls
+// FullTextContext instead of FullText, with a context done once the bar shuts
+// down or the run lasted longer than its timeout, see Timeout.
+type ContextModule interface {
+	FullTextContext(ctx context.Context) (string, error)
+}
+
+// ContextModuleFunc is a function for the single-method interface
+// ContextModule. It is a Module too, running with a context never done.
+type ContextModuleFunc func(ctx context.Context) (string, error)
+
+// FullText implements Module for ContextModuleFunc.
+func (f ContextModuleFunc) FullText() (string, error) {
+	return f(context.Background())
+}
+
+// FullTextContext implements ContextModule for ContextModuleFunc.
+func (f ContextModuleFunc) FullTextContext(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// Backend prints the bar for a particular status consumer.
+type Backend interface {
+	// Start is called once before any frame is printed.
+	Start(h Header) error
+	// Frame prints the current content of the bar.
+	Frame(b []Block) error
+}
+
+// The default backend emits the JSON infinite array to a writer.
+type stream struct {
+	w io.Writer
+}
+
+// Start prints the header and opens the infinite array.
+func (s stream) Start(h Header) error {
+	return write(s.w, h, 0x0A, 0x5B)
+}
+
+// Frame prints one element of the infinite array.
+func (s stream) Frame(b []Block) error {
+	return write(s.w, b, 0x2C)
+}
+
+// Plain renders the bar as a single line of text, skipping empty blocks. Pango
+// markup is removed.
+func Plain(b []Block, sep string) string {
+	parts := make([]string, 0, len(b))
+	for _, block := range b {
+		text := block.FullText
+		if block.Markup == Pango {
+			text = stripMarkup(text)
+		}
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// Pango is the markup of blocks whose text is Pango markup.
+const Pango = "pango"
+
+// Remove the tags of Pango markup and unescape its entities.
+func stripMarkup(s string) string {
+	var sb strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '<':
+			depth++
+		case r == '>' && depth > 0:
+			depth--
+		case depth == 0:
+			sb.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(sb.String())
+}
+
+// Run starts emitting the bar with the given configuration. Unless another
+// backend is configured, this is the JSON infinite array of sway-protocol(7).
+func Run(ctx context.Context, opts ...Option) (err error) {
+	cfg := &config{
+		header:      defaultHeader,
+		fps:         defaultFPS,
+		lowSlots:    lowSlots,
+		feedback:    defaultFeedback,
+		spinner:     DefaultSpinner,
+		drain:       defaultDrain,
+		lowPower:    defaultLowPower,
+		toggle:      defaultToggle,
+		scroll:      defaultScroll,
+		placeholder: defaultPlaceholder,
+	}
 
 	// Parse configuration options.
 	for _, opt := range opts {
 		opt(cfg)
 	}
 
+	if cfg.lowSlots < 1 {
+		cfg.lowSlots = lowSlots
+	}
+	if cfg.lowPower.Factor < 2 {
+		cfg.lowPower.Factor = defaultLowPower.Factor
+	}
+	if cfg.lowPower.Indicator == "" {
+		cfg.lowPower.Indicator = defaultLowPower.Indicator
+	}
+	if cfg.toggle.Indicator == "" {
+		cfg.toggle.Indicator = defaultToggle.Indicator
+	}
+	cfg.scroll = cfg.scroll.normalize()
+
+	cfg.signals()
+	if cfg.header.Version < 1 {
+		cfg.header.Version = defaultHeader.Version
+	}
+
+	// Reject invalid settings before anything is printed. Modules without an
+	// identifier are identified by their position.
+	if cfg.invalid != nil {
+		return cfg.invalid
+	}
+	taken := make(map[string]int, len(cfg.cells))
+	for i, c := range cfg.cells {
+		if err := c.validate(cfg.header); err != nil {
+			return fmt.Errorf("module %d: %w", i, err)
+		}
+		if c.id == "" {
+			c.id = strconv.Itoa(i)
+			cfg.cells[i].id = c.id
+		}
+		if j, ok := taken[c.id]; ok {
+			return fmt.Errorf("module %d: %w: %s is taken by module %d", i, ErrID, c.id, j)
+		}
+		taken[c.id] = i
+		// Workers need to know whether modules print markup to format them,
+		// and what to show when they fail.
+		cfg.cells[i].markup = c.markup || cfg.markup
+		if c.onError == nil {
+			cfg.cells[i].onError = &cfg.onError
+		}
+		if sig, ok := cfg.groups[c.group]; ok && c.group != "" {
+			cfg.cells[i].signals = append(c.signals, sig)
+		}
+	}
+
+	if cfg.backend == nil {
+		cfg.backend = stream{cfg.out}
+	}
+
+	// Leave a trace of what happened if the bar dies.
+	crash := newCrashRecorder(cfg.crash, cfg.cells)
+	defer crash.guard()
+	defer func() {
+		if err != nil {
+			debug(crash.dump(fmt.Sprintf("error: %v", err)))
+		}
+	}()
+
 	// If we can't print headers, exit early to avoid having already started
-	// multiple goroutines that will leak.
-	if err := write(cfg.out, defaultHeader, 0x0A, 0x5B); err != nil {
-		return err
+	// multiple goroutines that will leak. A resumed bar continues the output of
+	// its predecessor, which already printed them.
+	if !cfg.resumed {
+		if err := cfg.backend.Start(cfg.header); err != nil {
+			return err
+		}
 	}
 
+	for _, f := range cfg.hooks.start {
+		f(cfg.header)
+	}
+
+	defer func() {
+		for _, f := range cfg.hooks.shutdown {
+			f(err)
+		}
+	}()
+
 	n := len(cfg.cells)
 
 	// Create the scheduler and wait for all workers to terminate before
 	// closing the output channel.
-	scheduler := bootstrap(n)
+	scheduler := bootstrap(n, cfg.feedback)
+	scheduler.factor = cfg.lowPower.Factor
+	scheduler.slots = make(chan struct{}, cfg.lowSlots)
+	scheduler.indicator = cfg.toggle.Indicator
+	for i, c := range cfg.cells {
+		scheduler.placeholders[i] = cfg.placeholder
+		if c.placeholder != nil {
+			scheduler.placeholders[i] = *c.placeholder
+		}
+	}
+	defer close(scheduler.quit)
+
+	// Blocks inherited from a previous instance are kept until modules return
+	// instead of flashing placeholders.
+	b := make([]Block, n)
+	for i, c := range cfg.cells {
+		b[i] = c.style
+		b[i].FullText = ""
+		c.separator.apply(&b[i], true)
+		cfg.separator.apply(&b[i], false)
+		if c.markup || c.format != nil {
+			b[i].Markup = Pango
+		}
+	}
+	for i, c := range cfg.cells {
+		if prev, ok := cfg.resume[c.id]; ok {
+			b[i].FullText, b[i].ShortText = prev.FullText, prev.ShortText
+			b[i].Urgent = prev.Urgent
+			scheduler.resumed[i] = true
+		}
+	}
+
+	// Blocks are named after their module, or its identifier when it has no
+	// name, and their instance is the identifier so that blocks of the same
+	// module are told apart by clicks and by tools reading the bar. Blocks of
+	// anonymous modules stay bare unless clicks need them.
+	for i, c := range cfg.cells {
+		if c.name == "" && cfg.clicks == nil {
+			continue
+		}
+		if b[i].Name == "" {
+			b[i].Name = c.name
+		}
+		if b[i].Name == "" {
+			b[i].Name = c.id
+		}
+		if b[i].Instance == "" {
+			b[i].Instance = c.id
+		}
+	}
+
+	// Handlers run one at a time, then the module is refreshed. The toggle
+	// gesture disables modules instead of reaching them, and clicks needing
+	// confirmation only reach them the second time. Scrolls are turned into
+	// steps here so that every adjustable module accelerates alike.
+	if cfg.clicks != nil {
+		route := newRouter(b)
+		pending := make(confirmations)
+		scrolls := make(streaks)
+		go func() {
+			defer crash.guard()
+			debug(listen(cfg.clicks, route, func(idx int, e Click) {
+				if g := cfg.toggle.Gesture; g != nil && g.matches(e) {
+					request(scheduler.switches[idx], flip)
+					return
+				}
+				for _, f := range cfg.hooks.click {
+					f(idx, e)
+				}
+				c := cfg.cells[idx]
+				prompt := func(text string) { scheduler.prompt(idx, text) }
+				if !pending.confirm(idx, e, c.confirmation(e), prompt, scheduler.changed(idx)) {
+					return
+				}
+				handled, err := c.click(e, scrolls.delta(idx, e, c.scrolling(cfg.scroll)))
+				if err != nil {
+					debug(clickError(idx, c, err))
+				}
+				if handled {
+					scheduler.changed(idx)()
+				}
+			}))
+		}()
+	}
+
+	// Modules watching for changes refresh as soon as they are told to, and so
+	// do modules configured to refresh on the changes of something else. Some
+	// clean up once the bar stops, so they are waited for like workers.
+	watchers := make([][]Notifier, len(cfg.cells))
+	for i, c := range cfg.cells {
+		notifiers := c.notifiers
+		if n, ok := c.source().(Notifier); ok {
+			notifiers = append([]Notifier{n}, notifiers...)
+		}
+		if c.push != nil {
+			notifiers = append([]Notifier{c.push}, notifiers...)
+		}
+		watchers[i] = notifiers
+		scheduler.wg.Add(len(notifiers))
+	}
 
 	// Start one worker per module. This allows us to have variable refresh rate
 	// for each and every one of them.
 	for i, c := range cfg.cells {
-		go scheduler.update(ctx, i, c.module, c.interval, jitter(cfg.jitter))
+		go func(i int, c cell) {
+			defer crash.guard()
+			scheduler.update(ctx, i, c, jitter(cfg.jitter))
+		}(i, c)
 	}
 
-	b := make([]Block, n)
+	for i, notifiers := range watchers {
+		for _, n := range notifiers {
+			go func(i int, n Notifier) {
+				defer scheduler.wg.Done()
+				defer crash.guard()
+				debug(n.Notify(ctx, scheduler.changed(i)))
+			}(i, n)
+		}
+	}
+
+	var modes <-chan PowerMode
+	if cfg.control != nil {
+		modes = cfg.control.init(cfg.cells, scheduler.triggers, scheduler.switches)
+	}
+
+	// The battery level is only watched when low-power mode may engage by itself.
+	below := make(chan bool)
+	if lp := cfg.lowPower; lp.Below > 0 && lp.Level != nil {
+		go func() {
+			defer crash.guard()
+			lp.watch(ctx, below)
+		}()
+	}
+
+	// The bar sends the stop signal when it is hidden and the continue signal
+	// when it shows again. SIGSTOP can't be caught, but the bar is then frozen
+	// anyway and continuing refreshes modules all the same.
+	visibility := make(chan os.Signal, 1)
+	stop := syscall.Signal(cfg.header.StopSignal)
+	if catchable := visibilitySignals(cfg.header); len(catchable) > 0 {
+		signal.Notify(visibility, catchable...)
+		defer signal.Stop(visibility)
+	}
+
+	// Human-readable frames are only printed when requested.
+	var dbg *framePrinter
+	if cfg.debug != nil {
+		dbg = &framePrinter{cfg.debug, make([]string, n), make([]error, n)}
+		for i, c := range cfg.cells {
+			dbg.names[i] = c.name
+		}
+	}
+
+	// While energy is saved, an indicator block is appended to the bar.
+	low := false
+	indicator := Block{FullText: cfg.lowPower.Indicator, Name: "lowpower"}
+
+	// Frames identical to the last one printed are skipped, since modules with
+	// short intervals mostly print the same value again.
+	var last []Block
+
+	// Modules emitting several blocks take the place of their own once they
+	// returned them.
+	nested := make([][]Block, n)
+
+	// The last result of each module without error, for those keeping their
+	// value when they fail.
+	good := make([]*result, n)
+
+	draw := func() {
+		body, owners := expand(b, nested)
+		frame := cfg.theme.apply(body)
+		if low {
+			frame = append(frame, cfg.theme.apply([]Block{indicator})...)
+			owners = append(owners, -1)
+		}
+		if last != nil && reflect.DeepEqual(frame, last) {
+			return
+		}
+		last = append(last[:0], frame...)
+		debug(cfg.backend.Frame(frame))
+		if dbg != nil {
+			debug(dbg.print(frame, owners))
+		}
+		for _, f := range cfg.hooks.frame {
+			f(frame)
+		}
+		crash.printed(frame)
+	}
+
+	// Frames are throttled so that fast modules can't flood the bar.
+	frames := newThrottle(cfg.fps, cfg.coalesce)
+	defer frames.stop()
+
+	delays := make([]time.Duration, n)
+	for i, c := range cfg.cells {
+		delays[i] = c.spin
+	}
+
+	anim := newAnimation(cfg.spinner, delays)
+	defer anim.close()
+
+	styles, base := make([]Emphasis, n), make([]Block, n)
+	copy(base, b)
+	for i, c := range cfg.cells {
+		styles[i] = c.emphasis
+		if styles[i].Duration <= 0 {
+			styles[i] = cfg.highlight
+		}
+	}
+
+	// Block modules restyle their block with each value, and emphasis expires
+	// back to their latest style.
+	current := make([]Block, n)
+	copy(current, base)
+
+	emph := newHighlight(styles, current)
+	defer emph.close()
+
+	sizes, ids, shown := make([]int, n), make([]string, n), make([]trendMode, n)
+	for i, c := range cfg.cells {
+		sizes[i], ids[i], shown[i] = c.sparkline, c.id, c.trend
+	}
+	trend := newTrends(shown)
+
+	// Graphs pick up where they were left when the bar stopped.
+	spark := newSparklines(sizes)
+	if cfg.history != "" {
+		debug(spark.load(cfg.history, ids))
+		defer func() { debug(spark.save(cfg.history, ids)) }()
+	}
 
 	// Each time a screen update is required, mutate the bar body and print the new
 	// output inside the infinite JSON array. No error handling here because we
 	// don't want to prevent other modules from working.
-	for res := range scheduler.out {
-		b[res.idx].FullText = res.out
-		debug(res.err)
-		debug(write(cfg.out, b, 0x2C))
+	// When the context is done, workers get some time to finish what they are
+	// doing. Past the deadline, the last frame is flushed regardless.
+	var deadline <-chan time.Time
+	quit := ctx.Done()
+
+	// Frames wait while the bar is hidden since it doesn't read them.
+	hidden := false
+
+	// Low-power mode is engaged when forced or when the battery runs low. Busy
+	// animations stop and blocks keep their value until modules return.
+	mode, drained := LowPowerAuto, false
+	power := func() {
+		now := mode == LowPowerOn || (mode == LowPowerAuto && drained)
+		if now == low {
+			return
+		}
+		low, emph.quiet = now, now
+		scheduler.lowPower(low)
+		if low {
+			for i := range cfg.cells {
+				anim.stop(i)
+			}
+		}
+		if cfg.control != nil {
+			cfg.control.lowPower(low)
+		}
+		frames.dirty = true
 	}
 
-	return nil
+	for {
+		select {
+		case <-quit:
+			quit = nil
+			t := time.NewTimer(cfg.drain)
+			defer t.Stop()
+			deadline = t.C
+			continue
+		case <-deadline:
+			if frames.dirty {
+				draw()
+			}
+			return nil
+		case res, ok := <-scheduler.out:
+			if !ok {
+				// Flush the last deferred frame before leaving.
+				if frames.dirty {
+					draw()
+				}
+				return nil
+			}
+			if res.kind == done && res.err == nil {
+				kept := res
+				good[res.idx] = &kept
+			}
+			res = cfg.cells[res.idx].keep(res, good[res.idx])
+			switch {
+			case low && (res.kind == running || res.kind == spinning):
+				continue
+			case res.kind == running:
+				anim.start(res.idx, false)
+				continue
+			case res.kind == spinning:
+				anim.start(res.idx, true)
+				b[res.idx].FullText, b[res.idx].ShortText = anim.current(), ""
+				b[res.idx].Urgent = base[res.idx].Urgent
+				nested[res.idx] = nil
+			default:
+				anim.stop(res.idx)
+				b[res.idx].FullText, b[res.idx].ShortText = res.out, ""
+				b[res.idx].Urgent = base[res.idx].Urgent || res.urgent
+				if res.style != nil {
+					current[res.idx] = overlay(base[res.idx], *res.style)
+					text := b[res.idx]
+					b[res.idx] = current[res.idx]
+					b[res.idx].FullText, b[res.idx].Urgent = text.FullText, text.Urgent
+				}
+				if res.kind == done {
+					text := bar(res.out, res.value, cfg.cells[res.idx].bar)
+					text = trend.add(res.idx, text, res.value)
+					b[res.idx].FullText = spark.add(res.idx, text, res.value)
+					b[res.idx].ShortText = res.short
+					if res.short == "" {
+						b[res.idx].ShortText = base[res.idx].ShortText
+					}
+					emph.change(res.idx, res.out, b)
+				}
+				nested[res.idx] = nil
+				if res.kind == done && res.blocks != nil {
+					nested[res.idx] = nest(b[res.idx], res.blocks)
+				}
+			}
+			if logged(res.err) {
+				debug(res.err)
+			}
+			if res.err != nil && cfg.errors != nil {
+				report(cfg.errors, ModuleError{res.idx, cfg.cells[res.idx].name, time.Now(), res.err})
+			}
+			if dbg != nil && res.kind == done {
+				dbg.update(res.idx, res.err)
+			}
+			if cfg.control != nil {
+				cfg.control.update(res)
+			}
+			if res.kind == done {
+				s := status(res, cfg.cells[res.idx])
+				for _, f := range cfg.hooks.update {
+					f(s)
+				}
+				crash.update(s)
+			}
+			frames.dirty = true
+		case <-frames.C:
+			frames.armed = false
+		case <-anim.C:
+			if !anim.step(b) {
+				continue
+			}
+			frames.dirty = true
+		case <-emph.C:
+			if !emph.expire(b) {
+				continue
+			}
+			frames.dirty = true
+		case mode = <-modes:
+			power()
+		case drained = <-below:
+			power()
+		case sig := <-visibility:
+			hidden = sig == stop
+			scheduler.pause(hidden)
+		}
+
+		if !hidden && frames.ready() {
+			draw()
+		}
+	}
+}
+
+// A throttle limits the rate at which frames are printed. When a frame is
+// requested too soon after the previous one, or before the updates following
+// the first one had a chance to come in, it is deferred until the throttle's
+// channel fires.
+type throttle struct {
+	C        <-chan time.Time
+	dirty    bool
+	armed    bool
+	min      time.Duration
+	coalesce time.Duration
+	last     time.Time
+	since    time.Time
+	timer    *time.Timer
+}
+
+// Create a throttle allowing the given number of frames per second, and
+// holding each frame for the given window. Zero means no limit and no window.
+func newThrottle(fps int, coalesce time.Duration) *throttle {
+	t := &throttle{timer: time.NewTimer(time.Hour), coalesce: coalesce}
+	t.timer.Stop()
+	t.C = t.timer.C
+	if fps > 0 {
+		t.min = time.Second / time.Duration(fps)
+	}
+	return t
+}
+
+// Tell if a pending frame can be printed right now. If it is too early, arm the
+// timer so that the frame is printed as soon as allowed.
+func (t *throttle) ready() bool {
+	if !t.dirty {
+		return false
+	}
+
+	if t.since.IsZero() {
+		t.since = time.Now()
+	}
+
+	wait := t.min - time.Since(t.last)
+	if held := t.coalesce - time.Since(t.since); held > wait {
+		wait = held
+	}
+
+	if wait > 0 {
+		if !t.armed {
+			t.timer.Reset(wait)
+			t.armed = true
+		}
+		return false
+	}
+
+	t.dirty, t.last, t.since = false, time.Now(), time.Time{}
+
+	return true
+}
+
+// Release the timer.
+func (t *throttle) stop() {
+	t.timer.Stop()
 }
 
 // A scheduler is responsible for coordination of the asynchronous updates for each
 // module. Each time an update occurs, it is written to the scheduler's output channel.
 type scheduler struct {
-	wg  *sync.WaitGroup
-	out chan result
+	wg        *sync.WaitGroup
+	quit      chan struct{}
+	out       chan result
+	triggers  []chan bool
+	events    []chan struct{}
+	feedback  [3]Feedback
+	resumed   []bool
+	power     []chan bool
+	factor    int
+	switches  []chan switching
+	indicator string
+	pauses    []chan bool
+	// The text of each block while a refresh is pending, none meaning the
+	// block keeps its value.
+	placeholders []string
+	// Slots low-priority modules wait for, see LowPriority.
+	slots chan struct{}
 }
 
 // The result of a module update holding the module index and data to be
-// printed as well as any processing error.
+// printed as well as any processing error. Block modules also give the style
+// of their block.
 type result struct {
-	idx int
-	out string
-	err error
+	idx    int
+	out    string
+	err    error
+	kind   kind
+	short  string
+	urgent bool
+	style  *Block
+	value  *Value
+	blocks []Block
 }
 
-// Create a scheduler of the given size.
-func bootstrap(size int) scheduler {
+// The kind of a result tells how the module is progressing.
+type kind int
+
+const (
+	done     kind = iota // The module returned.
+	pending              // A refresh is pending, show the placeholder.
+	spinning             // A refresh is pending, show the spinner.
+	running              // The module started executing.
+	disabled             // The module was disabled, show the indicator.
+)
+
+// Create a scheduler of the given size. Each module also gets a channel to be
+// refreshed remotely: the value tells whether all modules are refreshed at once.
+func bootstrap(size int, feedback [3]Feedback) scheduler {
 	wg := new(sync.WaitGroup)
 	wg.Add(size)
 
@@ -117,7 +830,56 @@ func bootstrap(size int) scheduler {
 		wg.Wait()
 	}()
 
-	return scheduler{wg, out}
+	triggers := make([]chan bool, size)
+	for i := range triggers {
+		triggers[i] = make(chan bool, 1)
+	}
+
+	events := make([]chan struct{}, size)
+	for i := range events {
+		events[i] = make(chan struct{}, 1)
+	}
+
+	power := make([]chan bool, size)
+	for i := range power {
+		power[i] = make(chan bool, 1)
+	}
+
+	switches := make([]chan switching, size)
+	for i := range switches {
+		switches[i] = make(chan switching, 1)
+	}
+
+	pauses := make([]chan bool, size)
+	for i := range pauses {
+		pauses[i] = make(chan bool, 1)
+	}
+
+	return scheduler{
+		wg:           wg,
+		quit:         make(chan struct{}),
+		out:          out,
+		triggers:     triggers,
+		events:       events,
+		feedback:     feedback,
+		resumed:      make([]bool, size),
+		power:        power,
+		factor:       1,
+		switches:     switches,
+		pauses:       pauses,
+		placeholders: make([]string, size),
+	}
+}
+
+// Return a function refreshing a module when notified of a change. Changes
+// happening while a refresh is pending are merged into it.
+func (s scheduler) changed(idx int) func() {
+	return func() {
+		select {
+		case s.events[idx] <- struct{}{}:
+		default:
+		}
+	}
 }
 
 const (
@@ -126,30 +888,186 @@ const (
 	sigRtMax  = 0x40            // Maximum reload signal value for a single module.
 )
 
+// Return the signals of the header the bar may catch.
+func visibilitySignals(h Header) []os.Signal {
+	res := make([]os.Signal, 0, 2)
+	if sig := syscall.Signal(h.StopSignal); sig != 0 && sig != syscall.SIGSTOP {
+		res = append(res, sig)
+	}
+	if sig := syscall.Signal(h.ContSignal); sig != 0 && sig != syscall.Signal(h.StopSignal) {
+		res = append(res, sig)
+	}
+	return res
+}
+
+// Reserved tells why a signal can't refresh a module of a bar configured with
+// the given options, if it can't: some can't be caught, others stop the bar or
+// already mean something else to it, like the signals of the header. Only the
+// options deciding the header matter.
+func Reserved(sig syscall.Signal, opts ...Option) string {
+	cfg := &config{header: defaultHeader}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.signals()
+	return reserved(sig, cfg.header)
+}
+
+// Set the signals of the header the protocol calls for. Explicit signals always
+// win over protocol defaults.
+func (cfg *config) signals() {
+	if cfg.protocol == I3 && !cfg.stop {
+		cfg.header.StopSignal = int(syscall.SIGTSTP)
+	}
+}
+
+// Tell why a signal can't refresh a module with the given header, see Reserved.
+func reserved(sig syscall.Signal, h Header) string {
+	switch sig {
+	case 0:
+		return ""
+	case syscall.SIGKILL, syscall.SIGSTOP:
+		return "can't be caught"
+	case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
+		return "stops the bar"
+	case broadcast:
+		return "refreshes every module"
+	case syscall.Signal(h.StopSignal), syscall.Signal(h.ContSignal):
+		return "hides or shows the bar"
+	}
+	if sig < 0 || sig > sigRtMax {
+		return "can't be sent"
+	}
+	return ""
+}
+
+// ReloadSignal returns the signal refreshing the module at the given index,
+// unless it was given one with ReloadOn.
+func ReloadSignal(idx int) syscall.Signal {
+	return syscall.Signal(sigRtMin + ((idx + 1) % sigRtMax))
+}
+
+// Return the signal refreshing the module at the given index, zero if none.
+func (c cell) reloadSignal(idx int) syscall.Signal {
+	if c.reload != nil {
+		return *c.reload
+	}
+	return ReloadSignal(idx)
+}
+
 // The function responsible for periodically updating cells. It performs an
 // initial execution delayed with a random jitter to spread the load upon booting
 // Sway. Then, modules are updated according to their respective intervals or when
 // a signal is received. A SIGUSR1 signal will trigger a refresh for all modules
-// whereas each module can be individually reloaded with SIGRTMIN+i.
-func (s scheduler) update(ctx context.Context, i int, m Module, d, j time.Duration) {
+// whereas each module can be individually reloaded with SIGRTMIN+i, or the
+// signal it was given. Manual modules are only painted once and then wait for
+// their own signal, and scheduled modules wait for the next time of their
+// schedule.
+func (s scheduler) update(ctx context.Context, i int, c cell, j time.Duration) {
 	defer s.wg.Done()
 
-	s.wait(i)
+	d := c.interval
+
+	// Modules with active hours sleep outside of them: their block is hidden
+	// and they don't run until their next window opens.
+	t3 := time.NewTimer(time.Hour)
+	t3.Stop()
+	defer t3.Stop()
+
+	var edges <-chan time.Time
+	asleep := false
+	if len(c.windows) > 0 {
+		now := time.Now()
+		asleep = !active(c.windows, now)
+		t3.Reset(time.Until(nextEdge(c.windows, now)))
+		edges = t3.C
+	}
+
+	// Scheduled modules run at the times of their schedule instead of ticking,
+	// and so do modules planning their next run once they planned it. Timers
+	// don't count the time spent suspended, so the clock is checked at least
+	// every minute to catch up with it.
+	t4 := time.NewTimer(time.Hour)
+	t4.Stop()
+	defer t4.Stop()
+
+	planner, _ := c.source().(NextRunner)
+	planned := false
+
+	var due <-chan time.Time
+	var at time.Time
+	if c.schedule != nil {
+		at = c.schedule.Next(time.Now())
+		t4.Reset(until(at))
+		due = t4.C
+	}
+
+	switch {
+	case asleep:
+		s.hide(i, false)
+	case !s.resumed[i]:
+		s.wait(i)
+	}
 
 	t1 := time.NewTimer(j)
 	defer t1.Stop()
 
-	// Initialize the ticker with a higher interval than the jitter timer to allow
-	// first paint to only be triggered by the timer. Then, receiving on the timer
-	// channel will reset the ticker's duration to its normal value.
-	t2 := time.NewTicker(j + 1)
+	// Keep the ticker stopped so that first paint is only triggered by the timer.
+	// Then, receiving on the timer channel will start the ticker with its normal
+	// duration. Manual modules never tick.
+	t2 := time.NewTicker(time.Hour)
+	t2.Stop()
 	defer t2.Stop()
 
-	sigc, id := make(chan os.Signal, 1), sigRtMin+((i+1)%sigRtMax)
-	signal.Notify(sigc, broadcast, syscall.Signal(id))
+	sigc := make(chan os.Signal, 1)
+	sigs := append([]os.Signal{broadcast}, c.signals...)
+	if sig := c.reloadSignal(i); sig != 0 {
+		sigs = append(sigs, sig)
+	}
+	signal.Notify(sigc, sigs...)
 	defer close(sigc)
 	defer signal.Stop(sigc)
 
+	// The interval in use and whether ticks are paused depend on the power mode,
+	// on active hours, on whether the module is disabled, on whether its next
+	// run is planned and on whether the bar is hidden. Ticks only start once
+	// the jitter timer fired.
+	cur, paused, started, off, hidden := d, false, false, false, false
+
+	// Idle manual modules don't run until they are asked to.
+	idler, _ := c.source().(Idler)
+	asked := !c.manual || idler == nil
+	rearm := func() {
+		switch {
+		case c.manual || c.schedule != nil || !started:
+		case paused || asleep || off || hidden || planned:
+			t2.Stop()
+		default:
+			t2.Reset(cur)
+		}
+	}
+
+	// Refreshes outside of the schedule are triggered for this module alone
+	// or for all of them, and tell whether the module must run.
+	trigger := func(single bool, t Trigger) bool {
+		switch {
+		case asleep || off || hidden:
+			return false
+		case single && c.manual:
+			asked = true
+			s.wait(i)
+		case single:
+			s.notify(i, t)
+		case c.manual:
+			return false
+		default:
+			s.notify(i, t)
+			time.Sleep(j)
+			rearm()
+		}
+		return true
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -163,7 +1081,8 @@ func (s scheduler) update(ctx context.Context, i int, m Module, d, j time.Durati
 		// updating exactly at the same time (and also sets the correct ticker interval
 		// which was temporarily overridden at initialization phase).
 		case <-t1.C:
-			t2.Reset(d)
+			started = true
+			rearm()
 
 		// When activating a manual refresh for all modules, spread execution with
 		// jitter and cancel upcoming ticks by resetting the timer. This avoids performing
@@ -172,31 +1091,310 @@ func (s scheduler) update(ctx context.Context, i int, m Module, d, j time.Durati
 		// simply execute as fast as possible to minimize the time to visual feedback
 		// as this feature is often used to match another action that happened in the
 		// system (ie. user changed volume, we want to update the volume cell without any
-		// other visual artifact, we don't care about doing this twice).
+		// other visual artifact, we don't care about doing this twice). What the block
+		// shows meanwhile depends on the configured feedback. Manual modules are
+		// different: they ignore broadcasts because running them is usually costly
+		// and their own signal shows the placeholder because running them is slow.
 		case sig := <-sigc:
-			if sig != broadcast {
-				break
+			t := Single
+			if sig == broadcast {
+				t = Broadcast
+			}
+			if !trigger(t == Single, t) {
+				continue
 			}
-			s.wait(i)
-			time.Sleep(j)
-			t2.Reset(d)
-		}
 
-		s.do(i, m)
-	}
-}
+		// Remote refreshes behave like signals but have their own feedback.
+		case all := <-s.triggers[i]:
+			if !trigger(!all, Remote) {
+				continue
+			}
 
-// Process module output and write the result to the output channel.
-func (s scheduler) do(idx int, m Module) {
-	out, err := m.FullText()
-	s.out <- result{idx, out, err}
-}
+		// Notified changes are meant to be shown right away, without feedback.
+		case <-s.events[i]:
 
-const placeholder = "..."
+		// Scheduled runs are missed while the module can't run, like ticks.
+		case <-due:
+			now := time.Now()
+			if now.Before(at) {
+				t4.Reset(until(at))
+				continue
+			}
+			if c.schedule != nil {
+				at = c.schedule.Next(now)
+				t4.Reset(until(at))
+			}
 
-// Display a placeholder to inform user refresh instruction has been received.
+		// In low-power mode, intervals are lengthened and pausable modules stop
+		// ticking. Those paused until now are refreshed right away when the mode
+		// ends since their value is stale.
+		case low := <-s.power[i]:
+			stale := paused
+			cur, paused = d, false
+			if low {
+				cur, paused = d*time.Duration(s.factor), c.pausable
+			}
+			rearm()
+			if !stale || paused || !started {
+				continue
+			}
+
+		// Modules are hidden when their window closes and refreshed right away
+		// when one opens.
+		case <-edges:
+			now := time.Now()
+			t3.Reset(time.Until(nextEdge(c.windows, now)))
+			woke := asleep && active(c.windows, now)
+			if asleep = !active(c.windows, now); asleep {
+				rearm()
+				s.hide(i, off)
+			}
+			if woke && off {
+				s.off(i)
+			}
+			if !woke || !started {
+				continue
+			}
+			rearm()
+
+		// While the bar is hidden, modules don't run. Their value is likely
+		// stale once it shows again, so they are refreshed right away with
+		// some jitter since they all are at once. Stream modules only show
+		// the last value they sent, which costs nothing.
+		case hidden = <-s.pauses[i]:
+			if hidden || !started || (c.manual && c.push == nil) {
+				rearm()
+				continue
+			}
+			time.Sleep(j)
+			rearm()
+
+		// Disabled modules stop running and show the indicator, unless they
+		// sleep. They are refreshed right away once enabled again.
+		case sw := <-s.switches[i]:
+			was := off
+			if off = sw.apply(off); off == was {
+				continue
+			}
+			rearm()
+			switch {
+			case off && asleep:
+				continue
+			case off:
+				s.off(i)
+				continue
+			case !started:
+				continue
+			}
+		}
+
+		if asleep || off || hidden {
+			continue
+		}
+
+		if !asked {
+			s.prompt(i, sanitize(idler.IdleText()))
+			continue
+		}
+
+		start := time.Now()
+		err := s.do(ctx, i, c)
+		took := time.Since(start)
+
+		// Modules failing for good are disabled with their error shown, until
+		// enabled again.
+		if errors.As(err, new(FatalError)) {
+			log.Printf("module %d (%s): disabled after a fatal error", i, c.name)
+			off = true
+			rearm()
+			continue
+		}
+
+		// Runs never overlap since each module has a single worker, but ticks keep
+		// coming while a slow run goes on. Drop the one left behind rather than
+		// running again right away, and wait a full interval before the next one.
+		// Other refresh requests are queued, at most one of each kind.
+		if !c.manual && c.schedule == nil && took >= cur {
+			select {
+			case <-t2.C:
+				log.Printf("module %d (%s): skipped a run, the last one took %v with an interval of %v", i, c.name, took.Round(time.Millisecond), cur)
+			default:
+			}
+			rearm()
+		}
+
+		// Modules planning their next run stop ticking until they no longer
+		// do, and so do modules failing with an error telling when to run
+		// again. Their schedule, if any, is overridden meanwhile.
+		var next time.Time
+		if planner != nil {
+			next = planner.NextRun()
+		}
+		interval := cur
+		switch {
+		case c.manual:
+			interval = 0
+		case c.schedule != nil:
+			interval = time.Until(at)
+		}
+		var limit RateLimitError
+		if errors.As(err, &limit) && limit.Until.After(time.Now()) {
+			log.Printf("module %d (%s): rate limited until %s", i, c.name, limit.Until.Format("15:04:05"))
+		}
+		next = replan(err, next, time.Now(), interval)
+		switch {
+		case !next.IsZero():
+			at, planned, due = next, true, t4.C
+			t4.Reset(until(at))
+			rearm()
+		case planned:
+			planned = false
+			if c.schedule != nil {
+				at = c.schedule.Next(time.Now())
+				t4.Reset(until(at))
+			} else {
+				t4.Stop()
+				due = nil
+			}
+			rearm()
+		}
+	}
+}
+
+// Process module output and write the result to the output channel. Modules
+// with a spinner also report when they start. Text is sanitized first so that
+// nothing a module prints can break the protocol stream. Each run has its own
+// context, derived from the one of the bar. The error of the module, if any,
+// is returned for the worker to act upon. A module panicking fails like any
+// other instead of taking the bar down, and stays scheduled.
+func (s scheduler) do(ctx context.Context, idx int, c cell) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e := recovered(r)
+			log.Printf("module %d (%s): %v\n%s", idx, c.name, e, e.Stack)
+			err = e
+			s.send(result{idx: idx, out: c.failure("", err), err: err, kind: done})
+		}
+	}()
+	if c.spin > 0 {
+		s.send(result{idx: idx, kind: running})
+	}
+	ctx, cancel := c.deadline(ctx)
+	defer cancel()
+	run := func() (Block, error) { return c.render(ctx) }
+	var blocks []Block
+	if c.multi != nil {
+		run = c.renderMulti(&blocks)
+	}
+	if c.low {
+		render := run
+		run = func() (Block, error) { return lowPriority(s.slots, render) }
+	}
+	b, err := run()
+	b.FullText = sanitize(b.FullText)
+	if err != nil {
+		s.send(result{idx: idx, out: c.failure(b.FullText, err), err: err, kind: done})
+		return err
+	}
+	if st, ok := c.source().(ShortTexter); ok && b.ShortText == "" {
+		b.ShortText = st.ShortText()
+	}
+	b.ShortText = sanitize(b.ShortText)
+	v := c.value(b.FullText)
+	urgent := c.alert(v)
+	if c.format != nil {
+		raw := b.FullText
+		if b.FullText, err = c.format.apply(raw, c.markup); err != nil {
+			s.send(result{idx: idx, out: c.failure(raw, err), err: err, kind: done})
+			return err
+		}
+		b.ShortText = c.escape(b.ShortText)
+	}
+	res := result{
+		idx:    idx,
+		out:    b.FullText,
+		kind:   done,
+		short:  b.ShortText,
+		urgent: b.Urgent || c.urgent(v) || urgent,
+		value:  v,
+		blocks: blocks,
+	}
+	if c.block != nil {
+		res.style = &b
+	}
+	s.send(res)
+	return nil
+}
+
+// Write a result to the output channel unless Run already returned, in which
+// case nobody is listening anymore.
+func (s scheduler) send(r result) {
+	select {
+	case s.out <- r:
+	case <-s.quit:
+	}
+}
+
+const defaultPlaceholder = "..."
+
+// Show the configured feedback for a refresh caused by the given trigger.
+func (s scheduler) notify(idx int, t Trigger) {
+	switch s.feedback[t] {
+	case Keep:
+	case Placeholder:
+		s.wait(idx)
+	case Spinner:
+		s.send(result{idx: idx, kind: spinning})
+	}
+}
+
+// Empty the block of a module outside of its active hours. Disabled modules
+// stay so.
+func (s scheduler) hide(idx int, off bool) {
+	k := pending
+	if off {
+		k = disabled
+	}
+	s.send(result{idx: idx, kind: k})
+}
+
+// Show the indicator of a disabled module.
+func (s scheduler) off(idx int) {
+	s.send(result{idx: idx, out: s.indicator, kind: disabled})
+}
+
+// Tell every module whether the bar is hidden.
+func (s scheduler) pause(hidden bool) {
+	for _, c := range s.pauses {
+		select {
+		case <-c:
+		default:
+		}
+		c <- hidden
+	}
+}
+
+// Show a text in the block of a module until it is refreshed.
+func (s scheduler) prompt(idx int, text string) {
+	s.send(result{idx: idx, out: text, kind: pending})
+}
+
+// Display a placeholder to inform user refresh instruction has been received.
+// Without one, the block keeps its value.
 func (s scheduler) wait(idx int) {
-	s.out <- result{idx, placeholder, nil}
+	if s.placeholders[idx] == "" {
+		return
+	}
+	s.send(result{idx: idx, out: s.placeholders[idx], kind: pending})
+}
+
+// Return how long to wait for the given time, at most a minute.
+func until(t time.Time) time.Duration {
+	d := time.Until(t)
+	if d > time.Minute {
+		d = time.Minute
+	}
+	return d
 }
 
 var initRand sync.Once
@@ -213,6 +1411,36 @@ func jitter(max int) time.Duration {
 	return time.Duration(rand.Intn(max)) * time.Millisecond
 }
 
+// ModuleError is an error returned by a module along with where and when it
+// happened.
+type ModuleError struct {
+	Index int
+	Name  string
+	Time  time.Time
+	Err   error
+}
+
+// Error implements error.
+func (e ModuleError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("module %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the module.
+func (e ModuleError) Unwrap() error {
+	return e.Err
+}
+
+// Send an error without blocking: a slow consumer must not freeze the bar.
+func report(c chan<- ModuleError, err ModuleError) {
+	select {
+	case c <- err:
+	default:
+	}
+}
+
 // Print a log entry if there is an error.
 func debug(err error) {
 	if err != nil {
@@ -223,11 +1451,14 @@ func debug(err error) {
 // Marshal the given value to JSON, concatenate additional trailing bytes and
 // write them to the writer.
 func write(w io.Writer, v interface{}, glue ...byte) error {
-	json, err := json.Marshal(v)
-	if err != nil {
+	// Markup is written as is rather than with escaped angle brackets.
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
 		return err
 	}
-	if _, err := w.Write(append(json, glue...)); err != nil {
+	if _, err := w.Write(append(bytes.TrimSuffix(buf.Bytes(), []byte{0x0A}), glue...)); err != nil {
 		return err
 	}
 	return nil
@@ -235,20 +1466,144 @@ func write(w io.Writer, v interface{}, glue ...byte) error {
 
 // This struct holds the global configuration.
 type config struct {
-	out    io.Writer
-	jitter int
-	cells  []cell
+	feedback  [3]Feedback
+	spinner   []string
+	out       io.Writer
+	debug     io.Writer
+	backend   Backend
+	control   *Control
+	errors    chan<- ModuleError
+	hooks     hooks
+	header    Header
+	protocol  Protocol
+	stop      bool
+	jitter    int
+	fps       int
+	lowSlots  int
+	coalesce  time.Duration
+	drain     time.Duration
+	crash     string
+	highlight Emphasis
+	theme     Theme
+	separator Separator
+	history   string
+	clicks    io.Reader
+	resume    map[string]Block
+	resumed   bool
+	lowPower  LowPower
+	toggle    Toggle
+	scroll    Scroll
+	onError   ErrorPolicy
+	markup    bool
+	// Placeholder is shown while refreshes are pending, see WithPlaceholder.
+	placeholder string
+	// Signals refreshing every module of a group, see WithGroupSignal.
+	groups map[string]syscall.Signal
+	// Error of an option Run must reject, like an unknown trigger.
+	invalid error
+	cells   []cell
+}
+
+// Functions called at various stages of the bar lifecycle.
+type hooks struct {
+	start    []func(Header)
+	frame    []func([]Block)
+	update   []func(Status)
+	click    []func(int, Click)
+	shutdown []func(error)
 }
 
 // A cell is a module and the interval at which it must be updated.
 type cell struct {
-	module   Module
-	interval time.Duration
+	module    Module
+	block     BlockModule
+	multi     MultiModule
+	push      *pushed
+	name      string
+	interval  time.Duration
+	timeout   time.Duration
+	subsecond bool
+	manual    bool
+	spin      time.Duration
+	low       bool
+	emphasis  Emphasis
+	style     Block
+	id        string
+	sparkline int
+	bar       int
+	trend     trendMode
+	alerts    []*alerting
+	format    *Format
+	onClick   func(Click) error
+	pausable  bool
+	markup    bool
+	windows   []Window
+	schedule  *Schedule
+	group     string
+	// Nil means the signal given by the position of the module, zero none.
+	reload *syscall.Signal
+	// Signals refreshing the module on top of its own, like the one of its
+	// group.
+	signals    []os.Signal
+	thresholds []threshold
+	notifiers  []Notifier
+	separator  Separator
+	confirm    *Confirmation
+	scroll     *Scroll
+	onError    *ErrorPolicy
+	// Nil means the placeholder of the bar.
+	placeholder *string
+}
+
+const (
+	minInterval  = time.Second           // Shortest interval without opt-in.
+	minFast      = 50 * time.Millisecond // Shortest interval with opt-in.
+	defaultFPS   = 20                    // Maximum frames per second by default.
+	defaultDrain = 5 * time.Second       // Time given to modules to finish on shutdown.
+)
+
+// ErrID is returned when two modules have the same identifier.
+var ErrID = errors.New("duplicate module identifier")
+
+// ErrInterval is returned when a module has an interval Run can't honor.
+var ErrInterval = errors.New("invalid interval")
+
+// ErrTrigger is returned when feedback is configured for an unknown trigger.
+var ErrTrigger = errors.New("unknown trigger")
+
+// ErrSignal is returned when a module is given a signal it can't be refreshed
+// with.
+var ErrSignal = errors.New("invalid signal")
+
+// Check the cell settings are sane.
+func (c cell) validate(h Header) error {
+	if c.reload != nil {
+		if why := reserved(*c.reload, h); why != "" {
+			return fmt.Errorf("%w: %d %s", ErrSignal, *c.reload, why)
+		}
+	}
+	switch {
+	case c.schedule != nil && c.schedule.Next(time.Now()).IsZero():
+		return fmt.Errorf("%w: never happens", ErrSchedule)
+	case c.manual || c.schedule != nil:
+		return nil
+	case c.interval <= 0:
+		return fmt.Errorf("%w: %v must be positive", ErrInterval, c.interval)
+	case c.interval < minFast:
+		return fmt.Errorf("%w: %v is shorter than %v", ErrInterval, c.interval, minFast)
+	case c.interval < minInterval && !c.subsecond:
+		return fmt.Errorf("%w: %v requires sub-second opt-in", ErrInterval, c.interval)
+	default:
+		return nil
+	}
 }
 
 // Option is an application setting.
 type Option func(*config)
 
+// ModuleOption is a setting specific to a single module.
+type ModuleOption func(*cell)
+
 // WithOutput configures the output for the JSON data.
 func WithOutput(w io.Writer) Option {
 	return func(cfg *config) {
@@ -256,6 +1611,236 @@ func WithOutput(w io.Writer) Option {
 	}
 }
 
+// WithBackend configures a backend replacing the JSON output, for instance to
+// feed a bar that does not speak the protocol.
+func WithBackend(b Backend) Option {
+	return func(cfg *config) {
+		cfg.backend = b
+	}
+}
+
+// WithDebugFrames configures an additional output where human-readable frames
+// are written alongside the regular output, to help diagnose layout issues.
+func WithDebugFrames(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.debug = w
+	}
+}
+
+// WithControl configures a control giving access to the running bar.
+func WithControl(c *Control) Option {
+	return func(cfg *config) {
+		cfg.control = c
+	}
+}
+
+// WithFeedback configures what blocks show while a refresh caused by the given
+// trigger is pending. Unknown triggers make Run fail with ErrTrigger.
+func WithFeedback(t Trigger, f Feedback) Option {
+	return func(cfg *config) {
+		if t < 0 || int(t) >= len(cfg.feedback) {
+			cfg.invalid = fmt.Errorf("%w: %d", ErrTrigger, t)
+			return
+		}
+		cfg.feedback[t] = f
+	}
+}
+
+// WithSpinner configures the frames of the busy animation.
+func WithSpinner(frames ...string) Option {
+	return func(cfg *config) {
+		if len(frames) > 0 {
+			cfg.spinner = frames
+		}
+	}
+}
+
+// WithErrorChannel configures a channel receiving module errors, so that an
+// embedding application can react to them. Errors are dropped rather than
+// blocking the bar when the channel is full.
+func WithErrorChannel(c chan<- ModuleError) Option {
+	return func(cfg *config) {
+		cfg.errors = c
+	}
+}
+
+// WithStartHook registers a function called once the bar has started, right
+// after the header was printed. Hooks run on the main loop and must be fast.
+func WithStartHook(f func(Header)) Option {
+	return func(cfg *config) {
+		cfg.hooks.start = append(cfg.hooks.start, f)
+	}
+}
+
+// WithFrameHook registers a function called after each frame is printed. The
+// blocks must not be retained after the function returns.
+func WithFrameHook(f func([]Block)) Option {
+	return func(cfg *config) {
+		cfg.hooks.frame = append(cfg.hooks.frame, f)
+	}
+}
+
+// WithUpdateHook registers a function called each time a module returns.
+func WithUpdateHook(f func(Status)) Option {
+	return func(cfg *config) {
+		cfg.hooks.update = append(cfg.hooks.update, f)
+	}
+}
+
+// WithClickHook registers a function called with each click on the block of
+// a module, along with the index of the module, before the module gets it.
+// Hooks run on the goroutine reading clicks and must be fast.
+func WithClickHook(f func(int, Click)) Option {
+	return func(cfg *config) {
+		cfg.hooks.click = append(cfg.hooks.click, f)
+	}
+}
+
+// WithShutdownHook registers a function called when the bar stops, with the
+// error Run is about to return.
+func WithShutdownHook(f func(error)) Option {
+	return func(cfg *config) {
+		cfg.hooks.shutdown = append(cfg.hooks.shutdown, f)
+	}
+}
+
+// WithDrain configures how long Run waits for modules still executing, and for
+// notifiers cleaning up, once the context is done. Past this deadline, Run
+// returns without their results.
+func WithDrain(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.drain = d
+	}
+}
+
+// WithCrashDir configures a directory where a crash file is written if the bar
+// panics or fails. It holds the last frame, the state of modules and the stack
+// traces of all goroutines, which helps reporting bugs happening hours into a
+// session.
+func WithCrashDir(dir string) Option {
+	return func(cfg *config) {
+		cfg.crash = dir
+	}
+}
+
+// WithHighlight configures the style every block temporarily takes when its
+// value changes, so that updates stand out in busy bars. Modules with their own
+// emphasis keep it.
+func WithHighlight(e Emphasis) Option {
+	return func(cfg *config) {
+		cfg.highlight = e
+	}
+}
+
+// WithTheme configures the palette, separators and padding of every block.
+// Colors naming a color of the theme are resolved when blocks are printed.
+func WithTheme(t Theme) Option {
+	return func(cfg *config) {
+		cfg.theme = t
+	}
+}
+
+// WithSeparator configures the separator of every block, for instance to hide
+// the lines of sway or to adjust the gaps between blocks. Blocks styled with
+// their own separator keep it, and it takes precedence over the theme.
+func WithSeparator(s Separator) Option {
+	return func(cfg *config) {
+		cfg.separator = s
+	}
+}
+
+// WithHeader replaces the header printed before the bar, for instance to
+// disable the stop and continue signals at once. Its signals count as explicit
+// ones and a zero version means the default one. Options given afterwards, like
+// WithClickEvents, change it further.
+func WithHeader(h Header) Option {
+	return func(cfg *config) {
+		cfg.header = h
+		cfg.stop = true
+	}
+}
+
+// WithClickEvents asks the bar to send clicks, which are read from the given
+// reader, usually the standard input. Clicks go to modules implementing
+// ClickHandler or configured with OnClick.
+func WithClickEvents(r io.Reader) Option {
+	return func(cfg *config) {
+		cfg.clicks = r
+		cfg.header.ClickEvents = true
+	}
+}
+
+// WithHistoryFile configures a file where the values plotted by sparklines
+// are kept when the bar stops, so that graphs survive restarts.
+func WithHistoryFile(path string) Option {
+	return func(cfg *config) {
+		cfg.history = path
+	}
+}
+
+// WithResume configures the bar to continue the output of a previous instance,
+// for instance after re-executing itself: the header is not printed again so
+// the consumer sees a single stream. Blocks start from those of the previous
+// frame, given by module identifier, and modules missing from it start with
+// the placeholder.
+func WithResume(b map[string]Block) Option {
+	return func(cfg *config) {
+		cfg.resume = b
+		cfg.resumed = true
+	}
+}
+
+// WithLowPower configures how the bar saves energy, either when the battery
+// runs low or when asked through a Control.
+func WithLowPower(lp LowPower) Option {
+	return func(cfg *config) {
+		cfg.lowPower = lp
+	}
+}
+
+// WithToggle configures how modules are disabled from the bar, either with a
+// gesture or when asked through a Control.
+func WithToggle(t Toggle) Option {
+	return func(cfg *config) {
+		cfg.toggle = t
+	}
+}
+
+// WithScroll configures how scrolls change the value of adjustable modules,
+// see Adjuster. Modules can override it with Scrolling.
+func WithScroll(s Scroll) Option {
+	return func(cfg *config) {
+		cfg.scroll = s
+	}
+}
+
+// WithErrorPolicy configures what the blocks of failing modules show, unless
+// they have a policy of their own.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(cfg *config) {
+		cfg.onError = p
+	}
+}
+
+// WithPlaceholder configures the text blocks show while a refresh is pending,
+// "..." by default, like an icon. An empty text disables the placeholder:
+// blocks keep their value until the refresh completes, and are empty until
+// their first run.
+func WithPlaceholder(text string) Option {
+	return func(cfg *config) {
+		cfg.placeholder = text
+	}
+}
+
+// WithMarkup makes the output of every module Pango markup, so that parts of
+// a block can be styled with tags like <span>. Modules must then escape the
+// text they don't mean as markup.
+func WithMarkup() Option {
+	return func(cfg *config) {
+		cfg.markup = true
+	}
+}
+
 // WithError configures the output for the log entries.
 func WithError(w io.Writer) Option {
 	return func(cfg *config) {
@@ -265,15 +1850,81 @@ func WithError(w io.Writer) Option {
 
 // WithModule configures a module. Modules are printed in the order they are
 // passed through this function.
-func WithModule(module Module, interval time.Duration) Option {
+func WithModule(module Module, interval time.Duration, opts ...ModuleOption) Option {
+	return func(cfg *config) {
+		c := cell{module: module, interval: interval}
+		for _, opt := range opts {
+			opt(&c)
+		}
+		cfg.cells = append(cfg.cells, c)
+	}
+}
+
+// WithBlockModule configures a module emitting whole blocks. Modules of both
+// kinds can be mixed and take the same options.
+func WithBlockModule(module BlockModule, interval time.Duration, opts ...ModuleOption) Option {
 	return func(cfg *config) {
-		cfg.cells = append(cfg.cells, cell{module, interval})
+		c := cell{block: module, interval: interval}
+		for _, opt := range opts {
+			opt(&c)
+		}
+		cfg.cells = append(cfg.cells, c)
+	}
+}
+
+// WithMultiModule configures a module emitting several blocks. It takes the
+// same options as other modules, and its blocks are styled after the block
+// they configure.
+func WithMultiModule(module MultiModule, interval time.Duration, opts ...ModuleOption) Option {
+	return func(cfg *config) {
+		c := cell{multi: module, interval: interval}
+		for _, opt := range opts {
+			opt(&c)
+		}
+		cfg.cells = append(cfg.cells, c)
 	}
 }
 
 // WithModuleFunc configures a module from an anonymous function.
-func WithModuleFunc(f func() (string, error), interval time.Duration) Option {
-	return WithModule(ModuleFunc(f), interval)
+func WithModuleFunc(f func() (string, error), interval time.Duration, opts ...ModuleOption) Option {
+	return WithModule(ModuleFunc(f), interval, opts...)
+}
+
+// WithMaxFPS configures the maximum number of frames printed per second.
+// Updates happening faster are merged into the next frame. Zero disables the
+// limit.
+func WithMaxFPS(fps int) Option {
+	return func(cfg *config) {
+		cfg.fps = fps
+	}
+}
+
+// WithLowPrioritySlots configures how many low-priority modules may run at
+// once, one by default, so that a slow one doesn't hold back all the others.
+// See LowPriority.
+func WithLowPrioritySlots(n int) Option {
+	return func(cfg *config) {
+		cfg.lowSlots = n
+	}
+}
+
+// WithCoalesce holds frames for the given window once something changed, so
+// that updates coming in bursts, like those following SIGUSR1, are printed
+// together rather than one after the other. Zero, the default, prints frames
+// as soon as the frame rate allows.
+func WithCoalesce(window time.Duration) Option {
+	return func(cfg *config) {
+		cfg.coalesce = window
+	}
+}
+
+// SubSecond allows a module to be updated more than once per second, for
+// instance for a stopwatch or an audio meter. Intervals are still bounded to
+// avoid overloading the bar.
+func SubSecond() ModuleOption {
+	return func(c *cell) {
+		c.subsecond = true
+	}
 }
 
 // WithJitter configures the maximum time (in ms) over which modules will delay
@@ -283,3 +1934,286 @@ func WithJitter(jitter int) Option {
 		cfg.jitter = jitter
 	}
 }
+
+// WithStopSignal configures the signal the bar should send to pause updates
+// when it is hidden. Use 0 to disable it, for instance when multiple bars would
+// otherwise conflict.
+func WithStopSignal(sig syscall.Signal) Option {
+	return func(cfg *config) {
+		cfg.header.StopSignal = int(sig)
+		cfg.stop = true
+	}
+}
+
+// WithGroupSignal configures a signal refreshing every module of a group at
+// once, like a single reload of each of them. See Group.
+func WithGroupSignal(group string, sig syscall.Signal) Option {
+	return func(cfg *config) {
+		if cfg.groups == nil {
+			cfg.groups = make(map[string]syscall.Signal)
+		}
+		cfg.groups[group] = sig
+	}
+}
+
+// WithContSignal configures the signal the bar should send to resume updates
+// when it is shown again. Use 0 to disable it.
+func WithContSignal(sig syscall.Signal) Option {
+	return func(cfg *config) {
+		cfg.header.ContSignal = int(sig)
+	}
+}
+
+// WithProtocol configures the bar the status is written for, which decides
+// the default stop signal. See I3.
+func WithProtocol(p Protocol) Option {
+	return func(cfg *config) {
+		cfg.protocol = p
+	}
+}
+
+// Manual makes a module run only when its own signal is received, after an
+// initial paint, which Idler modules skip. Its interval is ignored. This is meant for costly on-demand
+// actions, which is why broadcast reloads don't affect it.
+func Manual() ModuleOption {
+	return func(c *cell) {
+		c.manual = true
+	}
+}
+
+// Spin animates a spinner in the block while the module is executing for longer
+// than the given delay, which is nicer than a frozen value for slow modules.
+func Spin(after time.Duration) ModuleOption {
+	return func(c *cell) {
+		c.spin = after
+	}
+}
+
+// LowPriority runs a module with the lowest CPU and IO priority, one such module
+// at a time unless WithLowPrioritySlots allows more. This is meant for heavy
+// built-in modules that shouldn't compete with foreground work. Commands
+// spawned by the module inherit the priority.
+func LowPriority() ModuleOption {
+	return func(c *cell) {
+		c.low = true
+	}
+}
+
+// Emphasize gives the block of a module the given style for a while each time
+// its value changes.
+func Emphasize(e Emphasis) ModuleOption {
+	return func(c *cell) {
+		c.emphasis = e
+	}
+}
+
+// Style gives the block of a module the attributes of the given block, except
+// its text which comes from the module.
+func Style(b Block) ModuleOption {
+	return func(c *cell) {
+		c.style = b
+	}
+}
+
+// Separated gives the block of a module its own separator, over the one of its
+// style.
+func Separated(s Separator) ModuleOption {
+	return func(c *cell) {
+		c.separator = s
+	}
+}
+
+// Sparkline plots the last values of a module after its text. See Valuer.
+func Sparkline(size int) ModuleOption {
+	return func(c *cell) {
+		c.sparkline = size
+	}
+}
+
+// ProgressBar draws the value of a module after its text as a bar of the given
+// width, for modules whose value has bounds. See Valuer.
+func ProgressBar(width int) ModuleOption {
+	return func(c *cell) {
+		c.bar = width
+	}
+}
+
+// ShowTrend appends an arrow after the text of a module telling where its value
+// is heading, like "21°C ↑", and with delta, how much it changed since the
+// previous run, like "21°C ↑1.5". See Valuer.
+func ShowTrend(delta bool) ModuleOption {
+	return func(c *cell) {
+		c.trend = trendArrow
+		if delta {
+			c.trend = trendDelta
+		}
+	}
+}
+
+// OnClick handles clicks on the block of a module in place of the module. The
+// handler returns ErrNotHandled for clicks the module handles itself.
+func OnClick(f func(Click) error) ModuleOption {
+	return func(c *cell) {
+		c.onClick = f
+	}
+}
+
+// Identified gives a module an identifier that stays the same when modules are
+// reordered, used to address it and to keep its state across restarts. By
+// default, modules are identified by their position.
+func Identified(id string) ModuleOption {
+	return func(c *cell) {
+		c.id = id
+	}
+}
+
+// Confirm makes clicks on a module take effect only when repeated in time, for
+// actions that are hard to undo. Clicks with the toggle gesture are not
+// confirmed.
+func Confirm(conf Confirmation) ModuleOption {
+	return func(c *cell) {
+		if conf.Within <= 0 {
+			conf.Within = defaultConfirmation.Within
+		}
+		if conf.Prompt == "" {
+			conf.Prompt = defaultConfirmation.Prompt
+		}
+		c.confirm = &conf
+	}
+}
+
+// Scrolling configures how scrolls change the value of a module implementing
+// Adjuster, in place of the setting given to WithScroll.
+func Scrolling(s Scroll) ModuleOption {
+	return func(c *cell) {
+		s = s.normalize()
+		c.scroll = &s
+	}
+}
+
+// PauseOnLowPower stops refreshing a module while the bar saves energy, for
+// instance because it uses the network. It is refreshed when energy is no
+// longer saved.
+func PauseOnLowPower() ModuleOption {
+	return func(c *cell) {
+		c.pausable = true
+	}
+}
+
+// ActiveDuring restricts a module to the given windows, for instance office
+// hours. Outside of them, its block is hidden and it doesn't run.
+func ActiveDuring(windows ...Window) ModuleOption {
+	return func(c *cell) {
+		c.windows = append(c.windows, windows...)
+	}
+}
+
+// OnSchedule makes a module run at the times of a schedule, like every day at
+// 07:00, instead of at intervals. Its interval is ignored, and it still runs
+// once when the bar starts and whenever it is reloaded.
+func OnSchedule(s Schedule) ModuleOption {
+	return func(c *cell) {
+		c.schedule = &s
+	}
+}
+
+// UrgentBelow marks the block of a module urgent while its value is below the
+// given limit, like a battery level. See Valuer.
+func UrgentBelow(limit float64) ModuleOption {
+	return func(c *cell) {
+		c.thresholds = append(c.thresholds, threshold{false, limit})
+	}
+}
+
+// UrgentAbove marks the block of a module urgent while its value is above the
+// given limit, like a temperature. See Valuer.
+func UrgentAbove(limit float64) ModuleOption {
+	return func(c *cell) {
+		c.thresholds = append(c.thresholds, threshold{true, limit})
+	}
+}
+
+// Alerting acts when a rule on the value of a module starts to hold, by
+// marking its block urgent or calling Fire. Rules are checked after each run.
+func Alerting(a Alert) ModuleOption {
+	return func(c *cell) {
+		c.alerts = append(c.alerts, &alerting{Alert: a})
+	}
+}
+
+// RefreshOn refreshes a module each time the given notifier tells, on top of
+// its interval, for instance when a file it reads changes. Unlike modules
+// implementing Notifier, the module doesn't have to know.
+func RefreshOn(n Notifier) ModuleOption {
+	return func(c *cell) {
+		c.notifiers = append(c.notifiers, n)
+	}
+}
+
+// Formatted rewrites the text of a module with a format, which makes its block
+// Pango markup. See Format.
+func Formatted(f *Format) ModuleOption {
+	return func(c *cell) {
+		c.format = f
+	}
+}
+
+// Timeout gives up on runs of a module lasting longer than the given duration
+// by cancelling their context. Only modules implementing ContextModule notice.
+func Timeout(d time.Duration) ModuleOption {
+	return func(c *cell) {
+		c.timeout = d
+	}
+}
+
+// OnError configures what the block of a module shows when it fails. See
+// WithErrorPolicy.
+func OnError(p ErrorPolicy) ModuleOption {
+	return func(c *cell) {
+		c.onError = &p
+	}
+}
+
+// PlaceholderText configures the placeholder of a module, an empty text
+// disabling it. See WithPlaceholder.
+func PlaceholderText(text string) ModuleOption {
+	return func(c *cell) {
+		c.placeholder = &text
+	}
+}
+
+// Markup makes the output of a module Pango markup. See WithMarkup.
+func Markup() ModuleOption {
+	return func(c *cell) {
+		c.markup = true
+	}
+}
+
+// Group puts a module in a group, whose modules are refreshed together by the
+// signal of the group and by Control.ReloadGroup, like network modules after
+// switching networks.
+func Group(name string) ModuleOption {
+	return func(c *cell) {
+		c.group = name
+	}
+}
+
+// ReloadOn binds a module to the given signal, which refreshes it like its
+// own, instead of the one given by its position: it then stays the same when
+// modules are reordered. Zero leaves the module without signal. Signals the
+// bar can't catch or already uses, like SIGTERM or those of the header, make
+// Run fail with ErrSignal.
+func ReloadOn(sig syscall.Signal) ModuleOption {
+	return func(c *cell) {
+		c.reload = &sig
+	}
+}
+
+// Named gives a module a name, used as the name of its block and to identify it
+// in diagnostics. Modules with the same name are told apart by the instance of
+// their block, which is their identifier.
+func Named(name string) ModuleOption {
+	return func(c *cell) {
+		c.name = name
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"openbar"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -75,3 +83,3467 @@ func TestOpenBar(t *testing.T) {
 		t.Error("invalid body")
 	}
 }
+
+func TestBlock(t *testing.T) {
+	zero, no := 0, false
+
+	tests := []struct {
+		block openbar.Block
+		want  string
+	}{
+		{
+			block: openbar.Block{FullText: "a"},
+			want:  `{"full_text":"a"}`,
+		},
+		{
+			block: openbar.Block{FullText: "a", ShortText: "b", Urgent: true, Markup: "pango"},
+			want:  `{"full_text":"a","short_text":"b","urgent":true,"markup":"pango"}`,
+		},
+		{
+			block: openbar.Block{FullText: "a", BorderTop: &zero, Separator: &no, SeparatorBlockWidth: &zero},
+			want:  `{"full_text":"a","border_top":0,"separator":false,"separator_block_width":0}`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, err := json.Marshal(test.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("want: %s, got: %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		opts     []openbar.ModuleOption
+		err      error
+	}{
+		{
+			interval: 0,
+			opts:     nil,
+			err:      openbar.ErrInterval,
+		},
+		{
+			interval: 100 * time.Millisecond,
+			opts:     nil,
+			err:      openbar.ErrInterval,
+		},
+		{
+			interval: 10 * time.Millisecond,
+			opts:     []openbar.ModuleOption{openbar.SubSecond()},
+			err:      openbar.ErrInterval,
+		},
+		{
+			interval: 100 * time.Millisecond,
+			opts:     []openbar.ModuleOption{openbar.SubSecond()},
+			err:      nil,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			module := openbar.ModuleFunc(func() (string, error) {
+				return "", nil
+			})
+
+			err := openbar.Run(
+				ctx,
+				openbar.WithOutput(io.Discard),
+				openbar.WithModule(module, test.interval, test.opts...),
+			)
+
+			if !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestUnknownTrigger(t *testing.T) {
+	for _, trigger := range []openbar.Trigger{-1, openbar.Remote + 1} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithFeedback(trigger, openbar.Spinner),
+		)
+
+		if !errors.Is(err, openbar.ErrTrigger) {
+			t.Errorf("want: %v, got: %v", openbar.ErrTrigger, err)
+		}
+	}
+}
+
+func TestReservedSignal(t *testing.T) {
+	tests := []struct {
+		sig  syscall.Signal
+		opts []openbar.Option
+		err  error
+	}{
+		{sig: syscall.SIGKILL, opts: nil, err: openbar.ErrSignal},
+		{sig: syscall.SIGTERM, opts: nil, err: openbar.ErrSignal},
+		{sig: syscall.SIGUSR1, opts: nil, err: openbar.ErrSignal},
+		{sig: syscall.SIGCONT, opts: nil, err: openbar.ErrSignal},
+		{sig: syscall.SIGTSTP, opts: []openbar.Option{openbar.WithProtocol(openbar.I3)}, err: openbar.ErrSignal},
+		{sig: syscall.Signal(70), opts: nil, err: openbar.ErrSignal},
+		{sig: syscall.SIGTSTP, opts: nil, err: nil},
+		{sig: syscall.SIGTSTP, opts: []openbar.Option{openbar.WithProtocol(openbar.I3), openbar.WithStopSignal(syscall.SIGUSR2)}, err: nil},
+		{sig: syscall.SIGUSR2, opts: nil, err: nil},
+		{sig: 0, opts: nil, err: nil},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			module := openbar.ModuleFunc(func() (string, error) {
+				return "", nil
+			})
+
+			opts := append([]openbar.Option{
+				openbar.WithOutput(io.Discard),
+				openbar.WithModule(module, time.Hour, openbar.ReloadOn(test.sig)),
+			}, test.opts...)
+
+			if err := openbar.Run(ctx, opts...); !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+
+			if why := openbar.Reserved(test.sig, test.opts...); (why != "") != (test.err != nil) {
+				t.Errorf("want: %v, got: %q", test.err, why)
+			}
+		})
+	}
+}
+
+func TestIdentified(t *testing.T) {
+	tests := []struct {
+		ids []string
+		err error
+	}{
+		{ids: []string{"", ""}, err: nil},
+		{ids: []string{"a", "b"}, err: nil},
+		{ids: []string{"a", "a"}, err: openbar.ErrID},
+		{ids: []string{"1", ""}, err: openbar.ErrID},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			opts := []openbar.Option{openbar.WithOutput(io.Discard)}
+			for _, id := range test.ids {
+				var mopts []openbar.ModuleOption
+				if id != "" {
+					mopts = append(mopts, openbar.Identified(id))
+				}
+				opts = append(opts, openbar.WithModuleFunc(func() (string, error) { return "", nil }, time.Hour, mopts...))
+			}
+
+			if err := openbar.Run(ctx, opts...); !errors.Is(err, test.err) {
+				t.Errorf("want: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSpin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdout := bytes.NewBuffer(nil)
+
+	// The module is slow until the spinner shows.
+	var once, spun sync.Once
+	finished, spinning := make(chan struct{}), make(chan struct{})
+	module := openbar.ModuleFunc(func() (string, error) {
+		defer once.Do(func() { close(finished) })
+		<-spinning
+		return "slow", nil
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := openbar.Run(
+			ctx,
+			openbar.WithOutput(stdout),
+			openbar.WithSpinner("spinning"),
+			openbar.WithModule(module, time.Hour, openbar.Spin(50*time.Millisecond)),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				if b[0].FullText == "spinning" {
+					spun.Do(func() { close(spinning) })
+				}
+			}),
+		); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	<-finished
+	cancel()
+	<-stopped
+
+	if !bytes.Contains(stdout.Bytes(), []byte(`"spinning"`)) {
+		t.Errorf("no spinner in output: %s", stdout.String())
+	}
+
+	if !bytes.Contains(stdout.Bytes(), []byte(`"slow"`)) {
+		t.Errorf("no final value in output: %s", stdout.String())
+	}
+}
+
+func TestErrorChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errc := make(chan openbar.ModuleError, 1)
+	failure := errors.New("failure")
+
+	module := openbar.ModuleFunc(func() (string, error) {
+		return "", failure
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithErrorChannel(errc),
+			openbar.WithModule(module, time.Hour, openbar.Named("failing")),
+		)
+	}()
+
+	select {
+	case err := <-errc:
+		if err.Name != "failing" || err.Index != 0 || err.Time.IsZero() {
+			t.Errorf("unexpected error: %+v", err)
+		}
+		if !errors.Is(err, failure) {
+			t.Errorf("want: %v, got: %v", failure, err.Err)
+		}
+	case <-time.After(time.Second):
+		t.Error("no error received")
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	tests := []struct {
+		global openbar.ErrorPolicy
+		policy *openbar.ErrorPolicy
+		want   string
+	}{
+		{want: "partial"},
+		{policy: &openbar.ErrorPolicy{Display: openbar.ErrorMessage}, want: "broken"},
+		{policy: &openbar.ErrorPolicy{Display: openbar.ErrorPlaceholder}, want: "⚠"},
+		{policy: &openbar.ErrorPolicy{Display: openbar.ErrorPlaceholder, Placeholder: "n/a"}, want: "n/a"},
+		{policy: &openbar.ErrorPolicy{Display: openbar.ErrorKeep}, want: "ok"},
+		{policy: &openbar.ErrorPolicy{Display: openbar.ErrorBlank}, want: ""},
+		{global: openbar.ErrorPolicy{Display: openbar.ErrorBlank}, want: ""},
+		{
+			global: openbar.ErrorPolicy{Display: openbar.ErrorBlank},
+			policy: &openbar.ErrorPolicy{Display: openbar.ErrorMessage},
+			want:   "broken",
+		},
+	}
+
+	for i, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// The module works once, then fails.
+		var runs int32
+		module := openbar.ModuleFunc(func() (string, error) {
+			if atomic.AddInt32(&runs, 1) == 1 {
+				return "ok", nil
+			}
+			return "partial", errors.New("broken")
+		})
+
+		opts := []openbar.ModuleOption{openbar.SubSecond()}
+		if test.policy != nil {
+			opts = append(opts, openbar.OnError(*test.policy))
+		}
+
+		failed := make(chan string, 10)
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			_ = openbar.Run(
+				ctx,
+				openbar.WithOutput(io.Discard),
+				openbar.WithErrorPolicy(test.global),
+				openbar.WithModule(module, 50*time.Millisecond, opts...),
+				openbar.WithUpdateHook(func(s openbar.Status) {
+					if s.Error == "" {
+						return
+					}
+					select {
+					case failed <- s.Text:
+					default:
+					}
+				}),
+			)
+		}()
+
+		select {
+		case got := <-failed:
+			if got != test.want {
+				t.Errorf("%d: want: %q, got: %q", i, test.want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%d: the module never failed", i)
+		}
+
+		cancel()
+		<-stopped
+	}
+}
+
+func TestContextModule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errc := make(chan openbar.ModuleError, 1)
+	given := make(chan error, 1)
+
+	wait := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithErrorChannel(errc),
+			openbar.WithModule(openbar.ContextModuleFunc(wait), time.Hour, openbar.Timeout(50*time.Millisecond)),
+			openbar.WithModule(openbar.ContextModuleFunc(func(ctx context.Context) (string, error) {
+				_, err := wait(ctx)
+				given <- err
+				return "", err
+			}), time.Hour),
+		)
+	}()
+
+	select {
+	case err := <-errc:
+		if err.Index != 0 || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("want: %v from module 0, got: %v from module %d", context.DeadlineExceeded, err.Err, err.Index)
+		}
+	case <-time.After(time.Second):
+		t.Error("no timeout")
+	}
+
+	// Runs still going on are cancelled along with the bar.
+	cancel()
+	select {
+	case err := <-given:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("want: %v, got: %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Error("run not cancelled on shutdown")
+	}
+	<-stopped
+}
+
+func TestHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	events := make([]string, 0)
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+
+	updated := make(chan struct{}, 1)
+
+	module := openbar.ModuleFunc(func() (string, error) {
+		return "hello", nil
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(module, time.Hour),
+			openbar.WithStartHook(func(openbar.Header) { record("start") }),
+			openbar.WithUpdateHook(func(s openbar.Status) {
+				record("update:" + s.Text)
+				updated <- struct{}{}
+			}),
+			openbar.WithShutdownHook(func(error) { record("shutdown") }),
+		)
+	}()
+
+	<-updated
+	cancel()
+	<-stopped
+
+	want := []string{"start", "update:hello", "shutdown"}
+
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("want: %v, got: %v", want, events)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	var once sync.Once
+	module := openbar.ModuleFunc(func() (string, error) {
+		once.Do(func() { close(started) })
+		<-release
+		return "", nil
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithDrain(50*time.Millisecond),
+			openbar.WithModule(module, time.Hour),
+		)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("hanging module prevented shutdown")
+	}
+}
+
+func TestLowPriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nice := make(chan string, 1)
+
+	var once sync.Once
+	module := openbar.ModuleFunc(func() (string, error) {
+		stat, err := os.ReadFile("/proc/thread-self/stat")
+		if err != nil {
+			return "", err
+		}
+		once.Do(func() { nice <- strings.Fields(string(stat))[18] })
+		return "", nil
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(module, time.Hour, openbar.LowPriority()),
+		)
+	}()
+
+	if got := <-nice; got != "19" {
+		t.Errorf("want: 19, got: %s", got)
+	}
+}
+
+func TestLowPrioritySlots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	defer close(release)
+
+	module := openbar.ModuleFunc(func() (string, error) {
+		started <- struct{}{}
+		<-release
+		return "", nil
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithLowPrioritySlots(2),
+			openbar.WithModule(module, time.Hour, openbar.LowPriority()),
+			openbar.WithModule(module, time.Hour, openbar.LowPriority()),
+		)
+	}()
+
+	// Neither module returns before both started.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("want: 2 modules running, got: %d", i)
+		}
+	}
+}
+
+func TestEmphasis(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	n := 0
+	module := openbar.ModuleFunc(func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return fmt.Sprint(n), nil
+	})
+
+	frames := make(chan openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(module, 200*time.Millisecond,
+				openbar.SubSecond(),
+				openbar.Emphasize(openbar.Emphasis{Duration: 50 * time.Millisecond, Color: "#ff0000"}),
+			),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- b[0]:
+				default:
+				}
+			}),
+		)
+	}()
+
+	want := []openbar.Block{
+		{FullText: "..."},
+		{FullText: "1"},
+		{FullText: "2", Color: "#ff0000"},
+		{FullText: "2"},
+	}
+
+	for _, w := range want {
+		if got := <-frames; got != w {
+			t.Errorf("want: %+v, got: %+v", w, got)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	n := 0
+	module := openbar.ModuleFunc(func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return fmt.Sprint(n), nil
+	})
+
+	frames := make(chan openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithHighlight(openbar.Emphasis{Duration: 50 * time.Millisecond, Background: "#333333", Border: "#ffffff"}),
+			openbar.WithModule(module, 200*time.Millisecond,
+				openbar.SubSecond(),
+				openbar.Style(openbar.Block{Background: "#000000"}),
+			),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- b[0]:
+				default:
+				}
+			}),
+		)
+	}()
+
+	// The block goes back to its own style once highlighted.
+	want := []openbar.Block{
+		{FullText: "...", Background: "#000000"},
+		{FullText: "1", Background: "#000000"},
+		{FullText: "2", Background: "#333333", Border: "#ffffff"},
+		{FullText: "2", Background: "#000000"},
+	}
+
+	for _, w := range want {
+		if got := <-frames; got != w {
+			t.Errorf("want: %+v, got: %+v", w, got)
+		}
+	}
+}
+
+// A module refreshed each time a value is sent on its channel.
+type notifier struct {
+	values chan string
+	last   string
+}
+
+func (n *notifier) FullText() (string, error) {
+	return n.last, nil
+}
+
+func (n *notifier) Notify(ctx context.Context, changed func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case v := <-n.values:
+			n.last = v
+			changed()
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := &notifier{values: make(chan string)}
+	updates := make(chan string, 10)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(n, time.Hour),
+			openbar.WithUpdateHook(func(s openbar.Status) { updates <- s.Text }),
+		)
+	}()
+
+	<-updates
+
+	n.values <- "changed"
+
+	select {
+	case got := <-updates:
+		if got != "changed" {
+			t.Errorf("want: %q, got: %q", "changed", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("module not refreshed")
+	}
+}
+
+func TestStreamModule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values := make(chan openbar.Update)
+	module := openbar.StreamModuleFunc(func(ctx context.Context) <-chan openbar.Update {
+		return values
+	})
+
+	updates := make(chan openbar.Status, 10)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithStreamModule(module, openbar.OnError(openbar.ErrorPolicy{Display: openbar.ErrorKeep})),
+			openbar.WithUpdateHook(func(s openbar.Status) { updates <- s }),
+		)
+	}()
+
+	// Values show as soon as they are sent, errors keeping the last good one.
+	tests := []struct {
+		sent openbar.Update
+		text string
+		err  bool
+	}{
+		{sent: openbar.Update{Text: "first", Err: nil}, text: "first", err: false},
+		{sent: openbar.Update{Text: "second", Err: nil}, text: "second", err: false},
+		{sent: openbar.Update{Text: "", Err: errors.New("lost")}, text: "second", err: true},
+	}
+
+	for i, test := range tests {
+		values <- test.sent
+
+		// The first value may also be shown by the initial paint.
+		timeout := time.After(time.Second)
+		for shown := false; !shown; {
+			select {
+			case got := <-updates:
+				shown = got.Text == test.text && (got.Error != "") == test.err
+			case <-timeout:
+				t.Fatalf("%d: want: %q (error: %v), not shown", i, test.text, test.err)
+			}
+		}
+	}
+}
+
+func TestRefreshOn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := 0
+	module := openbar.ModuleFunc(func() (string, error) {
+		runs++
+		return fmt.Sprint(runs), nil
+	})
+
+	kick := make(chan struct{})
+	external := openbar.NotifierFunc(func(ctx context.Context, changed func()) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-kick:
+				changed()
+			}
+		}
+	})
+
+	updates := make(chan string, 10)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(module, time.Hour, openbar.RefreshOn(external)),
+			openbar.WithUpdateHook(func(s openbar.Status) { updates <- s.Text }),
+		)
+	}()
+
+	<-updates
+
+	kick <- struct{}{}
+
+	select {
+	case got := <-updates:
+		if got != "2" {
+			t.Errorf("want: %q, got: %q", "2", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("module not refreshed")
+	}
+}
+
+func TestCrash(t *testing.T) {
+	dir := os.Getenv("OPENBAR_TEST_CRASH")
+
+	// The crash happens in a child process since it can't be recovered. Runs
+	// of modules recover from panics, so a watcher of changes panics instead.
+	if dir != "" {
+		module := openbar.ModuleFunc(func() (string, error) {
+			return "ok", nil
+		})
+		watcher := openbar.NotifierFunc(func(context.Context, func()) error {
+			panic("boom")
+		})
+		_ = openbar.Run(
+			context.Background(),
+			openbar.WithOutput(io.Discard),
+			openbar.WithCrashDir(dir),
+			openbar.WithModule(module, time.Hour, openbar.Named("bomb"), openbar.RefreshOn(watcher)),
+		)
+		return
+	}
+
+	dir = t.TempDir()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrash$")
+	cmd.Env = append(os.Environ(), "OPENBAR_TEST_CRASH="+dir)
+
+	if err := cmd.Run(); err == nil {
+		t.Fatal("want the child process to crash")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("want one crash file, got: %v, %v", files, err)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"panic: boom", "[0]  bomb", "goroutines:"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("crash file misses %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release := make(chan struct{})
+	module := openbar.ModuleFunc(func() (string, error) {
+		<-release
+		return "new", nil
+	})
+
+	frames := make(chan string, 10)
+	stdout := bytes.NewBuffer(nil)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(stdout),
+			openbar.WithJitter(0),
+			openbar.WithResume(map[string]openbar.Block{"clock": {FullText: "old"}, "gone": {FullText: "?"}}),
+			openbar.WithModule(module, time.Hour, openbar.Identified("clock")),
+			openbar.WithFrameHook(func(b []openbar.Block) { frames <- b[0].FullText }),
+		)
+	}()
+
+	// The previous value stays until the module returns: no placeholder.
+	select {
+	case f := <-frames:
+		t.Errorf("want: no frame, got: %q", f)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	if f := <-frames; f != "new" {
+		t.Errorf("want: %q, got: %q", "new", f)
+	}
+
+	cancel()
+	<-stopped
+
+	// The header was printed by the previous instance.
+	if want := `[{"full_text":"new"}],`; stdout.String() != want {
+		t.Errorf("want: %s, got: %s", want, stdout.String())
+	}
+}
+
+func TestOverrun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stderr := bytes.NewBuffer(nil)
+
+	// Each run takes longer than the interval.
+	var mu sync.Mutex
+	var gaps []time.Duration
+	var end time.Time
+	runs := make(chan struct{}, 16)
+	module := openbar.ModuleFunc(func() (string, error) {
+		mu.Lock()
+		if !end.IsZero() {
+			gaps = append(gaps, time.Since(end))
+		}
+		mu.Unlock()
+		<-time.After(150 * time.Millisecond)
+		mu.Lock()
+		end = time.Now()
+		mu.Unlock()
+		runs <- struct{}{}
+		return "", nil
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithError(stderr),
+			openbar.WithModule(module, 100*time.Millisecond, openbar.SubSecond(), openbar.Named("slow")),
+		)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("want: 3 runs, got: %d", i)
+		}
+	}
+	cancel()
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(gaps) < 2 {
+		t.Fatalf("want: several runs, got: %d", len(gaps)+1)
+	}
+
+	// Runs taking longer than the interval are not chained back to back.
+	for _, gap := range gaps {
+		if gap < 50*time.Millisecond {
+			t.Errorf("want: a pause between runs, got: %v", gap)
+		}
+	}
+
+	if !strings.Contains(stderr.String(), "module 0 (slow): skipped a run") {
+		t.Errorf("want: skipped runs logged, got: %q", stderr.String())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	history := filepath.Join(t.TempDir(), "history.json")
+
+	var mu sync.Mutex
+	n := 0
+	module := openbar.ModuleFunc(func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return fmt.Sprintf("%d%%", n), nil
+	})
+
+	// Run the bar until it printed the given number of values.
+	run := func(count int) []string {
+		ctx, cancel := context.WithCancel(context.Background())
+		frames := make(chan string, 100)
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			_ = openbar.Run(
+				ctx,
+				openbar.WithOutput(io.Discard),
+				openbar.WithHistoryFile(history),
+				openbar.WithModule(module, 100*time.Millisecond,
+					openbar.SubSecond(),
+					openbar.Identified("cpu"),
+					openbar.Sparkline(3),
+				),
+				openbar.WithFrameHook(func(b []openbar.Block) {
+					if b[0].FullText != "..." {
+						frames <- b[0].FullText
+					}
+				}),
+			)
+		}()
+
+		res := make([]string, 0, count)
+		for len(res) < count {
+			res = append(res, <-frames)
+		}
+
+		cancel()
+		<-stopped
+
+		return res
+	}
+
+	got := run(3)
+	want := []string{"1% ▁", "2% ▁█", "3% ▁▄█"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	// The next bar continues the graph.
+	got = run(1)
+	want = []string{"4% ▁▄█"}
+	if fmt.Sprint(got[:1]) != fmt.Sprint(want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+// A module keeping the clicks made on its block.
+type clickable struct {
+	mu     sync.Mutex
+	clicks []int
+}
+
+func (c *clickable) FullText() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprint(c.clicks), nil
+}
+
+func (c *clickable) Click(e openbar.Click) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clicks = append(c.clicks, e.Button)
+	return nil
+}
+
+func TestClick(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	module := new(clickable)
+	frames := make(chan []openbar.Block, 100)
+	headers := make(chan openbar.Header, 1)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithClickEvents(r),
+			openbar.WithStartHook(func(h openbar.Header) { headers <- h }),
+			openbar.WithModule(module, time.Hour, openbar.Identified("volume")),
+			openbar.WithModuleFunc(func() (string, error) { return "", nil }, time.Hour,
+				openbar.Identified("other"),
+				openbar.OnClick(func(openbar.Click) error { return errors.New("unexpected click") }),
+			),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	if h := <-headers; !h.ClickEvents {
+		t.Error("want: click events enabled")
+	}
+
+	// Wait for the first value so that clicks refresh the block afterwards.
+	for b := range frames {
+		if b[0].FullText == "[]" {
+			if b[0].Name != "volume" {
+				t.Errorf("want: block named after the module, got: %q", b[0].Name)
+			}
+			break
+		}
+	}
+
+	// Like i3bar, open the array and separate clicks with commas. The second
+	// click only has the event code of the middle button, like swaybar sends
+	// for some buttons.
+	if _, err := io.WriteString(w, "[\n"+`{"name":"volume","button":1}`+"\n"+`,{"name":"volume","event":274}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case b := <-frames:
+			if b[0].FullText == "[1 2]" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("clicks not handled")
+		}
+	}
+}
+
+func TestLowPower(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	runs, done := make([]int, 2), make(chan struct{}, 1)
+	counter := func(i int) func() (string, error) {
+		return func() (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs[i]++
+			select {
+			case done <- struct{}{}:
+			default:
+			}
+			return fmt.Sprint(runs[i]), nil
+		}
+	}
+
+	count := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), runs...)
+	}
+
+	control := openbar.NewControl()
+	if err := control.SetLowPower(openbar.LowPowerOn); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithLowPower(openbar.LowPower{Factor: 4, Indicator: "eco"}),
+			openbar.WithModuleFunc(counter(0), 50*time.Millisecond, openbar.SubSecond()),
+			openbar.WithModuleFunc(counter(1), 50*time.Millisecond, openbar.SubSecond(), openbar.PauseOnLowPower()),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	// Wait for a frame, or for a module to have run the given number of times.
+	frame := func(ok func([]openbar.Block) bool) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case b := <-frames:
+				if ok(b) {
+					return
+				}
+			case <-deadline:
+				t.Fatal("want: frame, got none")
+			}
+		}
+	}
+	ran := func(i, n int) time.Time {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for count()[i] < n {
+			select {
+			case <-done:
+			case <-deadline:
+				t.Fatalf("want: %d runs of module %d, got: %v", n, i, count())
+			}
+		}
+		return time.Now()
+	}
+
+	// The mode reaches the loop asynchronously.
+	frame(func(b []openbar.Block) bool {
+		return len(b) == 3 && b[2].FullText == "eco"
+	})
+
+	if !control.LowPower() {
+		t.Error("want: low-power mode reported")
+	}
+
+	// Intervals are four times longer. The first two runs may still come from
+	// ticks sent before the mode reached the module, and so may two runs of
+	// the pausable module, which then stops running.
+	before := count()
+	first := ran(0, before[0]+2)
+	if d := ran(0, before[0]+4).Sub(first); d < 300*time.Millisecond {
+		t.Errorf("want: two intervals of 200ms, got: %v", d)
+	}
+	if got := count(); got[1] > before[1]+2 {
+		t.Errorf("want: pausable module paused, got: %v", got)
+	}
+
+	if err := control.SetLowPower(openbar.LowPowerOff); err != nil {
+		t.Fatal(err)
+	}
+
+	frame(func(b []openbar.Block) bool {
+		return len(b) == 2
+	})
+	ran(1, count()[1]+4)
+}
+
+func TestMarkup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdout := bytes.NewBuffer(nil)
+	stopped := make(chan struct{})
+	printed := make(chan struct{}, 1)
+
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(stdout),
+			openbar.WithModuleFunc(func() (string, error) { return "<b>a</b> &amp; b", nil }, time.Hour, openbar.Markup()),
+			openbar.WithModuleFunc(func() (string, error) { return "<c>", nil }, time.Hour),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				if b[0].FullText != "" && b[1].FullText != "" {
+					select {
+					case printed <- struct{}{}:
+					default:
+					}
+				}
+			}),
+		)
+	}()
+
+	<-printed
+	cancel()
+	<-stopped
+
+	// Markup is printed as is.
+	want := `[{"full_text":"<b>a</b> &amp; b","markup":"pango"},{"full_text":"<c>"}]`
+	if !strings.Contains(stdout.String(), want) {
+		t.Errorf("want: %s, got: %s", want, stdout.String())
+	}
+
+	blocks := []openbar.Block{
+		{FullText: "<b>a</b> &amp; b", Markup: openbar.Pango},
+		{FullText: "<c>"},
+		{FullText: "<span/>", Markup: openbar.Pango},
+	}
+
+	if got := openbar.Plain(blocks, " | "); got != "a & b | <c>" {
+		t.Errorf("want: %q, got: %q", "a & b | <c>", got)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	// Monday 2024-01-01 and the following days.
+	at := func(day int, clock string) time.Time {
+		res, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("2024-01-%02d %s", day, clock), time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		window string
+		at     time.Time
+		want   bool
+		err    bool
+	}{
+		{window: "07:00-10:00", at: at(1, "08:30"), want: true},
+		{window: "07:00-10:00", at: at(1, "10:00"), want: false},
+		{window: "mon-fri 09:00-18:00", at: at(6, "10:00"), want: false},
+		{window: "mon-fri 09:00-18:00", at: at(5, "10:00"), want: true},
+		{window: "sat,sun", at: at(7, "23:59"), want: true},
+		{window: "fri-mon", at: at(2, "12:00"), want: false},
+		{window: "fri 22:00-02:00", at: at(6, "01:00"), want: true},
+		{window: "fri 22:00-02:00", at: at(5, "01:00"), want: false},
+		{window: "noon", err: true},
+		{window: "25:00-26:00", err: true},
+		{window: "10:00-10:00", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			w, err := openbar.ParseWindow(test.window)
+			if !errors.Is(err, openbar.ErrWindow) != !test.err {
+				t.Fatalf("want error: %v, got: %v", test.err, err)
+			}
+			if err == nil && w.Contains(test.at) != test.want {
+				t.Errorf("want: %v, got: %v", test.want, !test.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	open := openbar.Window{From: 0, To: 24 * time.Hour}
+	closed := openbar.Window{Days: []time.Weekday{(now.Weekday() + 3) % 7}}
+
+	var mu sync.Mutex
+	ran := make([]bool, 2)
+	module := func(i int) func() (string, error) {
+		return func() (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			ran[i] = true
+			return "on", nil
+		}
+	}
+
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(module(0), time.Hour, openbar.ActiveDuring(open)),
+			openbar.WithModuleFunc(module(1), time.Hour, openbar.ActiveDuring(closed)),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	for b := range frames {
+		if b[0].FullText == "on" {
+			if b[1].FullText != "" {
+				t.Errorf("want: hidden block, got: %q", b[1].FullText)
+			}
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if ran[1] {
+		t.Error("want: inactive module not run")
+	}
+}
+
+// A module with a shorter text for narrow bars.
+type abbreviated struct{}
+
+func (abbreviated) FullText() (string, error) { return "Wednesday", nil }
+
+func (abbreviated) ShortText() string { return "Wed" }
+
+func TestShortText(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(abbreviated{}, time.Hour),
+			openbar.WithModuleFunc(func() (string, error) { return "12:00", nil }, time.Hour,
+				openbar.Style(openbar.Block{ShortText: "noon"})),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	for b := range frames {
+		if b[0].FullText == "..." && b[0].ShortText != "" {
+			t.Errorf("want: no short text for the placeholder, got: %q", b[0].ShortText)
+		}
+		if b[0].FullText == "Wednesday" && b[1].FullText == "12:00" {
+			if b[0].ShortText != "Wed" || b[1].ShortText != "noon" {
+				t.Errorf("want: Wed and noon, got: %q and %q", b[0].ShortText, b[1].ShortText)
+			}
+			return
+		}
+	}
+}
+
+// A module saying its value needs attention.
+type alarming struct{}
+
+func (alarming) FullText() (string, error) { return "fire", nil }
+
+func (alarming) Urgent() bool { return true }
+
+func TestUrgent(t *testing.T) {
+	tests := []struct {
+		module openbar.Module
+		opts   []openbar.ModuleOption
+		want   bool
+	}{
+		{module: alarming{}, want: true},
+		{module: openbar.ModuleFunc(func() (string, error) { return "bat 8%", nil }), opts: []openbar.ModuleOption{openbar.UrgentBelow(10)}, want: true},
+		{module: openbar.ModuleFunc(func() (string, error) { return "bat 80%", nil }), opts: []openbar.ModuleOption{openbar.UrgentBelow(10)}},
+		{module: openbar.ModuleFunc(func() (string, error) { return "cpu 95°C", nil }), opts: []openbar.ModuleOption{openbar.UrgentAbove(90)}, want: true},
+		{module: openbar.ModuleFunc(func() (string, error) { return "cpu 50°C", nil }), opts: []openbar.ModuleOption{openbar.UrgentBelow(10), openbar.UrgentAbove(90)}},
+		{module: openbar.ModuleFunc(func() (string, error) { return "off", nil }), opts: []openbar.ModuleOption{openbar.UrgentBelow(10)}},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			frames := make(chan []openbar.Block, 100)
+
+			go func() {
+				_ = openbar.Run(
+					ctx,
+					openbar.WithOutput(io.Discard),
+					openbar.WithModule(test.module, time.Hour, test.opts...),
+					openbar.WithFrameHook(func(b []openbar.Block) {
+						select {
+						case frames <- append([]openbar.Block(nil), b...):
+						default:
+						}
+					}),
+				)
+			}()
+
+			for b := range frames {
+				if b[0].FullText == "..." {
+					if b[0].Urgent {
+						t.Error("want: placeholder not urgent, got: urgent")
+					}
+					continue
+				}
+				if b[0].Urgent != test.want {
+					t.Errorf("want: %v, got: %v", test.want, b[0].Urgent)
+				}
+				return
+			}
+		})
+	}
+}
+
+func TestBlockModule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+
+	battery := openbar.BlockModuleFunc(func() (openbar.Block, error) {
+		return openbar.Block{FullText: "5%", ShortText: "5", Color: "#ff0000", Urgent: true, Name: "other"}, nil
+	})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithBlockModule(battery, time.Hour,
+				openbar.Style(openbar.Block{Color: "#ffffff", Background: "#000000", Name: "battery"})),
+			openbar.WithModuleFunc(func() (string, error) { return "12:00", nil }, time.Hour),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	want := openbar.Block{FullText: "5%", ShortText: "5", Color: "#ff0000", Background: "#000000", Name: "battery", Urgent: true}
+
+	for b := range frames {
+		if b[0].FullText != "5%" || b[1].FullText != "12:00" {
+			continue
+		}
+		if !reflect.DeepEqual(b[0], want) {
+			t.Errorf("want: %+v, got: %+v", want, b[0])
+		}
+		return
+	}
+}
+
+func TestTheme(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+
+	battery := openbar.BlockModuleFunc(func() (openbar.Block, error) {
+		return openbar.Block{FullText: "5%", Color: openbar.ColorCritical}, nil
+	})
+
+	separator, width := false, 12
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithTheme(openbar.Theme{
+				Colors: map[string]string{
+					openbar.ColorCritical: "#ff0000",
+					openbar.ColorAccent:   "#0000ff",
+				},
+				Separator:           &separator,
+				SeparatorBlockWidth: &width,
+				Padding:             1,
+			}),
+			openbar.WithBlockModule(battery, time.Hour),
+			openbar.WithModuleFunc(func() (string, error) { return "12:00", nil }, time.Hour,
+				openbar.Style(openbar.Block{Background: openbar.ColorAccent, Border: "unknown", Separator: new(bool)})),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	want := []openbar.Block{
+		{FullText: " 5% ", Color: "#ff0000", Separator: &separator, SeparatorBlockWidth: &width},
+		{FullText: " 12:00 ", Background: "#0000ff", Separator: new(bool), SeparatorBlockWidth: &width},
+	}
+
+	for b := range frames {
+		if b[0].FullText != " 5% " || b[1].FullText != " 12:00 " {
+			continue
+		}
+		if !reflect.DeepEqual(b, want) {
+			t.Errorf("want: %+v, got: %+v", want, b)
+		}
+		return
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+
+	hide, show, narrow, wide := false, true, 4, 20
+	text := func() (string, error) { return "x", nil }
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithSeparator(openbar.Separator{Show: &hide, Width: &narrow}),
+			openbar.WithModuleFunc(text, time.Hour),
+			openbar.WithModuleFunc(text, time.Hour,
+				openbar.Style(openbar.Block{SeparatorBlockWidth: &wide})),
+			openbar.WithModuleFunc(text, time.Hour,
+				openbar.Style(openbar.Block{Separator: &hide}),
+				openbar.Separated(openbar.Separator{Show: &show})),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	want := []openbar.Block{
+		{FullText: "x", Separator: &hide, SeparatorBlockWidth: &narrow},
+		{FullText: "x", Separator: &hide, SeparatorBlockWidth: &wide},
+		{FullText: "x", Separator: &show, SeparatorBlockWidth: &narrow},
+	}
+
+	for b := range frames {
+		if b[0].FullText != "x" || b[1].FullText != "x" || b[2].FullText != "x" {
+			continue
+		}
+		if !reflect.DeepEqual(b, want) {
+			t.Errorf("want: %+v, got: %+v", want, b)
+		}
+		return
+	}
+}
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		block openbar.Block
+		data  string
+	}{
+		{block: openbar.Block{FullText: "x"}, data: `{"full_text":"x"}`},
+		{block: openbar.Block{FullText: "x", MinWidth: openbar.Pixels(120)}, data: `{"full_text":"x","min_width":120}`},
+		{
+			block: openbar.Block{FullText: "x", MinWidth: openbar.WidthOf("100%"), Align: openbar.AlignRight},
+			data:  `{"full_text":"x","min_width":"100%","align":"right"}`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			data, err := json.Marshal(test.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.data {
+				t.Errorf("want: %s, got: %s", test.data, data)
+			}
+
+			var b openbar.Block
+			if err := json.Unmarshal(data, &b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(b, test.block) {
+				t.Errorf("want: %+v, got: %+v", test.block, b)
+			}
+		})
+	}
+
+	var b openbar.Block
+	if err := json.Unmarshal([]byte(`{"min_width":-1}`), &b); err == nil {
+		t.Error("want: error, got: nil")
+	}
+}
+
+func TestToggle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var mu sync.Mutex
+	runs := 0
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs
+	}
+
+	control := openbar.NewControl()
+	frames, ticks := make(chan []openbar.Block, 100), make(chan struct{})
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithClickEvents(r),
+			openbar.WithToggle(openbar.Toggle{
+				Gesture:   &openbar.Gesture{Button: openbar.MiddleButton, Modifiers: []string{"Shift"}},
+				Indicator: "zz",
+			}),
+			openbar.WithModuleFunc(func() (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				runs++
+				return "on", nil
+			}, 50*time.Millisecond, openbar.SubSecond(), openbar.Identified("counter")),
+			// Runs of another module on the same interval tell time.
+			openbar.WithModuleFunc(func() (string, error) {
+				select {
+				case ticks <- struct{}{}:
+				default:
+				}
+				return "", nil
+			}, 50*time.Millisecond, openbar.SubSecond()),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	wait := func(text string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case b := <-frames:
+				if b[0].FullText == text {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("want: %q, got: nothing", text)
+			}
+		}
+	}
+
+	wait("on")
+
+	// A middle click alone is not the gesture, and lock keys don't matter.
+	if _, err := io.WriteString(w, `{"name":"counter","button":2}`+"\n"+`{"name":"counter","button":2,"modifiers":["Mod2","Shift"]}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait("zz")
+
+	before := count()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(time.Second):
+			t.Fatal("want: ticks, got: none")
+		}
+	}
+	if got := count(); got != before {
+		t.Errorf("want: %d runs, got: %d", before, got)
+	}
+
+	if s := control.Status(); !s[0].Disabled || s[0].Text != "zz" {
+		t.Errorf("want: disabled module, got: %+v", s[0])
+	}
+
+	if err := control.Enable(0); err != nil {
+		t.Fatal(err)
+	}
+
+	wait("on")
+
+	if err := control.Disable(2); !errors.Is(err, openbar.ErrNoModule) {
+		t.Errorf("want: %v, got: %v", openbar.ErrNoModule, err)
+	}
+}
+
+func TestInstance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	clicks := make(chan string, 10)
+	clock := func(id string) openbar.Option {
+		return openbar.WithModuleFunc(func() (string, error) { return id, nil }, time.Hour,
+			openbar.Named("clock"),
+			openbar.Identified(id),
+			openbar.OnClick(func(openbar.Click) error {
+				clicks <- id
+				return nil
+			}),
+		)
+	}
+
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithClickEvents(r),
+			clock("utc"),
+			clock("local"),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	b := <-frames
+	for i, want := range []string{"utc", "local"} {
+		if b[i].Name != "clock" || b[i].Instance != want {
+			t.Errorf("want: clock %s, got: %s %s", want, b[i].Name, b[i].Instance)
+		}
+	}
+
+	// The name alone is ambiguous, so the first click goes nowhere.
+	if _, err := io.WriteString(w, `{"name":"clock","button":1}`+"\n"+`{"name":"clock","instance":"local","button":1}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-clicks:
+		if id != "local" {
+			t.Errorf("want: local, got: %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("click not handled")
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	clicks, runs := make(chan int, 10), make(chan struct{}, 10)
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithClickEvents(r),
+			openbar.WithModuleFunc(func() (string, error) {
+				runs <- struct{}{}
+				return "vpn", nil
+			}, time.Hour,
+				openbar.Identified("vpn"),
+				openbar.Confirm(openbar.Confirmation{Buttons: []int{openbar.LeftButton}, Within: 200 * time.Millisecond, Prompt: "sure?"}),
+				openbar.OnClick(func(c openbar.Click) error {
+					clicks <- c.Button
+					return nil
+				}),
+			),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	wait := func(text string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case b := <-frames:
+				if b[0].FullText == text {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("want: %q, got: nothing", text)
+			}
+		}
+	}
+
+	click := func(button int) {
+		if _, err := fmt.Fprintf(w, `{"name":"vpn","button":%d}`+"\n", button); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	none := func() {
+		select {
+		case b := <-clicks:
+			t.Fatalf("want: no click, got: %d", b)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	wait("vpn")
+	<-runs
+
+	// Buttons without confirmation go through right away.
+	click(openbar.RightButton)
+	if b := <-clicks; b != openbar.RightButton {
+		t.Errorf("want: %d, got: %d", openbar.RightButton, b)
+	}
+
+	// Let the refresh following the click go by.
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want: refresh after the click, got: none")
+	}
+
+	click(openbar.LeftButton)
+	wait("sure?")
+	none()
+
+	click(openbar.LeftButton)
+	if b := <-clicks; b != openbar.LeftButton {
+		t.Errorf("want: %d, got: %d", openbar.LeftButton, b)
+	}
+	wait("vpn")
+
+	// Without a second click, the block goes back to its value.
+	click(openbar.LeftButton)
+	wait("sure?")
+	wait("vpn")
+	none()
+
+	click(openbar.LeftButton)
+	wait("sure?")
+	none()
+}
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		opts []openbar.Option
+		want openbar.Header
+	}{
+		{
+			opts: nil,
+			want: openbar.Header{Version: 1, ContSignal: int(syscall.SIGCONT), StopSignal: int(syscall.SIGSTOP)},
+		},
+		{
+			opts: []openbar.Option{openbar.WithHeader(openbar.Header{Version: 2}), openbar.WithProtocol(openbar.I3)},
+			want: openbar.Header{Version: 2},
+		},
+		{
+			opts: []openbar.Option{openbar.WithHeader(openbar.Header{ClickEvents: true, StopSignal: int(syscall.SIGUSR2)})},
+			want: openbar.Header{Version: 1, ClickEvents: true, StopSignal: int(syscall.SIGUSR2)},
+		},
+		{
+			opts: []openbar.Option{openbar.WithHeader(openbar.Header{}), openbar.WithClickEvents(strings.NewReader(""))},
+			want: openbar.Header{Version: 1, ClickEvents: true},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			headers := make(chan openbar.Header, 1)
+			opts := append(test.opts,
+				openbar.WithOutput(io.Discard),
+				openbar.WithStartHook(func(h openbar.Header) { headers <- h }),
+			)
+
+			go func() { _ = openbar.Run(ctx, opts...) }()
+
+			if got := <-headers; got != test.want {
+				t.Errorf("want: %+v, got: %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames, runs := make(chan []openbar.Block, 100), make(chan struct{}, 100)
+
+	go func() {
+		n := 0
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithStopSignal(syscall.SIGUSR2),
+			openbar.WithModuleFunc(func() (string, error) {
+				n++
+				runs <- struct{}{}
+				return fmt.Sprint(n), nil
+			}, 50*time.Millisecond, openbar.SubSecond()),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	<-frames
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Let the pause settle: a run may have started before it.
+	for settled := false; !settled; {
+		select {
+		case <-runs:
+		case <-time.After(100 * time.Millisecond):
+			settled = true
+		}
+	}
+	for len(frames) > 0 {
+		<-frames
+	}
+
+	// Then nothing runs and nothing is printed.
+	select {
+	case <-runs:
+		t.Error("want: no run while hidden")
+	case <-frames:
+		t.Error("want: no frame while hidden")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGCONT); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-frames:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want: frames once shown again")
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("want: modules running again, got: %d runs", i)
+		}
+	}
+}
+
+// A module asking to confirm its left clicks.
+type confirmer struct {
+	clicks chan int
+}
+
+func (m confirmer) FullText() (string, error) {
+	return "power", nil
+}
+
+func (m confirmer) Click(c openbar.Click) error {
+	m.clicks <- c.Button
+	return nil
+}
+
+func (m confirmer) Confirm(c openbar.Click) (string, bool) {
+	return "", c.Button == openbar.LeftButton
+}
+
+func TestConfirmer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	module := confirmer{make(chan int, 10)}
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithClickEvents(r),
+			openbar.WithModule(module, time.Hour, openbar.Identified("power")),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	wait := func(text string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case b := <-frames:
+				if b[0].FullText == text {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("want: %q, got: nothing", text)
+			}
+		}
+	}
+
+	wait("power")
+
+	if _, err := io.WriteString(w, `{"name":"power","button":1}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modules leaving the prompt out get the default one.
+	wait("confirm?")
+
+	if _, err := io.WriteString(w, `{"name":"power","button":1}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case b := <-module.clicks:
+		if b != openbar.LeftButton {
+			t.Errorf("want: %d, got: %d", openbar.LeftButton, b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("click not handled")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"plain", "plain"},
+		{"12:00\n", "12:00"},
+		{"a\nb\r\nc\td", "a b c d"},
+		{"\x1b[31mred\x1b[0m", "[31mred[0m"},
+		{"bell\a\x00\x7f", "bell"},
+		{"bad\xff\xfeutf8", "badutf8"},
+		{"é   ⏻ �", "é   ⏻ �"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+	opts := []openbar.Option{
+		openbar.WithOutput(io.Discard),
+		openbar.WithFrameHook(func(b []openbar.Block) {
+			select {
+			case frames <- append([]openbar.Block(nil), b...):
+			default:
+			}
+		}),
+	}
+	for _, test := range tests {
+		out := test.out
+		opts = append(opts, openbar.WithModuleFunc(func() (string, error) { return out, nil }, time.Hour))
+	}
+
+	go func() { _ = openbar.Run(ctx, opts...) }()
+
+	for b := range frames {
+		ready := true
+		for _, block := range b {
+			ready = ready && block.FullText != "..."
+		}
+		if !ready {
+			continue
+		}
+		for i, test := range tests {
+			if b[i].FullText != test.want {
+				t.Errorf("%d: want: %q, got: %q", i, test.want, b[i].FullText)
+			}
+		}
+		return
+	}
+}
+
+// A module recording how scrolls adjust it.
+type adjustable struct {
+	mu     sync.Mutex
+	deltas []int
+}
+
+func (a *adjustable) FullText() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return fmt.Sprint(a.deltas), nil
+}
+
+func (a *adjustable) Adjust(delta int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deltas = append(a.deltas, delta)
+	return nil
+}
+
+func TestScroll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	fast, slow := new(adjustable), new(adjustable)
+	left := make(chan struct{}, 1)
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithClickEvents(r),
+			openbar.WithScroll(openbar.Scroll{Step: 2, Max: 8, Within: time.Minute}),
+			openbar.WithModule(fast, time.Hour, openbar.Identified("fast")),
+			openbar.WithModule(slow, time.Hour, openbar.Identified("slow"),
+				openbar.Scrolling(openbar.Scroll{Step: 1}),
+				openbar.OnClick(func(c openbar.Click) error {
+					if c.Button != openbar.LeftButton {
+						return openbar.ErrNotHandled
+					}
+					left <- struct{}{}
+					return nil
+				}),
+			),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	for b := range frames {
+		if b[0].FullText == "[]" && b[1].FullText == "[]" {
+			break
+		}
+	}
+
+	// Scrolls in a row double the step up to the maximum, and changing
+	// direction starts over.
+	clicks := []string{
+		`{"name":"fast","button":4}`,
+		`{"name":"fast","button":4}`,
+		`{"name":"fast","button":4}`,
+		`{"name":"fast","button":4}`,
+		`{"name":"fast","button":5}`,
+		`{"name":"fast","button":4}`,
+		`{"name":"slow","button":1}`,
+		`{"name":"slow","button":5}`,
+		`{"name":"slow","button":5}`,
+	}
+	if _, err := io.WriteString(w, strings.Join(clicks, "\n")+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case b := <-frames:
+			if b[0].FullText == "[2 4 8 8 -2 2]" && b[1].FullText == "[-1 -1]" {
+				select {
+				case <-left:
+				default:
+					t.Error("want: left click handled by OnClick")
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("scrolls not handled")
+		}
+	}
+}
+
+func TestRedraw(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	runs, frames := 0, make([]string, 0)
+	ran, changed := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(func() (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				runs++
+				if runs == 8 {
+					close(ran)
+				}
+				if runs > 5 {
+					return "changed", nil
+				}
+				return "same", nil
+			}, 50*time.Millisecond, openbar.SubSecond()),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				mu.Lock()
+				defer mu.Unlock()
+				frames = append(frames, b[0].FullText)
+				if b[0].FullText == "changed" {
+					once.Do(func() { close(changed) })
+				}
+			}),
+		)
+	}()
+
+	for _, c := range []chan struct{}{ran, changed} {
+		select {
+		case <-c:
+		case <-time.After(2 * time.Second):
+			t.Fatal("want: 8 runs and the changed value, got: timeout")
+		}
+	}
+	cancel()
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The placeholder, then each value once however many times it is printed.
+	want := []string{"...", "same", "changed"}
+	if runs < 8 || !reflect.DeepEqual(frames, want) {
+		t.Errorf("want: %q after at least 8 runs, got: %q after %d", want, frames, runs)
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release, ran := make(chan struct{}), make(chan struct{}, 10)
+	var runs int32
+	module := func() (string, error) {
+		<-release
+		atomic.AddInt32(&runs, 1)
+		ran <- struct{}{}
+		return "done", nil
+	}
+
+	control := openbar.NewControl()
+	frames := make(chan []string, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithPlaceholder("⟳"),
+			openbar.WithModuleFunc(module, time.Hour, openbar.Manual()),
+			openbar.WithModuleFunc(module, time.Hour, openbar.Manual(), openbar.PlaceholderText("…")),
+			openbar.WithModuleFunc(module, time.Hour, openbar.Manual(), openbar.PlaceholderText("")),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				frames <- []string{b[0].FullText, b[1].FullText, b[2].FullText}
+			}),
+		)
+	}()
+
+	next := func() []string {
+		select {
+		case f := <-frames:
+			return f
+		case <-time.After(time.Second):
+			t.Fatal("no frame")
+			return nil
+		}
+	}
+
+	// Modules show their placeholder until their first run completes, the
+	// one without any staying empty.
+	placeholders := []string{"⟳", "…", ""}
+	for f := next(); !reflect.DeepEqual(f, placeholders); f = next() {
+		if f[2] != "" {
+			t.Errorf("want: empty block, got: %q", f[2])
+		}
+	}
+	close(release)
+
+	want := []string{"done", "done", "done"}
+	for f := next(); !reflect.DeepEqual(f, want); f = next() {
+		if f[2] != "" && f[2] != "done" {
+			t.Errorf("want: empty block until done, got: %q", f[2])
+		}
+	}
+
+	// Reloading the module without a placeholder leaves its value in place.
+	if err := control.Reload(2); err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadInt32(&runs) < 4 {
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatal("want: reload, got: none")
+		}
+	}
+	for {
+		select {
+		case f := <-frames:
+			if !reflect.DeepEqual(f, want) {
+				t.Errorf("want: %q, got: %q", want, f)
+			}
+		case <-time.After(100 * time.Millisecond):
+			return
+		}
+	}
+}
+
+type idler struct {
+	runs int32
+}
+
+func (m *idler) FullText() (string, error) {
+	atomic.AddInt32(&m.runs, 1)
+	return "ran", nil
+}
+
+func (m *idler) IdleText() string {
+	return "idle"
+}
+
+func TestIdler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manual, regular := new(idler), new(idler)
+	control := openbar.NewControl()
+	frames := make(chan []string, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithControl(control),
+			openbar.WithJitter(0),
+			openbar.WithModule(manual, time.Hour, openbar.Manual()),
+			openbar.WithModule(regular, time.Hour),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				frames <- []string{b[0].FullText, b[1].FullText}
+			}),
+		)
+	}()
+
+	wait := func(want []string) {
+		t.Helper()
+		deadline := time.After(time.Second)
+		for {
+			select {
+			case f := <-frames:
+				if reflect.DeepEqual(f, want) {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("want: %q, never got it", want)
+			}
+		}
+	}
+
+	// Only manual modules skip their initial paint.
+	wait([]string{"idle", "ran"})
+	if runs := atomic.LoadInt32(&manual.runs); runs != 0 {
+		t.Errorf("want: 0 runs, got: %d", runs)
+	}
+
+	if err := control.Reload(0); err != nil {
+		t.Fatal(err)
+	}
+	wait([]string{"ran", "ran"})
+}
+
+func TestExport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	printed := make(chan string, 10)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithExport(dir),
+			openbar.WithModuleFunc(func() (string, error) {
+				return "42%", nil
+			}, time.Minute),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case printed <- b[0].FullText:
+				default:
+				}
+			}),
+		)
+	}()
+
+	for text := range printed {
+		if text == "42%" {
+			break
+		}
+	}
+	cancel()
+	<-stopped
+
+	data, err := os.ReadFile(filepath.Join(dir, "frame.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frame []openbar.Block
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if len(frame) != 1 || frame[0].FullText != "42%" {
+		t.Errorf("want: %q, got: %v", "42%", frame)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "modules", "0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Text  string
+		Value *openbar.Value
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Text != "42%" || s.Value == nil || s.Value.Number != 42 {
+		t.Errorf("want: %q valued 42, got: %q valued %v", "42%", s.Text, s.Value)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+	opts := []openbar.Option{
+		openbar.WithOutput(io.Discard),
+		openbar.WithMaxFPS(0),
+		openbar.WithCoalesce(300 * time.Millisecond),
+		openbar.WithFrameHook(func(b []openbar.Block) {
+			select {
+			case frames <- append([]openbar.Block(nil), b...):
+			default:
+			}
+		}),
+	}
+
+	// Modules answering one after the other, like after a broadcast reload:
+	// each waits for the bar to get the value of the previous one.
+	returned := make([]chan struct{}, 3)
+	for i := range returned {
+		returned[i] = make(chan struct{})
+	}
+	opts = append(opts, openbar.WithUpdateHook(func(s openbar.Status) {
+		close(returned[s.Index])
+	}))
+	for i := 0; i < 3; i++ {
+		i := i
+		opts = append(opts, openbar.WithModuleFunc(func() (string, error) {
+			if i > 0 {
+				<-returned[i-1]
+			}
+			return "ok", nil
+		}, time.Hour))
+	}
+
+	go func() { _ = openbar.Run(ctx, opts...) }()
+
+	b := <-frames
+	for i := range b {
+		if b[i].FullText != "ok" {
+			t.Errorf("want: every module in the first frame, got: %q for module %d", b[i].FullText, i)
+		}
+	}
+}
+
+// A module whose text doesn't hold its value.
+type thermometer struct{}
+
+func (thermometer) FullText() (string, error) { return "hot", nil }
+
+func (thermometer) Value() openbar.Value {
+	return openbar.Value{Number: 75, Unit: "°C", Max: 100, Trend: openbar.Rising}
+}
+
+func TestValue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan []openbar.Block, 100)
+	updates := make(chan openbar.Status, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(thermometer{}, time.Hour,
+				openbar.UrgentAbove(50), openbar.ProgressBar(4), openbar.Sparkline(3)),
+			openbar.WithModuleFunc(func() (string, error) { return "fan 40 rpm", nil }, time.Hour,
+				openbar.UrgentBelow(50), openbar.ProgressBar(4)),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+			openbar.WithUpdateHook(func(s openbar.Status) { updates <- s }),
+		)
+	}()
+
+	for b := range frames {
+		if b[0].FullText == "..." || b[1].FullText == "..." {
+			continue
+		}
+		// Values parsed from the text have no bounds, hence no bar.
+		if b[0].FullText != "hot ███░ ▁" || b[1].FullText != "fan 40 rpm" {
+			t.Errorf("want: %q and %q, got: %q and %q", "hot ███░ ▁", "fan 40 rpm", b[0].FullText, b[1].FullText)
+		}
+		if !b[0].Urgent || !b[1].Urgent {
+			t.Errorf("want: both urgent, got: %v and %v", b[0].Urgent, b[1].Urgent)
+		}
+		break
+	}
+
+	for i := 0; i < 2; i++ {
+		s := <-updates
+		want := openbar.Value{Number: 40}
+		if s.Index == 0 {
+			want = thermometer{}.Value()
+		}
+		if s.Value == nil || *s.Value != want {
+			t.Errorf("%d: want: %+v, got: %+v", s.Index, want, s.Value)
+		}
+	}
+
+	v := openbar.Value{Number: 12.5, Unit: " GB", Min: 10, Max: 20}
+	if got := v.String(); got != "12.5 GB" {
+		t.Errorf("want: %q, got: %q", "12.5 GB", got)
+	}
+	if r, ok := v.Ratio(); !ok || r != 0.25 {
+		t.Errorf("want: 0.25, got: %v, %v", r, ok)
+	}
+	if got := (openbar.Value{Number: 120, Max: 100}).Bar(2); got != "██" {
+		t.Errorf("want: %q, got: %q", "██", got)
+	}
+}
+
+// A module emitting one block per disk, adding one each time a disk is
+// clicked.
+type disks struct {
+	mu      sync.Mutex
+	clicked []string
+}
+
+func (d *disks) Blocks() ([]openbar.Block, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := []openbar.Block{{FullText: "root"}, {FullText: "home", Instance: "home", Color: "#ff0000"}}
+	for _, c := range d.clicked {
+		res = append(res, openbar.Block{FullText: "clicked " + c})
+	}
+	return res, nil
+}
+
+func (d *disks) Click(c openbar.Click) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clicked = append(d.clicked, c.Instance)
+	return nil
+}
+
+func TestMultiModule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithClickEvents(r),
+			openbar.WithModuleFunc(func() (string, error) { return "before", nil }, time.Hour),
+			openbar.WithMultiModule(new(disks), time.Hour, openbar.Identified("disks"),
+				openbar.Style(openbar.Block{Color: "#ffffff"})),
+			openbar.WithModuleFunc(func() (string, error) { return "after", nil }, time.Hour),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	texts := func(b []openbar.Block) string {
+		res := make([]string, len(b))
+		for i := range b {
+			res[i] = b[i].FullText
+		}
+		return strings.Join(res, ",")
+	}
+
+	for b := range frames {
+		if texts(b) != "before,root,home,after" {
+			continue
+		}
+		want := []openbar.Block{
+			{FullText: "root", Color: "#ffffff", Name: "disks", Instance: "disks/0"},
+			{FullText: "home", Color: "#ff0000", Name: "disks", Instance: "disks/home"},
+		}
+		for i, w := range want {
+			got := b[i+1]
+			if got.Color != w.Color || got.Name != w.Name || got.Instance != w.Instance {
+				t.Errorf("%d: want: %+v, got: %+v", i, w, got)
+			}
+		}
+		break
+	}
+
+	// The module is told which of its blocks was clicked, and the bar makes
+	// room for the block it adds.
+	if _, err := io.WriteString(w, `{"name":"disks","instance":"disks/home","button":1}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case b := <-frames:
+			if texts(b) == "before,root,home,clicked home,after" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("blocks not added")
+		}
+	}
+}
+
+func TestShowTrend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values := []string{"20°C", "21.5°C", "21.5°C", "19°C"}
+	sequence := func() func() (string, error) {
+		var mu sync.Mutex
+		runs := 0
+		return func() (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs++
+			if runs > len(values) {
+				return "", nil
+			}
+			return values[runs-1], nil
+		}
+	}
+
+	frames := make(chan []openbar.Block, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(sequence(), 150*time.Millisecond, openbar.SubSecond(), openbar.ShowTrend(true)),
+			openbar.WithModuleFunc(sequence(), 150*time.Millisecond, openbar.SubSecond(), openbar.ShowTrend(false)),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	want := [][]string{
+		{"20°C", "21.5°C ↑1.5", "21.5°C →", "19°C ↓2.5"},
+		{"20°C", "21.5°C ↑", "21.5°C →", "19°C ↓"},
+	}
+	got := [][]string{{}, {}}
+
+	timeout := time.After(5 * time.Second)
+	for len(got[0]) < len(want[0]) || len(got[1]) < len(want[1]) {
+		select {
+		case b := <-frames:
+			for i := range got {
+				text := b[i].FullText
+				if text == "..." || text == "" || (len(got[i]) > 0 && got[i][len(got[i])-1] == text) {
+					continue
+				}
+				got[i] = append(got[i], text)
+			}
+		case <-timeout:
+			t.Fatalf("want: %q, got: %q", want, got)
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want openbar.Rule
+		err  error
+	}{
+		{"value > 90 for 5m", openbar.Rule{Op: ">", Limit: 90, For: 5 * time.Minute}, nil},
+		{"value <= -1.5", openbar.Rule{Op: "<=", Limit: -1.5}, nil},
+		{"value > 90 during 5m", openbar.Rule{}, openbar.ErrRule},
+		{"value => 90", openbar.Rule{}, openbar.ErrRule},
+		{"temp > 90", openbar.Rule{}, openbar.ErrRule},
+		{"value > 90 for soon", openbar.Rule{}, openbar.ErrRule},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, err := openbar.ParseRule(test.in)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("want: %v, got: %v", test.err, err)
+			}
+			if got != test.want {
+				t.Errorf("want: %+v, got: %+v", test.want, got)
+			}
+			if again, _ := openbar.ParseRule(got.String()); err == nil && again != got {
+				t.Errorf("want: %+v, got: %+v from %q", got, again, got.String())
+			}
+		})
+	}
+}
+
+func TestAlert(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	value, fired := 95, make([]openbar.Value, 0)
+
+	frames, updates := make(chan []openbar.Block, 100), make(chan struct{}, 100)
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(func() (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return fmt.Sprint(value), nil
+			}, 100*time.Millisecond, openbar.SubSecond(), openbar.Alerting(openbar.Alert{
+				Rule:   openbar.Rule{Op: ">", Limit: 90, For: 300 * time.Millisecond},
+				Urgent: true,
+				Fire: func(v openbar.Value) {
+					mu.Lock()
+					defer mu.Unlock()
+					fired = append(fired, v)
+				},
+			})),
+			openbar.WithUpdateHook(func(openbar.Status) {
+				select {
+				case updates <- struct{}{}:
+				default:
+				}
+			}),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	// The rule must hold for a while before the block turns urgent.
+	start := time.Now()
+	for b := range frames {
+		if b[0].Urgent {
+			if took := time.Since(start); took < 300*time.Millisecond {
+				t.Errorf("want: urgent after 300ms, got: %v", took)
+			}
+			break
+		}
+	}
+
+	mu.Lock()
+	if len(fired) != 1 || fired[0].Number != 95 {
+		t.Errorf("want: fired once with 95, got: %+v", fired)
+	}
+	value = 50
+	mu.Unlock()
+
+	for b := range frames {
+		if b[0].FullText == "50" {
+			if b[0].Urgent {
+				t.Error("want: not urgent once the rule breaks")
+			}
+			break
+		}
+	}
+
+	// A few more runs don't fire the alert again.
+	for len(updates) > 0 {
+		<-updates
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-updates:
+		case <-time.After(time.Second):
+			t.Fatal("want: more runs, got: none")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(fired) != 1 {
+		t.Errorf("want: fired once, got: %+v", fired)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	format := func(text string) *openbar.Format {
+		f, err := openbar.ParseFormat(text, map[string]string{"bat": "B"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	frames := make(chan []openbar.Block, 100)
+	formats := []*openbar.Format{
+		format(`{{icon "bat"}} {{trunc 4 .}}|{{pad 3 "x"}}|{{color "#f00" "hot"}}`),
+		format(`{{icon "temp"}} {{.}}`),
+		format(`{{icon "nope"}}`),
+	}
+
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(func() (string, error) { return "a<bcdef", nil }, time.Hour,
+				openbar.Formatted(formats[0])),
+			openbar.WithModuleFunc(func() (string, error) { return "<b>95</b>", nil }, time.Hour,
+				openbar.Markup(), openbar.UrgentAbove(90), openbar.Formatted(formats[1])),
+			openbar.WithModuleFunc(func() (string, error) { return "a&b", nil }, time.Hour,
+				openbar.Formatted(formats[2])),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				select {
+				case frames <- append([]openbar.Block(nil), b...):
+				default:
+				}
+			}),
+		)
+	}()
+
+	want := []openbar.Block{
+		{FullText: `B a&lt;b…|  x|<span foreground="#f00">hot</span>`, Markup: openbar.Pango},
+		{FullText: "🌡 <b>95</b>", Markup: openbar.Pango, Urgent: true},
+		// Formats failing leave the text as it is.
+		{FullText: "a&amp;b", Markup: openbar.Pango},
+	}
+
+	for b := range frames {
+		if b[0].FullText == "..." || b[1].FullText == "..." || b[2].FullText == "..." {
+			continue
+		}
+		for i := range want {
+			if b[i].FullText != want[i].FullText || b[i].Markup != want[i].Markup || b[i].Urgent != want[i].Urgent {
+				t.Errorf("%d: want: %+v, got: %+v", i, want[i], b[i])
+			}
+		}
+		return
+	}
+}
+
+func TestOnce(t *testing.T) {
+	// The slow module returns once the fast one did.
+	var once sync.Once
+	done := make(chan struct{})
+	slow := func() (string, error) {
+		<-done
+		return "slow", nil
+	}
+	fast := func() (string, error) {
+		once.Do(func() { close(done) })
+		return "fast", nil
+	}
+	tomorrow := openbar.Window{Days: []time.Weekday{(time.Now().Weekday() + 1) % 7}, To: 24 * time.Hour}
+
+	stdout := bytes.NewBuffer(nil)
+	err := openbar.Once(
+		context.Background(),
+		openbar.WithOutput(stdout),
+		openbar.WithModuleFunc(slow, time.Hour),
+		openbar.WithModuleFunc(fast, time.Hour),
+		openbar.WithModuleFunc(fast, time.Hour, openbar.ActiveDuring(tomorrow)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single line comes out, with every module that had to run.
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("want: a single line, got: %q", stdout.String())
+	}
+
+	var b []openbar.Block
+	if err := json.Unmarshal([]byte(lines[0]), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0, len(b))
+	for _, block := range b {
+		got = append(got, block.FullText)
+	}
+	if want := []string{"slow", "fast", ""}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	// Monday 2024-01-01 and the following days.
+	at := func(day int, clock string) time.Time {
+		res, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("2024-01-%02d %s", day, clock), time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		schedule string
+		from     time.Time
+		want     time.Time
+		err      bool
+	}{
+		{schedule: "0 7 * * *", from: at(1, "06:59"), want: at(1, "07:00")},
+		{schedule: "0 7 * * *", from: at(1, "07:00"), want: at(2, "07:00")},
+		{schedule: "*/15 9-18 * * mon-fri", from: at(5, "18:50"), want: at(8, "09:00")},
+		{schedule: "30 8 1,15 * *", from: at(2, "00:00"), want: at(15, "08:30")},
+		{schedule: "0 0 13 * fri", from: at(1, "00:00"), want: at(5, "00:00")},
+		{schedule: "0 12 * * 7", from: at(1, "00:00"), want: at(7, "12:00")},
+		{schedule: "@weekly", from: at(1, "00:00"), want: at(7, "00:00")},
+		{schedule: "0 7 * *", err: true},
+		{schedule: "60 * * * *", err: true},
+		{schedule: "0 7 * * sometimes", err: true},
+		{schedule: "0 0 31 feb *", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			s, err := openbar.ParseSchedule(test.schedule)
+			if !errors.Is(err, openbar.ErrSchedule) != !test.err {
+				t.Fatalf("want error: %v, got: %v", test.err, err)
+			}
+			if got := s.Next(test.from); err == nil && !got.Equal(test.want) {
+				t.Errorf("want: %v, got: %v", test.want, got)
+			}
+		})
+	}
+
+	// Scheduled modules need no interval and still run when the bar starts.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	yearly, err := openbar.ParseSchedule("@yearly")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := make(chan string, 100)
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(func() (string, error) { return "ran", nil }, 0, openbar.OnSchedule(yearly)),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				frames <- b[0].FullText
+			}),
+		)
+	}()
+
+	for {
+		select {
+		case text := <-frames:
+			if text == "ran" {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("want: a first run")
+		}
+	}
+}
+
+// A module planning its next runs a few times, then leaving it to its interval.
+type planner struct {
+	runs int32
+	left int32
+}
+
+func (p *planner) FullText() (string, error) {
+	return fmt.Sprint(atomic.AddInt32(&p.runs, 1)), nil
+}
+
+func (p *planner) NextRun() time.Time {
+	if atomic.AddInt32(&p.left, -1) < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(20 * time.Millisecond)
+}
+
+func TestNextRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &planner{left: 2}
+
+	frames := make(chan string, 100)
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModule(p, time.Hour),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				frames <- b[0].FullText
+			}),
+		)
+	}()
+
+	// The module runs at the times it plans despite its interval, then waits
+	// for its next tick.
+	timeout := time.After(time.Second)
+	for text := ""; text != "3"; {
+		select {
+		case text = <-frames:
+		case <-timeout:
+			t.Fatalf("want: 3 runs, got: %d", atomic.LoadInt32(&p.runs))
+		}
+	}
+
+	select {
+	case text := <-frames:
+		t.Errorf("want: 3 runs, got: %s", text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPlanned(t *testing.T) {
+	wait := time.Hour
+	m := openbar.Planned(func(context.Context) (string, time.Duration, error) {
+		return "value", wait, nil
+	})
+
+	if out, err := m.FullText(); out != "value" || err != nil {
+		t.Errorf("want: value, got: %q, %v", out, err)
+	}
+	if next := time.Until(m.(openbar.NextRunner).NextRun()); next <= 0 || next > wait {
+		t.Errorf("want: next run within %v, got: %v", wait, next)
+	}
+
+	// Without delay, the module goes back to its interval.
+	wait = 0
+	if _, err := m.FullText(); err != nil {
+		t.Fatal(err)
+	}
+	if next := m.(openbar.NextRunner).NextRun(); !next.IsZero() {
+		t.Errorf("want: no next run, got: %v", next)
+	}
+}
+
+func TestGroupSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := syscall.Signal(50)
+	runs := make([]int32, 3)
+	module := func(i int) func() (string, error) {
+		return func() (string, error) {
+			return fmt.Sprint(atomic.AddInt32(&runs[i], 1)), nil
+		}
+	}
+
+	frames := make(chan []string, 100)
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithGroupSignal("network", sig),
+			openbar.WithModuleFunc(module(0), time.Hour, openbar.Group("network")),
+			openbar.WithModuleFunc(module(1), time.Hour),
+			openbar.WithModuleFunc(module(2), time.Hour, openbar.Group("network")),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				frames <- []string{b[0].FullText, b[1].FullText, b[2].FullText}
+			}),
+		)
+	}()
+
+	wait := func(want []string) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case f := <-frames:
+				if reflect.DeepEqual(f, want) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("want: %v, got: %v runs", want, runs)
+			}
+		}
+	}
+
+	wait([]string{"1", "1", "1"})
+
+	// Modules of the group run again, the other one doesn't.
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		t.Fatal(err)
+	}
+	wait([]string{"2", "1", "2"})
+}
+
+func TestReloadOn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make([]int32, 2)
+	module := func(i int) func() (string, error) {
+		return func() (string, error) {
+			return fmt.Sprint(atomic.AddInt32(&runs[i], 1)), nil
+		}
+	}
+
+	// The second module takes the signal the first one would have by its
+	// position.
+	sig := syscall.Signal(51)
+	frames := make(chan []string, 100)
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithModuleFunc(module(0), time.Hour, openbar.ReloadOn(sig)),
+			openbar.WithModuleFunc(module(1), time.Hour, openbar.ReloadOn(openbar.ReloadSignal(0))),
+			openbar.WithFrameHook(func(b []openbar.Block) {
+				frames <- []string{b[0].FullText, b[1].FullText}
+			}),
+		)
+	}()
+
+	wait := func(want []string) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case f := <-frames:
+				if reflect.DeepEqual(f, want) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("want: %v, got: %v runs", want, runs)
+			}
+		}
+	}
+
+	wait([]string{"1", "1"})
+
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		t.Fatal(err)
+	}
+	wait([]string{"2", "1"})
+
+	if err := syscall.Kill(os.Getpid(), openbar.ReloadSignal(0)); err != nil {
+		t.Fatal(err)
+	}
+	wait([]string{"2", "2"})
+}
+
+// Run a bar with a single module and return its frames.
+func runErrors(ctx context.Context, f func() (string, error), d time.Duration, opts ...openbar.Option) <-chan string {
+	frames := make(chan string, 100)
+	go func() {
+		_ = openbar.Run(
+			ctx,
+			append([]openbar.Option{
+				openbar.WithOutput(io.Discard),
+				openbar.WithJitter(0),
+				openbar.WithModuleFunc(f, d, openbar.SubSecond()),
+				openbar.WithFrameHook(func(b []openbar.Block) {
+					select {
+					case frames <- b[0].FullText:
+					default:
+					}
+				}),
+			}, opts...)...,
+		)
+	}()
+	return frames
+}
+
+func TestTemporaryError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int32
+	frames := runErrors(ctx, func() (string, error) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return "down", openbar.TemporaryError{Err: errors.New("timeout"), Retry: 20 * time.Millisecond}
+		}
+		return "up", nil
+	}, time.Hour)
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case text := <-frames:
+			if text == "up" {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("want: a retry, got: %d runs", atomic.LoadInt32(&runs))
+		}
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int32
+	start := time.Now()
+	wait := 300 * time.Millisecond
+	frames := runErrors(ctx, func() (string, error) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return "slow down", openbar.RateLimited(errors.New("too many requests"), wait)
+		}
+		return "ok", nil
+	}, 50*time.Millisecond)
+
+	// Ticks are ignored until the service accepts requests again.
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case text := <-frames:
+			if text != "ok" {
+				continue
+			}
+			if took := time.Since(start); took < wait {
+				t.Errorf("want: a run after %v, got: %v", wait, took)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("want: a run after %v, got: %d runs", wait, atomic.LoadInt32(&runs))
+		}
+	}
+}
+
+func TestFatalError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int32
+	control := openbar.NewControl()
+	// Runs of another module on the same interval tell time.
+	ticks := make(chan struct{})
+	ticker := openbar.WithModuleFunc(func() (string, error) {
+		select {
+		case ticks <- struct{}{}:
+		default:
+		}
+		return "", nil
+	}, 50*time.Millisecond, openbar.SubSecond())
+	frames := runErrors(ctx, func() (string, error) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return "revoked", openbar.Fatal(errors.New("invalid token"))
+		}
+		return "ok", nil
+	}, 50*time.Millisecond, openbar.WithControl(control), ticker)
+
+	wait := func(want string) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case text := <-frames:
+				if text == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("want: %q, got: %d runs", want, atomic.LoadInt32(&runs))
+			}
+		}
+	}
+
+	wait("revoked")
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(time.Second):
+			t.Fatal("want: ticks, got: none")
+		}
+	}
+	if got := atomic.LoadInt32(&runs); got != 1 {
+		t.Errorf("want: 1 run, got: %d", got)
+	}
+
+	if err := control.Enable(0); err != nil {
+		t.Fatal(err)
+	}
+
+	wait("ok")
+}
+
+func TestWrappedErrors(t *testing.T) {
+	err := errors.New("failed")
+	if openbar.Temporary(nil) != nil || openbar.RateLimited(nil, time.Second) != nil || openbar.Fatal(nil) != nil {
+		t.Error("want: nil errors to stay nil")
+	}
+	for _, wrapped := range []error{openbar.Temporary(err), openbar.RateLimited(err, time.Second), openbar.Fatal(err)} {
+		if !errors.Is(fmt.Errorf("module: %w", wrapped), err) || wrapped.Error() != err.Error() {
+			t.Errorf("want: %v wrapped, got: %v", err, wrapped)
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	for name, opts := range map[string][]openbar.ModuleOption{
+		"normal": nil,
+		"low":    {openbar.LowPriority()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var runs int32
+			errs := make(chan openbar.ModuleError, 10)
+			frames := make(chan string, 100)
+
+			go func() {
+				_ = openbar.Run(
+					ctx,
+					openbar.WithOutput(io.Discard),
+					openbar.WithJitter(0),
+					openbar.WithErrorChannel(errs),
+					openbar.WithModuleFunc(func() (string, error) {
+						if atomic.AddInt32(&runs, 1) == 1 {
+							panic("boom")
+						}
+						return "ok", nil
+					}, 50*time.Millisecond, append([]openbar.ModuleOption{openbar.SubSecond()}, opts...)...),
+					openbar.WithFrameHook(func(b []openbar.Block) {
+						select {
+						case frames <- b[0].FullText:
+						default:
+						}
+					}),
+				)
+			}()
+
+			select {
+			case err := <-errs:
+				var p openbar.PanicError
+				if !errors.As(err, &p) || p.Value != "boom" || len(p.Stack) == 0 {
+					t.Errorf("want: panic: boom, got: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("want: an error, got: nothing")
+			}
+
+			// The module keeps running.
+			timeout := time.After(time.Second)
+			for {
+				select {
+				case text := <-frames:
+					if text == "ok" {
+						return
+					}
+				case <-timeout:
+					t.Fatalf("want: ok, got: %d runs", atomic.LoadInt32(&runs))
+				}
+			}
+		})
+	}
+}
+
+func TestNotifierCleanup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The notifier cleans up once told to.
+	var cleaned int32
+	stopping, release := make(chan struct{}), make(chan struct{})
+	watcher := openbar.NotifierFunc(func(ctx context.Context, _ func()) error {
+		<-ctx.Done()
+		close(stopping)
+		<-release
+		atomic.StoreInt32(&cleaned, 1)
+		return nil
+	})
+
+	started := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = openbar.Run(
+			ctx,
+			openbar.WithOutput(io.Discard),
+			openbar.WithJitter(0),
+			openbar.WithModuleFunc(func() (string, error) { return "ok", nil }, time.Hour, openbar.RefreshOn(watcher)),
+			openbar.WithFrameHook(func([]openbar.Block) {
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+			}),
+		)
+	}()
+
+	<-started
+	cancel()
+	<-stopping
+
+	select {
+	case <-done:
+		t.Error("want: Run to wait for notifiers to clean up")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want: Run to return")
+	}
+
+	if atomic.LoadInt32(&cleaned) != 1 {
+		t.Error("want: Run to wait for notifiers to clean up")
+	}
+}
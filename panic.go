@@ -0,0 +1,29 @@
+package openbar
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// PanicError is the error of a module run which panicked, along with the
+// stack of the goroutine at the time.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements error.
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Turn the value of a recovered panic into an error. It must be called from
+// the deferred function which recovered for the stack to be the one of the
+// panic. Panics forwarded from another goroutine keep their own.
+func recovered(r interface{}) PanicError {
+	if e, ok := r.(PanicError); ok {
+		return e
+	}
+	buf := make([]byte, 1<<16)
+	return PanicError{r, buf[:runtime.Stack(buf, false)]}
+}
@@ -0,0 +1,442 @@
+// Package pipewire follows the graph of PipeWire with a single pw-dump(1)
+// process streaming its changes, shared by the modules showing the volume, the
+// microphone, the default output or the cameras in use. Modules read the
+// latest state of the graph and are told as soon as it changes, without
+// talking to PipeWire themselves.
+//
+// The process starts on first use. When it stops, for instance when PipeWire
+// restarts, modules are told and the next reading starts it again.
+package pipewire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCommand streams the changes of the graph.
+var DefaultCommand = []string{"pw-dump", "--monitor", "--no-colors"}
+
+// MetadataCommand changes the default nodes.
+var MetadataCommand = []string{"pw-metadata"}
+
+// VolumeCommand changes the volume of the default nodes, see wpctl(1).
+var VolumeCommand = []string{"wpctl"}
+
+// DefaultTimeout bounds the wait for the first state of the graph.
+const DefaultTimeout = 5 * time.Second
+
+// Media classes of the nodes the client keeps.
+const (
+	Sink   = "Audio/Sink"
+	Source = "Audio/Source"
+	Camera = "Video/Source"
+)
+
+// Keys of the default nodes in the metadata, by class. The configured ones are
+// those chosen by the user, which the session manager follows.
+var (
+	defaults = map[string]string{
+		Sink:   "default.audio.sink",
+		Source: "default.audio.source",
+	}
+	targets = map[string]string{
+		Sink:   "@DEFAULT_AUDIO_SINK@",
+		Source: "@DEFAULT_AUDIO_SOURCE@",
+	}
+	configured = map[string]string{
+		Sink:   "default.configured.audio.sink",
+		Source: "default.configured.audio.source",
+	}
+)
+
+var (
+	// ErrNoNode is returned when there is no default node of a class.
+	ErrNoNode = errors.New("no node")
+	// ErrTimeout is returned when PipeWire takes too long to tell its state.
+	ErrTimeout = errors.New("pipewire timeout")
+	// ErrClosed is returned when reading a closed client.
+	ErrClosed = errors.New("pipewire client closed")
+)
+
+// Node is an audio or video device, or a stream.
+type Node struct {
+	ID          int
+	Name        string
+	Description string
+	Class       string
+	// State is running while the node is in use, and idle or suspended
+	// otherwise.
+	State string
+	// Volume is the volume of the loudest channel, in percent as shown by
+	// mixers.
+	Volume float64
+	Muted  bool
+}
+
+// Graph is the state of PipeWire at some point.
+type Graph struct {
+	// Nodes are sorted by identifier.
+	Nodes []Node
+	// Defaults are the names of the default nodes by class.
+	Defaults map[string]string
+}
+
+// Default returns the default node of a class, Sink or Source.
+func (g Graph) Default(class string) (Node, error) {
+	name := g.Defaults[class]
+	for _, n := range g.Nodes {
+		if n.Class == class && n.Name == name {
+			return n, nil
+		}
+	}
+	return Node{}, fmt.Errorf("%w: %s", ErrNoNode, class)
+}
+
+// Class returns the nodes of a class.
+func (g Graph) Class(class string) []Node {
+	res := make([]Node, 0)
+	for _, n := range g.Nodes {
+		if n.Class == class {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// Client follows the graph of PipeWire.
+type Client struct {
+	command []string
+	mu      sync.Mutex
+	nodes   map[int]Node
+	meta    map[string]string
+	subs    map[*func()]struct{}
+	cmd     *exec.Cmd
+	ready   chan struct{}
+	running bool
+	err     error
+	closed  bool
+}
+
+// New returns a client streaming the graph with the given pw-dump command.
+func New(command ...string) *Client {
+	return &Client{command: command, subs: make(map[*func()]struct{})}
+}
+
+var shared = New(DefaultCommand...)
+
+// Commands returns the command lines clients run.
+func Commands() [][]string {
+	return [][]string{DefaultCommand, MetadataCommand, VolumeCommand}
+}
+
+// Shared returns the client shared by all modules.
+func Shared() *Client {
+	return shared
+}
+
+// Graph returns the current state of the graph, starting the stream if needed.
+func (c *Client) Graph() (Graph, error) {
+	c.mu.Lock()
+	err := c.start()
+	ready := c.ready
+	c.mu.Unlock()
+
+	if err != nil {
+		return Graph{}, err
+	}
+
+	select {
+	case <-ready:
+	case <-time.After(DefaultTimeout):
+		return Graph{}, ErrTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.running {
+		return Graph{}, c.err
+	}
+
+	g := Graph{Nodes: make([]Node, 0, len(c.nodes)), Defaults: make(map[string]string)}
+	for _, n := range c.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	for class, key := range defaults {
+		if name, ok := c.meta[key]; ok {
+			g.Defaults[class] = name
+		}
+	}
+
+	return g, nil
+}
+
+// Notify calls changed each time the graph changes, or when the stream stops,
+// until the context is done. The stream is started by readings, so that
+// subscribers keep being told across restarts.
+func (c *Client) Notify(ctx context.Context, changed func()) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.subs[&changed] = struct{}{}
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	delete(c.subs, &changed)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// SetDefault makes the node with the given name the default one of its class,
+// Sink or Source.
+func (c *Client) SetDefault(class, name string) error {
+	key, ok := configured[class]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoNode, class)
+	}
+
+	value, err := json.Marshal(struct {
+		Name string `json:"name"`
+	}{name})
+	if err != nil {
+		return err
+	}
+
+	args := append(append([]string{}, MetadataCommand[1:]...), "0", key, string(value), "Spa:String:JSON")
+
+	//nolint:gosec
+	return exec.Command(MetadataCommand[0], args...).Run()
+}
+
+// Adjust changes the volume of the default node of a class, Sink or Source, by
+// the given number of percents. The volume stays between 0 and 100%.
+func (c *Client) Adjust(class string, delta int) error {
+	target, ok := targets[class]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoNode, class)
+	}
+
+	step := fmt.Sprintf("%d%%+", delta)
+	if delta < 0 {
+		step = fmt.Sprintf("%d%%-", -delta)
+	}
+
+	args := append(append([]string{}, VolumeCommand[1:]...), "set-volume", "--limit", "1.0", target, step)
+
+	//nolint:gosec
+	return exec.Command(VolumeCommand[0], args...).Run()
+}
+
+// Close stops the stream. Pending notifications return when their context is
+// done, and readings fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.running {
+		return c.cmd.Process.Kill()
+	}
+	return nil
+}
+
+// Start the stream unless it runs. The caller holds the lock.
+func (c *Client) start() error {
+	switch {
+	case c.closed:
+		return ErrClosed
+	case c.running:
+		return nil
+	}
+
+	//nolint:gosec
+	cmd := exec.Command(c.command[0], c.command[1:]...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("pipewire: %w", err)
+	}
+
+	c.cmd, c.running, c.err = cmd, true, nil
+	c.nodes, c.meta = make(map[int]Node), make(map[string]string)
+	c.ready = make(chan struct{})
+
+	go func(ready chan struct{}) {
+		err := c.stream(json.NewDecoder(out), ready)
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+
+		c.mu.Lock()
+		c.running, c.err = false, fmt.Errorf("pipewire: %w", err)
+		started := true
+		select {
+		case <-ready:
+		default:
+			started = false
+			close(ready)
+		}
+		c.mu.Unlock()
+
+		// Streams failing from the start, like when PipeWire doesn't run,
+		// are not worth telling since readings would start them again
+		// right away.
+		if started {
+			c.notify()
+		}
+	}(c.ready)
+
+	return nil
+}
+
+// Apply the batches of changes printed by pw-dump until it stops. The first
+// batch is the whole graph.
+func (c *Client) stream(dec *json.Decoder, ready chan struct{}) error {
+	for first := true; ; first = false {
+		var batch []object
+		if err := dec.Decode(&batch); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		for _, o := range batch {
+			c.apply(o)
+		}
+		if first {
+			close(ready)
+		}
+		c.mu.Unlock()
+
+		c.notify()
+	}
+}
+
+// Call every subscriber. Handlers are called without the lock so that they may
+// read the graph.
+func (c *Client) notify() {
+	c.mu.Lock()
+	fns := make([]func(), 0, len(c.subs))
+	for fn := range c.subs {
+		fns = append(fns, *fn)
+	}
+	c.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// An object is a global of PipeWire, as printed by pw-dump. Removed globals
+// only have their identifier.
+type object struct {
+	ID       int                    `json:"id"`
+	Type     string                 `json:"type"`
+	Info     *info                  `json:"info"`
+	Props    map[string]interface{} `json:"props"`
+	Metadata []struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	} `json:"metadata"`
+}
+
+type info struct {
+	State  string                 `json:"state"`
+	Props  map[string]interface{} `json:"props"`
+	Params struct {
+		Props []struct {
+			Mute           *bool     `json:"mute"`
+			ChannelVolumes []float64 `json:"channelVolumes"`
+		} `json:"Props"`
+	} `json:"params"`
+}
+
+// Types of the globals the client keeps.
+const (
+	typeNode     = "PipeWire:Interface:Node"
+	typeMetadata = "PipeWire:Interface:Metadata"
+)
+
+// Apply a change of the graph. The caller holds the lock.
+func (c *Client) apply(o object) {
+	switch o.Type {
+	case "":
+		delete(c.nodes, o.ID)
+	case typeNode:
+		c.node(o)
+	case typeMetadata:
+		if o.Props["metadata.name"] != "default" {
+			return
+		}
+		for _, m := range o.Metadata {
+			var v struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(m.Value, &v); err != nil || v.Name == "" {
+				delete(c.meta, m.Key)
+				continue
+			}
+			c.meta[m.Key] = v.Name
+		}
+	}
+}
+
+// Apply a change of a node. Updates may leave out what didn't change, so the
+// node starts from what is known of it. The caller holds the lock.
+func (c *Client) node(o object) {
+	if o.Info == nil {
+		return
+	}
+
+	n, ok := c.nodes[o.ID]
+	if !ok {
+		n = Node{ID: o.ID}
+	}
+
+	if v, ok := o.Info.Props["media.class"].(string); ok {
+		n.Class = v
+	}
+	if v, ok := o.Info.Props["node.name"].(string); ok {
+		n.Name = v
+	}
+	if v, ok := o.Info.Props["node.description"].(string); ok {
+		n.Description = v
+	}
+	if o.Info.State != "" {
+		n.State = o.Info.State
+	}
+
+	// Volumes are cubic, mixers show their cube root.
+	for _, p := range o.Info.Params.Props {
+		if p.Mute != nil {
+			n.Muted = *p.Mute
+		}
+		if len(p.ChannelVolumes) > 0 {
+			loudest := 0.0
+			for _, v := range p.ChannelVolumes {
+				loudest = math.Max(loudest, v)
+			}
+			n.Volume = math.Round(math.Cbrt(loudest) * 100)
+		}
+	}
+
+	switch n.Class {
+	case Sink, Source, Camera:
+		c.nodes[o.ID] = n
+	default:
+		delete(c.nodes, o.ID)
+	}
+}
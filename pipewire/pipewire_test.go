@@ -0,0 +1,136 @@
+package pipewire_test
+
+import (
+	"context"
+	"errors"
+	"openbar/pipewire"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A fake pw-dump printing the graph, then a change once told to.
+const script = `#!/bin/sh
+cat <<'JSON'
+[
+  {"id": 0, "type": "PipeWire:Interface:Core", "info": {}},
+  {"id": 40, "type": "PipeWire:Interface:Metadata", "props": {"metadata.name": "default"}, "metadata": [
+    {"subject": 0, "key": "default.audio.sink", "type": "Spa:String:JSON", "value": {"name": "speakers"}},
+    {"subject": 0, "key": "default.audio.source", "type": "Spa:String:JSON", "value": {"name": "mic"}}
+  ]},
+  {"id": 50, "type": "PipeWire:Interface:Node", "info": {"state": "idle",
+    "props": {"media.class": "Audio/Sink", "node.name": "speakers", "node.description": "Speakers"},
+    "params": {"Props": [{"volume": 1.0, "mute": false, "channelVolumes": [0.125, 0.064]}]}}},
+  {"id": 51, "type": "PipeWire:Interface:Node", "info": {"state": "suspended",
+    "props": {"media.class": "Audio/Sink", "node.name": "headset", "node.description": "Headset"},
+    "params": {"Props": [{"mute": true, "channelVolumes": [1.0, 1.0]}]}}},
+  {"id": 52, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+    "props": {"media.class": "Audio/Source", "node.name": "mic", "node.description": "Microphone"},
+    "params": {"Props": [{"mute": false, "channelVolumes": [0.216]}]}}},
+  {"id": 53, "type": "PipeWire:Interface:Node", "info": {"state": "suspended",
+    "props": {"media.class": "Video/Source", "node.name": "cam", "node.description": "Webcam"}, "params": {}}},
+  {"id": 60, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+    "props": {"media.class": "Stream/Output/Audio", "node.name": "firefox"}, "params": {}}}
+]
+JSON
+while [ ! -e "$(dirname "$0")/go" ]; do sleep 0.05; done
+cat <<'JSON'
+[
+  {"id": 40, "type": "PipeWire:Interface:Metadata", "props": {"metadata.name": "default"}, "metadata": [
+    {"subject": 0, "key": "default.audio.sink", "type": "Spa:String:JSON", "value": {"name": "headset"}}
+  ]},
+  {"id": 53, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+    "props": {"media.class": "Video/Source", "node.name": "cam", "node.description": "Webcam"}, "params": {}}},
+  {"id": 50, "info": null}
+]
+JSON
+exec sleep 60
+`
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pw-dump")
+	if err := os.WriteFile(path, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := pipewire.New(path)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 16)
+	go func() {
+		_ = c.Notify(ctx, func() {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	g, err := c.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := pipewire.Graph{
+		Nodes: []pipewire.Node{
+			{ID: 50, Name: "speakers", Description: "Speakers", Class: pipewire.Sink, State: "idle", Volume: 50},
+			{ID: 51, Name: "headset", Description: "Headset", Class: pipewire.Sink, State: "suspended", Volume: 100, Muted: true},
+			{ID: 52, Name: "mic", Description: "Microphone", Class: pipewire.Source, State: "running", Volume: 60},
+			{ID: 53, Name: "cam", Description: "Webcam", Class: pipewire.Camera, State: "suspended"},
+		},
+		Defaults: map[string]string{pipewire.Sink: "speakers", pipewire.Source: "mic"},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Fatalf("want: %+v, got: %+v", want, g)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "go"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for len(g.Nodes) != 3 {
+		select {
+		case <-changes:
+		case <-deadline:
+			t.Fatal("want: change, got: nothing")
+		}
+		if g, err = c.Graph(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sink, err := g.Default(pipewire.Sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.Name != "headset" || !sink.Muted {
+		t.Errorf("want: muted headset, got: %+v", sink)
+	}
+
+	if cams := g.Class(pipewire.Camera); len(cams) != 1 || cams[0].State != "running" {
+		t.Errorf("want: running camera, got: %+v", cams)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	c := pipewire.New("openbar-nonexistent")
+
+	if _, err := c.Graph(); err == nil {
+		t.Error("want: error, got: nil")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Graph(); !errors.Is(err, pipewire.ErrClosed) {
+		t.Errorf("want: %v, got: %v", pipewire.ErrClosed, err)
+	}
+}
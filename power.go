@@ -0,0 +1,101 @@
+package openbar
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PowerMode tells whether the bar saves energy.
+type PowerMode int
+
+const (
+	// LowPowerAuto saves energy when the battery runs low. This is the default.
+	LowPowerAuto PowerMode = iota
+	// LowPowerOn always saves energy.
+	LowPowerOn
+	// LowPowerOff never saves energy.
+	LowPowerOff
+)
+
+// String implements fmt.Stringer for PowerMode.
+func (m PowerMode) String() string {
+	switch m {
+	case LowPowerAuto:
+		return "auto"
+	case LowPowerOn:
+		return "on"
+	case LowPowerOff:
+		return "off"
+	default:
+		return fmt.Sprintf("PowerMode(%d)", int(m))
+	}
+}
+
+// ParsePowerMode returns the mode with the given name.
+func ParsePowerMode(s string) (PowerMode, error) {
+	for _, m := range []PowerMode{LowPowerAuto, LowPowerOn, LowPowerOff} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid power mode: %s", s)
+}
+
+// LowPower describes how the bar saves energy. In low-power mode, intervals
+// are multiplied by Factor, busy animations and highlights are disabled,
+// modules set to pause stop refreshing and an indicator block is appended to
+// the bar.
+type LowPower struct {
+	// Factor lengthens intervals. Values below 2 default to 3.
+	Factor int
+	// Below is the battery percentage under which low-power mode is engaged
+	// automatically. Zero disables it.
+	Below int
+	// Level returns the current battery percentage.
+	Level func() (int, error)
+	// Indicator is the text of the block shown while energy is saved.
+	Indicator string
+}
+
+// How often the battery level is checked.
+const levelPoll = time.Minute
+
+var defaultLowPower = LowPower{Factor: 3, Indicator: "low power"}
+
+// Report whether the battery level is below the threshold each time it is
+// checked, until the context is done.
+func (lp LowPower) watch(ctx context.Context, below chan<- bool) {
+	t := time.NewTicker(levelPoll)
+	defer t.Stop()
+
+	for {
+		if level, err := lp.Level(); err == nil {
+			select {
+			case below <- level < lp.Below:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			debug(err)
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Tell every worker whether energy is saved. Only the last state matters to
+// workers that did not see the previous one yet.
+func (s scheduler) lowPower(low bool) {
+	for _, c := range s.power {
+		select {
+		case <-c:
+		default:
+		}
+		c <- low
+	}
+}
@@ -0,0 +1,57 @@
+package openbar
+
+import (
+	"runtime"
+	"syscall"
+)
+
+const (
+	lowestNice = 19      // Lowest CPU priority.
+	idleIO     = 3 << 13 // Idle IO scheduling class for ioprio_set(2).
+	ioprioWho  = 1       // Target a single thread for ioprio_set(2).
+	lowSlots   = 1       // Low-priority modules running at once by default.
+)
+
+// Execute a module on a thread of its own with the lowest CPU and IO priority,
+// once one of the given slots is free, so that low-priority modules never take
+// more processors than there are slots, whatever GOMAXPROCS is. The thread is
+// never unlocked so it exits along with the goroutine instead of carrying its
+// priority over to the rest of the bar. A panic of the module is forwarded to
+// the caller.
+func lowPriority(slots chan struct{}, run func() (Block, error)) (Block, error) {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	type output struct {
+		block Block
+		err   error
+		panic *PanicError
+	}
+
+	c := make(chan output, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		defer func() {
+			if r := recover(); r != nil {
+				e := recovered(r)
+				c <- output{panic: &e}
+			}
+		}()
+
+		tid := syscall.Gettid()
+		_ = syscall.Setpriority(syscall.PRIO_PROCESS, tid, lowestNice)
+		_, _, _ = syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWho, uintptr(tid), idleIO)
+
+		b, err := run()
+		c <- output{b, err, nil}
+	}()
+
+	res := <-c
+	if res.panic != nil {
+		panic(*res.panic)
+	}
+
+	return res.block, res.err
+}
@@ -0,0 +1,80 @@
+package openbar
+
+import (
+	"context"
+	"sync"
+)
+
+// StreamModule is a bar module driven by external events, like inotify,
+// D-Bus signals or Sway IPC, which knows its value as soon as it changes
+// rather than when asked. Stream sends each new value until the context is
+// done, and may close the channel then. The block shows the last value sent,
+// and is empty until the first one. Optional interfaces, like Urgenter or
+// ClickHandler, apply to stream modules too and describe the last value sent.
+type StreamModule interface {
+	Stream(ctx context.Context) <-chan Update
+}
+
+// StreamModuleFunc is a function for the single-method interface StreamModule.
+type StreamModuleFunc func(ctx context.Context) <-chan Update
+
+// Stream implements StreamModule for StreamModuleFunc.
+func (f StreamModuleFunc) Stream(ctx context.Context) <-chan Update {
+	return f(ctx)
+}
+
+// Update is a value sent by a StreamModule, as FullText would return it.
+type Update struct {
+	Text string
+	Err  error
+}
+
+// The last value of a stream module. Its block is refreshed with each value,
+// so that values go through thresholds, formats and hooks like those of other
+// modules.
+type pushed struct {
+	source StreamModule
+
+	mu   sync.Mutex
+	last Update
+}
+
+// FullText implements Module: it returns the last value.
+func (p *pushed) FullText() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last.Text, p.last.Err
+}
+
+// Notify implements Notifier: the block is refreshed with each value.
+func (p *pushed) Notify(ctx context.Context, changed func()) error {
+	updates := p.source.Stream(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case u, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			p.mu.Lock()
+			p.last = u
+			p.mu.Unlock()
+			changed()
+		}
+	}
+}
+
+// WithStreamModule configures a module sending its values. It never runs on a
+// schedule, so it has no interval, and it takes the same options as other
+// modules. Reloading it shows its last value again.
+func WithStreamModule(module StreamModule, opts ...ModuleOption) Option {
+	return func(cfg *config) {
+		p := &pushed{source: module}
+		c := cell{module: p, manual: true, push: p}
+		for _, opt := range opts {
+			opt(&c)
+		}
+		cfg.cells = append(cfg.cells, c)
+	}
+}
@@ -0,0 +1,89 @@
+// Package record captures the stream emitted by OpenBar with timestamps and
+// replays it later at the original speed, so that a bug seen on the bar can be
+// reproduced and shared without the modules that caused it.
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// An entry is one chunk of the stream and its offset since the recording started.
+type entry struct {
+	Offset time.Duration `json:"t"`
+	Data   string        `json:"d"`
+}
+
+// Recorder is a writer forwarding everything to an underlying writer while
+// saving a timestamped copy of each write to a recording.
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	enc   *json.Encoder
+	start time.Time
+}
+
+// NewRecorder returns a writer forwarding to w and recording to rec.
+func NewRecorder(w, rec io.Writer) *Recorder {
+	return &Recorder{w: w, enc: json.NewEncoder(rec), start: time.Now()}
+}
+
+// Write implements io.Writer. The chunk is recorded even if forwarding it fails
+// since that is probably what needs to be investigated.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(entry{time.Since(r.start), string(p)}); err != nil {
+		return 0, err
+	}
+
+	return r.w.Write(p)
+}
+
+// Replay writes a recording to w, waiting between chunks as much as the
+// original stream did.
+func Replay(ctx context.Context, w io.Writer, rec io.Reader) error {
+	scanner := bufio.NewScanner(rec)
+	scanner.Buffer(nil, 1<<24)
+
+	start := time.Now()
+
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return err
+		}
+
+		if err := sleep(ctx, e.Offset-time.Since(start)); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Wait for the given duration unless the context is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
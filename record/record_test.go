@@ -0,0 +1,59 @@
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"openbar/record"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	out, rec := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+	r := record.NewRecorder(out, rec)
+
+	chunks := []string{"{\"version\":1}\n[", "[{\"full_text\":\"foo\"}],", "[{\"full_text\":\"bar\"}],"}
+
+	for _, chunk := range chunks {
+		if _, err := r.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := strings.Join(chunks, ""); out.String() != want {
+		t.Errorf("want: %q, got: %q", want, out.String())
+	}
+
+	replayed := bytes.NewBuffer(nil)
+
+	if err := record.Replay(context.Background(), replayed, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != replayed.String() {
+		t.Errorf("want: %q, got: %q", out.String(), replayed.String())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// Chunks written 10ms apart.
+	rec := strings.NewReader(`{"t":0,"d":"a"}` + "\n" + `{"t":10000000,"d":"b"}` + "\n" + `{"t":20000000,"d":"c"}` + "\n")
+
+	replayed := bytes.NewBuffer(nil)
+
+	start := time.Now()
+
+	if err := record.Replay(context.Background(), replayed, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("replay too fast: %v", elapsed)
+	}
+
+	if replayed.String() != "abc" {
+		t.Errorf("want: %q, got: %q", "abc", replayed.String())
+	}
+}
@@ -0,0 +1,126 @@
+package openbar
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultRetry is how long a module failing with a temporary error waits
+// before running again, unless the error tells otherwise.
+const DefaultRetry = 5 * time.Second
+
+// Errors returned by modules are shown as configured, then modules run again
+// at their next tick. Wrapping them in one of the types below tells the bar
+// what to do about them instead.
+
+// TemporaryError is an error expected to go away soon, like a network hiccup.
+// The module runs again after Retry, or DefaultRetry when zero, if that comes
+// before its next tick. Temporary errors are not logged.
+type TemporaryError struct {
+	Err   error
+	Retry time.Duration
+}
+
+// Temporary wraps err into a TemporaryError, retried after DefaultRetry. A
+// nil error stays nil.
+func Temporary(err error) error {
+	if err == nil {
+		return nil
+	}
+	return TemporaryError{Err: err}
+}
+
+// Error implements error.
+func (e TemporaryError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e TemporaryError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimitError is an error of a service asking to be left alone for a
+// while, like with the Retry-After header of HTTP. The module doesn't tick
+// until then.
+type RateLimitError struct {
+	Err   error
+	Until time.Time
+}
+
+// RateLimited wraps err into a RateLimitError asking to wait for the given
+// delay. A nil error stays nil.
+func RateLimited(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return RateLimitError{err, time.Now().Add(after)}
+}
+
+// Error implements error.
+func (e RateLimitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// FatalError is an error running again won't fix, like a revoked token. The
+// module is disabled with the error shown, until enabled again from a click
+// or the control socket.
+type FatalError struct {
+	Err error
+}
+
+// Fatal wraps err into a FatalError. A nil error stays nil.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return FatalError{err}
+}
+
+// Error implements error.
+func (e FatalError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e FatalError) Unwrap() error {
+	return e.Err
+}
+
+// Move the next planned run of a module, zero if there is none, according to
+// the error of its last run: temporary errors bring it closer if the module
+// would otherwise wait longer, rate limits push it back. Modules without
+// interval pass zero.
+func replan(err error, next, now time.Time, interval time.Duration) time.Time {
+	var limit RateLimitError
+	var temp TemporaryError
+	switch {
+	case errors.As(err, &limit):
+		if limit.Until.After(next) && limit.Until.After(now) {
+			return limit.Until
+		}
+	case errors.As(err, &temp):
+		d := temp.Retry
+		if d <= 0 {
+			d = DefaultRetry
+		}
+		if interval > 0 && d >= interval {
+			break
+		}
+		if at := now.Add(d); next.IsZero() || at.Before(next) {
+			return at
+		}
+	}
+	return next
+}
+
+// Tell whether an error is worth logging. Temporary ones are expected, and
+// panics are logged along with their stack when they happen.
+func logged(err error) bool {
+	return err != nil && !errors.As(err, new(TemporaryError)) && !errors.As(err, new(PanicError))
+}
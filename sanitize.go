@@ -0,0 +1,46 @@
+package openbar
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Make the text of a module fit on a bar, whatever the module printed: line
+// breaks and tabs become spaces, other control characters and invalid UTF-8
+// are dropped. A trailing line break, as left by most commands, is removed.
+func sanitize(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if clean(s) {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+		case r == '\r' && i < len(s) && s[i] == '\n':
+		case r == '\n', r == '\r', r == '\t', r == '\v', r == '\f':
+			sb.WriteByte(' ')
+		case unicode.IsControl(r):
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// Tell whether a text can be printed as is, which is the common case.
+func clean(s string) bool {
+	for _, r := range s {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
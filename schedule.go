@@ -0,0 +1,246 @@
+package openbar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSchedule is returned when parsing an invalid schedule.
+var ErrSchedule = errors.New("invalid schedule")
+
+// Schedule is a set of times of the year given like in crontab(5), at which a
+// module runs instead of at intervals.
+type Schedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// When both days of the month and of the week are restricted, either of
+	// them matching is enough.
+	either bool
+}
+
+// NextRunner is implemented by modules knowing when they should run next,
+// like a module following the sun waiting for the next sunset. NextRun is
+// called after each run: the module then runs at that time instead of at its
+// next tick, and the zero time lets it tick again.
+type NextRunner interface {
+	NextRun() time.Time
+}
+
+// PlannerFunc is a module function telling along with its value how long to
+// wait before its next run, like an API asking clients to come back later.
+// Zero leaves the module to its interval.
+type PlannerFunc func(ctx context.Context) (string, time.Duration, error)
+
+// Planned returns a module running f, which plans its own runs.
+func Planned(f PlannerFunc) Module {
+	return &planned{f: f}
+}
+
+// The module of a PlannerFunc, remembering the time of the next run.
+type planned struct {
+	f PlannerFunc
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// FullText implements Module.
+func (p *planned) FullText() (string, error) {
+	return p.FullTextContext(context.Background())
+}
+
+// FullTextContext implements ContextModule.
+func (p *planned) FullTextContext(ctx context.Context) (string, error) {
+	text, d, err := p.f(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next = time.Time{}
+	if d > 0 {
+		p.next = time.Now().Add(d)
+	}
+
+	return text, err
+}
+
+// NextRun implements NextRunner.
+func (p *planned) NextRun() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next
+}
+
+// Shorthands for common schedules.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var months = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// ParseSchedule reads a schedule made of five fields, the minute, hour, day
+// of the month, month and day of the week, like "0 7 * * *" for every day at
+// 07:00 or "*/15 9-18 * * mon-fri" for every quarter of an hour during office
+// hours. Fields are lists of values, ranges and steps, and months and days of
+// the week may be given by name. Shorthands like "@daily" are understood too.
+// Times are those of the local clock.
+func ParseSchedule(s string) (Schedule, error) {
+	expr := s
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("%w: %s: want 5 fields, got %d", ErrSchedule, s, len(fields))
+	}
+
+	days := make(map[string]int, len(weekdays))
+	for name, d := range weekdays {
+		days[name] = int(d)
+	}
+
+	var res Schedule
+	var err error
+	for i, f := range []struct {
+		set      *uint64
+		min, max int
+		names    map[string]int
+	}{
+		{&res.minutes, 0, 59, nil},
+		{&res.hours, 0, 23, nil},
+		{&res.days, 1, 31, nil},
+		{&res.months, 1, 12, months},
+		{&res.weekdays, 0, 7, days},
+	} {
+		if *f.set, err = parseField(fields[i], f.min, f.max, f.names); err != nil {
+			return Schedule{}, fmt.Errorf("%w: %s: %v", ErrSchedule, s, err)
+		}
+	}
+
+	// Sunday is either 0 or 7.
+	if res.weekdays&(1<<7) != 0 {
+		res.weekdays |= 1
+	}
+	res.either = !strings.HasPrefix(fields[2], "*") && !strings.HasPrefix(fields[4], "*")
+
+	if res.Next(time.Now()).IsZero() {
+		return Schedule{}, fmt.Errorf("%w: %s: never happens", ErrSchedule, s)
+	}
+
+	return res, nil
+}
+
+// Read a field like "1-5", "*/10" or "mon,wed,fri" into a set of values.
+func parseField(s string, min, max int, names map[string]int) (uint64, error) {
+	var res uint64
+
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step: %s", part)
+			}
+			part, step = part[:i], n
+		}
+
+		first, last := min, max
+		if part != "*" {
+			bounds := strings.Split(part, "-")
+			if len(bounds) > 2 {
+				return 0, fmt.Errorf("invalid range: %s", part)
+			}
+			var err error
+			if first, err = parseValue(bounds[0], min, max, names); err != nil {
+				return 0, err
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = parseValue(bounds[1], min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				last = max
+			}
+			if last < first {
+				return 0, fmt.Errorf("invalid range: %s", part)
+			}
+		}
+
+		for v := first; v <= last; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+
+	return res, nil
+}
+
+// Read a single value of a field, either a number or a name.
+func parseValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("want %d-%d, got: %s", min, max, s)
+	}
+	return v, nil
+}
+
+// Tell whether the schedule applies on the day of the given time.
+func (s Schedule) on(t time.Time) bool {
+	if s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	day, weekday := s.days&(1<<uint(t.Day())) != 0, s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.either {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first time of the schedule after t, or the zero time if
+// there is none within the next few years. Days are walked through calendar
+// dates so that daylight saving changes are followed: times skipped by the
+// clock are skipped by the schedule as well.
+func (s Schedule) Next(t time.Time) time.Time {
+	for day := 0; day <= 8*366; day++ {
+		date := time.Date(t.Year(), t.Month(), t.Day()+day, 0, 0, 0, 0, t.Location())
+		if !s.on(date) {
+			continue
+		}
+		for h := 0; h < 24; h++ {
+			if s.hours&(1<<uint(h)) == 0 {
+				continue
+			}
+			for m := 0; m < 60; m++ {
+				if s.minutes&(1<<uint(m)) == 0 {
+					continue
+				}
+				at := time.Date(date.Year(), date.Month(), date.Day(), h, m, 0, 0, t.Location())
+				if at.After(t) && at.Hour() == h {
+					return at
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,86 @@
+package openbar
+
+import "time"
+
+// Adjuster is implemented by modules whose value is changed by scrolling over
+// their block, like a volume or a brightness. Scrolls are turned into steps
+// the same way for every module, see Scroll. Delta is in the unit of the
+// module, positive when scrolling up.
+type Adjuster interface {
+	Adjust(delta int) error
+}
+
+// Scroll describes how scrolls over the block of an adjustable module change
+// its value. Scrolling fast in one direction makes steps grow, so that going
+// from one end to the other takes a flick rather than many notches.
+type Scroll struct {
+	// Step is how much a single scroll changes the value. Defaults to 5.
+	Step int
+	// Max is the largest step fast scrolls grow to. Steps don't grow unless it
+	// is above Step.
+	Max int
+	// Within is how close scrolls must be to count as fast. Defaults to 150
+	// milliseconds.
+	Within time.Duration
+}
+
+var defaultScroll = Scroll{Step: 5, Within: 150 * time.Millisecond}
+
+// Return how scrolls change the value of a cell.
+func (c cell) scrolling(global Scroll) Scroll {
+	if c.scroll != nil {
+		return *c.scroll
+	}
+	return global
+}
+
+// Fill in the defaults of a scroll.
+func (s Scroll) normalize() Scroll {
+	if s.Step <= 0 {
+		s.Step = defaultScroll.Step
+	}
+	if s.Within <= 0 {
+		s.Within = defaultScroll.Within
+	}
+	if s.Max < s.Step {
+		s.Max = s.Step
+	}
+	return s
+}
+
+// Recent scrolls, by block. Clicks are handled one at a time.
+type streaks map[int]streak
+
+// The last scroll over a block and the step it made.
+type streak struct {
+	button int
+	at     time.Time
+	step   int
+}
+
+// Return how much a click changes the value of a block, 0 unless it is a
+// scroll. The step doubles with each scroll following the previous one in the
+// same direction within the configured time, and starts over otherwise.
+func (s streaks) delta(idx int, c Click, conf Scroll) int {
+	sign := 1
+	switch c.Button {
+	case ScrollUp:
+	case ScrollDown:
+		sign = -1
+	default:
+		delete(s, idx)
+		return 0
+	}
+
+	now := time.Now()
+	step := conf.Step
+	if prev, ok := s[idx]; ok && prev.button == c.Button && now.Sub(prev.at) < conf.Within {
+		step = prev.step * 2
+		if step > conf.Max {
+			step = conf.Max
+		}
+	}
+	s[idx] = streak{c.Button, now, step}
+
+	return sign * step
+}
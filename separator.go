@@ -0,0 +1,19 @@
+package openbar
+
+// Separator configures the line sway draws after a block and the gap it leaves
+// before the next one, in pixels. Fields left nil keep the default of sway.
+type Separator struct {
+	Show  *bool
+	Width *int
+}
+
+// Give a block the fields set in the separator. Unless force is set, the block
+// keeps the fields it already has.
+func (s Separator) apply(b *Block, force bool) {
+	if s.Show != nil && (force || b.Separator == nil) {
+		b.Separator = s.Show
+	}
+	if s.Width != nil && (force || b.SeparatorBlockWidth == nil) {
+		b.SeparatorBlockWidth = s.Width
+	}
+}
@@ -0,0 +1,116 @@
+package openbar
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Levels of a sparkline, from the lowest value to the highest.
+var levels = []rune("▁▂▃▄▅▆▇█")
+
+// Sparklines keep the last values of modules and plot them after their text.
+// Modules with a zero size have no sparkline.
+type sparklines struct {
+	sizes  []int
+	values [][]float64
+}
+
+// Create sparklines of the given sizes.
+func newSparklines(sizes []int) *sparklines {
+	return &sparklines{sizes: sizes, values: make([][]float64, len(sizes))}
+}
+
+// Record the value of the new text of a module and return the text along with
+// its sparkline. Texts without a value leave the history as it is.
+func (s *sparklines) add(idx int, text string, v *Value) string {
+	size := s.sizes[idx]
+	if size <= 0 {
+		return text
+	}
+
+	if v != nil {
+		s.values[idx] = append(s.values[idx], v.Number)
+		if over := len(s.values[idx]) - size; over > 0 {
+			s.values[idx] = s.values[idx][over:]
+		}
+	}
+
+	if len(s.values[idx]) == 0 {
+		return text
+	}
+
+	return strings.TrimSpace(text + " " + plot(s.values[idx]))
+}
+
+// Draw values relative to the lowest and the highest of them.
+func plot(values []float64) string {
+	low, high := values[0], values[0]
+	for _, v := range values {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+
+	var res strings.Builder
+	for _, v := range values {
+		level := 0
+		if high > low {
+			level = int((v - low) / (high - low) * float64(len(levels)-1))
+		}
+		res.WriteRune(levels[level])
+	}
+	return res.String()
+}
+
+// Restore the values of modules from a file written by save. A missing file
+// is not an error since there is no history on first run.
+func (s *sparklines) load(path string, ids []string) error {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	history := make(map[string][]float64)
+	if err := json.Unmarshal(data, &history); err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		values := history[id]
+		if over := len(values) - s.sizes[i]; over > 0 {
+			values = values[over:]
+		}
+		if s.sizes[i] > 0 {
+			s.values[i] = values
+		}
+	}
+
+	return nil
+}
+
+// Write the values of modules to a file, by module identifier. The file is
+// replaced at once so that a crash can't leave it half written.
+func (s *sparklines) save(path string, ids []string) error {
+	history := make(map[string][]float64)
+	for i, id := range ids {
+		if len(s.values[i]) > 0 {
+			history[id] = s.values[i]
+		}
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
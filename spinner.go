@@ -0,0 +1,91 @@
+package openbar
+
+import "time"
+
+// DefaultSpinner is the sequence of frames of the busy animation.
+var DefaultSpinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// How often the busy animation moves to its next frame.
+const spinRate = 100 * time.Millisecond
+
+// An animation spins the blocks of busy modules. Its ticker only runs while at
+// least one module is busy so that an idle bar does not wake up for nothing.
+type animation struct {
+	C      <-chan time.Time
+	frames []string
+	delays []time.Duration
+	since  []time.Time
+	frame  int
+	busy   int
+	ticker *time.Ticker
+}
+
+// Create an animation for modules with the given delays after which the
+// spinner is displayed.
+func newAnimation(frames []string, delays []time.Duration) *animation {
+	a := &animation{
+		frames: frames,
+		delays: delays,
+		since:  make([]time.Time, len(delays)),
+		ticker: time.NewTicker(spinRate),
+	}
+	a.ticker.Stop()
+	a.C = a.ticker.C
+	return a
+}
+
+// Mark a module as busy. Forced modules spin right away regardless of their
+// delay.
+func (a *animation) start(idx int, forced bool) {
+	if a.since[idx].IsZero() {
+		a.busy++
+		if a.busy == 1 {
+			a.ticker.Reset(spinRate)
+		}
+	}
+	if forced || a.since[idx].IsZero() {
+		a.since[idx] = time.Now()
+	}
+	if forced {
+		a.since[idx] = a.since[idx].Add(-a.delays[idx])
+	}
+}
+
+// Mark a module as done.
+func (a *animation) stop(idx int) {
+	if a.since[idx].IsZero() {
+		return
+	}
+	a.since[idx] = time.Time{}
+	a.busy--
+	if a.busy == 0 {
+		a.ticker.Stop()
+	}
+}
+
+// Move to the next frame and update the blocks of modules that have been busy
+// long enough. Their short text is cleared so that the spinner shows in narrow
+// bars too. Return whether any block changed.
+func (a *animation) step(b []Block) bool {
+	a.frame = (a.frame + 1) % len(a.frames)
+
+	changed := false
+
+	for i, since := range a.since {
+		if !since.IsZero() && time.Since(since) >= a.delays[i] {
+			b[i].FullText, b[i].ShortText, changed = a.frames[a.frame], "", true
+		}
+	}
+
+	return changed
+}
+
+// Return the current frame.
+func (a *animation) current() string {
+	return a.frames[a.frame]
+}
+
+// Release the ticker.
+func (a *animation) close() {
+	a.ticker.Stop()
+}
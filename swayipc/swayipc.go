@@ -0,0 +1,162 @@
+// Package swayipc is a minimal client for the IPC of Sway, as described in
+// sway-ipc(7). It only covers what modules need.
+package swayipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// Message types.
+const (
+	Subscribe  uint32 = 2
+	GetOutputs uint32 = 3
+)
+
+// Event types.
+const (
+	OutputEvent uint32 = 0x80000001
+)
+
+// Every message starts with this string.
+const magic = "i3-ipc"
+
+// Messages use the native byte order, which is little-endian on all platforms
+// Sway runs on in practice.
+var order = binary.LittleEndian
+
+// ErrNoSocket is returned when the socket can't be found.
+var ErrNoSocket = errors.New("SWAYSOCK not set")
+
+// ErrMagic is returned when a message doesn't start with the magic string.
+var ErrMagic = errors.New("invalid magic string")
+
+// Socket returns the path of the socket of the running Sway instance.
+func Socket() (string, error) {
+	path := os.Getenv("SWAYSOCK")
+	if path == "" {
+		return "", ErrNoSocket
+	}
+	return path, nil
+}
+
+// Conn is a connection to Sway.
+type Conn struct {
+	net.Conn
+}
+
+// Dial connects to the socket at the given path.
+func Dial(path string) (*Conn, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn}, nil
+}
+
+// Output is a monitor as returned by GET_OUTPUTS.
+type Output struct {
+	Name   string `json:"name"`
+	Make   string `json:"make"`
+	Model  string `json:"model"`
+	Active bool   `json:"active"`
+}
+
+// Outputs returns the connected outputs.
+func (c *Conn) Outputs() ([]Output, error) {
+	res := make([]Output, 0)
+	if err := c.call(GetOutputs, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Subscribe asks for the events with the given names ("output", "workspace",
+// ...). They can then be read with Next.
+func (c *Conn) Subscribe(events ...string) error {
+	res := struct {
+		Success bool `json:"success"`
+	}{}
+
+	if err := c.call(Subscribe, events, &res); err != nil {
+		return err
+	}
+
+	if !res.Success {
+		return fmt.Errorf("subscription refused: %v", events)
+	}
+
+	return nil
+}
+
+// Next waits for the next message and returns its type and payload.
+func (c *Conn) Next() (uint32, []byte, error) {
+	header := make([]byte, len(magic)+8)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return 0, nil, err
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return 0, nil, ErrMagic
+	}
+
+	size := order.Uint32(header[len(magic):])
+	kind := order.Uint32(header[len(magic)+4:])
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return kind, payload, nil
+}
+
+// Send a message and decode the reply into v.
+func (c *Conn) call(kind uint32, payload interface{}, v interface{}) error {
+	if err := c.send(kind, payload); err != nil {
+		return err
+	}
+
+	for {
+		t, data, err := c.Next()
+		if err != nil {
+			return err
+		}
+		// Events may come before the reply on a subscribed connection.
+		if t == kind {
+			return json.Unmarshal(data, v)
+		}
+	}
+}
+
+// Write a message. A nil payload is sent empty.
+func (c *Conn) send(kind uint32, payload interface{}) error {
+	var data []byte
+
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+
+	return Write(c, kind, data)
+}
+
+// Write frames a message of the given type. It is exported so that tests can
+// fake Sway.
+func Write(w io.Writer, kind uint32, data []byte) error {
+	msg := make([]byte, len(magic)+8, len(magic)+8+len(data))
+	copy(msg, magic)
+	order.PutUint32(msg[len(magic):], uint32(len(data)))
+	order.PutUint32(msg[len(magic)+4:], kind)
+
+	_, err := w.Write(append(msg, data...))
+
+	return err
+}
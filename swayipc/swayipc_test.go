@@ -0,0 +1,71 @@
+package swayipc_test
+
+import (
+	"net"
+	"openbar/swayipc"
+	"path/filepath"
+	"testing"
+)
+
+func TestConn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sway.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	// Answer a subscription, send an event and then answer GET_OUTPUTS.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		c := &swayipc.Conn{Conn: conn}
+
+		if _, _, err := c.Next(); err != nil {
+			return
+		}
+		_ = swayipc.Write(conn, swayipc.Subscribe, []byte(`{"success": true}`))
+		_ = swayipc.Write(conn, swayipc.OutputEvent, []byte(`{"change": "unspecified"}`))
+
+		if _, _, err := c.Next(); err != nil {
+			return
+		}
+		_ = swayipc.Write(conn, swayipc.OutputEvent, []byte(`{"change": "unspecified"}`))
+		_ = swayipc.Write(conn, swayipc.GetOutputs, []byte(`[{"name": "eDP-1", "active": true}, {"name": "HDMI-A-1"}]`))
+	}()
+
+	c, err := swayipc.Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Subscribe("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	kind, _, err := c.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kind != swayipc.OutputEvent {
+		t.Errorf("want: %x, got: %x", swayipc.OutputEvent, kind)
+	}
+
+	outputs, err := c.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 2 || outputs[0].Name != "eDP-1" || !outputs[0].Active || outputs[1].Active {
+		t.Errorf("unexpected outputs: %+v", outputs)
+	}
+}
@@ -0,0 +1,63 @@
+package openbar
+
+import "strings"
+
+// Theme is a palette shared by every block, so that the whole bar is restyled
+// at once. Colors of blocks, presets and emphasis may name a color of the theme,
+// like "warning", instead of giving its hex code. Blocks that don't set their
+// separator get those of the theme.
+type Theme struct {
+	// Colors are hex codes by semantic name, usually normal, warning,
+	// critical and accent.
+	Colors              map[string]string
+	Separator           *bool
+	SeparatorBlockWidth *int
+	// Padding is the number of spaces around the text of every block.
+	Padding int
+}
+
+// Conventional names of the colors of a theme.
+const (
+	ColorNormal   = "normal"
+	ColorWarning  = "warning"
+	ColorCritical = "critical"
+	ColorAccent   = "accent"
+)
+
+// Resolve a color. Hex codes are kept, names of the theme are replaced with
+// their value and unknown names are dropped since sway wouldn't understand
+// them.
+func (t Theme) color(c string) string {
+	if c == "" || strings.HasPrefix(c, "#") {
+		return c
+	}
+	return t.Colors[c]
+}
+
+// Return a copy of a frame styled with the theme. Blocks are styled as they are
+// printed so that the theme applies the same way to every source of style.
+func (t Theme) apply(frame []Block) []Block {
+	res := make([]Block, len(frame))
+	pad := strings.Repeat(" ", t.Padding)
+
+	for i, b := range frame {
+		b.Color = t.color(b.Color)
+		b.Background = t.color(b.Background)
+		b.Border = t.color(b.Border)
+		if b.Separator == nil {
+			b.Separator = t.Separator
+		}
+		if b.SeparatorBlockWidth == nil {
+			b.SeparatorBlockWidth = t.SeparatorBlockWidth
+		}
+		if pad != "" && b.FullText != "" {
+			b.FullText = pad + b.FullText + pad
+			if b.ShortText != "" {
+				b.ShortText = pad + b.ShortText + pad
+			}
+		}
+		res[i] = b
+	}
+
+	return res
+}
@@ -0,0 +1,66 @@
+package openbar
+
+import (
+	"math"
+	"strconv"
+)
+
+// Arrows of trends.
+var arrows = map[Trend]string{Steady: "→", Rising: "↑", Falling: "↓"}
+
+// How the trend of a module is shown after its text.
+type trendMode int
+
+const (
+	noTrend    trendMode = iota // The trend is not shown.
+	trendArrow                  // An arrow tells where the value is heading.
+	trendDelta                  // The arrow is followed by the change since the previous value.
+)
+
+// Trends keep the previous value of modules to tell where they are heading.
+type trends struct {
+	modes []trendMode
+	prev  []*float64
+}
+
+// Create trends shown the given ways.
+func newTrends(modes []trendMode) *trends {
+	return &trends{modes: modes, prev: make([]*float64, len(modes))}
+}
+
+// Record the new value of a module and return its text followed by its trend.
+// The trend the module tells wins over the one seen from its values, which is
+// filled in otherwise. The first value only has the trend of the module.
+func (t *trends) add(idx int, text string, v *Value) string {
+	if v == nil {
+		return text
+	}
+
+	prev := t.prev[idx]
+	n := v.Number
+	t.prev[idx] = &n
+
+	delta := 0.0
+	if prev != nil {
+		delta = v.Number - *prev
+	}
+	if v.Trend == Steady {
+		switch {
+		case delta > 0:
+			v.Trend = Rising
+		case delta < 0:
+			v.Trend = Falling
+		}
+	}
+
+	switch {
+	case t.modes[idx] == noTrend:
+		return text
+	case prev == nil && v.Trend == Steady:
+		return text
+	case t.modes[idx] == trendDelta && prev != nil && delta != 0:
+		return text + " " + arrows[v.Trend] + strconv.FormatFloat(math.Abs(math.Round(delta*100)/100), 'f', -1, 64)
+	default:
+		return text + " " + arrows[v.Trend]
+	}
+}
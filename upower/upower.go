@@ -0,0 +1,226 @@
+// Package upower reads power supplies from the UPower service: laptop
+// batteries, wireless peripherals, whether the machine runs on battery, the
+// state of the lid and the active power profile. Modules share the connection
+// to the system bus and are told when anything changes instead of polling.
+package upower
+
+import (
+	"context"
+	"fmt"
+	"openbar/dbus"
+)
+
+const (
+	service     = "org.freedesktop.UPower"
+	root        = dbus.ObjectPath("/org/freedesktop/UPower")
+	iface       = "org.freedesktop.UPower"
+	deviceIface = "org.freedesktop.UPower.Device"
+)
+
+// Power profiles are served by power-profiles-daemon, under the name of UPower
+// in recent versions and under its historical name before.
+var profiles = []struct {
+	service string
+	path    dbus.ObjectPath
+	iface   string
+}{
+	{"org.freedesktop.UPower.PowerProfiles", "/org/freedesktop/UPower/PowerProfiles", "org.freedesktop.UPower.PowerProfiles"},
+	{"net.hadess.PowerProfiles", "/net/hadess/PowerProfiles", "net.hadess.PowerProfiles"},
+}
+
+// Kind is the type of a device.
+type Kind uint32
+
+// Names of the kinds, as printed by upower(1).
+var kinds = []string{
+	"unknown", "line-power", "battery", "ups", "monitor", "mouse", "keyboard",
+	"pda", "phone", "media-player", "tablet", "computer", "gaming-input", "pen",
+	"touchpad", "modem", "network", "headset", "speakers", "headphones", "video",
+	"other-audio", "remote-control", "printer", "scanner", "camera", "wearable",
+	"toy", "bluetooth-generic",
+}
+
+// Kinds of devices powering the machine.
+const (
+	LinePower Kind = 1
+	Battery   Kind = 2
+)
+
+// String implements fmt.Stringer for Kind.
+func (k Kind) String() string {
+	if int(k) < len(kinds) {
+		return kinds[k]
+	}
+	return kinds[0]
+}
+
+// State is the charging state of a battery.
+type State uint32
+
+// Charging states.
+const (
+	Unknown State = iota
+	Charging
+	Discharging
+	Empty
+	FullyCharged
+	PendingCharge
+	PendingDischarge
+)
+
+// Names of the states, as printed by upower(1).
+var states = []string{
+	"unknown", "charging", "discharging", "empty", "fully-charged",
+	"pending-charge", "pending-discharge",
+}
+
+// String implements fmt.Stringer for State.
+func (s State) String() string {
+	if int(s) < len(states) {
+		return states[s]
+	}
+	return states[0]
+}
+
+// Device is a power supply or a device with a battery.
+type Device struct {
+	Path       dbus.ObjectPath
+	NativePath string
+	Kind       Kind
+	Model      string
+	// PowerSupply is set for devices powering the machine, as opposed to
+	// peripherals.
+	PowerSupply bool
+	Present     bool
+	Online      bool
+	Percentage  float64
+	State       State
+	// EnergyRate is the power draw in watts.
+	EnergyRate float64
+	// Capacity is the full capacity compared to the design capacity, in
+	// percent.
+	Capacity     float64
+	ChargeCycles int
+}
+
+// UPower is a client of the UPower service.
+type UPower struct {
+	bus *dbus.Bus
+}
+
+// New returns a client of the UPower service on the given bus.
+func New(bus *dbus.Bus) *UPower {
+	return &UPower{bus}
+}
+
+var system = New(dbus.System())
+
+// System returns the client of the system bus shared by all modules.
+func System() *UPower {
+	return system
+}
+
+// Devices returns every device known to UPower.
+func (u *UPower) Devices() ([]Device, error) {
+	res, err := u.bus.Call(service, root, iface, "EnumerateDevices")
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 {
+		return nil, fmt.Errorf("%w: EnumerateDevices returned %d values", dbus.ErrMessage, len(res))
+	}
+	paths, _ := res[0].([]interface{})
+
+	devices := make([]Device, 0, len(paths))
+	for _, p := range paths {
+		path, ok := p.(dbus.ObjectPath)
+		if !ok {
+			continue
+		}
+		d, err := u.Device(path)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// Device returns the device at the given object path.
+func (u *UPower) Device(path dbus.ObjectPath) (Device, error) {
+	props, err := u.bus.GetAll(service, path, deviceIface)
+	if err != nil {
+		return Device{}, err
+	}
+
+	d := Device{Path: path}
+	d.NativePath, _ = props["NativePath"].(string)
+	d.Model, _ = props["Model"].(string)
+	d.PowerSupply, _ = props["PowerSupply"].(bool)
+	d.Present, _ = props["IsPresent"].(bool)
+	d.Online, _ = props["Online"].(bool)
+	d.Percentage, _ = props["Percentage"].(float64)
+	d.EnergyRate, _ = props["EnergyRate"].(float64)
+	d.Capacity, _ = props["Capacity"].(float64)
+	if kind, ok := props["Type"].(uint32); ok {
+		d.Kind = Kind(kind)
+	}
+	if state, ok := props["State"].(uint32); ok {
+		d.State = State(state)
+	}
+	if cycles, ok := props["ChargeCycles"].(int32); ok {
+		d.ChargeCycles = int(cycles)
+	}
+
+	return d, nil
+}
+
+// OnBattery tells whether the machine runs on battery.
+func (u *UPower) OnBattery() (bool, error) {
+	v, err := u.bus.Get(service, root, iface, "OnBattery")
+	if err != nil {
+		return false, err
+	}
+	on, _ := v.(bool)
+	return on, nil
+}
+
+// LidClosed tells whether the lid is closed. Machines without a lid never have
+// it closed.
+func (u *UPower) LidClosed() (bool, error) {
+	props, err := u.bus.GetAll(service, root, iface)
+	if err != nil {
+		return false, err
+	}
+	present, _ := props["LidIsPresent"].(bool)
+	closed, _ := props["LidIsClosed"].(bool)
+	return present && closed, nil
+}
+
+// Profile returns the active power profile, like "balanced".
+func (u *UPower) Profile() (string, error) {
+	var err error
+	for _, p := range profiles {
+		var v interface{}
+		if v, err = u.bus.Get(p.service, p.path, p.iface, "ActiveProfile"); err == nil {
+			profile, _ := v.(string)
+			return profile, nil
+		}
+	}
+	return "", err
+}
+
+// Notify calls changed each time a device, the daemon or the power profile
+// changes, until the context is done.
+func (u *UPower) Notify(ctx context.Context, changed func()) error {
+	fn := func(dbus.Signal) { changed() }
+
+	// Recent versions of power-profiles-daemon live under the path of UPower.
+	legacy := profiles[1]
+	go func() {
+		_ = u.bus.Watch(ctx, dbus.Match{Sender: legacy.service, PathNamespace: legacy.path}, fn)
+	}()
+
+	return u.bus.Watch(ctx, dbus.Match{PathNamespace: root}, fn)
+}
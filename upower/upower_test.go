@@ -0,0 +1,29 @@
+package upower_test
+
+import (
+	"fmt"
+	"openbar/upower"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		value fmt.Stringer
+		want  string
+	}{
+		{value: upower.LinePower, want: "line-power"},
+		{value: upower.Battery, want: "battery"},
+		{value: upower.Kind(17), want: "headset"},
+		{value: upower.Kind(100), want: "unknown"},
+		{value: upower.FullyCharged, want: "fully-charged"},
+		{value: upower.State(100), want: "unknown"},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if got := test.value.String(); got != test.want {
+				t.Errorf("want: %s, got: %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package openbar
+
+// Urgenter is implemented by modules knowing when their value needs attention,
+// like a battery about to run out. Urgent is called after each successful run
+// and describes the value FullText just returned.
+type Urgenter interface {
+	Urgent() bool
+}
+
+// A threshold marks a block urgent when its value crosses a limit.
+type threshold struct {
+	above bool
+	limit float64
+}
+
+// Tell whether a value crosses the threshold. Missing values never do.
+func (t threshold) crossed(v *Value) bool {
+	if v == nil {
+		return false
+	}
+	if t.above {
+		return v.Number > t.limit
+	}
+	return v.Number < t.limit
+}
+
+// Tell whether the output of a successful run makes the block of a module
+// urgent, either because the module says so or because of its thresholds.
+func (c cell) urgent(v *Value) bool {
+	if u, ok := c.source().(Urgenter); ok && u.Urgent() {
+		return true
+	}
+	for _, t := range c.thresholds {
+		if t.crossed(v) {
+			return true
+		}
+	}
+	return false
+}
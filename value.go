@@ -0,0 +1,92 @@
+package openbar
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The first number of a text is the value of modules that don't tell theirs.
+var number = regexp.MustCompile(`-?[0-9]+(\.[0-9]+)?`)
+
+// Value is the reading of a numeric module, like a volume of 45% out of 100.
+// Thresholds, sparklines and progress bars work on it rather than on the
+// text of the block.
+type Value struct {
+	Number float64 `json:"number"`
+	// Unit follows the number when it is printed, like "%" or " GB".
+	Unit string `json:"unit,omitempty"`
+	// Min and Max bound the number when Max is above Min, like 0 and 100 for
+	// a percentage.
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+	// Trend tells where the number is heading.
+	Trend Trend `json:"trend,omitempty"`
+}
+
+// Trend is the direction a value is heading.
+type Trend int
+
+// Directions of a value.
+const (
+	Steady Trend = iota
+	Rising
+	Falling
+)
+
+// Valuer is implemented by numeric modules. Value is called after each
+// successful run and describes the value FullText just returned. Without it,
+// the value of a module is the first number of its text.
+type Valuer interface {
+	Value() Value
+}
+
+// String prints the number followed by its unit, like "45%".
+func (v Value) String() string {
+	return strconv.FormatFloat(v.Number, 'f', -1, 64) + v.Unit
+}
+
+// Ratio returns where the number stands between its bounds, from 0 to 1, or
+// false when it has none.
+func (v Value) Ratio() (float64, bool) {
+	if v.Max <= v.Min {
+		return 0, false
+	}
+	return math.Min(1, math.Max(0, (v.Number-v.Min)/(v.Max-v.Min))), true
+}
+
+// Bar draws the number between its bounds as a progress bar of the given
+// width, like "███░░". Values without bounds have no bar.
+func (v Value) Bar(width int) string {
+	r, ok := v.Ratio()
+	if !ok || width <= 0 {
+		return ""
+	}
+	full := int(math.Round(r * float64(width)))
+	return strings.Repeat("█", full) + strings.Repeat("░", width-full)
+}
+
+// Append the progress bar of a value to a text, unless it has none.
+func bar(text string, v *Value, width int) string {
+	if v == nil || width <= 0 {
+		return text
+	}
+	if b := v.Bar(width); b != "" {
+		return strings.TrimSpace(text + " " + b)
+	}
+	return text
+}
+
+// Return the value of the output of a successful run, or nil if it has none.
+func (c cell) value(text string) *Value {
+	if v, ok := c.source().(Valuer); ok {
+		res := v.Value()
+		return &res
+	}
+	n, err := strconv.ParseFloat(number.FindString(text), 64)
+	if err != nil {
+		return nil
+	}
+	return &Value{Number: n}
+}
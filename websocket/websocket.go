@@ -0,0 +1,348 @@
+// Package websocket is a minimal WebSocket client, as described in RFC 6455.
+// It only covers what modules need: messages are read whole, pings are
+// answered and extensions are not negotiated.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Opcodes of frames.
+const (
+	continuation byte = 0x0
+	text         byte = 0x1
+	binaryFrame  byte = 0x2
+	closeFrame   byte = 0x8
+	ping         byte = 0x9
+	pong         byte = 0xa
+)
+
+// MaxMessage is the size of the largest message read.
+const MaxMessage = 1 << 20
+
+// How long the handshake or a single write may take.
+const timeout = 10 * time.Second
+
+// Appended to the key of the client to compute the accept header.
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrHandshake is returned when the server doesn't switch to WebSocket.
+var ErrHandshake = errors.New("bad handshake")
+
+// ErrProtocol is returned when the server sends frames out of order.
+var ErrProtocol = errors.New("protocol error")
+
+// ErrTooLarge is returned when a message is longer than MaxMessage.
+var ErrTooLarge = errors.New("message too large")
+
+// ErrClosed is returned once the server closed the connection.
+var ErrClosed = errors.New("connection closed")
+
+// Conn is a connection to a server. Read belongs to a single goroutine, the
+// other methods may be called from several.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+}
+
+// Dial connects to a ws:// or wss:// address with the given additional
+// headers, which may be nil.
+func Dial(ctx context.Context, address string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port := "80"
+	switch u.Scheme {
+	case "ws":
+	case "wss":
+		port = "443"
+	default:
+		return nil, fmt.Errorf("unknown scheme: %s", u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "wss" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+	}
+
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.handshake(ctx, u, header); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Ask the server to switch to WebSocket.
+func (c *Conn) handshake(ctx context.Context, u *url.URL, header http.Header) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(c.conn); err != nil {
+		return err
+	}
+
+	res, err := http.ReadResponse(c.r, req)
+	if err != nil {
+		return err
+	}
+
+	sum := sha1.Sum([]byte(key + guid)) //nolint:gosec
+	switch {
+	case res.StatusCode != http.StatusSwitchingProtocols:
+		return fmt.Errorf("%w: %s", ErrHandshake, res.Status)
+	case res.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]):
+		return fmt.Errorf("%w: invalid accept header", ErrHandshake)
+	}
+
+	return c.conn.SetDeadline(time.Time{})
+}
+
+// Endpoint is a server streaming messages. Send, when not empty, is written
+// once connected, such as a request to subscribe to some feed.
+type Endpoint struct {
+	URL    string
+	Header http.Header
+	Send   []byte
+}
+
+// Subscribe connects to the endpoint and calls received with each message,
+// until the context is done or the connection fails.
+func (e Endpoint) Subscribe(ctx context.Context, received func([]byte)) error {
+	c, err := Dial(ctx, e.URL, e.Header)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	if len(e.Send) > 0 {
+		if err := c.Write(e.Send); err != nil {
+			return err
+		}
+	}
+
+	for {
+		msg, err := c.Read()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		received(msg)
+	}
+}
+
+// Read waits for the next message, text or binary, and returns its payload.
+func (c *Conn) Read() ([]byte, error) {
+	var msg []byte
+	started := false
+
+	for {
+		fin, op, payload, err := c.frame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case ping:
+			if err := c.write(pong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case pong:
+			continue
+		case closeFrame:
+			_ = c.write(closeFrame, payload)
+			return nil, ErrClosed
+		case text, binaryFrame:
+			if started {
+				return nil, fmt.Errorf("%w: interleaved message", ErrProtocol)
+			}
+			started = true
+		case continuation:
+			if !started {
+				return nil, fmt.Errorf("%w: continuation without message", ErrProtocol)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode: %d", ErrProtocol, op)
+		}
+
+		if len(msg)+len(payload) > MaxMessage {
+			return nil, ErrTooLarge
+		}
+		msg = append(msg, payload...)
+
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// Read a frame and return whether it is the last of its message, its opcode
+// and its payload.
+func (c *Conn) frame() (bool, byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin, op := head[0]&0x80 != 0, head[0]&0x0f
+	masked, n := head[1]&0x80 != 0, uint64(head[1]&0x7f)
+
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext)
+	}
+
+	if n > MaxMessage {
+		return false, 0, nil, ErrTooLarge
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.r, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range mask {
+		for j := i; j < len(payload); j += 4 {
+			payload[j] ^= mask[i]
+		}
+	}
+
+	return fin, op, payload, nil
+}
+
+// Write sends a text message.
+func (c *Conn) Write(data []byte) error {
+	return c.write(text, data)
+}
+
+// Close ends the connection, telling the server first.
+func (c *Conn) Close() error {
+	_ = c.write(closeFrame, nil)
+	return c.conn.Close()
+}
+
+// Write a frame. Frames sent by clients are masked.
+func (c *Conn) write(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(n))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+
+	start := len(frame)
+	frame = append(frame, payload...)
+	for i := range payload {
+		frame[start+i] ^= mask[i%4]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write(frame)
+
+	return err
+}
@@ -0,0 +1,155 @@
+package websocket_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"openbar/websocket"
+	"strings"
+	"testing"
+)
+
+// A client connected to the fake server.
+type peer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Start a fake server accepting the handshake and return its address along
+// with the clients it accepted and the headers they sent.
+func serve(t *testing.T) (string, <-chan *peer, <-chan http.Header) {
+	peers, headers := make(chan *peer, 1), make(chan http.Header, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11")) //nolint:gosec
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+		w.WriteHeader(http.StatusSwitchingProtocols)
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		headers <- r.Header
+		peers <- &peer{t, conn, rw.Reader}
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), peers, headers
+}
+
+// Write an unmasked frame with a short payload.
+func (p *peer) write(fin bool, op byte, payload string) {
+	h := op
+	if fin {
+		h |= 0x80
+	}
+	if _, err := p.conn.Write(append([]byte{h, byte(len(payload))}, payload...)); err != nil {
+		p.t.Error(err)
+	}
+}
+
+// Read a masked frame with a short payload.
+func (p *peer) read() (byte, string) {
+	head := make([]byte, 6)
+	if _, err := io.ReadFull(p.r, head); err != nil {
+		p.t.Error(err)
+		return 0, ""
+	}
+	payload := make([]byte, head[1]&0x7f)
+	if _, err := io.ReadFull(p.r, payload); err != nil {
+		p.t.Error(err)
+	}
+	for i := range payload {
+		payload[i] ^= head[2+i%4]
+	}
+	return head[0] & 0x0f, string(payload)
+}
+
+func TestConn(t *testing.T) {
+	addr, peers, headers := serve(t)
+
+	c, err := websocket.Dial(context.Background(), addr, http.Header{"Authorization": {"Bearer token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := <-peers
+	if h := <-headers; h.Get("Authorization") != "Bearer token" {
+		t.Errorf("want: %q, got: %q", "Bearer token", h.Get("Authorization"))
+	}
+
+	if err := c.Write([]byte(`{"subscribe":"ticker"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if op, payload := p.read(); op != 1 || payload != `{"subscribe":"ticker"}` {
+		t.Errorf("want: text subscription, got: %d %q", op, payload)
+	}
+
+	// A message in two fragments with a ping in between, which is answered.
+	p.write(false, 1, `{"price":`)
+	p.write(true, 9, "hello")
+	p.write(true, 0, `42}`)
+
+	msg, err := c.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != `{"price":42}` {
+		t.Errorf("want: %q, got: %q", `{"price":42}`, msg)
+	}
+	if op, payload := p.read(); op != 10 || payload != "hello" {
+		t.Errorf("want: pong hello, got: %d %q", op, payload)
+	}
+
+	p.write(true, 8, "")
+	if _, err := c.Read(); !errors.Is(err, websocket.ErrClosed) {
+		t.Errorf("want: %v, got: %v", websocket.ErrClosed, err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !errors.Is(err, websocket.ErrHandshake) {
+		t.Errorf("want: %v, got: %v", websocket.ErrHandshake, err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, peers, _ := serve(t)
+
+	go func() {
+		p := <-peers
+		if _, payload := p.read(); payload != "hello" {
+			t.Errorf("want: %q, got: %q", "hello", payload)
+		}
+		p.write(true, 1, "first")
+		p.write(true, 1, "second")
+	}()
+
+	var got []string
+	err := websocket.Endpoint{URL: addr, Send: []byte("hello")}.Subscribe(ctx, func(msg []byte) {
+		if got = append(got, string(msg)); len(got) == 2 {
+			cancel()
+		}
+	})
+	if err != nil || strings.Join(got, ",") != "first,second" {
+		t.Errorf("want: first,second, got: %v, %v", got, err)
+	}
+}
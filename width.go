@@ -0,0 +1,57 @@
+package openbar
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Alignments of the text of blocks narrower than their minimum width.
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+// Width is the minimum width of a block, either in pixels or as the width of a
+// text. Texts like "100%" keep blocks whose values change width, like CPU
+// usage, from making the bar jitter.
+type Width struct {
+	Pixels int
+	Text   string
+}
+
+// Pixels returns a minimum width in pixels.
+func Pixels(n int) *Width {
+	return &Width{Pixels: n}
+}
+
+// WidthOf returns the minimum width of a text.
+func WidthOf(text string) *Width {
+	return &Width{Text: text}
+}
+
+// MarshalJSON implements json.Marshaler for Width.
+func (w Width) MarshalJSON() ([]byte, error) {
+	if w.Text != "" {
+		return json.Marshal(w.Text)
+	}
+	return []byte(strconv.Itoa(w.Pixels)), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Width, which is a number of
+// pixels or a text.
+func (w *Width) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*w = Width{Text: text}
+		return nil
+	}
+
+	var pixels int
+	if err := json.Unmarshal(data, &pixels); err != nil || pixels < 0 {
+		return errors.New("min_width must be a positive number of pixels or a text")
+	}
+	*w = Width{Pixels: pixels}
+	return nil
+}
@@ -0,0 +1,176 @@
+package openbar
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrWindow is returned when parsing an invalid window.
+var ErrWindow = errors.New("invalid window")
+
+// Window is a period of the week during which a module is active. From and To
+// are times of the day, as offsets from midnight. A window ending before it
+// starts spans midnight and belongs to the day it starts. Without days, the
+// window applies every day.
+type Window struct {
+	Days []time.Weekday
+	From time.Duration
+	To   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWindow reads a window like "mon-fri 09:00-18:00". Either part can be
+// left out: "07:00-10:00" applies every day and "sat,sun" lasts all day.
+func ParseWindow(s string) (Window, error) {
+	w := Window{To: 24 * time.Hour}
+
+	for _, field := range strings.Fields(s) {
+		var err error
+		if strings.Contains(field, ":") {
+			w.From, w.To, err = parseHours(field)
+		} else {
+			w.Days, err = parseDays(field)
+		}
+		if err != nil {
+			return Window{}, fmt.Errorf("%w: %s: %v", ErrWindow, s, err)
+		}
+	}
+
+	if w.From == w.To {
+		return Window{}, fmt.Errorf("%w: %s: empty", ErrWindow, s)
+	}
+
+	return w, nil
+}
+
+// Read a range of times of the day like "09:00-18:00".
+func parseHours(s string) (from, to time.Duration, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("want HH:MM-HH:MM, got: %s", s)
+	}
+	if from, err = parseClock(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if to, err = parseClock(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+// Read a time of the day like "09:00", where "24:00" is the end of the day.
+func parseClock(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Read a list of days and ranges of days like "mon-wed,fri".
+func parseDays(s string) ([]time.Weekday, error) {
+	var res []time.Weekday
+
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid days: %s", part)
+		}
+
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown day: %s", bounds[0])
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return nil, fmt.Errorf("unknown day: %s", bounds[1])
+			}
+		}
+
+		// Ranges can wrap around the end of the week, like "fri-mon".
+		for d := first; ; d = (d + 1) % 7 {
+			res = append(res, d)
+			if d == last {
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Tell whether the window applies on the given day.
+func (w Window) on(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains tells whether the given time falls within the window.
+func (w Window) Contains(t time.Time) bool {
+	// Offsets are wall clock times, regardless of daylight saving changes.
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if w.From < w.To {
+		return w.on(t.Weekday()) && offset >= w.From && offset < w.To
+	}
+
+	yesterday := (t.Weekday() + 6) % 7
+
+	return (w.on(t.Weekday()) && offset >= w.From) || (w.on(yesterday) && offset < w.To)
+}
+
+// Tell whether the given time falls within any of the windows.
+func active(windows []Window, t time.Time) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the next time after t at which a window opens or closes. Days are
+// walked through calendar dates so that daylight saving changes are followed.
+func nextEdge(windows []Window, t time.Time) time.Time {
+	var next time.Time
+
+	for day := 0; day <= 8; day++ {
+		for _, w := range windows {
+			for _, offset := range []time.Duration{w.From, w.To} {
+				h, m := int(offset/time.Hour), int(offset%time.Hour/time.Minute)
+				edge := time.Date(t.Year(), t.Month(), t.Day()+day, h, m, 0, 0, t.Location())
+				if edge.After(t) && (next.IsZero() || edge.Before(next)) {
+					next = edge
+				}
+			}
+		}
+		if !next.IsZero() {
+			break
+		}
+	}
+
+	return next
+}